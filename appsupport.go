@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// appSupportPaths returns the per-app data and cache directories of name under
+// home on goos: ~/Library/Application Support and ~/Library/Caches on macOS,
+// ~/.local/share and ~/.cache on Linux
+func appSupportPaths(goos, home, name string) []string {
+	switch goos {
+	case "darwin":
+		return []string{
+			filepath.Join(home, "Library", "Application Support", name),
+			filepath.Join(home, "Library", "Caches", name),
+		}
+	case "linux":
+		return []string{
+			filepath.Join(home, ".local", "share", name),
+			filepath.Join(home, ".cache", name),
+		}
+	}
+	return nil
+}
+
+// validateBaseName checks a name given to --allow-app-support or
+// --allow-keychain-file, which must be a single path component
+func validateBaseName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, '/') {
+		return fmt.Errorf("invalid name %q: must be a single file or directory name", name)
+	}
+	return nil
+}
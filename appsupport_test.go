@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAppSupportPaths(t *testing.T) {
+	tests := []struct {
+		goos string
+		want []string
+	}{
+		{"darwin", []string{
+			"/Users/me/Library/Application Support/tool",
+			"/Users/me/Library/Caches/tool",
+		}},
+		{"linux", []string{
+			"/Users/me/.local/share/tool",
+			"/Users/me/.cache/tool",
+		}},
+		{"windows", nil},
+	}
+	for _, tt := range tests {
+		if got := appSupportPaths(tt.goos, "/Users/me", "tool"); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("appSupportPaths(%q) = %q, want %q", tt.goos, got, tt.want)
+		}
+	}
+}
+
+func TestValidateBaseName(t *testing.T) {
+	for _, name := range []string{"tool", "com.example.Tool", "My App"} {
+		if err := validateBaseName(name); err != nil {
+			t.Errorf("validateBaseName(%q) = %v, want nil", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "a/b", "../x"} {
+		if err := validateBaseName(name); err == nil {
+			t.Errorf("validateBaseName(%q) = nil, want error", name)
+		}
+	}
+}
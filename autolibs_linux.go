@@ -0,0 +1,193 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"debug/elf"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ldSoConf is the dynamic loader's list of library directories
+const ldSoConf = "/etc/ld.so.conf"
+
+// defaultLibraryDirs are searched after ld.so.conf, like the loader's built-in path
+var defaultLibraryDirs = []string{"/lib64", "/usr/lib64", "/lib", "/usr/lib"}
+
+// commandLibraryPaths returns the shared libraries the command is dynamically linked against
+// The command is resolved with LookPath and its ELF headers are read rather than
+// running ldd, which may execute code from the binary outside the sandbox
+// Symlinked libraries are returned together with their targets, since Landlock checks the final file
+func commandLibraryPaths(command string) ([]string, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, fmt.Errorf("command not found: %w", err)
+	}
+
+	var searchDirs []string
+	for _, dir := range filepath.SplitList(os.Getenv("LD_LIBRARY_PATH")) {
+		if filepath.IsAbs(dir) {
+			searchDirs = append(searchDirs, dir)
+		}
+	}
+	searchDirs = append(searchDirs, readLdSoConf(ldSoConf, 0)...)
+	searchDirs = append(searchDirs, defaultLibraryDirs...)
+
+	libs, err := elfLibraryPaths(path, searchDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, lib := range libs {
+		paths = append(paths, lib)
+		if resolved, err := filepath.EvalSymlinks(lib); err == nil && resolved != lib {
+			paths = append(paths, resolved)
+		}
+	}
+	return paths, nil
+}
+
+// elfLibraryPaths returns the program interpreter of the executable at path and
+// the libraries it needs, directly or through other libraries, found in its
+// rpath or runpath and then in searchDirs; libraries that are not found are skipped
+func elfLibraryPaths(path string, searchDirs []string) ([]string, error) {
+	exe, err := elf.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	defer exe.Close()
+
+	var paths []string
+	for _, prog := range exe.Progs {
+		if prog.Type != elf.PT_INTERP {
+			continue
+		}
+		interp := make([]byte, prog.Filesz)
+		if _, err := prog.ReadAt(interp, 0); err != nil {
+			return nil, fmt.Errorf("read interpreter of %s: %w", path, err)
+		}
+		paths = append(paths, strings.TrimRight(string(interp), "\x00"))
+	}
+
+	needed, err := exe.ImportedLibraries()
+	if err != nil {
+		return nil, fmt.Errorf("read dynamic section of %s: %w", path, err)
+	}
+	if len(paths) == 0 && len(needed) == 0 {
+		return nil, fmt.Errorf("%s is not a dynamically linked executable", path)
+	}
+
+	type pending struct {
+		name string
+		dirs []string // rpath or runpath of the object that needs it
+	}
+	queue := make([]pending, 0, len(needed))
+	for _, name := range needed {
+		queue = append(queue, pending{name, elfRunPaths(exe, path)})
+	}
+
+	seen := make(map[string]bool)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if seen[next.name] {
+			continue
+		}
+		seen[next.name] = true
+
+		lib, ok := findLibrary(next.name, slices.Concat(next.dirs, searchDirs), exe.Class, exe.Machine)
+		if !ok {
+			continue
+		}
+		paths = append(paths, lib)
+
+		f, err := elf.Open(lib)
+		if err != nil {
+			continue
+		}
+		libNeeded, _ := f.ImportedLibraries()
+		for _, name := range libNeeded {
+			queue = append(queue, pending{name, elfRunPaths(f, lib)})
+		}
+		f.Close()
+	}
+	return paths, nil
+}
+
+// findLibrary returns the first file named name in dirs that has the class and
+// machine of the executable, as the loader skips libraries of other architectures
+func findLibrary(name string, dirs []string, class elf.Class, machine elf.Machine) (string, bool) {
+	if strings.Contains(name, "/") {
+		return name, filepath.IsAbs(name)
+	}
+	for _, dir := range dirs {
+		candidate := filepath.Join(dir, name)
+		f, err := elf.Open(candidate)
+		if err != nil {
+			continue
+		}
+		matches := f.Class == class && f.Machine == machine
+		f.Close()
+		if matches {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// elfRunPaths returns the DT_RPATH and DT_RUNPATH directories of the object at
+// path, with $ORIGIN replaced by the object's directory
+func elfRunPaths(f *elf.File, path string) []string {
+	var dirs []string
+	for _, tag := range []elf.DynTag{elf.DT_RPATH, elf.DT_RUNPATH} {
+		values, _ := f.DynString(tag)
+		for _, value := range values {
+			for _, dir := range filepath.SplitList(value) {
+				dir = strings.NewReplacer("${ORIGIN}", filepath.Dir(path), "$ORIGIN", filepath.Dir(path)).Replace(dir)
+				if filepath.IsAbs(dir) {
+					dirs = append(dirs, dir)
+				}
+			}
+		}
+	}
+	return dirs
+}
+
+// readLdSoConf returns the directories listed in an ld.so.conf file, following
+// its include directives; a missing file lists nothing
+func readLdSoConf(path string, depth int) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if pattern, ok := strings.CutPrefix(line, "include "); ok && depth < 8 {
+			for _, field := range strings.Fields(pattern) {
+				if !filepath.IsAbs(field) {
+					field = filepath.Join(filepath.Dir(path), field)
+				}
+				matches, _ := filepath.Glob(field)
+				for _, match := range matches {
+					dirs = append(dirs, readLdSoConf(match, depth+1)...)
+				}
+			}
+			continue
+		}
+		if filepath.IsAbs(line) {
+			dirs = append(dirs, line)
+		}
+	}
+	return dirs
+}
@@ -0,0 +1,96 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestElfLibraryPaths(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	libs, err := elfLibraryPaths(sh, append(readLdSoConf(ldSoConf, 0), defaultLibraryDirs...))
+	if err != nil {
+		t.Skipf("sh is not dynamically linked: %v", err)
+	}
+
+	// Compare with the loader, which may run here as sh is trusted
+	out, err := exec.Command("ldd", sh).Output()
+	if err != nil {
+		t.Skipf("ldd not available: %v", err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 3 && fields[1] == "=>" && filepath.IsAbs(fields[2]) {
+			if !slices.Contains(libs, fields[2]) {
+				t.Errorf("elfLibraryPaths(%s) = %v, missing %s", sh, libs, fields[2])
+			}
+		}
+	}
+	if len(libs) == 0 || !strings.Contains(libs[0], "ld-") {
+		t.Errorf("expected the program interpreter first, got %v", libs)
+	}
+}
+
+func TestElfLibraryPathsStatic(t *testing.T) {
+	// Build a static binary so the test does not depend on the host
+	dir := t.TempDir()
+	src := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(src, []byte("package main\nfunc main() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "static")
+	cmd := exec.Command("go", "build", "-o", bin, src)
+	cmd.Env = append(os.Environ(), "CGO_ENABLED=0", "GOFLAGS=")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("go build failed: %v\n%s", err, out)
+	}
+	if _, err := elfLibraryPaths(bin, nil); err == nil || !strings.Contains(err.Error(), "not a dynamically linked executable") {
+		t.Errorf("expected a static executable error, got %v", err)
+	}
+}
+
+func TestElfLibraryPathsRejectsNonELF(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "script")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := elfLibraryPaths(script, nil); err == nil {
+		t.Error("expected an error for a non-ELF file")
+	}
+}
+
+func TestReadLdSoConf(t *testing.T) {
+	dir := t.TempDir()
+	confDir := filepath.Join(dir, "ld.so.conf.d")
+	if err := os.Mkdir(confDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		filepath.Join(dir, "ld.so.conf"):           "# comment\n/usr/local/lib\ninclude ld.so.conf.d/*.conf\n\nrelative/ignored\n",
+		filepath.Join(confDir, "a-multiarch.conf"): "/lib/x86_64-linux-gnu # trailing comment\n/usr/lib/x86_64-linux-gnu\n",
+		filepath.Join(confDir, "b-self.conf"):      "include " + filepath.Join(dir, "ld.so.conf") + "\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := readLdSoConf(filepath.Join(dir, "ld.so.conf"), 0)
+	want := []string{"/usr/local/lib", "/lib/x86_64-linux-gnu", "/usr/lib/x86_64-linux-gnu"}
+	if !reflect.DeepEqual(got[:3], want) {
+		t.Errorf("readLdSoConf() = %v, want prefix %v", got, want)
+	}
+	if readLdSoConf(filepath.Join(dir, "missing.conf"), 0) != nil {
+		t.Error("expected no directories for a missing file")
+	}
+}
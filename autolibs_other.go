@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// commandLibraryPaths is only implemented on Linux, where strict mode needs explicit library access
+func commandLibraryPaths(command string) ([]string, error) {
+	return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// expandBraces expands shell-style brace patterns: "/work/{src,build}" becomes
+// "/work/src" and "/work/build"; groups may be nested and repeated
+// A group without a comma (e.g. "{x}") is kept literally, as in the shell, and
+// ${VAR} references are left for environment expansion
+// Unbalanced braces are an error
+func expandBraces(pattern string) ([]string, error) {
+	open := -1
+	for i := 0; i < len(pattern) && open == -1; i++ {
+		switch pattern[i] {
+		case '$':
+			skip, err := skipVarReference(pattern, i)
+			if err != nil {
+				return nil, err
+			}
+			i = skip
+		case '}':
+			return nil, fmt.Errorf("unmatched '}' in %q", pattern)
+		case '{':
+			open = i
+		}
+	}
+	if open == -1 {
+		return []string{pattern}, nil
+	}
+
+	// Find the matching close brace and the commas at this nesting level
+	depth, end := 0, -1
+	var commas []int
+scan:
+	for i := open; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '$':
+			skip, err := skipVarReference(pattern, i)
+			if err != nil {
+				return nil, err
+			}
+			i = skip
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				end = i
+				break scan
+			}
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		}
+	}
+	if end == -1 {
+		return nil, fmt.Errorf("unmatched '{' in %q", pattern)
+	}
+
+	prefix, suffix := pattern[:open], pattern[end+1:]
+
+	var alternatives []string
+	if len(commas) == 0 {
+		inner, err := expandBraces(pattern[open+1 : end])
+		if err != nil {
+			return nil, err
+		}
+		for _, alt := range inner {
+			alternatives = append(alternatives, "{"+alt+"}")
+		}
+	} else {
+		start := open + 1
+		for _, comma := range append(commas, end) {
+			expanded, err := expandBraces(pattern[start:comma])
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, expanded...)
+			start = comma + 1
+		}
+	}
+
+	suffixes, err := expandBraces(suffix)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]string, 0, len(alternatives)*len(suffixes))
+	for _, alt := range alternatives {
+		for _, suf := range suffixes {
+			results = append(results, prefix+alt+suf)
+		}
+	}
+	return results, nil
+}
+
+// skipVarReference returns the index of the '}' closing a ${VAR} reference at i,
+// or i itself when the '$' does not start one
+func skipVarReference(pattern string, i int) (int, error) {
+	if i+1 >= len(pattern) || pattern[i+1] != '{' {
+		return i, nil
+	}
+	end := strings.IndexByte(pattern[i:], '}')
+	if end == -1 {
+		return 0, fmt.Errorf("unterminated ${ in %q", pattern)
+	}
+	return i + end, nil
+}
+
+// expandBraceList applies expandBraces to each path, keeping their order
+func expandBraceList(paths []string) ([]string, error) {
+	var result []string
+	for _, path := range paths {
+		expanded, err := expandBraces(path)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expanded...)
+	}
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    []string
+		wantErr bool
+	}{
+		{"no braces", "/work/src", []string{"/work/src"}, false},
+		{"single group", "/work/{src,build,dist}", []string{"/work/src", "/work/build", "/work/dist"}, false},
+		{"multiple groups", "/{a,b}/{x,y}", []string{"/a/x", "/a/y", "/b/x", "/b/y"}, false},
+		{"nested groups", "/work/{src,lib/{a,b}}", []string{"/work/src", "/work/lib/a", "/work/lib/b"}, false},
+		{"group in the middle", "$HOME/.{npm,cargo}/cache", []string{"$HOME/.npm/cache", "$HOME/.cargo/cache"}, false},
+		{"empty alternative", "/work/build{,-debug}", []string{"/work/build", "/work/build-debug"}, false},
+		{"group without comma is literal", "/work/{x}", []string{"/work/{x}"}, false},
+		{"variable references are kept", "${HOME}/{a,b}", []string{"${HOME}/a", "${HOME}/b"}, false},
+		{"variable reference inside group", "/{${TMPDIR},/var/tmp}/x", []string{"/${TMPDIR}/x", "//var/tmp/x"}, false},
+		{"unterminated variable reference", "/x/${HOME", nil, true},
+		{"unmatched open brace", "/work/{src,build", nil, true},
+		{"unmatched close brace", "/work/src}", nil, true},
+		{"close before open", "/work/}{a,b}", nil, true},
+		{"unmatched inside group", "/work/{a,{b}", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandBraces(tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandBraces(%q) error = %v, wantErr %v", tt.pattern, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandBraces(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FileAccess is a file access observed while tracing a command
+// Call is the traced syscall; Truncate is set when it truncates the file, and
+// Errno is the error the call failed with (empty if it succeeded or is unfinished)
+type FileAccess struct {
+	Path     string
+	Write    bool
+	Call     string
+	Truncate bool
+	Errno    string
+}
+
+// tracedSyscall describes where a traced syscall takes its paths
+// Each entry of paths is {dirfd argument, path argument}; dirfd is -1 when the
+// path is relative to the working directory. flags is the open flags argument
+// (-1 if none); without one, the access is a write exactly when write is set
+type tracedSyscall struct {
+	paths [][2]int
+	flags int
+	write bool
+}
+
+// tracedSyscalls are the file syscalls Landlock restricts; others in strace's
+// %file class (stat, access, chmod, ...) are not checked by the sandbox
+var tracedSyscalls = map[string]tracedSyscall{
+	"open":      {paths: [][2]int{{-1, 0}}, flags: 1},
+	"openat":    {paths: [][2]int{{0, 1}}, flags: 2},
+	"openat2":   {paths: [][2]int{{0, 1}}, flags: 2},
+	"creat":     {paths: [][2]int{{-1, 0}}, flags: -1, write: true},
+	"execve":    {paths: [][2]int{{-1, 0}}, flags: -1},
+	"execveat":  {paths: [][2]int{{0, 1}}, flags: -1},
+	"truncate":  {paths: [][2]int{{-1, 0}}, flags: -1, write: true},
+	"mkdir":     {paths: [][2]int{{-1, 0}}, flags: -1, write: true},
+	"mkdirat":   {paths: [][2]int{{0, 1}}, flags: -1, write: true},
+	"mknod":     {paths: [][2]int{{-1, 0}}, flags: -1, write: true},
+	"mknodat":   {paths: [][2]int{{0, 1}}, flags: -1, write: true},
+	"rmdir":     {paths: [][2]int{{-1, 0}}, flags: -1, write: true},
+	"unlink":    {paths: [][2]int{{-1, 0}}, flags: -1, write: true},
+	"unlinkat":  {paths: [][2]int{{0, 1}}, flags: -1, write: true},
+	"rename":    {paths: [][2]int{{-1, 0}, {-1, 1}}, flags: -1, write: true},
+	"renameat":  {paths: [][2]int{{0, 1}, {2, 3}}, flags: -1, write: true},
+	"renameat2": {paths: [][2]int{{0, 1}, {2, 3}}, flags: -1, write: true},
+	"link":      {paths: [][2]int{{-1, 0}, {-1, 1}}, flags: -1, write: true},
+	"linkat":    {paths: [][2]int{{0, 1}, {2, 3}}, flags: -1, write: true},
+	"symlink":   {paths: [][2]int{{-1, 1}}, flags: -1, write: true},
+	"symlinkat": {paths: [][2]int{{1, 2}}, flags: -1, write: true},
+}
+
+// openWriteFlags are the open flags that need write access
+var openWriteFlags = []string{"O_WRONLY", "O_RDWR", "O_CREAT", "O_TRUNC"}
+
+// parseStraceLine extracts the file accesses from one line of `strace -f -y` output
+// Relative paths are resolved against the dirfd strace annotates, or cwd.
+// Calls that failed with ENOENT are skipped: the sandbox would not change their outcome.
+func parseStraceLine(line, cwd string) []FileAccess {
+	_, line = splitStracePid(line)
+
+	open := strings.IndexByte(line, '(')
+	if open == -1 {
+		return nil
+	}
+	name := line[:open]
+	call, ok := tracedSyscalls[name]
+	if !ok {
+		return nil
+	}
+	args, rest := splitSyscallArgs(line[open+1:])
+	errno := ""
+	if _, result, ok := strings.Cut(rest, "= "); ok {
+		if fields := strings.Fields(result); len(fields) > 1 && fields[0] == "-1" {
+			errno = fields[1]
+		}
+	}
+	if errno == "ENOENT" {
+		return nil
+	}
+
+	write := call.write
+	truncate := name == "creat" || name == "truncate"
+	if call.flags >= 0 && call.flags < len(args) {
+		for _, flag := range openWriteFlags {
+			if strings.Contains(args[call.flags], flag) {
+				write = true
+			}
+		}
+		truncate = strings.Contains(args[call.flags], "O_TRUNC")
+	}
+
+	var accesses []FileAccess
+	for _, pair := range call.paths {
+		if pair[1] >= len(args) {
+			continue
+		}
+		path, err := strconv.Unquote(args[pair[1]])
+		if err != nil || path == "" {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			base := cwd
+			if pair[0] >= 0 && pair[0] < len(args) {
+				if dir, ok := fdPath(args[pair[0]]); ok {
+					base = dir
+				}
+			}
+			path = filepath.Join(base, path)
+		}
+		accesses = append(accesses, FileAccess{
+			Path:     filepath.Clean(path),
+			Write:    write,
+			Call:     name,
+			Truncate: truncate,
+			Errno:    errno,
+		})
+	}
+	return accesses
+}
+
+// splitStracePid splits the pid strace -f prefixes to each line once there is a
+// child from the rest of the line; pid is empty if the line has none
+func splitStracePid(line string) (pid, rest string) {
+	if fields := strings.SplitN(line, " ", 2); len(fields) == 2 {
+		if _, err := strconv.Atoi(fields[0]); err == nil {
+			return fields[0], strings.TrimLeft(fields[1], " ")
+		}
+	}
+	return "", line
+}
+
+// splitSyscallArgs splits the arguments of a traced call at top-level commas
+// It returns the arguments and the text after the closing parenthesis
+// (the result); an unfinished call yields the arguments seen so far
+func splitSyscallArgs(s string) ([]string, string) {
+	var args []string
+	depth, start := 0, 0
+	inQuote := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inQuote {
+			switch c {
+			case '\\':
+				i++
+			case '"':
+				inQuote = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inQuote = true
+		case '(', '[', '{', '<':
+			depth++
+		case ']', '}', '>':
+			depth--
+		case ')':
+			if depth == 0 {
+				return append(args, strings.TrimSpace(s[start:i])), s[i+1:]
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	// Unfinished call: drop the trailing "<unfinished ...>" marker
+	last := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s[start:]), "<unfinished ...>"))
+	if last != "" {
+		args = append(args, last)
+	}
+	return args, ""
+}
+
+// fdPath returns the path strace -y prints after a descriptor, as in 3</home/user>
+func fdPath(arg string) (string, bool) {
+	open := strings.IndexByte(arg, '<')
+	if open == -1 || !strings.HasSuffix(arg, ">") {
+		return "", false
+	}
+	return arg[open+1 : len(arg)-1], true
+}
+
+// printCompareReport prints the traced accesses the sandbox would deny, grouped
+// by write and read, each path once
+func printCompareReport(w io.Writer, denied []FileAccess) {
+	if len(denied) == 0 {
+		fmt.Fprintln(w, "No traced accesses would be denied by the sandbox")
+		return
+	}
+
+	writes := make(map[string]bool)
+	reads := make(map[string]bool)
+	for _, access := range denied {
+		if access.Write {
+			writes[access.Path] = true
+		} else {
+			reads[access.Path] = true
+		}
+	}
+	fmt.Fprintf(w, "%d paths would be denied by the sandbox:\n", len(writes)+len(reads))
+	for _, group := range []struct {
+		title string
+		paths map[string]bool
+	}{{"Write", writes}, {"Read", reads}} {
+		if len(group.paths) == 0 {
+			continue
+		}
+		paths := make([]string, 0, len(group.paths))
+		for path := range group.paths {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		fmt.Fprintf(w, "\n%s (%d):\n", group.title, len(paths))
+		for _, path := range paths {
+			fmt.Fprintf(w, "  - %s\n", path)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/landlock-lsm/go-landlock/landlock"
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+)
+
+// compareRun runs the command unsandboxed under strace and reports the file
+// accesses the Landlock sandbox built from config would have denied
+func compareRun(config *SandboxConfig) error {
+	if config.ProfileFile != "" {
+		return errProfileFileUnsupported
+	}
+	stracePath, err := exec.LookPath("strace")
+	if err != nil {
+		return fmt.Errorf("--compare-run needs strace: %w", err)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("get working directory: %w", err)
+	}
+
+	// The command runs unsandboxed, so the rules are only previewed: output files
+	// are not created, and the warnings are left to the sandboxed run
+	var grants []landlockGrant
+	if !config.AllowAll {
+		grants = landlockGrants(config, true)
+	}
+
+	traceFile, err := os.CreateTemp("", "cage-trace-*.txt")
+	if err != nil {
+		return fmt.Errorf("create trace file: %w", err)
+	}
+	traceFile.Close()
+	defer os.Remove(traceFile.Name())
+
+	argv := append([]string{
+		"-f", "-qq", "-y", "-s", "4096",
+		"-e", "trace=%file", "-e", "signal=none",
+		"-o", traceFile.Name(), "--", config.Command,
+	}, config.Args...)
+	cmd := exec.Command(stracePath, argv...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = commandEnv(os.Environ(), config.Env)
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("trace command: %w", err)
+		}
+		logger.Infof("traced command exited with status %d", exitErr.ExitCode())
+	}
+
+	file, err := os.Open(traceFile.Name())
+	if err != nil {
+		return fmt.Errorf("read trace: %w", err)
+	}
+	defer file.Close()
+
+	var denied []FileAccess
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		for _, access := range parseStraceLine(scanner.Text(), cwd) {
+			if !config.AllowAll && !landlockPermits(grants, access) {
+				denied = append(denied, access)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read trace: %w", err)
+	}
+
+	printCompareReport(os.Stderr, denied)
+	return nil
+}
+
+// landlockPermits reports whether the Landlock rules in grants allow the traced
+// access. The rights of every rule that covers a path add up, as in Landlock
+func landlockPermits(grants []landlockGrant, access FileAccess) bool {
+	rights, onParent := requiredRights(access)
+	path := access.Path
+	if onParent {
+		path = filepath.Dir(path)
+	}
+
+	// Rules are tied to real locations, so compare against the resolved path
+	path = resolveRulePath(path)
+	var granted landlock.AccessFSSet
+	for _, grant := range grants {
+		if grant.covers(path) {
+			granted |= grant.access
+		}
+	}
+	return granted&rights == rights
+}
+
+// requiredRights returns the Landlock rights a traced access needs and whether
+// Landlock checks them on the parent directory, as for creating and removing entries
+// Rename and link need to make an entry in both directories they touch
+func requiredRights(access FileAccess) (landlock.AccessFSSet, bool) {
+	switch access.Call {
+	case "execve", "execveat":
+		return ll.AccessFSExecute, false
+	case "truncate":
+		return ll.AccessFSTruncate, false
+	case "mkdir", "mkdirat":
+		return ll.AccessFSMakeDir, true
+	case "mknod", "mknodat":
+		return ll.AccessFSMakeFifo, true
+	case "symlink", "symlinkat":
+		return ll.AccessFSMakeSym, true
+	case "rmdir":
+		return ll.AccessFSRemoveDir, true
+	case "unlink", "unlinkat":
+		return ll.AccessFSRemoveFile, true
+	case "rename", "renameat", "renameat2":
+		return ll.AccessFSRemoveFile | ll.AccessFSMakeReg, true
+	case "link", "linkat":
+		return ll.AccessFSMakeReg, true
+	}
+
+	if !access.Write {
+		if info, err := os.Stat(access.Path); err == nil && info.IsDir() {
+			return ll.AccessFSReadDir, false
+		}
+		return ll.AccessFSReadFile, false
+	}
+	if access.Truncate {
+		return ll.AccessFSWriteFile | ll.AccessFSTruncate, false
+	}
+	return ll.AccessFSWriteFile, false
+}
@@ -0,0 +1,99 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLandlockPermits(t *testing.T) {
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	logs := filepath.Join(dir, "logs")
+	usr := filepath.Join(dir, "usr")
+	for _, path := range []string{filepath.Join(work, "secrets", "cache"), logs, usr, filepath.Join(dir, "srv")} {
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tty := filepath.Join(dir, "tty")
+	socket := filepath.Join(dir, "agent.sock")
+	for _, path := range []string{tty, socket, filepath.Join(dir, "other.log")} {
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: work, Mode: AccessWrite, Action: ActionAllow},
+			{Path: filepath.Join(work, "secrets"), Mode: AccessReadWrite, Action: ActionDeny},
+			{Path: filepath.Join(work, "secrets", "cache"), Mode: AccessWrite, Action: ActionAllow},
+			{Path: filepath.Join(dir, "out.log"), Mode: AccessWrite, Action: ActionAllow, IsFile: true},
+			{Path: filepath.Join(dir, "srv"), Mode: AccessWrite, Action: ActionAllow},
+			{Path: filepath.Join(dir, "srv"), Mode: AccessReadWrite, Action: ActionDeny},
+			{Path: logs, Mode: AccessWrite, Action: ActionAllow, Append: true},
+		},
+		ReadRules: []ResolvedRule{
+			{Path: usr, Mode: AccessRead, Action: ActionAllow},
+		},
+		TTYDevices:     []string{tty},
+		ConnectSockets: []string{socket},
+	}
+
+	tests := []struct {
+		access FileAccess
+		strict bool
+		want   bool
+	}{
+		{FileAccess{Path: filepath.Join(work, "main.go"), Write: true, Call: "openat"}, false, true},
+		{FileAccess{Path: filepath.Join(work, "secrets", "cache", "x"), Write: true, Call: "openat"}, false, true},
+		{FileAccess{Path: filepath.Join(dir, "out.log"), Write: true, Call: "openat"}, false, true},
+		{FileAccess{Path: filepath.Join(dir, "other.log"), Write: true, Call: "openat"}, false, false},
+		{FileAccess{Path: filepath.Join(dir, "srv", "data"), Write: true, Call: "openat"}, false, false},
+		{FileAccess{Path: "/dev/null", Write: true, Call: "openat"}, true, true},
+		{FileAccess{Path: tty, Write: true, Call: "openat"}, true, true},
+		{FileAccess{Path: socket, Call: "openat"}, true, true},
+		{FileAccess{Path: socket, Write: true, Call: "openat"}, true, false},
+		{FileAccess{Path: "/etc/passwd", Call: "openat"}, false, true},
+		{FileAccess{Path: "/etc/passwd", Call: "openat"}, true, false},
+		{FileAccess{Path: filepath.Join(usr, "go"), Call: "execve"}, true, true},
+		{FileAccess{Path: filepath.Join(work, "go.mod"), Call: "openat"}, true, true},
+		{FileAccess{Path: filepath.Join(work, "build"), Write: true, Call: "mkdir"}, false, true},
+
+		// --allow-append: files can be created and written, but not truncated or removed
+		{FileAccess{Path: filepath.Join(logs, "app.log"), Write: true, Call: "openat"}, false, true},
+		{FileAccess{Path: filepath.Join(logs, "app.log"), Write: true, Call: "openat", Truncate: true}, false, false},
+		{FileAccess{Path: filepath.Join(logs, "app.log"), Write: true, Call: "unlink"}, false, false},
+		{FileAccess{Path: filepath.Join(logs, "old"), Write: true, Call: "mkdir"}, false, false},
+	}
+
+	var stderr strings.Builder
+	saved := logger
+	logger = &Logger{stderr: &stderr, level: LogInfo}
+	defer func() { logger = saved }()
+
+	for _, strict := range []bool{false, true} {
+		config.Strict = strict
+		grants := landlockGrants(config, true)
+		for _, tt := range tests {
+			if tt.strict != strict {
+				continue
+			}
+			if got := landlockPermits(grants, tt.access); got != tt.want {
+				t.Errorf("landlockPermits(%+v, strict=%v) = %v, want %v", tt.access, tt.strict, got, tt.want)
+			}
+		}
+	}
+
+	// The preview leaves the missing output file alone and reports nothing
+	if _, err := os.Stat(filepath.Join(dir, "out.log")); !os.IsNotExist(err) {
+		t.Errorf("landlockGrants(preview) created the output file: %v", err)
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("landlockGrants(preview) logged %q", stderr.String())
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// compareRun needs strace to trace the command, which is only available on Linux
+func compareRun(config *SandboxConfig) error {
+	return fmt.Errorf("--compare-run is not supported on %s (it traces the command with strace, Linux only)", runtime.GOOS)
+}
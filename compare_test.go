@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStraceLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []FileAccess
+	}{
+		{
+			name: "read-only open",
+			line: `4242  openat(AT_FDCWD</work>, "/etc/ld.so.cache", O_RDONLY|O_CLOEXEC) = 3</etc/ld.so.cache>`,
+			want: []FileAccess{{Path: "/etc/ld.so.cache", Call: "openat"}},
+		},
+		{
+			name: "create relative to cwd",
+			line: `openat(AT_FDCWD, "out/build.log", O_WRONLY|O_CREAT|O_TRUNC, 0666) = 3`,
+			want: []FileAccess{{Path: "/work/out/build.log", Write: true, Call: "openat", Truncate: true}},
+		},
+		{
+			name: "relative to an annotated dirfd",
+			line: `4242 unlinkat(5</home/user/.cache>, "tmp-123", 0) = 0`,
+			want: []FileAccess{{Path: "/home/user/.cache/tmp-123", Write: true, Call: "unlinkat"}},
+		},
+		{
+			name: "rename touches both paths",
+			line: `renameat2(AT_FDCWD, "/tmp/a", AT_FDCWD, "/home/user/b", RENAME_NOREPLACE) = 0`,
+			want: []FileAccess{{Path: "/tmp/a", Write: true, Call: "renameat2"}, {Path: "/home/user/b", Write: true, Call: "renameat2"}},
+		},
+		{
+			name: "symlink target is not accessed",
+			line: `symlink("/etc/passwd", "/work/link") = 0`,
+			want: []FileAccess{{Path: "/work/link", Write: true, Call: "symlink"}},
+		},
+		{
+			name: "unfinished call",
+			line: `4243 openat(AT_FDCWD, "/var/lib/data", O_RDWR <unfinished ...>`,
+			want: []FileAccess{{Path: "/var/lib/data", Write: true, Call: "openat"}},
+		},
+		{
+			name: "escaped path",
+			line: `execve("/opt/my \"tool\"", ["tool"], 0x7ffc /* 20 vars */) = 0`,
+			want: []FileAccess{{Path: `/opt/my "tool"`, Call: "execve"}},
+		},
+		{
+			name: "denied call",
+			line: `4242 openat(AT_FDCWD, "/root/.ssh/id_ed25519", O_RDONLY) = -1 EACCES (Permission denied)`,
+			want: []FileAccess{{Path: "/root/.ssh/id_ed25519", Call: "openat", Errno: "EACCES"}},
+		},
+		{name: "missing file", line: `openat(AT_FDCWD, "/nope", O_RDONLY) = -1 ENOENT (No such file or directory)`},
+		{name: "unchecked syscall", line: `newfstatat(AT_FDCWD, "/etc", {st_mode=S_IFDIR|0755, ...}, 0) = 0`},
+		{name: "resumed call", line: `4243 <... openat resumed>) = 4`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseStraceLine(tt.line, "/work")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseStraceLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintCompareReport(t *testing.T) {
+	var buf bytes.Buffer
+	printCompareReport(&buf, []FileAccess{
+		{Path: "/home/user/.npmrc"},
+		{Path: "/home/user/.cache/x", Write: true},
+		{Path: "/home/user/.npmrc"},
+	})
+	out := buf.String()
+	for _, want := range []string{
+		"2 paths would be denied",
+		"Write (1):\n  - /home/user/.cache/x",
+		"Read (1):\n  - /home/user/.npmrc",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "Write") > strings.Index(out, "Read") {
+		t.Errorf("write accesses should be listed before reads:\n%s", out)
+	}
+
+	buf.Reset()
+	printCompareReport(&buf, nil)
+	if !strings.Contains(buf.String(), "No traced accesses would be denied") {
+		t.Errorf("unexpected report for no denials: %s", buf.String())
+	}
+}
@@ -8,7 +8,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/goccy/go-yaml"
 )
@@ -18,6 +21,11 @@ var builtinPresetsYAML []byte
 
 var BuiltinPresets map[string]Preset
 
+// defaultConfigYAML is the config used when the user has no config file
+//
+//go:embed default_config.yaml
+var defaultConfigYAML []byte
+
 func init() {
 	var config struct {
 		Presets map[string]Preset `yaml:"presets"`
@@ -32,27 +40,68 @@ type Config struct {
 	Defaults    Defaults          `yaml:"defaults"`
 	Presets     map[string]Preset `yaml:"presets"`
 	AutoPresets []AutoPresetRule  `yaml:"auto-presets"`
+
+	// embedded is set for the default config, whose presets a preset directory may replace
+	embedded bool
 }
 
 type Defaults struct {
-	Presets []string `yaml:"presets"`
+	Presets       []string `yaml:"presets"`
+	OutputFormat  string   `yaml:"output-format,omitempty"`
+	MaxRules      int      `yaml:"max-rules,omitempty"`
+	MaxPathLength int      `yaml:"max-path-length,omitempty"`
+	SkipScope     string   `yaml:"skip-defaults-scope,omitempty"` // global (default) or explicit
+}
+
+// outputFormats are the values accepted by -o
+var outputFormats = []string{"text", "yaml", "raw", "json"}
+
+// validateOutputFormat checks that format is one of the accepted -o values
+func validateOutputFormat(format string) error {
+	for _, f := range outputFormats {
+		if format == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid output format %q (expected one of: %s)", format, strings.Join(outputFormats, ", "))
 }
 
 type Preset struct {
-	Extends       []string    `yaml:"extends,omitempty"`
-	SkipDefaults  bool        `yaml:"skip-defaults,omitempty"`
-	Strict        bool        `yaml:"strict,omitempty"`
-	Allow         []AllowPath `yaml:"allow,omitempty"`
-	AllowKeychain bool        `yaml:"allow-keychain"`
-	AllowGit      bool        `yaml:"allow-git"`
-	Read          []AllowPath `yaml:"read,omitempty"`
-	Deny          []AllowPath `yaml:"deny,omitempty"`
+	Extends       []string          `yaml:"extends,omitempty"`
+	SoftExtends   []string          `yaml:"optional-extends,omitempty"` // applied after Extends; a missing one is skipped with a warning
+	SkipDefaults  bool              `yaml:"skip-defaults,omitempty"`
+	Strict        bool              `yaml:"strict,omitempty"`
+	Priority      int               `yaml:"priority,omitempty"` // higher wins conflicts between presets of the same origin
+	Allow         []AllowPath       `yaml:"allow,omitempty"`
+	AllowKeychain bool              `yaml:"allow-keychain"`
+	AllowGit      bool              `yaml:"allow-git"`
+	AllowDNS      bool              `yaml:"allow-dns,omitempty"`
+	AllowGo       bool              `yaml:"allow-go,omitempty"`
+	Read          []AllowPath       `yaml:"read,omitempty"`
+	Deny          []AllowPath       `yaml:"deny,omitempty"`
+	DenyWrite     []AllowPath       `yaml:"deny-write,omitempty"` // write denied, reads unaffected
+	Remove        *PresetRemove     `yaml:"remove,omitempty"`
+	Env           map[string]string `yaml:"env,omitempty"` // Variables set in the command's environment
+}
+
+// PresetRemove lists inherited rules a child preset drops from its extends chain
+// Paths match by exact cleaned path within the same section (and therefore the same access mode)
+type PresetRemove struct {
+	Allow []string `yaml:"allow,omitempty"`
+	Read  []string `yaml:"read,omitempty"`
+	Deny  []string `yaml:"deny,omitempty"`
 }
 
 type AllowPath struct {
 	Path         string   `yaml:"path"`
 	EvalSymLinks bool     `yaml:"eval-symlinks,omitempty"`
-	Except       []string `yaml:"except,omitempty"` // Paths to exclude (carve-outs)
+	Except       []string `yaml:"except,omitempty"`       // Paths to exclude (carve-outs)
+	Refer        *bool    `yaml:"refer,omitempty"`        // Allow moving files across the allowed directory (Linux, default true)
+	OS           string   `yaml:"os,omitempty"`           // Only apply on this platform (darwin or linux)
+	Until        string   `yaml:"until,omitempty"`        // RFC3339 time after which an allow or read path is left out
+	WhenCommand  string   `yaml:"when-command,omitempty"` // Only apply when the command's name matches this glob
+	Recursive    *bool    `yaml:"recursive,omitempty"`    // false denies only the directory's direct entries (deny and deny-write, macOS)
+	Origin       string   `yaml:"-"`                      // Preset that defined the path (set by ExplainPreset)
 }
 
 type AutoPresetRule struct {
@@ -79,6 +128,17 @@ func (p *AllowPath) UnmarshalYAML(b []byte) error {
 		if err := yaml.Unmarshal(b, &ap); err != nil {
 			return fmt.Errorf("unmarshal AllowPath map: %w", err)
 		}
+		if ap.OS != "" && ap.OS != "darwin" && ap.OS != "linux" {
+			return fmt.Errorf("unmarshal AllowPath: unsupported os %q (use darwin or linux)", ap.OS)
+		}
+		if ap.Until != "" {
+			if _, err := time.Parse(time.RFC3339, ap.Until); err != nil {
+				return fmt.Errorf("unmarshal AllowPath: until %q is not an RFC3339 time (e.g. 2026-12-31T18:00:00Z)", ap.Until)
+			}
+		}
+		if _, err := filepath.Match(ap.WhenCommand, ""); err != nil {
+			return fmt.Errorf("unmarshal AllowPath: when-command %q is not a valid glob", ap.WhenCommand)
+		}
 		*p = (AllowPath)(ap)
 		return nil
 	default:
@@ -99,6 +159,7 @@ func userConfigDir() (string, error) {
 
 func loadConfig(configPath string) (*Config, error) {
 	paths := []string{}
+	useDefault := false
 
 	if configPath != "" {
 		paths = append(paths, configPath)
@@ -107,6 +168,7 @@ func loadConfig(configPath string) (*Config, error) {
 		if err == nil {
 			paths = append(paths, filepath.Join(configDir, "cage", "presets.yaml"))
 			paths = append(paths, filepath.Join(configDir, "cage", "presets.yml"))
+			useDefault = true
 		}
 	}
 
@@ -120,9 +182,24 @@ func loadConfig(configPath string) (*Config, error) {
 		}
 	}
 
+	// Without a config file of their own, users get the embedded default;
+	// a missing --config file stays an empty config
+	if useDefault {
+		return defaultConfig()
+	}
 	return &Config{Presets: make(map[string]Preset)}, nil
 }
 
+// defaultConfig parses the embedded default config
+func defaultConfig() (*Config, error) {
+	var config Config
+	if err := yaml.Unmarshal(defaultConfigYAML, &config); err != nil {
+		return nil, fmt.Errorf("error loading default config: %w", err)
+	}
+	config.embedded = true
+	return &config, nil
+}
+
 func loadConfigFromFile(path string) (*Config, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -153,7 +230,36 @@ func (c *Config) GetPreset(name string) (Preset, bool) {
 	return preset, ok
 }
 
+// PresetTraceEvent is one step in the resolution of a preset's extends chain
+type PresetTraceEvent struct {
+	Depth   int      // nesting level in the extends chain (0 = the explained preset)
+	Preset  string   // preset being resolved
+	Kind    string   // "extends", "skip", "apply", "remove" or "override"
+	Parents []string // extended presets, in application order (extends only; skip names the missing one)
+	Section string   // allow, read or deny (remove/override only)
+	Path    string   // affected path (remove/override only)
+	From    string   // preset that originally contributed the path (remove/override only)
+	Counts  [3]int   // number of allow, read and deny rules contributed (apply only)
+}
+
+// ExplainPreset resolves a preset like ResolvePreset, additionally tagging every
+// path with the preset it came from and returning the ordered resolution trace
+func (c *Config) ExplainPreset(name string) (*Preset, []PresetTraceEvent, error) {
+	trace := []PresetTraceEvent{}
+	resolved, err := c.resolvePreset(name, nil, &trace, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolved, trace, nil
+}
+
 func (c *Config) ResolvePreset(name string, visited map[string]bool) (*Preset, error) {
+	return c.resolvePreset(name, visited, nil, 0)
+}
+
+// resolvePreset merges the extends chain of a preset; when trace is non-nil it also
+// records provenance for each path and the steps taken
+func (c *Config) resolvePreset(name string, visited map[string]bool, trace *[]PresetTraceEvent, depth int) (*Preset, error) {
 	if visited == nil {
 		visited = make(map[string]bool)
 	}
@@ -168,34 +274,154 @@ func (c *Config) ResolvePreset(name string, visited map[string]bool) (*Preset, e
 		return nil, fmt.Errorf("preset not found: %s", name)
 	}
 
-	if len(preset.Extends) == 0 {
+	record := func(event PresetTraceEvent) {
+		if trace != nil {
+			event.Depth = depth
+			event.Preset = name
+			*trace = append(*trace, event)
+		}
+	}
+	if trace != nil {
+		preset = withOrigin(preset, name)
+	}
+	applied := PresetTraceEvent{
+		Kind:   "apply",
+		Counts: [3]int{len(preset.Allow), len(preset.Read), len(preset.Deny)},
+	}
+
+	if len(preset.Extends) == 0 && len(preset.SoftExtends) == 0 {
+		record(applied)
 		return &preset, nil
 	}
 
+	// A missing optional base is left out before the chain is recorded
+	parents := preset.Extends
+	for _, parentName := range preset.SoftExtends {
+		if _, ok := c.GetPreset(parentName); !ok {
+			logger.Warnf("preset %s: optional base preset %s not found, skipping it", name, parentName)
+			record(PresetTraceEvent{Kind: "skip", Parents: []string{parentName}})
+			continue
+		}
+		parents = append(parents[:len(parents):len(parents)], parentName)
+	}
+	record(PresetTraceEvent{Kind: "extends", Parents: parents})
+
 	merged := &Preset{}
 
-	for _, parentName := range preset.Extends {
-		parent, err := c.ResolvePreset(parentName, visited)
+	for _, parentName := range parents {
+		if _, ok := c.GetPreset(parentName); !ok {
+			return nil, fmt.Errorf("preset %s extends %s, which does not exist (list it under optional-extends if it may be missing)", name, parentName)
+		}
+		parent, err := c.resolvePreset(parentName, visited, trace, depth+1)
 		if err != nil {
 			return nil, fmt.Errorf("resolving parent preset %s: %w", parentName, err)
 		}
 		mergePresets(merged, parent)
 	}
 
+	if preset.Remove != nil {
+		var removed []AllowPath
+		sections := []struct {
+			name     string
+			paths    *[]AllowPath
+			removals []string
+		}{
+			{"allow", &merged.Allow, preset.Remove.Allow},
+			{"read", &merged.Read, preset.Remove.Read},
+			{"deny", &merged.Deny, preset.Remove.Deny},
+		}
+		for _, section := range sections {
+			*section.paths, removed = removePaths(*section.paths, section.removals)
+			for _, path := range removed {
+				record(PresetTraceEvent{Kind: "remove", Section: section.name, Path: path.Path, From: path.Origin})
+			}
+		}
+	}
+
+	if trace != nil {
+		recordOverrides := func(section string, inherited, own []AllowPath) {
+			for _, path := range own {
+				for _, parentPath := range inherited {
+					if cleanPath(expandEnvOnly(parentPath.Path)) == cleanPath(expandEnvOnly(path.Path)) {
+						record(PresetTraceEvent{Kind: "override", Section: section, Path: path.Path, From: parentPath.Origin})
+						break
+					}
+				}
+			}
+		}
+		recordOverrides("allow", merged.Allow, preset.Allow)
+		recordOverrides("read", merged.Read, preset.Read)
+		recordOverrides("deny", merged.Deny, preset.Deny)
+	}
+
+	record(applied)
 	mergePresets(merged, &preset)
 
 	return merged, nil
 }
 
+// withOrigin returns a copy of the preset with every path tagged with the preset name
+func withOrigin(preset Preset, name string) Preset {
+	tag := func(paths []AllowPath) []AllowPath {
+		tagged := make([]AllowPath, len(paths))
+		for i, path := range paths {
+			path.Origin = name
+			tagged[i] = path
+		}
+		return tagged
+	}
+	preset.Allow = tag(preset.Allow)
+	preset.Read = tag(preset.Read)
+	preset.Deny = tag(preset.Deny)
+	preset.DenyWrite = tag(preset.DenyWrite)
+	return preset
+}
+
+// removePaths drops the paths matching any of the removals, compared after env expansion and cleaning
+// It returns the kept and the removed paths
+func removePaths(paths []AllowPath, removals []string) (kept, removed []AllowPath) {
+	if len(removals) == 0 {
+		return paths, nil
+	}
+
+	remove := make(map[string]bool, len(removals))
+	for _, path := range removals {
+		remove[cleanPath(expandEnvOnly(path))] = true
+	}
+
+	kept = make([]AllowPath, 0, len(paths))
+	for _, path := range paths {
+		if remove[cleanPath(expandEnvOnly(path.Path))] {
+			removed = append(removed, path)
+			continue
+		}
+		kept = append(kept, path)
+	}
+	return kept, removed
+}
+
 func mergePresets(dst, src *Preset) {
 	dst.Allow = append(dst.Allow, src.Allow...)
 	dst.Read = append(dst.Read, src.Read...)
 	dst.Deny = append(dst.Deny, src.Deny...)
+	dst.DenyWrite = append(dst.DenyWrite, src.DenyWrite...)
 
 	dst.Strict = dst.Strict || src.Strict
 	dst.SkipDefaults = dst.SkipDefaults || src.SkipDefaults
 	dst.AllowKeychain = dst.AllowKeychain || src.AllowKeychain
 	dst.AllowGit = dst.AllowGit || src.AllowGit
+	dst.AllowDNS = dst.AllowDNS || src.AllowDNS
+	dst.AllowGo = dst.AllowGo || src.AllowGo
+	if src.Priority != 0 {
+		dst.Priority = src.Priority
+	}
+
+	if len(src.Env) > 0 && dst.Env == nil {
+		dst.Env = make(map[string]string, len(src.Env))
+	}
+	for name, value := range src.Env {
+		dst.Env[name] = value
+	}
 }
 
 func (c *Config) ListPresets() []string {
@@ -209,6 +435,34 @@ func (c *Config) ListPresets() []string {
 	return presets
 }
 
+// allPresetsName is the --preset name that stands for every preset (ExpandPresetNames)
+const allPresetsName = "@all"
+
+// ExpandPresetNames replaces @all in names with every preset ListPresets returns,
+// sorted by name; a preset named more than once is kept at its first position
+func (c *Config) ExpandPresetNames(names []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	for _, name := range names {
+		if name != allPresetsName {
+			add(name)
+			continue
+		}
+		all := c.ListPresets()
+		sort.Strings(all)
+		for _, preset := range all {
+			add(preset)
+		}
+	}
+	return result
+}
+
 // GetAutoPresets returns the preset names that should be automatically applied for the given command
 func (c *Config) GetAutoPresets(command string) ([]string, error) {
 	var presets []string
@@ -247,12 +501,34 @@ func (c *Config) GetAutoPresets(command string) ([]string, error) {
 	return presets, nil
 }
 
+// commandMatches reports whether the base name of command matches the glob
+// pattern of a when-command; there is no command to match in which mode
+func commandMatches(pattern, command string) bool {
+	if command == "" {
+		return false
+	}
+	matched, _ := filepath.Match(pattern, filepath.Base(command))
+	return matched
+}
+
 // expandEnvOnly expands environment variables in a path
 // This is safer than shell expansion as it doesn't allow command execution
 func expandEnvOnly(path string) string {
 	return os.ExpandEnv(path)
 }
 
+// expandUserPath expands environment variables and a leading ~ (the current
+// user's home directory) in a rule path; ~user forms are left as they are
+func expandUserPath(path string) string {
+	path = expandEnvOnly(path)
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + path[1:]
+		}
+	}
+	return path
+}
+
 // getGitCommonDir returns the git common directory for the current repository
 // This is useful for git worktrees where the .git directory is a file pointing to the common dir
 // Returns empty string and nil error if not in a git repository (expected case)
@@ -270,30 +546,52 @@ func getGitCommonDir() (string, error) {
 	return strings.TrimSpace(string(output)), nil
 }
 
-// ProcessPreset expands all dynamic values in a preset
+// ProcessPreset expands all dynamic values in a preset and drops the paths
+// meant for another platform and the allow and read paths whose until has passed
+// Paths with a when-command are dropped too; see ProcessPresetFor
 func (p *Preset) ProcessPreset() (*Preset, error) {
+	return p.ProcessPresetFor("")
+}
+
+// ProcessPresetFor is ProcessPreset for sandboxing command, keeping the paths
+// whose when-command matches the command's name
+func (p *Preset) ProcessPresetFor(command string) (*Preset, error) {
+	return p.processPresetFor(runtime.GOOS, command, time.Now())
+}
+
+// processPresetFor is ProcessPresetFor for the platform goos (runtime.GOOS) at
+// the time now
+func (p *Preset) processPresetFor(goos, command string, now time.Time) (*Preset, error) {
 	processed := &Preset{
 		SkipDefaults:  p.SkipDefaults,
 		Strict:        p.Strict,
+		Priority:      p.Priority,
 		AllowKeychain: p.AllowKeychain,
 		AllowGit:      p.AllowGit,
+		AllowDNS:      p.AllowDNS,
+		AllowGo:       p.AllowGo,
 		Allow:         make([]AllowPath, 0, len(p.Allow)),
 		Read:          make([]AllowPath, 0, len(p.Read)),
 		Deny:          make([]AllowPath, 0, len(p.Deny)),
+		DenyWrite:     make([]AllowPath, 0, len(p.DenyWrite)),
 	}
 
-	expandPath := func(path AllowPath) AllowPath {
-		expanded := os.ExpandEnv(path.Path)
-		if path.EvalSymLinks {
-			resolvedPath, err := filepath.EvalSymlinks(expanded)
-			if err == nil {
-				expanded = resolvedPath
-			}
+	// expandPath expands brace patterns first, so each alternative gets its own
+	// environment and symlink expansion
+	expandPath := func(path AllowPath) ([]AllowPath, error) {
+		patterns, err := expandBraces(path.Path)
+		if err != nil {
+			return nil, err
+		}
+		excepts, err := expandBraceList(path.Except)
+		if err != nil {
+			return nil, err
 		}
-		// Expand exception paths
+
+		// Expand exception paths like the path they belong to
 		var expandedExcept []string
-		for _, exc := range path.Except {
-			expandedExc := os.ExpandEnv(exc)
+		for _, exc := range excepts {
+			expandedExc := expandUserPath(exc)
 			if path.EvalSymLinks {
 				if resolved, err := filepath.EvalSymlinks(expandedExc); err == nil {
 					expandedExc = resolved
@@ -301,17 +599,76 @@ func (p *Preset) ProcessPreset() (*Preset, error) {
 			}
 			expandedExcept = append(expandedExcept, expandedExc)
 		}
-		return AllowPath{Path: expanded, Except: expandedExcept}
+
+		var result []AllowPath
+		for _, pattern := range patterns {
+			expanded := expandUserPath(pattern)
+			if path.EvalSymLinks {
+				resolvedPath, err := filepath.EvalSymlinks(expanded)
+				if err == nil {
+					expanded = resolvedPath
+				}
+			}
+			result = append(result, AllowPath{Path: expanded, Except: expandedExcept, Refer: path.Refer, Recursive: path.Recursive})
+		}
+		return result, nil
+	}
+	expandPaths := func(section string, paths []AllowPath, into *[]AllowPath) error {
+		for _, path := range paths {
+			if path.OS != "" && path.OS != goos {
+				continue
+			}
+			if path.WhenCommand != "" && !commandMatches(path.WhenCommand, command) {
+				continue
+			}
+			if path.Until != "" {
+				// Dropping an expired deny would quietly widen access
+				if section != "allow" && section != "read" {
+					return fmt.Errorf("%s %s: until is only supported for allow and read paths", section, path.Path)
+				}
+				until, err := time.Parse(time.RFC3339, path.Until)
+				if err != nil {
+					return fmt.Errorf("%s %s: until %q is not an RFC3339 time", section, path.Path, path.Until)
+				}
+				if !now.Before(until) {
+					logger.Warnf("%s %s expired at %s and was left out", section, path.Path, path.Until)
+					continue
+				}
+			}
+			if path.Recursive != nil {
+				if section != "deny" && section != "deny-write" {
+					return fmt.Errorf("%s %s: recursive is only supported for deny and deny-write paths", section, path.Path)
+				}
+				if !*path.Recursive && len(path.Except) > 0 {
+					return fmt.Errorf("%s %s: except cannot be combined with recursive: false", section, path.Path)
+				}
+			}
+			expanded, err := expandPath(path)
+			if err != nil {
+				return err
+			}
+			*into = append(*into, expanded...)
+		}
+		return nil
 	}
 
-	for _, path := range p.Allow {
-		processed.Allow = append(processed.Allow, expandPath(path))
+	if err := expandPaths("allow", p.Allow, &processed.Allow); err != nil {
+		return nil, err
+	}
+	if err := expandPaths("read", p.Read, &processed.Read); err != nil {
+		return nil, err
 	}
-	for _, path := range p.Read {
-		processed.Read = append(processed.Read, expandPath(path))
+	if err := expandPaths("deny", p.Deny, &processed.Deny); err != nil {
+		return nil, err
 	}
-	for _, path := range p.Deny {
-		processed.Deny = append(processed.Deny, expandPath(path))
+	if err := expandPaths("deny-write", p.DenyWrite, &processed.DenyWrite); err != nil {
+		return nil, err
+	}
+	for name, value := range p.Env {
+		if processed.Env == nil {
+			processed.Env = make(map[string]string, len(p.Env))
+		}
+		processed.Env[name] = os.ExpandEnv(value)
 	}
 
 	return processed, nil
@@ -3,8 +3,12 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/goccy/go-yaml"
 )
@@ -169,15 +173,52 @@ func TestConfigListPresets(t *testing.T) {
 	}
 }
 
+func TestExpandPresetNamesAll(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"npm":   {Allow: []AllowPath{{Path: "~/.npm"}}},
+			"cargo": {Allow: []AllowPath{{Path: "~/.cargo"}}},
+		},
+	}
+
+	got := config.ExpandPresetNames([]string{"npm", "@all"})
+
+	want := config.ListPresets()
+	if len(got) != len(want) {
+		t.Fatalf("@all expanded to %d presets, want %d: %v", len(got), len(want), got)
+	}
+	if got[0] != "npm" {
+		t.Errorf("a preset named before @all should keep its position, got %v", got)
+	}
+	if !sort.StringsAreSorted(got[1:]) {
+		t.Errorf("@all should expand in sorted order, got %v", got[1:])
+	}
+	found := make(map[string]bool)
+	for _, name := range got {
+		found[name] = true
+	}
+	for _, name := range want {
+		if !found[name] {
+			t.Errorf("@all expansion is missing %s", name)
+		}
+	}
+
+	if got := config.ExpandPresetNames([]string{"cargo"}); !reflect.DeepEqual(got, []string{"cargo"}) {
+		t.Errorf("ExpandPresetNames() without @all = %v, want [cargo]", got)
+	}
+}
+
 func TestBuiltinPresetsYAMLLoaded(t *testing.T) {
 	expectedPresets := []string{
 		"secure",
 		"strict-base",
 		"secure-home",
+		"home-jail",
 		"npm",
 		"cargo",
 		"java",
 		"go",
+		"no-exfil",
 	}
 
 	for _, name := range expectedPresets {
@@ -1066,6 +1107,30 @@ func TestResolvePresetWithSkipDefaults(t *testing.T) {
 	}
 }
 
+func TestResolvePresetPriority(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"base":     {Priority: 5, Allow: []AllowPath{{Path: "/base"}}},
+			"inherits": {Extends: []string{"base"}},
+			"override": {Extends: []string{"base"}, Priority: 20},
+		},
+	}
+
+	for name, want := range map[string]int{"base": 5, "inherits": 5, "override": 20} {
+		resolved, err := config.ResolvePreset(name, nil)
+		if err != nil {
+			t.Fatalf("ResolvePreset(%s) failed: %v", name, err)
+		}
+		processed, err := resolved.ProcessPreset()
+		if err != nil {
+			t.Fatalf("ProcessPreset(%s) failed: %v", name, err)
+		}
+		if processed.Priority != want {
+			t.Errorf("preset %s priority = %d, want %d", name, processed.Priority, want)
+		}
+	}
+}
+
 func TestResolvePresetCircularReference(t *testing.T) {
 	config := &Config{
 		Presets: map[string]Preset{
@@ -1312,3 +1377,818 @@ func TestProcessPresetWithSymlinkEvaluation(t *testing.T) {
 		})
 	}
 }
+
+func TestResolvePresetRemoveInheritedRules(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+
+	config := &Config{
+		Presets: map[string]Preset{
+			"base": {
+				Allow: []AllowPath{{Path: "$HOME/.cache"}, {Path: "/tmp/build"}},
+				Read:  []AllowPath{{Path: "/usr"}},
+				Deny:  []AllowPath{{Path: "$HOME/.ssh"}, {Path: "$HOME/.aws"}},
+			},
+			"child": {
+				Extends: []string{"base"},
+				Allow:   []AllowPath{{Path: "/child"}},
+				Remove: &PresetRemove{
+					Allow: []string{"/home/test/.cache/"},
+					Deny:  []string{"$HOME/.aws"},
+				},
+			},
+		},
+	}
+
+	resolved, err := config.ResolvePreset("child", nil)
+	if err != nil {
+		t.Fatalf("ResolvePreset() error = %v", err)
+	}
+
+	allowPaths := []string{}
+	for _, p := range resolved.Allow {
+		allowPaths = append(allowPaths, p.Path)
+	}
+	if !reflect.DeepEqual(allowPaths, []string{"/tmp/build", "/child"}) {
+		t.Errorf("expected inherited $HOME/.cache allow to be removed, got %v", allowPaths)
+	}
+
+	if len(resolved.Deny) != 1 || resolved.Deny[0].Path != "$HOME/.ssh" {
+		t.Errorf("expected only $HOME/.ssh deny to remain, got %v", resolved.Deny)
+	}
+
+	if len(resolved.Read) != 1 || resolved.Read[0].Path != "/usr" {
+		t.Errorf("read rules should be untouched, got %v", resolved.Read)
+	}
+}
+
+func TestResolvePresetRemoveMatchesMode(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"base": {
+				Allow: []AllowPath{{Path: "/shared"}},
+				Read:  []AllowPath{{Path: "/shared"}},
+			},
+			"child": {
+				Extends: []string{"base"},
+				Remove:  &PresetRemove{Read: []string{"/shared"}},
+			},
+		},
+	}
+
+	resolved, err := config.ResolvePreset("child", nil)
+	if err != nil {
+		t.Fatalf("ResolvePreset() error = %v", err)
+	}
+
+	if len(resolved.Read) != 0 {
+		t.Errorf("expected read rule to be removed, got %v", resolved.Read)
+	}
+	if len(resolved.Allow) != 1 {
+		t.Errorf("allow rule with the same path should be kept, got %v", resolved.Allow)
+	}
+}
+
+func TestLoadConfigWithRemove(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	content := `presets:
+  child:
+    extends:
+      - "builtin:go"
+    remove:
+      allow:
+        - "$HOME/go"
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	resolved, err := config.ResolvePreset("child", nil)
+	if err != nil {
+		t.Fatalf("ResolvePreset() error = %v", err)
+	}
+	for _, p := range resolved.Allow {
+		if p.Path == "$HOME/go" {
+			t.Error("expected $HOME/go to be removed from builtin:go")
+		}
+	}
+}
+
+func TestExplainPreset(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"grandparent": {
+				Allow: []AllowPath{{Path: "/grandparent"}, {Path: "/shared"}},
+				Deny:  []AllowPath{{Path: "/secret"}},
+			},
+			"parent": {
+				Extends: []string{"grandparent"},
+				Allow:   []AllowPath{{Path: "/parent"}},
+			},
+			"child": {
+				Extends: []string{"parent"},
+				Allow:   []AllowPath{{Path: "/shared"}},
+				Remove:  &PresetRemove{Deny: []string{"/secret"}},
+			},
+		},
+	}
+
+	resolved, trace, err := config.ExplainPreset("child")
+	if err != nil {
+		t.Fatalf("ExplainPreset() error = %v", err)
+	}
+
+	origins := make(map[string]string)
+	for _, p := range resolved.Allow {
+		origins[p.Path] = p.Origin
+	}
+	if origins["/grandparent"] != "grandparent" || origins["/parent"] != "parent" {
+		t.Errorf("unexpected provenance: %v", origins)
+	}
+	if len(resolved.Deny) != 0 {
+		t.Errorf("expected /secret to be removed, got %v", resolved.Deny)
+	}
+
+	var steps []string
+	for _, event := range trace {
+		steps = append(steps, event.Kind+":"+event.Preset)
+	}
+	expected := []string{
+		"extends:child",
+		"extends:parent",
+		"apply:grandparent",
+		"apply:parent",
+		"remove:child",
+		"override:child",
+		"apply:child",
+	}
+	if !reflect.DeepEqual(steps, expected) {
+		t.Errorf("trace = %v, want %v", steps, expected)
+	}
+
+	for _, event := range trace {
+		switch event.Kind {
+		case "remove":
+			if event.Path != "/secret" || event.From != "grandparent" {
+				t.Errorf("unexpected remove event: %+v", event)
+			}
+		case "override":
+			if event.Path != "/shared" || event.From != "grandparent" {
+				t.Errorf("unexpected override event: %+v", event)
+			}
+		}
+	}
+}
+
+func TestExplainPresetDoesNotTagConfig(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"base": {Allow: []AllowPath{{Path: "/base"}}},
+		},
+	}
+
+	if _, _, err := config.ExplainPreset("base"); err != nil {
+		t.Fatalf("ExplainPreset() error = %v", err)
+	}
+	if origin := config.Presets["base"].Allow[0].Origin; origin != "" {
+		t.Errorf("ExplainPreset should not modify the config, got origin %q", origin)
+	}
+
+	resolved, err := config.ResolvePreset("base", nil)
+	if err != nil {
+		t.Fatalf("ResolvePreset() error = %v", err)
+	}
+	if resolved.Allow[0].Origin != "" {
+		t.Error("ResolvePreset should not track provenance")
+	}
+}
+
+func TestAllowPathReferOption(t *testing.T) {
+	content := `presets:
+  tight:
+    allow:
+      - "/default"
+      - path: "/no-refer"
+        refer: false
+`
+	var config Config
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatalf("yaml.Unmarshal failed: %v", err)
+	}
+
+	preset := config.Presets["tight"]
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	if processed.Allow[0].Refer != nil {
+		t.Errorf("expected refer to be unset by default, got %v", *processed.Allow[0].Refer)
+	}
+	if processed.Allow[1].Refer == nil || *processed.Allow[1].Refer {
+		t.Error("expected refer: false to be preserved by ProcessPreset")
+	}
+}
+
+func TestPresetEnv(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+
+	content := `presets:
+  base:
+    env:
+      GIT_CONFIG_NOSYSTEM: "1"
+      CACHE_DIR: "${HOME}/.cache/base"
+  child:
+    extends:
+      - base
+    env:
+      CACHE_DIR: "${HOME}/.cache/child"
+`
+	var config Config
+	if err := yaml.Unmarshal([]byte(content), &config); err != nil {
+		t.Fatalf("yaml.Unmarshal failed: %v", err)
+	}
+
+	resolved, err := config.ResolvePreset("child", nil)
+	if err != nil {
+		t.Fatalf("ResolvePreset() error = %v", err)
+	}
+	processed, err := resolved.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+
+	expected := map[string]string{
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"CACHE_DIR":           "/home/test/.cache/child",
+	}
+	if !reflect.DeepEqual(processed.Env, expected) {
+		t.Errorf("expected child env to override base, got %v", processed.Env)
+	}
+
+	if config.Presets["base"].Env["CACHE_DIR"] != "${HOME}/.cache/base" {
+		t.Error("resolving a preset should not modify the base preset's env")
+	}
+}
+
+func TestBuiltinHomeJailPreset(t *testing.T) {
+	home := t.TempDir()
+	project := filepath.Join(home, "Projects", "app")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	t.Setenv("HOME", home)
+	t.Chdir(project)
+
+	config := &Config{}
+	resolved, err := config.ResolvePreset("builtin:home-jail", nil)
+	if err != nil {
+		t.Fatalf("ResolvePreset() error = %v", err)
+	}
+	processed, err := resolved.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+
+	resolver := NewRuleResolver()
+	source := RuleSource{PresetName: "builtin:home-jail"}
+	for _, path := range processed.Allow {
+		resolver.AddAllowRule(path.Path, source)
+	}
+	for _, path := range processed.Deny {
+		resolver.AddDenyRule(path.Path, path.Except, source)
+	}
+	if errs := resolver.ValidatePreset("builtin:home-jail"); len(errs) != 0 {
+		t.Fatalf("home-jail has conflicting rules: %v", errs)
+	}
+
+	writeRules, _, conflicts := resolver.Resolve()
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %v", conflicts)
+	}
+
+	var deny, allow *ResolvedRule
+	for i := range writeRules {
+		switch writeRules[i].Action {
+		case ActionDeny:
+			deny = &writeRules[i]
+		case ActionAllow:
+			allow = &writeRules[i]
+		}
+	}
+	if deny == nil || deny.Path != home || deny.Mode != AccessReadWrite {
+		t.Fatalf("expected read+write deny of $HOME, got %+v", deny)
+	}
+	if !slices.Contains(deny.Except, filepath.Join(home, ".gitconfig")) {
+		t.Errorf("expected .gitconfig to stay readable, got except %v", deny.Except)
+	}
+	if allow == nil || allow.Path != project {
+		t.Fatalf("expected write carve-out for the project directory, got %+v", allow)
+	}
+	if !pathContains(deny.Path, allow.Path) {
+		t.Errorf("project allow %s should be nested inside the $HOME deny", allow.Path)
+	}
+}
+
+func TestBuiltinHomeJailPresetRemoveProject(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"jail-build": {
+				Extends: []string{"builtin:home-jail"},
+				Remove:  &PresetRemove{Allow: []string{"."}},
+				Allow:   []AllowPath{{Path: "$HOME/Projects/build"}},
+			},
+		},
+	}
+
+	resolved, err := config.ResolvePreset("jail-build", nil)
+	if err != nil {
+		t.Fatalf("ResolvePreset() error = %v", err)
+	}
+	if len(resolved.Allow) != 1 || resolved.Allow[0].Path != "$HOME/Projects/build" {
+		t.Errorf("expected the project allow to be replaced, got %v", resolved.Allow)
+	}
+}
+
+func TestProcessPresetBraceExpansion(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+
+	preset := Preset{
+		Allow: []AllowPath{
+			{Path: "$HOME/src/{api,web}", Except: []string{"$HOME/src/{api,web}/.env"}},
+		},
+		Read: []AllowPath{{Path: "/opt/{a,b{1,2}}"}},
+		Deny: []AllowPath{{Path: "${HOME}/.{ssh,aws}"}},
+	}
+
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+
+	var allow []string
+	for _, path := range processed.Allow {
+		allow = append(allow, path.Path)
+		wantExcept := []string{"/home/test/src/api/.env", "/home/test/src/web/.env"}
+		if !reflect.DeepEqual(path.Except, wantExcept) {
+			t.Errorf("allow %s except = %v, want %v", path.Path, path.Except, wantExcept)
+		}
+	}
+	if want := []string{"/home/test/src/api", "/home/test/src/web"}; !reflect.DeepEqual(allow, want) {
+		t.Errorf("allow paths = %v, want %v", allow, want)
+	}
+
+	var read []string
+	for _, path := range processed.Read {
+		read = append(read, path.Path)
+	}
+	if want := []string{"/opt/a", "/opt/b1", "/opt/b2"}; !reflect.DeepEqual(read, want) {
+		t.Errorf("read paths = %v, want %v", read, want)
+	}
+
+	var deny []string
+	for _, path := range processed.Deny {
+		deny = append(deny, path.Path)
+	}
+	if want := []string{"/home/test/.ssh", "/home/test/.aws"}; !reflect.DeepEqual(deny, want) {
+		t.Errorf("deny paths = %v, want %v", deny, want)
+	}
+
+	malformed := Preset{Allow: []AllowPath{{Path: "/work/{a,b"}}}
+	if _, err := malformed.ProcessPreset(); err == nil {
+		t.Error("ProcessPreset() with unmatched brace succeeded, want error")
+	}
+}
+
+func TestProcessPresetExpandsExceptPaths(t *testing.T) {
+	t.Setenv("HOME", "/home/test")
+	t.Setenv("APP_NAME", "editor")
+
+	preset := Preset{
+		Deny: []AllowPath{
+			{Path: "$HOME/.config", Except: []string{"$HOME/.config/${APP_NAME}", "~/.config/shared", "~other/.config"}},
+			{Path: "~/.ssh", Except: []string{"~"}},
+		},
+	}
+
+	processed, err := preset.ProcessPreset()
+	if err != nil {
+		t.Fatalf("ProcessPreset() error = %v", err)
+	}
+	if len(processed.Deny) != 2 {
+		t.Fatalf("expected 2 deny paths, got %d", len(processed.Deny))
+	}
+
+	if got := processed.Deny[0].Path; got != "/home/test/.config" {
+		t.Errorf("deny path = %s, want /home/test/.config", got)
+	}
+	wantExcept := []string{"/home/test/.config/editor", "/home/test/.config/shared", "~other/.config"}
+	if !reflect.DeepEqual(processed.Deny[0].Except, wantExcept) {
+		t.Errorf("except = %v, want %v", processed.Deny[0].Except, wantExcept)
+	}
+	if got := processed.Deny[1].Path; got != "/home/test/.ssh" {
+		t.Errorf("deny path = %s, want /home/test/.ssh", got)
+	}
+	if !reflect.DeepEqual(processed.Deny[1].Except, []string{"/home/test"}) {
+		t.Errorf("except = %v, want [/home/test]", processed.Deny[1].Except)
+	}
+}
+
+func TestProcessPresetSelectsPathsByOS(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+presets:
+  caches:
+    allow:
+      - "/shared"
+      - path: "/Users/me/cache"
+        os: darwin
+      - path: "/home/me/cache"
+        os: linux
+    deny:
+      - path: "/Users/me/.ssh"
+        os: darwin
+`), &config)
+	if err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+	preset := config.Presets["caches"]
+
+	tests := []struct {
+		goos  string
+		allow []string
+		deny  int
+	}{
+		{goos: "darwin", allow: []string{"/shared", "/Users/me/cache"}, deny: 1},
+		{goos: "linux", allow: []string{"/shared", "/home/me/cache"}, deny: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goos, func(t *testing.T) {
+			processed, err := preset.processPresetFor(tt.goos, "", time.Now())
+			if err != nil {
+				t.Fatalf("processPresetFor() error = %v", err)
+			}
+			var allow []string
+			for _, path := range processed.Allow {
+				allow = append(allow, path.Path)
+			}
+			if !reflect.DeepEqual(allow, tt.allow) {
+				t.Errorf("allow = %v, want %v", allow, tt.allow)
+			}
+			if len(processed.Deny) != tt.deny {
+				t.Errorf("expected %d deny paths, got %v", tt.deny, processed.Deny)
+			}
+		})
+	}
+}
+
+func TestAllowPathRejectsUnknownOS(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+presets:
+  caches:
+    allow:
+      - path: "/Users/me/cache"
+        os: macos
+`), &config)
+	if err == nil || !strings.Contains(err.Error(), `unsupported os "macos"`) {
+		t.Errorf("expected an unsupported os error, got %v", err)
+	}
+}
+
+func TestProcessPresetDropsExpiredPaths(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+presets:
+  sprint:
+    allow:
+      - "/work"
+      - path: "/work/release"
+        until: "2026-06-30T18:00:00Z"
+    read:
+      - path: "/shared/specs"
+        until: "2026-06-30T18:00:00+02:00"
+`), &config)
+	if err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+	preset := config.Presets["sprint"]
+
+	tests := []struct {
+		name  string
+		now   time.Time
+		allow []string
+		read  int
+	}{
+		{"before expiry", time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC), []string{"/work", "/work/release"}, 1},
+		{"after expiry", time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), []string{"/work"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			processed, err := preset.processPresetFor("linux", "", tt.now)
+			if err != nil {
+				t.Fatalf("processPresetFor() error = %v", err)
+			}
+			var allow []string
+			for _, path := range processed.Allow {
+				allow = append(allow, path.Path)
+			}
+			if !reflect.DeepEqual(allow, tt.allow) {
+				t.Errorf("allow = %v, want %v", allow, tt.allow)
+			}
+			if len(processed.Read) != tt.read {
+				t.Errorf("read = %v, want %d paths", processed.Read, tt.read)
+			}
+		})
+	}
+}
+
+func TestAllowPathUntilValidation(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+presets:
+  sprint:
+    allow:
+      - path: "/work/release"
+        until: "end of sprint"
+`), &config)
+	if err == nil || !strings.Contains(err.Error(), "not an RFC3339 time") {
+		t.Errorf("expected an RFC3339 error, got %v", err)
+	}
+
+	// An expired deny must not silently widen access
+	preset := Preset{Deny: []AllowPath{{Path: "/secrets", Until: "2020-01-01T00:00:00Z"}}}
+	if _, err := preset.processPresetFor("linux", "", time.Now()); err == nil || !strings.Contains(err.Error(), "only supported for allow and read") {
+		t.Errorf("expected until on a deny to be rejected, got %v", err)
+	}
+}
+
+func TestProcessPresetSelectsPathsByCommand(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+presets:
+  js:
+    allow:
+      - "~/.npm"
+      - path: "/work/node_modules"
+        when-command: npm
+      - path: "/work/.pnpm-store"
+        when-command: "pnp[mx]"
+    deny:
+      - path: "/work/.env"
+        when-command: "node*"
+`), &config)
+	if err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+	preset := config.Presets["js"]
+
+	tests := []struct {
+		command string
+		allow   []string
+		deny    int
+	}{
+		{command: "npm", allow: []string{"/work/node_modules"}},
+		{command: "/usr/local/bin/npm", allow: []string{"/work/node_modules"}},
+		{command: "pnpx", allow: []string{"/work/.pnpm-store"}},
+		{command: "node", deny: 1},
+		{command: "npx"},
+		{command: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			processed, err := preset.processPresetFor("linux", tt.command, time.Now())
+			if err != nil {
+				t.Fatalf("processPresetFor() error = %v", err)
+			}
+			var allow []string
+			for _, path := range processed.Allow[1:] {
+				allow = append(allow, path.Path)
+			}
+			if !reflect.DeepEqual(allow, tt.allow) {
+				t.Errorf("conditional allow = %v, want %v", allow, tt.allow)
+			}
+			if len(processed.Deny) != tt.deny {
+				t.Errorf("expected %d deny paths, got %v", tt.deny, processed.Deny)
+			}
+		})
+	}
+}
+
+func TestAllowPathRejectsInvalidWhenCommand(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+presets:
+  js:
+    allow:
+      - path: "/work/node_modules"
+        when-command: "np[m"
+`), &config)
+	if err == nil || !strings.Contains(err.Error(), "not a valid glob") {
+		t.Errorf("expected an invalid glob error, got %v", err)
+	}
+}
+
+func TestProcessPresetRecursive(t *testing.T) {
+	notRecursive := false
+	preset := Preset{
+		Deny:      []AllowPath{{Path: "/work", Recursive: &notRecursive}},
+		DenyWrite: []AllowPath{{Path: "/shared", Recursive: &notRecursive}},
+	}
+	processed, err := preset.processPresetFor("darwin", "", time.Now())
+	if err != nil {
+		t.Fatalf("processPresetFor() error = %v", err)
+	}
+	if r := processed.Deny[0].Recursive; r == nil || *r {
+		t.Errorf("deny recursive = %v, want false", r)
+	}
+	if r := processed.DenyWrite[0].Recursive; r == nil || *r {
+		t.Errorf("deny-write recursive = %v, want false", r)
+	}
+
+	invalid := []Preset{
+		{Allow: []AllowPath{{Path: "/work", Recursive: &notRecursive}}},
+		{Deny: []AllowPath{{Path: "/work", Recursive: &notRecursive, Except: []string{"/work/docs"}}}},
+	}
+	for _, preset := range invalid {
+		if _, err := preset.processPresetFor("darwin", "", time.Now()); err == nil {
+			t.Errorf("expected an error for %+v", preset)
+		}
+	}
+}
+
+func TestResolvePresetOptionalExtends(t *testing.T) {
+	var config Config
+	err := yaml.Unmarshal([]byte(`
+presets:
+  base:
+    allow: ["/base"]
+  portable:
+    extends: [base]
+    optional-extends: [site-local, base-extra]
+    allow: ["/work"]
+  base-extra:
+    read: ["/extra"]
+  strict-parent:
+    extends: [site-local]
+`), &config)
+	if err != nil {
+		t.Fatalf("unmarshal config: %v", err)
+	}
+
+	resolved, err := config.ResolvePreset("portable", nil)
+	if err != nil {
+		t.Fatalf("a missing optional base should not fail: %v", err)
+	}
+	var allow []string
+	for _, path := range resolved.Allow {
+		allow = append(allow, path.Path)
+	}
+	if !reflect.DeepEqual(allow, []string{"/base", "/work"}) {
+		t.Errorf("allow = %v, want [/base /work]", allow)
+	}
+	if len(resolved.Read) != 1 || resolved.Read[0].Path != "/extra" {
+		t.Errorf("expected the present optional base to be applied, got read %v", resolved.Read)
+	}
+
+	_, trace, err := config.ExplainPreset("portable")
+	if err != nil {
+		t.Fatalf("ExplainPreset() error = %v", err)
+	}
+	var skipped []string
+	for _, event := range trace {
+		if event.Kind == "skip" {
+			skipped = append(skipped, event.Parents...)
+		}
+	}
+	if !reflect.DeepEqual(skipped, []string{"site-local"}) {
+		t.Errorf("skipped = %v, want [site-local]", skipped)
+	}
+
+	// A missing hard base is still an error, which points at optional-extends
+	_, err = config.ResolvePreset("strict-parent", nil)
+	if err == nil || !strings.Contains(err.Error(), "extends site-local, which does not exist") || !strings.Contains(err.Error(), "optional-extends") {
+		t.Errorf("expected a missing base error, got %v", err)
+	}
+}
+
+func TestLoadConfigFallsBackToDefault(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	for _, name := range []string{"dev", "untrusted"} {
+		resolved, err := config.ResolvePreset(name, nil)
+		if err != nil {
+			t.Fatalf("default preset %s does not resolve: %v", name, err)
+		}
+		if len(resolved.Allow) == 0 {
+			t.Errorf("default preset %s allows nothing", name)
+		}
+	}
+
+	// A preset file replaces a default preset of the same name
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "dev.yaml"), []byte("allow:\n  - /work\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadPresetDir(config, dir); err != nil {
+		t.Fatalf("loadPresetDir() error = %v", err)
+	}
+	if dev := config.Presets["dev"]; len(dev.Allow) != 1 || dev.Allow[0].Path != "/work" {
+		t.Errorf("expected presets.d to replace the default dev preset, got %+v", dev)
+	}
+}
+
+func TestLoadConfigUserFileReplacesDefault(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	if err := os.MkdirAll(filepath.Join(configDir, "cage"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	content := "presets:\n  mine:\n    allow:\n      - /tmp\n"
+	if err := os.WriteFile(filepath.Join(configDir, "cage", "presets.yaml"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig("")
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if _, ok := config.Presets["dev"]; ok {
+		t.Error("the default config should not be used when the user has a config file")
+	}
+	if _, ok := config.Presets["mine"]; !ok {
+		t.Error("expected the user's preset")
+	}
+}
+
+func TestBuiltinNoExfilPresetComposes(t *testing.T) {
+	home := t.TempDir()
+	project := filepath.Join(home, "Projects", "app")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatalf("failed to create project: %v", err)
+	}
+	t.Setenv("HOME", home)
+	t.Chdir(project)
+
+	config := &Config{}
+	resolver := NewRuleResolver()
+	for _, name := range []string{"builtin:secure", "builtin:no-exfil"} {
+		resolved, err := config.ResolvePreset(name, nil)
+		if err != nil {
+			t.Fatalf("ResolvePreset(%s) error = %v", name, err)
+		}
+		processed, err := resolved.ProcessPreset()
+		if err != nil {
+			t.Fatalf("ProcessPreset(%s) error = %v", name, err)
+		}
+		source := RuleSource{PresetName: name}
+		for _, path := range processed.Allow {
+			resolver.AddAllowRule(path.Path, source)
+		}
+		for _, path := range processed.Read {
+			resolver.AddReadRule(path.Path, source)
+		}
+		for _, path := range processed.Deny {
+			resolver.AddDenyRule(path.Path, path.Except, source)
+		}
+		for _, path := range processed.DenyWrite {
+			resolver.AddWriteDenyRule(path.Path, source)
+		}
+		if errs := resolver.ValidatePreset(name); len(errs) != 0 {
+			t.Fatalf("%s has conflicting rules: %v", name, errs)
+		}
+	}
+
+	writeRules, _, conflicts := resolver.Resolve()
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %v", conflicts)
+	}
+
+	denies := make(map[string]AccessMode)
+	for _, rule := range writeRules {
+		if rule.Action == ActionDeny {
+			denies[rule.Path] = rule.Mode
+		}
+	}
+	expected := map[string]AccessMode{
+		filepath.Join(home, ".ssh"):                       AccessReadWrite,
+		filepath.Join(home, ".aws"):                       AccessReadWrite,
+		filepath.Join(home, ".cargo", "credentials.toml"): AccessReadWrite,
+		filepath.Join(home, ".ssh", "authorized_keys"):    AccessWrite,
+		filepath.Join(home, ".bashrc"):                    AccessWrite,
+		filepath.Join(home, "Library", "LaunchAgents"):    AccessWrite,
+	}
+	for path, mode := range expected {
+		if got, ok := denies[path]; !ok || got != mode {
+			t.Errorf("deny %s = %v (present %v), want %v", path, got, ok, mode)
+		}
+	}
+}
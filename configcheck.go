@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/goccy/go-yaml"
+)
+
+// checkConfigData parses a config with unknown keys rejected and resolves the
+// extends chain of every preset, returning all problems found
+func checkConfigData(data []byte) []error {
+	var config Config
+	if err := yaml.UnmarshalWithOptions(data, &config, yaml.DisallowUnknownField()); err != nil {
+		return []error{err}
+	}
+
+	names := config.ListPresets()
+	sort.Strings(names)
+	var errs []error
+	for _, name := range names {
+		if _, err := config.ResolvePreset(name, nil); err != nil {
+			errs = append(errs, fmt.Errorf("preset %s: %w", name, err))
+		}
+	}
+	return errs
+}
+
+// runConfigCheck implements --config-check: it validates the config file cage
+// would load, writes the result to w and returns the exit status. Without a
+// config file of their own, users get the embedded default, which is checked.
+func runConfigCheck(w io.Writer, configPath string) int {
+	path, err := configFilePath(configPath)
+	if err != nil {
+		fmt.Fprintf(w, "cage: %v\n", err)
+		return 1
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && configPath == "" {
+		path, data, err = "embedded default config", defaultConfigYAML, nil
+	}
+	if err != nil {
+		fmt.Fprintf(w, "cage: %v\n", err)
+		return 1
+	}
+
+	errs := checkConfigData(data)
+	for _, err := range errs {
+		fmt.Fprintf(w, "%s: %v\n", path, err)
+	}
+	if len(errs) > 0 {
+		return 1
+	}
+	fmt.Fprintf(w, "%s: ok\n", path)
+	return 0
+}
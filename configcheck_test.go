@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunConfigCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		wantCode int
+		want     []string
+	}{
+		{
+			name: "valid",
+			content: `presets:
+  base:
+    allow: ["/work"]
+  dev:
+    extends: [base]
+    optional-extends: [missing]
+`,
+			want: []string{"ok"},
+		},
+		{
+			name: "unknown key",
+			content: `presets:
+  dev:
+    alow: ["/work"]
+`,
+			wantCode: 1,
+			want:     []string{"alow"},
+		},
+		{
+			name: "missing base",
+			content: `presets:
+  dev:
+    extends: [base]
+`,
+			wantCode: 1,
+			want:     []string{"preset dev:", "extends base, which does not exist"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "presets.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			if code := runConfigCheck(&out, path); code != tt.wantCode {
+				t.Errorf("exit status %d, want %d; output:\n%s", code, tt.wantCode, out.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("expected %q in output, got:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRunConfigCheckMissingFile(t *testing.T) {
+	var out bytes.Buffer
+	if code := runConfigCheck(&out, filepath.Join(t.TempDir(), "none.yaml")); code == 0 {
+		t.Errorf("expected a missing --config file to fail, got:\n%s", out.String())
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// Credentials identifies the user and group the command runs as
+// Groups are its supplementary groups; without any, they are cleared
+type Credentials struct {
+	UID    uint32
+	GID    uint32
+	Groups []uint32
+}
+
+// resolveCredentials determines the credentials requested by --user, --uid and --gid
+// It returns nil when no change was requested. --uid and --gid override the values
+// looked up for --user; the target user must exist. The command gets the
+// supplementary groups of the user given by --uid or --user, as after a login,
+// and none for --gid alone. Only root can switch users, so this can drop
+// privileges but never gain them.
+func resolveCredentials(name string, uid, gid int) (*Credentials, error) {
+	if name == "" && uid < 0 && gid < 0 {
+		return nil, nil
+	}
+
+	creds := &Credentials{UID: uint32(os.Getuid()), GID: uint32(os.Getgid())}
+
+	var target *user.User
+	if name != "" {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", name, err)
+		}
+		target = u
+		if err := parseID(u.Uid, &creds.UID); err != nil {
+			return nil, fmt.Errorf("user %s: %w", name, err)
+		}
+		if err := parseID(u.Gid, &creds.GID); err != nil {
+			return nil, fmt.Errorf("user %s: %w", name, err)
+		}
+	}
+
+	if uid >= 0 {
+		u, err := user.LookupId(strconv.Itoa(uid))
+		if err != nil {
+			return nil, fmt.Errorf("uid %d: %w", uid, err)
+		}
+		target = u
+		creds.UID = uint32(uid)
+	}
+	if gid >= 0 {
+		if _, err := user.LookupGroupId(strconv.Itoa(gid)); err != nil {
+			return nil, fmt.Errorf("gid %d: %w", gid, err)
+		}
+		creds.GID = uint32(gid)
+	}
+
+	if target != nil {
+		groups, err := target.GroupIds()
+		if err != nil {
+			return nil, fmt.Errorf("user %s: list groups: %w", target.Username, err)
+		}
+		for _, group := range groups {
+			var id uint32
+			if err := parseID(group, &id); err != nil {
+				return nil, fmt.Errorf("user %s: %w", target.Username, err)
+			}
+			creds.Groups = append(creds.Groups, id)
+		}
+	}
+
+	changing := int(creds.UID) != os.Getuid() || int(creds.GID) != os.Getgid()
+	if changing && os.Geteuid() != 0 {
+		return nil, fmt.Errorf("switching to uid %d gid %d requires running cage as root", creds.UID, creds.GID)
+	}
+
+	return creds, nil
+}
+
+func parseID(s string, id *uint32) error {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid id %q: %w", s, err)
+	}
+	*id = uint32(n)
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestResolveCredentialsNone(t *testing.T) {
+	creds, err := resolveCredentials("", -1, -1)
+	if err != nil {
+		t.Fatalf("resolveCredentials() error = %v", err)
+	}
+	if creds != nil {
+		t.Errorf("expected nil credentials when nothing is requested, got %+v", creds)
+	}
+}
+
+func TestResolveCredentialsCurrentUser(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("cannot look up current user: %v", err)
+	}
+
+	creds, err := resolveCredentials(current.Username, -1, -1)
+	if err != nil {
+		t.Fatalf("resolveCredentials() error = %v", err)
+	}
+	if int(creds.UID) != os.Getuid() {
+		t.Errorf("expected uid %d, got %d", os.Getuid(), creds.UID)
+	}
+
+	creds, err = resolveCredentials("", os.Getuid(), os.Getgid())
+	if err != nil {
+		t.Fatalf("resolveCredentials() error = %v", err)
+	}
+	if int(creds.GID) != os.Getgid() {
+		t.Errorf("expected gid %d, got %d", os.Getgid(), creds.GID)
+	}
+}
+
+func TestResolveCredentialsUnknownUser(t *testing.T) {
+	if _, err := resolveCredentials("cage-no-such-user", -1, -1); err == nil {
+		t.Error("expected error for unknown user")
+	}
+}
+
+func TestResolveCredentialsRequiresRoot(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("running as root")
+	}
+	if _, err := resolveCredentials("", 0, -1); err == nil {
+		t.Error("expected error when switching to root without privileges")
+	}
+}
+
+func TestResolveCredentialsSupplementaryGroups(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Skipf("cannot look up current user: %v", err)
+	}
+	want, err := current.GroupIds()
+	if err != nil {
+		t.Skipf("cannot list groups of the current user: %v", err)
+	}
+
+	for _, creds := range []func() (*Credentials, error){
+		func() (*Credentials, error) { return resolveCredentials(current.Username, -1, -1) },
+		func() (*Credentials, error) { return resolveCredentials("", os.Getuid(), -1) },
+	} {
+		creds, err := creds()
+		if err != nil {
+			t.Fatalf("resolveCredentials() error = %v", err)
+		}
+		var got []string
+		for _, group := range creds.Groups {
+			got = append(got, strconv.FormatUint(uint64(group), 10))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("Groups = %v, want the user's groups %v", got, want)
+		}
+	}
+
+	// --gid alone names no user, so there are no groups to take over
+	creds, err := resolveCredentials("", -1, os.Getgid())
+	if err != nil {
+		t.Fatalf("resolveCredentials() error = %v", err)
+	}
+	if len(creds.Groups) != 0 {
+		t.Errorf("Groups = %v, want none for --gid alone", creds.Groups)
+	}
+}
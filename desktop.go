@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// errDesktopUnsupported is returned by desktopPaths on platforms where desktop
+// integration does not go through files that sandbox rules could grant
+var errDesktopUnsupported = errors.New("has no effect on macOS, where desktop services are reached through Mach ports")
+
+// x11SocketDir holds the local X11 server sockets, one X<n> per display
+const x11SocketDir = "/tmp/.X11-unix"
+
+// desktopPaths returns what GUI and desktop-integrated tools need on Linux:
+// $XDG_RUNTIME_DIR, the session DBus socket and the Wayland and X11 display
+// sockets, all resolved from the environment, plus the X authority file
+// Sockets inside $XDG_RUNTIME_DIR are covered by it and not listed separately
+func desktopPaths(env toolchainEnv) (toolchainPaths, error) {
+	if env.goos == "darwin" {
+		return toolchainPaths{}, errDesktopUnsupported
+	}
+
+	var paths toolchainPaths
+	runtimeDir := env.getenv("XDG_RUNTIME_DIR")
+	if filepath.IsAbs(runtimeDir) {
+		runtimeDir = filepath.Clean(runtimeDir)
+		paths.Allow = append(paths.Allow, runtimeDir)
+	} else {
+		runtimeDir = ""
+	}
+	addSocket := func(path string) {
+		if runtimeDir == "" || !pathContains(runtimeDir, path) {
+			paths.Allow = append(paths.Allow, path)
+		}
+	}
+
+	for _, socket := range dbusSocketPaths(env.getenv("DBUS_SESSION_BUS_ADDRESS")) {
+		addSocket(socket)
+	}
+
+	if display := env.getenv("WAYLAND_DISPLAY"); display != "" {
+		if filepath.IsAbs(display) {
+			addSocket(filepath.Clean(display))
+		} else if runtimeDir == "" {
+			return paths, fmt.Errorf("cannot locate Wayland socket %q: $XDG_RUNTIME_DIR is not set", display)
+		}
+	}
+
+	if socket, ok := x11SocketPath(env.getenv("DISPLAY")); ok {
+		paths.Allow = append(paths.Allow, socket)
+		if xauth := env.envOr("XAUTHORITY", filepath.Join(env.home, ".Xauthority")); filepath.IsAbs(xauth) {
+			paths.Read = append(paths.Read, xauth)
+		}
+	}
+	return paths, nil
+}
+
+// dbusSocketPaths returns the socket files of the unix:path= entries in a DBus
+// address such as "unix:path=/run/user/1000/bus,guid=…"; abstract sockets have
+// no file and other transports are not files, so they are skipped
+func dbusSocketPaths(address string) []string {
+	var paths []string
+	for _, entry := range strings.Split(address, ";") {
+		params, ok := strings.CutPrefix(entry, "unix:")
+		if !ok {
+			continue
+		}
+		for _, param := range strings.Split(params, ",") {
+			if path, ok := strings.CutPrefix(param, "path="); ok && filepath.IsAbs(path) {
+				paths = append(paths, filepath.Clean(path))
+			}
+		}
+	}
+	return paths
+}
+
+// x11SocketPath returns the socket of a local X11 display such as ":0" or
+// "unix:1.0"; remote displays are reached over TCP and have no socket file
+func x11SocketPath(display string) (string, bool) {
+	host, number, ok := strings.Cut(display, ":")
+	if !ok || (host != "" && host != "unix") {
+		return "", false
+	}
+	number, _, _ = strings.Cut(number, ".")
+	if number == "" || strings.Trim(number, "0123456789") != "" {
+		return "", false
+	}
+	return filepath.Join(x11SocketDir, "X"+number), true
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDesktopPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		vars    map[string]string
+		want    toolchainPaths
+		wantErr bool
+	}{
+		{
+			name: "no desktop session",
+		},
+		{
+			name: "wayland session with sockets in the runtime dir",
+			vars: map[string]string{
+				"XDG_RUNTIME_DIR":          "/run/user/1000",
+				"DBUS_SESSION_BUS_ADDRESS": "unix:path=/run/user/1000/bus",
+				"WAYLAND_DISPLAY":          "wayland-0",
+			},
+			want: toolchainPaths{Allow: []string{"/run/user/1000"}},
+		},
+		{
+			name: "x11 session with a bus outside the runtime dir",
+			vars: map[string]string{
+				"XDG_RUNTIME_DIR":          "/run/user/1000/",
+				"DBUS_SESSION_BUS_ADDRESS": "unix:abstract=/tmp/dbus-x;unix:path=/tmp/dbus-session,guid=abc",
+				"DISPLAY":                  ":1.0",
+			},
+			want: toolchainPaths{
+				Allow: []string{"/run/user/1000", "/tmp/dbus-session", "/tmp/.X11-unix/X1"},
+				Read:  []string{"/home/me/.Xauthority"},
+			},
+		},
+		{
+			name: "absolute wayland socket and xauthority from env",
+			vars: map[string]string{
+				"WAYLAND_DISPLAY": "/tmp/wayland-1",
+				"DISPLAY":         "unix:0",
+				"XAUTHORITY":      "/run/gdm/xauth",
+			},
+			want: toolchainPaths{
+				Allow: []string{"/tmp/wayland-1", "/tmp/.X11-unix/X0"},
+				Read:  []string{"/run/gdm/xauth"},
+			},
+		},
+		{
+			name: "remote display has no socket",
+			vars: map[string]string{"DISPLAY": "remote.example.com:0"},
+		},
+		{
+			name:    "relative wayland socket without runtime dir",
+			vars:    map[string]string{"WAYLAND_DISPLAY": "wayland-0"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := toolchainEnv{goos: "linux", home: "/home/me", getenv: mockEnv(tt.vars)}
+			got, err := desktopPaths(env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("desktopPaths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("desktopPaths() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDesktopPathsDarwin(t *testing.T) {
+	env := toolchainEnv{goos: "darwin", home: "/Users/me", getenv: mockEnv(map[string]string{"DISPLAY": ":0"})}
+	got, err := desktopPaths(env)
+	if !errors.Is(err, errDesktopUnsupported) {
+		t.Errorf("desktopPaths() error = %v, want errDesktopUnsupported", err)
+	}
+	if len(got.Allow) != 0 || len(got.Read) != 0 {
+		t.Errorf("desktopPaths() = %+v, want no paths", got)
+	}
+}
+
+func TestX11SocketPath(t *testing.T) {
+	tests := []struct {
+		display string
+		want    string
+		ok      bool
+	}{
+		{":0", "/tmp/.X11-unix/X0", true},
+		{":10.1", "/tmp/.X11-unix/X10", true},
+		{"unix:2", "/tmp/.X11-unix/X2", true},
+		{"localhost:10.0", "", false},
+		{":", "", false},
+		{":abc", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := x11SocketPath(tt.display)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("x11SocketPath(%q) = %q, %v; want %q, %v", tt.display, got, ok, tt.want, tt.ok)
+		}
+	}
+}
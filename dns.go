@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// dnsConfigFiles are the name-resolution and service databases read by libc and
+// Go's resolver; --allow-dns grants read access to the ones that exist
+var dnsConfigFiles = map[string][]string{
+	"darwin": {
+		"/etc/resolv.conf",
+		"/etc/hosts",
+		"/etc/services",
+		"/etc/protocols",
+	},
+	"linux": {
+		"/etc/resolv.conf",
+		"/etc/hosts",
+		"/etc/nsswitch.conf",
+		"/etc/host.conf",
+		"/etc/gai.conf",
+		"/etc/services",
+		"/etc/protocols",
+	},
+}
+
+// nssLibraryPatterns match glibc's NSS modules, which are loaded at run time
+// according to /etc/nsswitch.conf rather than linked into the binary (Linux only)
+var nssLibraryPatterns = []string{
+	"/lib/libnss_*",
+	"/lib/*/libnss_*",
+	"/lib64/libnss_*",
+	"/usr/lib/libnss_*",
+	"/usr/lib/*/libnss_*",
+	"/usr/lib64/libnss_*",
+}
+
+// dnsReadPaths returns the existing files needed for DNS resolution on goos
+func dnsReadPaths(goos string) []string {
+	var paths []string
+	for _, path := range dnsConfigFiles[goos] {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+
+	if goos == "linux" {
+		for _, pattern := range nssLibraryPatterns {
+			matches, _ := filepath.Glob(pattern)
+			paths = append(paths, matches...)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDNSReadPaths(t *testing.T) {
+	if paths := dnsReadPaths("plan9"); len(paths) != 0 {
+		t.Errorf("expected no DNS paths for an unsupported platform, got %v", paths)
+	}
+
+	for _, goos := range []string{"darwin", "linux"} {
+		for _, path := range dnsReadPaths(goos) {
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("dnsReadPaths(%q) returned missing path %s", goos, path)
+			}
+		}
+	}
+
+	for _, path := range dnsReadPaths("darwin") {
+		if strings.Contains(path, "libnss_") {
+			t.Errorf("NSS modules should only be added on Linux, got %s", path)
+		}
+	}
+}
+
+func TestMergePresetsAllowDNS(t *testing.T) {
+	dst := &Preset{}
+	mergePresets(dst, &Preset{AllowDNS: true})
+	mergePresets(dst, &Preset{})
+	if !dst.AllowDNS {
+		t.Error("allow-dns should be inherited from a parent preset")
+	}
+}
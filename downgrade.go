@@ -0,0 +1,33 @@
+package main
+
+// downgradeWrites implements --downgrade-writes: every write allow becomes a
+// read allow, so the command sees the same paths but can write none of them.
+// Denies are kept. It returns the new rules and the write allows it downgraded.
+func downgradeWrites(writeRules, readRules []ResolvedRule) (newWrite, newRead, downgraded []ResolvedRule) {
+	readAllowed := make(map[string]bool)
+	for _, rule := range readRules {
+		if rule.Action == ActionAllow {
+			readAllowed[rule.Path] = true
+		}
+	}
+
+	newWrite = []ResolvedRule{}
+	newRead = append([]ResolvedRule{}, readRules...)
+	for _, rule := range writeRules {
+		if rule.Action != ActionAllow {
+			newWrite = append(newWrite, rule)
+			continue
+		}
+		downgraded = append(downgraded, rule)
+		if readAllowed[rule.Path] {
+			continue
+		}
+		readAllowed[rule.Path] = true
+		read := rule
+		read.Mode = AccessRead
+		read.Append = false
+		newRead = append(newRead, read)
+	}
+	sortRulesBySpecificity(newRead)
+	return newWrite, newRead, downgraded
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDowngradeWrites(t *testing.T) {
+	resolver := NewRuleResolver()
+	cli := RuleSource{Origin: OriginCLI}
+	resolver.AddAllowRule("/work", cli)
+	resolver.AddReadRule("/work", cli)
+	resolver.AddAppendRule("/var/log/app", cli)
+	resolver.AddOutputRule("/tmp/out.log", cli)
+	resolver.AddReadRule("/docs", cli)
+	resolver.AddDenyRule("/work/secret", nil, RuleSource{PresetName: "dev"})
+	writeRules, readRules, _ := resolver.Resolve()
+
+	newWrite, newRead, downgraded := downgradeWrites(writeRules, readRules)
+
+	if len(newWrite) != 1 || newWrite[0].Path != "/work/secret" || newWrite[0].Action != ActionDeny {
+		t.Errorf("expected only the deny to stay a write rule, got %+v", newWrite)
+	}
+	if len(downgraded) != 3 {
+		t.Errorf("expected 3 downgraded allows, got %+v", downgraded)
+	}
+
+	var paths []string
+	for _, rule := range newRead {
+		paths = append(paths, rule.Path)
+		if rule.Action != ActionAllow || rule.Mode != AccessRead || rule.Append {
+			t.Errorf("expected a plain read allow, got %+v", rule)
+		}
+		if rule.Path == "/tmp/out.log" && !rule.IsFile {
+			t.Errorf("output file should stay a single-file rule, got %+v", rule)
+		}
+	}
+	want := []string{"/docs", "/tmp/out.log", "/var/log/app", "/work"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("read rules = %v, want %v", paths, want)
+	}
+}
@@ -2,14 +2,252 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
-// printDryRunAndExit displays the dry-run information and exits
-func printDryRunAndExit(config *SandboxConfig) {
+// printDryRunAndExit displays the dry-run information and exits, with status 2
+// after reporting problems found by --dry-run-strict
+func printDryRunAndExit(config *SandboxConfig, problems []string) {
 	if err := showDryRun(config); err != nil {
-		fmt.Fprintf(os.Stderr, "cage: error showing dry-run: %v\n", err)
+		logger.Errorf("error showing dry-run: %v", err)
 		os.Exit(1)
 	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			logger.logf(LogWarn, "cage: dry-run: ", "%s", problem)
+		}
+		os.Exit(2)
+	}
 	os.Exit(0)
 }
+
+// dryRunProblems lists what --dry-run-strict at level treats as a problem: rule
+// conflicts for "conflicts", and for "all" also the lint findings and allow
+// paths that do not exist
+func dryRunProblems(level string, config *SandboxConfig, findings []LintFinding) []string {
+	var problems []string
+	conflicts := append([]RuleConflict(nil), config.Conflicts...)
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	for _, conflict := range conflicts {
+		winner := conflict.Resolution
+		problems = append(problems, fmt.Sprintf("%s: conflicting rules, %s from %s wins (%s)",
+			conflict.Path, winner.Action, formatRuleSource(winner), conflictReason(conflict)))
+	}
+	if level != "all" {
+		return problems
+	}
+
+	for _, finding := range findings {
+		if finding.Heuristic {
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%s: %s", finding.Path, finding.Message))
+	}
+	for _, rules := range [][]ResolvedRule{config.WriteRules, config.ReadRules} {
+		for _, rule := range rules {
+			// Output files are created by the command, so they may not exist yet
+			if rule.Action != ActionAllow || rule.IsGlob || rule.IsFile {
+				continue
+			}
+			if _, err := os.Stat(rule.Path); os.IsNotExist(err) {
+				problems = append(problems, fmt.Sprintf("%s: allow path does not exist (from %s)", rule.Path, formatRuleSource(rule)))
+			}
+		}
+	}
+	return problems
+}
+
+func formatRuleSource(rule ResolvedRule) string {
+	if rule.Source.Reason != "" {
+		source := rule.Source
+		source.Reason = ""
+		return formatRuleSource(ResolvedRule{Source: source}) + " # " + rule.Source.Reason
+	}
+	if rule.Source.IsCLI() {
+		return "CLI flag"
+	}
+	if rule.Source.PresetName != "" {
+		switch rule.Source.Origin {
+		case OriginAutoPreset:
+			return rule.Source.PresetName + " (auto)"
+		case OriginDefaultPreset:
+			return rule.Source.PresetName + " (default)"
+		}
+		return rule.Source.PresetName
+	}
+	return "preset"
+}
+
+// formatRulePath returns the rule's path, preceded by the path as given when
+// cleanPath changed it (e.g. "./build → /work/build")
+func formatRulePath(rule ResolvedRule) string {
+	if rule.Original == "" || rule.Original == rule.Path {
+		return rule.Path
+	}
+	return rule.Original + " → " + rule.Path
+}
+
+// dryRunEntry is one allow line of the dry-run listing: the rule, its displayed
+// path and the text after the path
+type dryRunEntry struct {
+	Rule   ResolvedRule
+	Path   string
+	Detail string
+}
+
+// allowEntries returns the dry-run lines for the allow rules, with sibling paths
+// collapsed when collapse is set
+func allowEntries(rules []ResolvedRule, detail func(ResolvedRule) string, collapse bool) []dryRunEntry {
+	var entries []dryRunEntry
+	for _, rule := range rules {
+		if rule.Action == ActionAllow {
+			entries = append(entries, dryRunEntry{Rule: rule, Path: formatRulePath(rule), Detail: detail(rule)})
+		}
+	}
+	if collapse {
+		entries = collapseEntries(entries)
+	}
+	return entries
+}
+
+// collapseEntries merges sibling paths with the same detail into one brace
+// pattern at the position of the first, e.g. /work/{a,b,c} for /work/a,
+// /work/b and /work/c (--collapse). Globs, renamed paths and names with brace
+// characters are left as they are, so the pattern expands back to the paths.
+func collapseEntries(entries []dryRunEntry) []dryRunEntry {
+	type groupKey struct{ parent, detail string }
+	collapsible := func(entry dryRunEntry) bool {
+		return !entry.Rule.IsGlob && entry.Path == entry.Rule.Path &&
+			entry.Path != "/" && !strings.ContainsAny(entry.Path, "{},")
+	}
+
+	names := make(map[groupKey][]string)
+	for _, entry := range entries {
+		if collapsible(entry) {
+			key := groupKey{filepath.Dir(entry.Path), entry.Detail}
+			names[key] = append(names[key], filepath.Base(entry.Path))
+		}
+	}
+
+	var result []dryRunEntry
+	done := make(map[groupKey]bool)
+	for _, entry := range entries {
+		if !collapsible(entry) {
+			result = append(result, entry)
+			continue
+		}
+		key := groupKey{filepath.Dir(entry.Path), entry.Detail}
+		if done[key] {
+			continue
+		}
+		done[key] = true
+		if siblings := names[key]; len(siblings) > 1 {
+			entry.Path = filepath.Join(key.parent, "{"+strings.Join(siblings, ",")+"}")
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+// canonicalizedRules returns the rules whose path was changed by cleanPath
+func canonicalizedRules(writeRules, readRules []ResolvedRule) []ResolvedRule {
+	var result []ResolvedRule
+	for _, rules := range [][]ResolvedRule{writeRules, readRules} {
+		for _, rule := range rules {
+			if rule.Original != "" && rule.Original != rule.Path {
+				result = append(result, rule)
+			}
+		}
+	}
+	return result
+}
+
+// printConflicts prints the dry-run conflict section: counts by type, then the
+// conflicts sorted by path, at most max of them in detail (0 lists all)
+func printConflicts(w io.Writer, conflicts []RuleConflict, max int) {
+	if len(conflicts) == 0 {
+		return
+	}
+
+	sorted := make([]RuleConflict, len(conflicts))
+	copy(sorted, conflicts)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+	samePreset := 0
+	for _, conflict := range sorted {
+		if conflict.IsSamePreset {
+			samePreset++
+		}
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Rule Conflicts:")
+	fmt.Fprintln(w, "----------------------------------------")
+	fmt.Fprintf(w, "%d conflicts (%d cross-preset, %d intra-preset)\n", len(sorted), len(sorted)-samePreset, samePreset)
+	shown := sorted
+	if max > 0 && len(sorted) > max {
+		shown = sorted[:max]
+		fmt.Fprintf(w, "Showing the first %d by path (use --max-conflicts to change, --preview -o json for the full list)\n", max)
+	}
+	fmt.Fprintln(w)
+
+	for _, conflict := range shown {
+		conflictType := "Cross-preset"
+		if conflict.IsSamePreset {
+			conflictType = "Intra-preset"
+		}
+		fmt.Fprintf(w, "%s conflict for path: %s\n", conflictType, conflict.Path)
+		fmt.Fprintln(w, "  Conflicting rules:")
+		for _, rule := range conflict.Rules {
+			actionStr := "allow"
+			if rule.Action == ActionDeny {
+				actionStr = "deny"
+			}
+			fmt.Fprintf(w, "    - %s %s (%s) from %s\n", actionStr, rule.Path, rule.Mode.String(), formatRuleSource(rule))
+		}
+		actionStr := "allow"
+		if conflict.Resolution.Action == ActionDeny {
+			actionStr = "deny"
+		}
+		fmt.Fprintf(w, "  Resolution: %s from %s (CLI > preset > auto > default, higher priority, allow > deny, specific > general)\n", actionStr, formatRuleSource(conflict.Resolution))
+		fmt.Fprintln(w)
+	}
+	if hidden := len(sorted) - len(shown); hidden > 0 {
+		fmt.Fprintf(w, "... and %d more\n", hidden)
+	}
+}
+
+// secretEnvMarkers are name fragments of variables whose values --mask-env hides
+var secretEnvMarkers = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "API_KEY", "PRIVATE_KEY", "ACCESS_KEY", "AUTH"}
+
+// isSecretEnvName reports whether an environment variable name looks like it
+// holds a secret
+func isSecretEnvName(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, marker := range secretEnvMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// printChildEnv writes the environment the command receives for --print-env,
+// sorted by name; mask hides the values of variables that look like secrets
+func printChildEnv(w io.Writer, env []string, mask bool) {
+	sorted := append([]string(nil), env...)
+	sort.Strings(sorted)
+	fmt.Fprintf(w, "Child environment (%d variables):\n", len(sorted))
+	for _, entry := range sorted {
+		name, value, _ := strings.Cut(entry, "=")
+		if mask && value != "" && isSecretEnvName(name) {
+			value = "****"
+		}
+		fmt.Fprintf(w, "  %s=%s\n", name, value)
+	}
+}
@@ -3,11 +3,33 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"strings"
 )
 
+// printProfileCheck compiles the profile with sandbox-exec and prints the outcome
+// A profile that compiled but keeps /usr/bin/true from running still passes
+func printProfileCheck(profile string) error {
+	err := checkSandboxProfile(profile)
+	switch {
+	case errors.Is(err, errProfileNotRun):
+		fmt.Printf("Profile check: OK (%v)\n", err)
+	case err != nil:
+		fmt.Println("Profile check: FAILED")
+		return err
+	default:
+		fmt.Println("Profile check: OK (compiled by sandbox-exec)")
+	}
+	return nil
+}
+
 func showDryRun(config *SandboxConfig) error {
+	if config.ProfileFile != "" {
+		return showProfileFileDryRun(config)
+	}
+
 	fmt.Println("Sandbox Profile (dry-run):")
 	fmt.Println("========================================")
 	fmt.Println("Version: macOS Sandbox v1")
@@ -21,28 +43,59 @@ func showDryRun(config *SandboxConfig) error {
 		fmt.Println("- Allow all operations by default")
 		fmt.Println("- Deny all file writes")
 		fmt.Println("- Allow writes to:")
-		fmt.Println("  * System temporary directories")
+		if !config.NoDefaultTmp {
+			fmt.Println("  * System temporary directories")
+		}
 
 		if config.AllowKeychain {
 			fmt.Println("  * Keychain directories (-allow-keychain)")
+		} else {
+			for _, name := range config.KeychainFiles {
+				fmt.Printf("  * Keychain %s (--allow-keychain-file)\n", name)
+			}
+		}
+
+		if config.AllowPTY {
+			fmt.Println("  * Pseudo-terminal devices (-allow-pty)")
+		}
+
+		if len(config.TTYDevices) > 0 {
+			fmt.Printf("  * Controlling terminal: %s (disable with --no-tty)\n", strings.Join(config.TTYDevices, ", "))
+		}
+
+		for _, socket := range config.ConnectSockets {
+			fmt.Printf("  * Connect to Unix socket %s (--allow-connect)\n", socket)
 		}
 
 		// Show write allow rules
-		for _, rule := range config.WriteRules {
-			if rule.Action == ActionAllow {
-				fmt.Printf("  * %s (%s)\n", rule.Path, formatRuleSource(rule))
+		writeDetail := func(rule ResolvedRule) string {
+			fileNote := ""
+			if rule.IsFile {
+				fileNote = " [output file]"
+			}
+			if rule.Append {
+				fileNote = " [append only]"
+			}
+			if rule.Mode == AccessReadWrite {
+				fileNote += " [read+write]"
 			}
+			return fmt.Sprintf(" (%s)%s", formatRuleSource(rule), fileNote)
+		}
+		for _, entry := range allowEntries(config.WriteRules, writeDetail, config.Collapse) {
+			fmt.Printf("  * %s%s\n", entry.Path, entry.Detail)
 		}
 
 		if config.Strict {
 			fmt.Println()
 			fmt.Println("- STRICT MODE: Deny all file reads by default")
 			fmt.Println("- Allow reads to:")
+			if !config.NoDefaultTmp {
+				fmt.Println("  * System temporary directories")
+			}
 
-			for _, rule := range config.ReadRules {
-				if rule.Action == ActionAllow {
-					fmt.Printf("  * %s (%s)\n", rule.Path, formatRuleSource(rule))
-				}
+			readDetail := func(rule ResolvedRule) string { return " (" + formatRuleSource(rule) + ")" }
+			for _, entry := range allowEntries(config.ReadRules, readDetail, config.Collapse) {
+				fmt.Printf("  * %s%s\n", entry.Path, entry.Detail)
 			}
 		}
 
@@ -73,44 +126,43 @@ func showDryRun(config *SandboxConfig) error {
 		}
 	}
 
-	// Show conflicts if any
-	if len(config.Conflicts) > 0 {
-		fmt.Println()
-		fmt.Println("Rule Conflicts:")
-		fmt.Println("----------------------------------------")
-		for _, conflict := range config.Conflicts {
-			conflictType := "Cross-preset"
-			if conflict.IsSamePreset {
-				conflictType = "Intra-preset"
-			}
-			fmt.Printf("%s conflict for path: %s\n", conflictType, conflict.Path)
-			fmt.Println("  Conflicting rules:")
-			for _, rule := range conflict.Rules {
-				actionStr := "allow"
-				if rule.Action == ActionDeny {
-					actionStr = "deny"
-				}
-				fmt.Printf("    - %s %s (%s) from %s\n", actionStr, rule.Path, formatAccessMode(rule.Mode), formatRuleSource(rule))
-			}
-			actionStr := "allow"
-			if conflict.Resolution.Action == ActionDeny {
-				actionStr = "deny"
-			}
-			fmt.Printf("  Resolution: %s from %s (CLI > preset, allow > deny, specific > general)\n", actionStr, formatRuleSource(conflict.Resolution))
-			fmt.Println()
-		}
-	}
-
-	fmt.Println()
-	fmt.Println("Raw profile:")
-	fmt.Println("----------------------------------------")
+	printConflicts(os.Stdout, config.Conflicts, config.MaxConflicts)
 
 	profile, err := generateSandboxProfile(config)
 	if err != nil {
 		return fmt.Errorf("generate sandbox profile: %w", err)
 	}
-	fmt.Print(profile)
-	fmt.Println("----------------------------------------")
+	fmt.Println()
+	if !config.SummaryOnly {
+		fmt.Println("Raw profile:")
+		fmt.Println("----------------------------------------")
+		fmt.Print(profile)
+		fmt.Println("----------------------------------------")
+	}
+
+	if config.ProfileLint {
+		printProfileLint(os.Stdout, lintSandboxProfile(profile))
+	}
+
+	if err := printProfileCheck(profile); err != nil {
+		return err
+	}
+
+	if config.PrintEnv {
+		fmt.Println()
+		printChildEnv(os.Stdout, commandEnv(os.Environ(), config.Env), config.MaskEnv)
+	} else if len(config.Env) > 0 {
+		fmt.Println()
+		fmt.Println("Environment:")
+		for _, entry := range commandEnv(nil, config.Env) {
+			fmt.Printf("  %s\n", entry)
+		}
+	}
+
+	if !config.Limits.IsZero() {
+		fmt.Println()
+		fmt.Printf("Resource limits: %s\n", config.Limits)
+	}
 
 	fmt.Println()
 	fmt.Printf("Command: %s", config.Command)
@@ -122,27 +174,34 @@ func showDryRun(config *SandboxConfig) error {
 	return nil
 }
 
-func formatRuleSource(rule ResolvedRule) string {
-	if rule.Source.IsCLI {
-		return "CLI flag"
+// showProfileFileDryRun prints and checks a prebuilt profile given with --profile-file
+func showProfileFileDryRun(config *SandboxConfig) error {
+	profile, err := os.ReadFile(config.ProfileFile)
+	if err != nil {
+		return fmt.Errorf("read profile file: %w", err)
 	}
-	if rule.Source.PresetName != "" {
-		return rule.Source.PresetName
+
+	fmt.Println("Sandbox Profile (dry-run):")
+	fmt.Println("========================================")
+	fmt.Printf("Profile file: %s (rule generation disabled)\n", config.ProfileFile)
+	fmt.Println()
+	fmt.Println("Raw profile:")
+	fmt.Println("----------------------------------------")
+	fmt.Print(string(profile))
+	fmt.Println("----------------------------------------")
+
+	if err := printProfileCheck(string(profile)); err != nil {
+		return err
 	}
-	return "preset"
-}
 
-func formatAccessMode(mode AccessMode) string {
-	switch mode {
-	case AccessRead:
-		return "read"
-	case AccessWrite:
-		return "write"
-	case AccessReadWrite:
-		return "read+write"
-	default:
-		return "unknown"
+	fmt.Println()
+	fmt.Printf("Command: %s", config.Command)
+	if len(config.Args) > 0 {
+		fmt.Printf(" %s", strings.Join(config.Args, " "))
 	}
+	fmt.Println()
+
+	return nil
 }
 
 func printDenyRule(rule ResolvedRule) {
@@ -150,7 +209,10 @@ func printDenyRule(rule ResolvedRule) {
 	if rule.IsGlob {
 		globNote = " (glob pattern)"
 	}
-	fmt.Printf("  * %s (%s)%s - from %s\n", rule.Path, formatAccessMode(rule.Mode), globNote, formatRuleSource(rule))
+	if rule.FileLevel {
+		globNote += " (direct entries only)"
+	}
+	fmt.Printf("  * %s (%s)%s - from %s\n", formatRulePath(rule), rule.Mode.String(), globNote, formatRuleSource(rule))
 	for _, exc := range rule.Except {
 		fmt.Printf("    except: %s\n", exc)
 	}
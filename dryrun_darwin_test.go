@@ -61,3 +61,35 @@ func TestDryRunDisplayShowsDuplicate(t *testing.T) {
 		t.Errorf("Deny rule should appear once in summary (currently fails - BUG), got %d", denyRuleCount)
 	}
 }
+
+func TestDryRunSummaryOnlyOmitsRawProfile(t *testing.T) {
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: "/Users/test/project", Action: ActionAllow, Mode: AccessWrite, Source: RuleSource{Origin: OriginCLI}},
+		},
+		SummaryOnly: true,
+		Command:     "test",
+	}
+
+	var buf bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := showDryRun(config)
+
+	w.Close()
+	os.Stdout = oldStdout
+	io.Copy(&buf, r)
+
+	if err != nil {
+		t.Fatalf("showDryRun failed: %v", err)
+	}
+	output := buf.String()
+	if strings.Contains(output, "Raw profile:") || strings.Contains(output, "(version 1)") {
+		t.Errorf("--summary-only should omit the raw profile, got:\n%s", output)
+	}
+	if !strings.Contains(output, "/Users/test/project") {
+		t.Errorf("--summary-only should keep the rule summary, got:\n%s", output)
+	}
+}
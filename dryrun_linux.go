@@ -4,18 +4,35 @@ package main
 
 import (
 	"fmt"
-	"path/filepath"
+	"os"
 	"strings"
+
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
 )
 
 func showDryRun(config *SandboxConfig) error {
+	if config.ProfileFile != "" {
+		return errProfileFileUnsupported
+	}
+
 	fmt.Println("Sandbox Profile (dry-run):")
 	fmt.Println("========================================")
-	fmt.Println("Platform: Linux")
-	fmt.Println("Technology: Landlock LSM")
-	fmt.Println()
-	fmt.Println("The following restrictions would be applied:")
+	// There is no raw profile on Linux; the summary leaves out the Landlock details
+	kernelABI, _ := ll.LandlockGetABIVersion()
+	effectiveABI, abiErr := checkLandlockABI(kernelABI, config.RequireLandlockABI)
+	if !config.SummaryOnly {
+		fmt.Println("Platform: Linux")
+		fmt.Println("Technology: Landlock LSM")
+		fmt.Printf("Landlock ABI: v%d (kernel supports v%d)\n", effectiveABI, kernelABI)
+	}
+	if abiErr != nil {
+		fmt.Printf("WARNING: %v\n", abiErr)
+	}
 	fmt.Println()
+	if !config.SummaryOnly {
+		fmt.Println("The following restrictions would be applied:")
+		fmt.Println()
+	}
 	fmt.Println("Rules:")
 
 	if config.AllowAll {
@@ -25,37 +42,58 @@ func showDryRun(config *SandboxConfig) error {
 			fmt.Println("- STRICT MODE: Only explicit read paths are allowed")
 			fmt.Println("- Allow read access to:")
 
-			for _, rule := range config.ReadRules {
-				if rule.Action == ActionAllow {
-					absPath, err := filepath.Abs(rule.Path)
-					if err != nil {
-						absPath = rule.Path
-					}
-					fmt.Printf("  * %s\n", absPath)
-				}
+			noDetail := func(ResolvedRule) string { return "" }
+			for _, entry := range allowEntries(config.ReadRules, noDetail, config.Collapse) {
+				fmt.Printf("  * %s\n", entry.Path)
+				printGlobMatches(entry.Rule)
 			}
 		} else {
 			fmt.Println("- Allow read access to all files")
 		}
 
+		if len(config.ConnectSockets) > 0 {
+			fmt.Println("- Allow connecting to Unix sockets (read_file only, no write access):")
+			for _, socket := range config.ConnectSockets {
+				fmt.Printf("  * %s\n", socket)
+			}
+		}
+
 		fmt.Println("- Deny write access except to:")
 		fmt.Println("  * /dev/null (for discarding output)")
 
-		for _, rule := range config.WriteRules {
-			if rule.Action == ActionAllow {
-				absPath, err := filepath.Abs(rule.Path)
-				if err != nil {
-					absPath = rule.Path
-				}
-				// Determine the source of the rule
-				source := "user specified"
-				if rule.Source.IsCLI {
-					source = "command line"
-				} else if rule.Source.PresetName != "" {
-					source = rule.Source.PresetName
-				}
-				fmt.Printf("  * %s (%s)\n", absPath, source)
+		if config.AllowPTY {
+			fmt.Println("  * /dev/ptmx, /dev/tty, /dev/pts (pseudo-terminals)")
+		}
+
+		if len(config.TTYDevices) > 0 {
+			fmt.Printf("  * %s (controlling terminal, disable with --no-tty)\n", strings.Join(config.TTYDevices, ", "))
+		}
+
+		writeDetail := func(rule ResolvedRule) string {
+			// Determine the source of the rule
+			source := "user specified"
+			if rule.Source.IsCLI() {
+				source = "command line"
+			} else if rule.Source.PresetName != "" {
+				source = rule.Source.PresetName
+			}
+			if rule.IsFile {
+				source += ", output file"
 			}
+			if rule.Append {
+				source += ", append only"
+			}
+			if rule.Mode == AccessReadWrite {
+				source += ", read+write"
+			}
+			if rule.Source.Reason != "" {
+				source += " # " + rule.Source.Reason
+			}
+			return " (" + source + ")"
+		}
+		for _, entry := range allowEntries(config.WriteRules, writeDetail, config.Collapse) {
+			fmt.Printf("  * %s%s\n", entry.Path, entry.Detail)
+			printGlobMatches(entry.Rule)
 		}
 
 		// Collect all deny rules from both read and write rules
@@ -75,32 +113,46 @@ func showDryRun(config *SandboxConfig) error {
 			fmt.Println()
 			fmt.Println("- Deny rules:")
 			for _, rule := range denyRules {
-				modeStr := ""
-				switch rule.Mode {
-				case AccessRead:
-					modeStr = "read"
-				case AccessWrite:
-					modeStr = "write"
-				case AccessReadWrite:
-					modeStr = "read+write"
-				}
-				absPath, err := filepath.Abs(rule.Path)
-				if err != nil {
-					absPath = rule.Path
-				}
 				note := ""
-				if rule.Mode&AccessRead != 0 {
+				if rule.FileLevel {
+					note = " (WARNING: file-level deny not supported on Linux, ignored)"
+				} else if rule.Mode&AccessRead != 0 {
 					if rule.IsGlob {
 						note = " (WARNING: glob patterns not supported on Linux)"
 					} else {
 						note = " (WARNING: read deny only effective with --strict on Linux)"
 					}
+				} else if _, inside := enclosingWriteAllow(rule.Path, config.WriteRules); inside && !rule.IsGlob {
+					note = " (WARNING: write deny inside an allowed directory not enforced on Linux)"
 				}
-				fmt.Printf("  * %s (%s)%s\n", absPath, modeStr, note)
+				fmt.Printf("  * %s (%s)%s - from %s\n", formatRulePath(rule), rule.Mode, note, formatRuleSource(rule))
 			}
 		}
 	}
 
+	if !config.AllowAll && !config.AllowNewPrivs {
+		fmt.Println()
+		fmt.Println("- No new privileges: setuid/setgid binaries and file capabilities grant nothing (disable with --allow-new-privs)")
+	}
+
+	printConflicts(os.Stdout, config.Conflicts, config.MaxConflicts)
+
+	if config.PrintEnv {
+		fmt.Println()
+		printChildEnv(os.Stdout, commandEnv(os.Environ(), config.Env), config.MaskEnv)
+	} else if len(config.Env) > 0 {
+		fmt.Println()
+		fmt.Println("Environment:")
+		for _, entry := range commandEnv(nil, config.Env) {
+			fmt.Printf("  %s\n", entry)
+		}
+	}
+
+	if !config.Limits.IsZero() {
+		fmt.Println()
+		fmt.Printf("Resource limits: %s\n", config.Limits)
+	}
+
 	fmt.Println()
 	fmt.Printf("Command: %s", config.Command)
 	if len(config.Args) > 0 {
@@ -110,3 +162,17 @@ func showDryRun(config *SandboxConfig) error {
 
 	return nil
 }
+
+// printGlobMatches lists the paths a glob allow matches at launch
+func printGlobMatches(rule ResolvedRule) {
+	if !rule.IsGlob {
+		return
+	}
+	matches := rulePaths(rule, false)
+	if len(matches) == 0 {
+		fmt.Println("    (glob matches nothing)")
+	}
+	for _, match := range matches {
+		fmt.Printf("    - %s\n", match)
+	}
+}
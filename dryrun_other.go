@@ -14,9 +14,9 @@ func showDryRun(config *SandboxConfig) error {
 }
 
 // printDryRunAndExit displays the dry-run information and exits
-func printDryRunAndExit(config *SandboxConfig) {
+func printDryRunAndExit(config *SandboxConfig, problems []string) {
 	if err := showDryRun(config); err != nil {
-		fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+		logger.Errorf("%v", err)
 		os.Exit(1)
 	}
 	os.Exit(0)
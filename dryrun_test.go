@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPrintConflictsSummarizesAboveMax(t *testing.T) {
+	var conflicts []RuleConflict
+	for i := 9; i >= 0; i-- {
+		path := fmt.Sprintf("/work/dir%d", i)
+		conflicts = append(conflicts, RuleConflict{
+			Path:         path,
+			Rules:        []ResolvedRule{{Path: path, Action: ActionAllow}, {Path: path, Action: ActionDeny}},
+			Resolution:   ResolvedRule{Path: path, Action: ActionAllow},
+			IsSamePreset: i%2 == 0,
+		})
+	}
+
+	var buf strings.Builder
+	printConflicts(&buf, conflicts, 3)
+	output := buf.String()
+
+	if !strings.Contains(output, "10 conflicts (5 cross-preset, 5 intra-preset)") {
+		t.Errorf("expected counts by type, got:\n%s", output)
+	}
+	if got := strings.Count(output, "conflict for path:"); got != 3 {
+		t.Errorf("expected 3 conflicts in detail, got %d:\n%s", got, output)
+	}
+	for _, path := range []string{"/work/dir0", "/work/dir1", "/work/dir2"} {
+		if !strings.Contains(output, "conflict for path: "+path+"\n") {
+			t.Errorf("expected %s among the first conflicts by path, got:\n%s", path, output)
+		}
+	}
+	if strings.Contains(output, "/work/dir3") {
+		t.Errorf("conflicts beyond --max-conflicts should not be listed, got:\n%s", output)
+	}
+	if !strings.Contains(output, "... and 7 more") {
+		t.Errorf("expected the number of hidden conflicts, got:\n%s", output)
+	}
+
+	buf.Reset()
+	printConflicts(&buf, conflicts, 0)
+	if got := strings.Count(buf.String(), "conflict for path:"); got != 10 {
+		t.Errorf("max 0 should list all conflicts, got %d", got)
+	}
+}
+
+func TestDryRunProblems(t *testing.T) {
+	dir := t.TempDir()
+	missing := dir + "/missing"
+	conflict := RuleConflict{
+		Path: dir,
+		Rules: []ResolvedRule{
+			{Path: dir, Action: ActionAllow, Source: RuleSource{PresetName: "dev"}},
+			{Path: dir, Action: ActionDeny, Source: RuleSource{PresetName: "lockdown"}},
+		},
+		Resolution: ResolvedRule{Path: dir, Action: ActionAllow, Source: RuleSource{PresetName: "dev"}},
+	}
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: dir, Action: ActionAllow},
+			{Path: missing, Action: ActionAllow, Source: RuleSource{PresetName: "dev"}},
+			{Path: dir + "/out.log", Action: ActionAllow, IsFile: true},
+		},
+		Conflicts: []RuleConflict{conflict},
+	}
+	findings := []LintFinding{{Path: "/work/*.env", Message: "glob deny is ignored"}}
+
+	problems := dryRunProblems("conflicts", config, findings)
+	if len(problems) != 1 || !strings.Contains(problems[0], "allow from dev wins (allow beats deny)") {
+		t.Errorf("conflicts level = %q, want only the conflict", problems)
+	}
+
+	problems = dryRunProblems("all", config, findings)
+	if len(problems) != 3 {
+		t.Fatalf("all level = %q, want the conflict, the finding and the missing path", problems)
+	}
+	if problems[1] != "/work/*.env: glob deny is ignored" {
+		t.Errorf("unexpected finding problem %q", problems[1])
+	}
+	if problems[2] != missing+": allow path does not exist (from dev)" {
+		t.Errorf("unexpected missing path problem %q", problems[2])
+	}
+
+	if problems := dryRunProblems("all", &SandboxConfig{}, nil); len(problems) != 0 {
+		t.Errorf("expected no problems for an empty config, got %q", problems)
+	}
+}
+
+func TestCollapseEntries(t *testing.T) {
+	entry := func(path, detail string) dryRunEntry {
+		return dryRunEntry{Rule: ResolvedRule{Path: path, Action: ActionAllow}, Path: path, Detail: detail}
+	}
+	entries := []dryRunEntry{
+		entry("/work/a", " (dev)"),
+		entry("/work/b", " (dev)"),
+		entry("/work/b/sub", " (dev)"),
+		entry("/work/c", " (dev)"),
+		entry("/work/d", " (CLI flag)"),
+		entry("/other/x", " (dev)"),
+		{Rule: ResolvedRule{Path: "/work/*.log", IsGlob: true}, Path: "/work/*.log", Detail: " (dev)"},
+	}
+
+	collapsed := collapseEntries(entries)
+	var got []string
+	for _, e := range collapsed {
+		got = append(got, e.Path+e.Detail)
+	}
+	want := []string{
+		"/work/{a,b,c} (dev)",
+		"/work/b/sub (dev)",
+		"/work/d (CLI flag)",
+		"/other/x (dev)",
+		"/work/*.log (dev)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("collapseEntries() =\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// The collapsed listing must stand for exactly the expanded paths
+	expanded := make(map[string]bool)
+	for _, e := range collapsed {
+		paths, err := expandBraces(e.Path)
+		if err != nil {
+			t.Fatalf("expandBraces(%q): %v", e.Path, err)
+		}
+		for _, path := range paths {
+			expanded[path] = true
+		}
+	}
+	if len(expanded) != len(entries) {
+		t.Errorf("collapsed listing expands to %d paths, want %d: %v", len(expanded), len(entries), expanded)
+	}
+	for _, e := range entries {
+		if !expanded[e.Path] {
+			t.Errorf("collapsed listing is missing %s", e.Path)
+		}
+	}
+}
+
+func TestPrintChildEnv(t *testing.T) {
+	base := []string{"PATH=/usr/bin", "HOME=/home/me", "GITHUB_TOKEN=ghp_secret", "NODE_ENV=development"}
+	env := commandEnv(base, map[string]string{"NODE_ENV": "test", "CAGE_PROFILE": "ci"})
+
+	var out strings.Builder
+	printChildEnv(&out, env, true)
+	got := out.String()
+
+	for _, want := range []string{
+		"Child environment (5 variables):\n",
+		"  CAGE_PROFILE=ci\n",
+		"  NODE_ENV=test\n",
+		"  GITHUB_TOKEN=****\n",
+		"  PATH=/usr/bin\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	// The overridden value and the masked secret must not leak
+	for _, unwanted := range []string{"development", "ghp_secret"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("unexpected %q in:\n%s", unwanted, got)
+		}
+	}
+	if strings.Index(got, "CAGE_PROFILE") > strings.Index(got, "PATH") {
+		t.Errorf("expected variables sorted by name:\n%s", got)
+	}
+
+	out.Reset()
+	printChildEnv(&out, env, false)
+	if !strings.Contains(out.String(), "GITHUB_TOKEN=ghp_secret") {
+		t.Errorf("expected values unmasked without --mask-env:\n%s", out.String())
+	}
+}
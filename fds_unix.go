@@ -0,0 +1,84 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// closeInheritedFDs marks every file descriptor above stderr close-on-exec so
+// descriptors cage inherited (or opened itself) do not leak into the sandbox
+//
+// Since cage execs the command in place, the child also takes over cage's own
+// process; access to other processes' /proc entries (fd, mem, environ) is
+// ptrace-checked, which Landlock already denies outside the sandbox domain.
+func closeInheritedFDs() error {
+	entries, err := os.ReadDir("/dev/fd")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil || fd <= 2 {
+			continue
+		}
+		syscall.CloseOnExec(fd)
+	}
+	return nil
+}
+
+// inheritableFDs returns the file descriptors above stderr that a command would
+// inherit through exec: those without close-on-exec, as cage sets it on its own
+func inheritableFDs() ([]int, error) {
+	entries, err := os.ReadDir("/dev/fd")
+	if err != nil {
+		return nil, err
+	}
+	var fds []int
+	for _, entry := range entries {
+		fd, err := strconv.Atoi(entry.Name())
+		if err != nil || fd <= 2 {
+			continue
+		}
+		if flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0); err == nil && flags&unix.FD_CLOEXEC == 0 {
+			fds = append(fds, fd)
+		}
+	}
+	slices.Sort(fds)
+	return fds, nil
+}
+
+// extraFiles returns the exec.Cmd ExtraFiles that pass fds to a child under the
+// same numbers. They are close-on-exec duplicates, which the caller closes once
+// the child has started, so the originals stay with their owner
+func extraFiles(fds []int) ([]*os.File, error) {
+	if len(fds) == 0 {
+		return nil, nil
+	}
+	// ExtraFiles[i] becomes descriptor 3+i; nil entries are closed in the child
+	files := make([]*os.File, slices.Max(fds)-2)
+	for _, fd := range fds {
+		dup, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 3)
+		if err != nil {
+			closeFiles(files)
+			return nil, fmt.Errorf("duplicate descriptor %d: %w", fd, err)
+		}
+		files[fd-3] = os.NewFile(uintptr(dup), "fd"+strconv.Itoa(fd))
+	}
+	return files, nil
+}
+
+// closeFiles closes the non-nil files
+func closeFiles(files []*os.File) {
+	for _, file := range files {
+		if file != nil {
+			file.Close()
+		}
+	}
+}
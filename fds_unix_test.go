@@ -0,0 +1,83 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCloseInheritedFDs(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe failed: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// Simulate an inherited descriptor without close-on-exec
+	if _, err := unix.FcntlInt(w.Fd(), syscall.F_SETFD, 0); err != nil {
+		t.Fatalf("clearing FD_CLOEXEC failed: %v", err)
+	}
+
+	if err := closeInheritedFDs(); err != nil {
+		t.Fatalf("closeInheritedFDs() error = %v", err)
+	}
+
+	flags, err := unix.FcntlInt(w.Fd(), syscall.F_GETFD, 0)
+	if err != nil {
+		t.Fatalf("F_GETFD failed: %v", err)
+	}
+	if flags&syscall.FD_CLOEXEC == 0 {
+		t.Error("expected inherited descriptor to be marked close-on-exec")
+	}
+
+	for _, fd := range []uintptr{os.Stdin.Fd(), os.Stdout.Fd(), os.Stderr.Fd()} {
+		flags, err := unix.FcntlInt(fd, syscall.F_GETFD, 0)
+		if err != nil {
+			continue
+		}
+		if flags&syscall.FD_CLOEXEC != 0 {
+			t.Errorf("standard descriptor %d should not be close-on-exec", fd)
+		}
+	}
+}
+
+func TestExtraFilesKeepsNumbers(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("os.Pipe failed: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := unix.FcntlInt(w.Fd(), syscall.F_SETFD, 0); err != nil {
+		t.Fatalf("clearing FD_CLOEXEC failed: %v", err)
+	}
+
+	// Only the descriptor without close-on-exec is inherited
+	fds, err := inheritableFDs()
+	if err != nil {
+		t.Fatalf("inheritableFDs() error = %v", err)
+	}
+	if !slices.Contains(fds, int(w.Fd())) || slices.Contains(fds, int(r.Fd())) {
+		t.Fatalf("inheritableFDs() = %v, want %d but not %d", fds, w.Fd(), r.Fd())
+	}
+
+	files, err := extraFiles([]int{int(w.Fd())})
+	if err != nil {
+		t.Fatalf("extraFiles() error = %v", err)
+	}
+	defer closeFiles(files)
+	if len(files) != int(w.Fd())-2 || files[w.Fd()-3] == nil {
+		t.Fatalf("extraFiles() = %v, want descriptor %d at index %d", files, w.Fd(), w.Fd()-3)
+	}
+	for i, file := range files[:w.Fd()-3] {
+		if file != nil {
+			t.Errorf("extraFiles()[%d] = %v, want nil", i, file)
+		}
+	}
+}
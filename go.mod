@@ -3,8 +3,11 @@ module github.com/RutgerLubbers/cage
 go 1.24.4
 
 require (
-	github.com/goccy/go-yaml v1.18.0 // indirect
-	github.com/landlock-lsm/go-landlock v0.0.0-20250303204525-1544bccde3a3 // indirect
-	golang.org/x/sys v0.26.0 // indirect
+	github.com/goccy/go-yaml v1.18.0
+	github.com/landlock-lsm/go-landlock v0.0.0-20250303204525-1544bccde3a3
+)
+
+require (
+	golang.org/x/sys v0.26.0
 	kernel.org/pub/linux/libs/security/libcap/psx v1.2.70 // indirect
 )
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// goEnvOutput runs `go env` for the given variables; tests replace it
+var goEnvOutput = func(names ...string) ([]byte, error) {
+	return exec.Command("go", append([]string{"env"}, names...)...).Output()
+}
+
+var (
+	goPathsOnce sync.Once
+	goPaths     []string
+	goPathsErr  error
+)
+
+// goToolchainPaths returns the Go build cache and module cache, asking `go env`
+// once per run
+func goToolchainPaths() ([]string, error) {
+	goPathsOnce.Do(func() {
+		goPaths, goPathsErr = lookupGoToolchainPaths()
+	})
+	return goPaths, goPathsErr
+}
+
+// lookupGoToolchainPaths resolves GOCACHE and GOMODCACHE, falling back to the
+// first GOPATH entry's pkg/mod for toolchains that leave GOMODCACHE empty
+func lookupGoToolchainPaths() ([]string, error) {
+	output, err := goEnvOutput("GOCACHE", "GOMODCACHE", "GOPATH")
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("go is not installed")
+		}
+		return nil, fmt.Errorf("go env failed: %w", err)
+	}
+
+	values := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	for len(values) < 3 {
+		values = append(values, "")
+	}
+	goCache, modCache, goPath := values[0], values[1], values[2]
+	if modCache == "" && goPath != "" {
+		modCache = filepath.Join(filepath.SplitList(goPath)[0], "pkg", "mod")
+	}
+
+	var paths []string
+	// GOCACHE=off disables the build cache
+	if goCache != "" && goCache != "off" {
+		paths = append(paths, goCache)
+	}
+	if modCache != "" {
+		paths = append(paths, modCache)
+	}
+	return paths, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLookupGoToolchainPaths(t *testing.T) {
+	orig := goEnvOutput
+	defer func() { goEnvOutput = orig }()
+
+	tests := []struct {
+		name    string
+		output  string
+		err     error
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "cache and module cache",
+			output: "/home/me/.cache/go-build\n/home/me/go/pkg/mod\n/home/me/go\n",
+			want:   []string{"/home/me/.cache/go-build", "/home/me/go/pkg/mod"},
+		},
+		{
+			name:   "module cache from GOPATH",
+			output: "/home/me/.cache/go-build\n\n/home/me/go:/opt/go\n",
+			want:   []string{"/home/me/.cache/go-build", "/home/me/go/pkg/mod"},
+		},
+		{
+			name:   "build cache off",
+			output: "off\n/home/me/go/pkg/mod\n/home/me/go\n",
+			want:   []string{"/home/me/go/pkg/mod"},
+		},
+		{
+			name:    "go not installed",
+			err:     &exec.Error{Name: "go", Err: exec.ErrNotFound},
+			wantErr: "go is not installed",
+		},
+		{
+			name:    "go env fails",
+			err:     errors.New("exit status 1"),
+			wantErr: "go env failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotNames []string
+			goEnvOutput = func(names ...string) ([]byte, error) {
+				gotNames = names
+				return []byte(tt.output), tt.err
+			}
+
+			paths, err := lookupGoToolchainPaths()
+			if !reflect.DeepEqual(gotNames, []string{"GOCACHE", "GOMODCACHE", "GOPATH"}) {
+				t.Errorf("go env called with %v", gotNames)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(paths, tt.want) {
+				t.Errorf("paths = %v, want %v", paths, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePresetsAllowGo(t *testing.T) {
+	dst := &Preset{}
+	mergePresets(dst, &Preset{AllowGo: true})
+	if !dst.AllowGo {
+		t.Error("expected AllowGo to be inherited")
+	}
+}
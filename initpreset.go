@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// presetFromFlags builds a preset equivalent to the rule flags on the command line
+// Presets given with --preset become the preset's extends list
+func presetFromFlags(f *flags) *Preset {
+	toPaths := func(paths []string) []AllowPath {
+		var result []AllowPath
+		for _, path := range paths {
+			result = append(result, AllowPath{Path: path})
+		}
+		return result
+	}
+
+	// App support directories differ per OS, so each gets an entry per platform
+	allow := toPaths(f.allowPaths)
+	for _, name := range f.appSupport {
+		for _, goos := range []string{"darwin", "linux"} {
+			for _, path := range appSupportPaths(goos, "~", name) {
+				allow = append(allow, AllowPath{Path: path, OS: goos})
+			}
+		}
+	}
+
+	deny := toPaths(f.deny)
+	for _, path := range f.denyFileLevel {
+		notRecursive := false
+		deny = append(deny, AllowPath{Path: path, Recursive: &notRecursive})
+	}
+
+	return &Preset{
+		Extends:       f.presets,
+		SkipDefaults:  f.noDefaults,
+		Strict:        f.strict,
+		Allow:         allow,
+		Read:          toPaths(append(f.allowRead, f.allowMounts...)),
+		Deny:          deny,
+		AllowKeychain: f.allowKeychain,
+		AllowGit:      f.allowGit,
+		AllowDNS:      f.allowDNS,
+		AllowGo:       f.allowGo,
+	}
+}
+
+// configFilePath returns the config file --save writes to: --config if given,
+// otherwise the first existing default location, or presets.yaml if there is none
+func configFilePath(configPath string) (string, error) {
+	if configPath != "" {
+		return configPath, nil
+	}
+	configDir, err := userConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("get config directory: %w", err)
+	}
+	candidates := []string{
+		filepath.Join(configDir, "cage", "presets.yaml"),
+		filepath.Join(configDir, "cage", "presets.yml"),
+	}
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return candidates[0], nil
+}
+
+// savePreset adds the preset to the config file at path, keeping existing content and comments
+// It refuses to overwrite a preset that already exists
+func savePreset(path, name string, p *Preset) error {
+	var snippet bytes.Buffer
+	writePresetYAML(&snippet, name, p, nil)
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("create config directory: %w", err)
+		}
+		return os.WriteFile(path, snippet.Bytes(), 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("read config: %w", err)
+	}
+
+	var config Config
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	if _, exists := config.Presets[name]; exists {
+		return fmt.Errorf("preset %q already exists in %s", name, path)
+	}
+
+	file, err := parser.ParseBytes(data, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("parse config %s: %w", path, err)
+	}
+	presetsPath, err := yaml.PathString("$.presets")
+	if err != nil {
+		return err
+	}
+	presets, err := presetsPath.FilterFile(file)
+	if err != nil {
+		// No presets section yet: the snippet starts one
+		if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+			data = append(data, '\n')
+		}
+		return os.WriteFile(path, append(data, snippet.Bytes()...), 0o644)
+	}
+
+	// Merge the preset (the snippet without its "presets:" line) into the existing section
+	lines := strings.Split(strings.TrimSuffix(snippet.String(), "\n"), "\n")
+	var entry strings.Builder
+	for _, line := range lines[1:] {
+		entry.WriteString(strings.TrimPrefix(line, "  "))
+		entry.WriteString("\n")
+	}
+
+	// An empty section ("presets:" or "presets: {}") has no block mapping to merge into
+	if mapping, ok := presets.(*ast.MappingNode); !ok || (mapping.IsFlowStyle && len(mapping.Values) == 0) {
+		err = presetsPath.ReplaceWithReader(file, strings.NewReader(entry.String()))
+	} else {
+		err = presetsPath.MergeFromReader(file, strings.NewReader(entry.String()))
+	}
+	if err != nil {
+		return fmt.Errorf("add preset to %s: %w", path, err)
+	}
+	return os.WriteFile(path, []byte(file.String()), 0o644)
+}
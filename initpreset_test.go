@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPresetFromFlags(t *testing.T) {
+	f := &flags{
+		presets:    []string{"builtin:strict-base"},
+		allowPaths: []string{".", "$HOME/.npm"},
+		allowRead:  []string{"/usr"},
+		deny:       []string{"$HOME/.ssh"},
+		strict:     true,
+		allowGit:   true,
+	}
+
+	var out bytes.Buffer
+	writePresetYAML(&out, "mine", presetFromFlags(f), nil)
+
+	expected := `presets:
+  mine:
+    extends:
+      - "builtin:strict-base"
+    allow-git: true
+    strict: true
+    allow:
+      - "$HOME/.npm"
+      - "."
+    read:
+      - "/usr"
+    deny:
+      - "$HOME/.ssh"
+`
+	if out.String() != expected {
+		t.Errorf("unexpected preset YAML:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+func TestPresetFromFlagsAppSupport(t *testing.T) {
+	f := &flags{appSupport: []string{"tool"}}
+
+	var out bytes.Buffer
+	writePresetYAML(&out, "mine", presetFromFlags(f), nil)
+
+	expected := `presets:
+  mine:
+    allow:
+      - path: "~/.cache/tool"
+        os: linux
+      - path: "~/.local/share/tool"
+        os: linux
+      - path: "~/Library/Application Support/tool"
+        os: darwin
+      - path: "~/Library/Caches/tool"
+        os: darwin
+`
+	if out.String() != expected {
+		t.Errorf("unexpected preset YAML:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+func TestPresetFromFlagsDenyFileLevel(t *testing.T) {
+	f := &flags{deny: []string{"/secrets"}, denyFileLevel: []string{"/work"}}
+
+	var out bytes.Buffer
+	writePresetYAML(&out, "mine", presetFromFlags(f), nil)
+
+	expected := `presets:
+  mine:
+    deny:
+      - "/secrets"
+      - path: "/work"
+        recursive: false
+`
+	if out.String() != expected {
+		t.Errorf("unexpected preset YAML:\n%s\nwant:\n%s", out.String(), expected)
+	}
+}
+
+func TestSavePreset(t *testing.T) {
+	preset := presetFromFlags(&flags{
+		allowPaths: []string{"/work"},
+		deny:       []string{"/work/secrets"},
+	})
+
+	t.Run("new config file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "cage", "presets.yaml")
+		if err := savePreset(path, "mine", preset); err != nil {
+			t.Fatalf("savePreset() error = %v", err)
+		}
+		assertSavedPreset(t, path, "mine", preset)
+	})
+
+	t.Run("existing presets section keeps comments", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "presets.yaml")
+		content := "# my presets\npresets:\n  npm:\n    allow:\n      - \".\"\n\nauto-presets:\n  - command: npm\n    presets: [npm]\n"
+		os.WriteFile(path, []byte(content), 0o644)
+
+		if err := savePreset(path, "mine", preset); err != nil {
+			t.Fatalf("savePreset() error = %v", err)
+		}
+		assertSavedPreset(t, path, "mine", preset)
+
+		data, _ := os.ReadFile(path)
+		if !strings.Contains(string(data), "# my presets") {
+			t.Errorf("expected comments to be preserved, got:\n%s", data)
+		}
+		config, _ := loadConfigFromFile(path)
+		if _, ok := config.Presets["npm"]; !ok || len(config.AutoPresets) != 1 {
+			t.Errorf("expected existing presets and auto-presets to be kept, got %+v", config)
+		}
+	})
+
+	t.Run("config without presets section", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "presets.yaml")
+		os.WriteFile(path, []byte("defaults:\n  presets:\n    - \"builtin:secure\""), 0o644)
+
+		if err := savePreset(path, "mine", preset); err != nil {
+			t.Fatalf("savePreset() error = %v", err)
+		}
+		assertSavedPreset(t, path, "mine", preset)
+	})
+
+	t.Run("empty presets section", func(t *testing.T) {
+		for _, content := range []string{
+			"defaults:\n  presets: []\npresets:\n",
+			"presets:\ndefaults:\n  presets: []\n",
+			"presets: {}\n",
+		} {
+			path := filepath.Join(t.TempDir(), "presets.yaml")
+			os.WriteFile(path, []byte(content), 0o644)
+
+			if err := savePreset(path, "mine", preset); err != nil {
+				t.Fatalf("savePreset() with %q error = %v", content, err)
+			}
+			assertSavedPreset(t, path, "mine", preset)
+		}
+	})
+
+	t.Run("existing preset is not overwritten", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "presets.yaml")
+		os.WriteFile(path, []byte("presets:\n  mine:\n    strict: true\n"), 0o644)
+
+		err := savePreset(path, "mine", preset)
+		if err == nil || !strings.Contains(err.Error(), "already exists") {
+			t.Errorf("expected already exists error, got %v", err)
+		}
+	})
+}
+
+// assertSavedPreset checks that the config file at path defines name with the rules of want
+func assertSavedPreset(t *testing.T, path, name string, want *Preset) {
+	t.Helper()
+	config, err := loadConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("saved config does not load: %v", err)
+	}
+	got, ok := config.Presets[name]
+	if !ok {
+		t.Fatalf("preset %q not found in saved config", name)
+	}
+	if !reflect.DeepEqual(got.Allow, want.Allow) || !reflect.DeepEqual(got.Deny, want.Deny) {
+		t.Errorf("saved preset = %+v, want %+v", got, want)
+	}
+}
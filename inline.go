@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// inlinePresetPrefix names presets given with --preset-inline: cli-inline-1, cli-inline-2, ...
+const inlinePresetPrefix = "cli-inline-"
+
+// parseInlinePreset parses a --preset-inline value; YAML is a superset of JSON,
+// so both forms are accepted. Unknown fields are rejected to catch typos.
+func parseInlinePreset(content string) (Preset, error) {
+	var preset Preset
+	if strings.TrimSpace(content) == "" {
+		return preset, fmt.Errorf("empty preset")
+	}
+	if err := yaml.UnmarshalWithOptions([]byte(content), &preset, yaml.DisallowUnknownField()); err != nil {
+		return preset, err
+	}
+	return preset, nil
+}
+
+// addInlinePresets adds each --preset-inline value to config as a synthetic preset
+// and returns their names in command-line order
+func addInlinePresets(config *Config, contents []string) ([]string, error) {
+	var names []string
+	for i, content := range contents {
+		name := fmt.Sprintf("%s%d", inlinePresetPrefix, i+1)
+		preset, err := parseInlinePreset(content)
+		if err != nil {
+			return nil, fmt.Errorf("--preset-inline #%d: %w", i+1, err)
+		}
+		if _, exists := config.Presets[name]; exists {
+			return nil, fmt.Errorf("--preset-inline #%d: preset %s is already defined in the config", i+1, name)
+		}
+		if config.Presets == nil {
+			config.Presets = make(map[string]Preset)
+		}
+		config.Presets[name] = preset
+		names = append(names, name)
+	}
+	return names, nil
+}
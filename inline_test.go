@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddInlinePresets(t *testing.T) {
+	config := &Config{}
+	names, err := addInlinePresets(config, []string{
+		`{"allow":["/work"],"strict":true}`,
+		"extends: [base]\nread:\n  - /opt/tools\n",
+	})
+	if err != nil {
+		t.Fatalf("addInlinePresets() error = %v", err)
+	}
+	if want := []string{"cli-inline-1", "cli-inline-2"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("names = %v, want %v", names, want)
+	}
+
+	first := config.Presets["cli-inline-1"]
+	if !first.Strict || len(first.Allow) != 1 || first.Allow[0].Path != "/work" {
+		t.Errorf("cli-inline-1 = %+v, want strict with allow /work", first)
+	}
+	second := config.Presets["cli-inline-2"]
+	if !reflect.DeepEqual(second.Extends, []string{"base"}) || len(second.Read) != 1 || second.Read[0].Path != "/opt/tools" {
+		t.Errorf("cli-inline-2 = %+v, want extends base with read /opt/tools", second)
+	}
+}
+
+func TestAddInlinePresetsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", "  "},
+		{"malformed JSON", `{"allow":["/work"]`},
+		{"unknown field", `{"alow":["/work"]}`},
+		{"wrong type", `{"strict":"yes please"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := addInlinePresets(&Config{}, []string{tt.content}); err == nil {
+				t.Errorf("addInlinePresets(%q) succeeded, want error", tt.content)
+			}
+		})
+	}
+
+	config := &Config{Presets: map[string]Preset{"cli-inline-1": {}}}
+	if _, err := addInlinePresets(config, []string{`{"strict":true}`}); err == nil {
+		t.Error("addInlinePresets() replaced a preset from the config, want error")
+	}
+}
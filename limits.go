@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// defaultMaxRules is well above what real presets produce but keeps a runaway
+	// preset from generating a profile sandbox-exec or Landlock cannot load
+	defaultMaxRules = 10000
+	// defaultMaxPathLength matches PATH_MAX on Linux
+	defaultMaxPathLength = 4096
+)
+
+// RuleLimits bounds the size of the resolved rule set
+type RuleLimits struct {
+	MaxRules      int
+	MaxPathLength int
+}
+
+// ruleLimits returns the limits configured in defaults, falling back to the built-in values
+func ruleLimits(defaults Defaults) (RuleLimits, error) {
+	limits := RuleLimits{
+		MaxRules:      defaultMaxRules,
+		MaxPathLength: defaultMaxPathLength,
+	}
+	if defaults.MaxRules < 0 {
+		return limits, fmt.Errorf("defaults.max-rules must not be negative, got %d", defaults.MaxRules)
+	}
+	if defaults.MaxPathLength < 0 {
+		return limits, fmt.Errorf("defaults.max-path-length must not be negative, got %d", defaults.MaxPathLength)
+	}
+	if defaults.MaxRules > 0 {
+		limits.MaxRules = defaults.MaxRules
+	}
+	if defaults.MaxPathLength > 0 {
+		limits.MaxPathLength = defaults.MaxPathLength
+	}
+	return limits, nil
+}
+
+// checkRuleLimits verifies the resolved rules stay within limits
+// Errors name the offending path and source, or the largest contributors to the rule count
+func checkRuleLimits(writeRules, readRules []ResolvedRule, limits RuleLimits) error {
+	counts := make(map[string]int)
+	total := 0
+	for _, rules := range [][]ResolvedRule{writeRules, readRules} {
+		for _, rule := range rules {
+			if len(rule.Path) > limits.MaxPathLength {
+				return fmt.Errorf("path from %s is %d bytes, exceeding max-path-length %d: %.64s...",
+					formatRuleSource(rule), len(rule.Path), limits.MaxPathLength, rule.Path)
+			}
+			for _, exc := range rule.Except {
+				if len(exc) > limits.MaxPathLength {
+					return fmt.Errorf("except path from %s is %d bytes, exceeding max-path-length %d: %.64s...",
+						formatRuleSource(rule), len(exc), limits.MaxPathLength, exc)
+				}
+			}
+			counts[formatRuleSource(rule)]++
+			total++
+		}
+	}
+
+	if total > limits.MaxRules {
+		sources := make([]string, 0, len(counts))
+		for source := range counts {
+			sources = append(sources, source)
+		}
+		sort.Slice(sources, func(i, j int) bool {
+			if counts[sources[i]] != counts[sources[j]] {
+				return counts[sources[i]] > counts[sources[j]]
+			}
+			return sources[i] < sources[j]
+		})
+		return fmt.Errorf("%d rules exceed max-rules %d (largest source: %s with %d rules)",
+			total, limits.MaxRules, sources[0], counts[sources[0]])
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleLimits(t *testing.T) {
+	limits, err := ruleLimits(Defaults{})
+	if err != nil {
+		t.Fatalf("ruleLimits() error = %v", err)
+	}
+	if limits.MaxRules != defaultMaxRules || limits.MaxPathLength != defaultMaxPathLength {
+		t.Errorf("ruleLimits() = %+v, want built-in defaults", limits)
+	}
+
+	limits, err = ruleLimits(Defaults{MaxRules: 5, MaxPathLength: 20})
+	if err != nil {
+		t.Fatalf("ruleLimits() error = %v", err)
+	}
+	if limits.MaxRules != 5 || limits.MaxPathLength != 20 {
+		t.Errorf("ruleLimits() = %+v, want configured values", limits)
+	}
+
+	if _, err := ruleLimits(Defaults{MaxRules: -1}); err == nil {
+		t.Error("ruleLimits() should reject a negative max-rules")
+	}
+}
+
+func TestCheckRuleLimits_MaxRules(t *testing.T) {
+	var writeRules []ResolvedRule
+	for _, path := range []string{"/a", "/b", "/c"} {
+		writeRules = append(writeRules, ResolvedRule{
+			Path:   path,
+			Mode:   AccessWrite,
+			Action: ActionAllow,
+			Source: RuleSource{PresetName: "big"},
+		})
+	}
+	readRules := []ResolvedRule{
+		{Path: "/d", Mode: AccessRead, Action: ActionAllow, Source: RuleSource{Origin: OriginCLI}},
+	}
+
+	if err := checkRuleLimits(writeRules, readRules, RuleLimits{MaxRules: 4, MaxPathLength: 100}); err != nil {
+		t.Errorf("checkRuleLimits() at the limit error = %v", err)
+	}
+
+	err := checkRuleLimits(writeRules, readRules, RuleLimits{MaxRules: 3, MaxPathLength: 100})
+	if err == nil {
+		t.Fatal("checkRuleLimits() should fail when max-rules is exceeded")
+	}
+	if !strings.Contains(err.Error(), "max-rules 3") || !strings.Contains(err.Error(), "big with 3 rules") {
+		t.Errorf("checkRuleLimits() error = %q, want count and largest source", err)
+	}
+}
+
+func TestCheckRuleLimits_MaxPathLength(t *testing.T) {
+	long := "/" + strings.Repeat("x", 40)
+	limits := RuleLimits{MaxRules: 100, MaxPathLength: 32}
+
+	writeRules := []ResolvedRule{
+		{Path: long, Mode: AccessWrite, Action: ActionAllow, Source: RuleSource{PresetName: "deep"}},
+	}
+	err := checkRuleLimits(writeRules, nil, limits)
+	if err == nil {
+		t.Fatal("checkRuleLimits() should fail when a path exceeds max-path-length")
+	}
+	if !strings.Contains(err.Error(), "deep") || !strings.Contains(err.Error(), "max-path-length 32") {
+		t.Errorf("checkRuleLimits() error = %q, want source and limit", err)
+	}
+
+	denyRules := []ResolvedRule{
+		{Path: "/home", Mode: AccessReadWrite, Action: ActionDeny, Except: []string{long}, Source: RuleSource{PresetName: "deep"}},
+	}
+	if err := checkRuleLimits(denyRules, nil, limits); err == nil || !strings.Contains(err.Error(), "except path") {
+		t.Errorf("checkRuleLimits() error = %v, want except path error", err)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LintFinding describes a rule that will not behave as written on the target platform
+type LintFinding struct {
+	Path    string
+	Message string
+	// Heuristic findings are warnings that do not fail --validate
+	Heuristic bool
+}
+
+// lintRules checks the resolved rules for problems on the given platform (runtime.GOOS)
+// carveFraction is the share of a denied directory's entries that carve-outs may
+// restore before they are reported as too broad
+func lintRules(writeRules, readRules []ResolvedRule, goos string, carveFraction float64) []LintFinding {
+	var findings []LintFinding
+
+	// Deny rules appear in both lists for AccessReadWrite, so check each path once
+	seenDeny := make(map[string]bool)
+	for _, rules := range [][]ResolvedRule{writeRules, readRules} {
+		for _, rule := range rules {
+			if rule.Action != ActionDeny || seenDeny[rule.Path] {
+				continue
+			}
+			seenDeny[rule.Path] = true
+			if finding, ok := lintGlobDeny(rule, goos); ok {
+				findings = append(findings, finding)
+			}
+			findings = append(findings, lintBroadCarveOuts(rule, carveFraction)...)
+		}
+	}
+
+	for _, rule := range writeRules {
+		if finding, ok := lintUnwritableAllow(rule); ok {
+			findings = append(findings, finding)
+		}
+	}
+
+	return findings
+}
+
+// lintUnwritableAllow flags an existing write allow the current user cannot write
+// to (e.g. a root-owned directory), where the allow has no effect. Paths that do
+// not exist yet are left to --dry-run-strict
+func lintUnwritableAllow(rule ResolvedRule) (LintFinding, bool) {
+	if rule.Action != ActionAllow || rule.IsGlob {
+		return LintFinding{}, false
+	}
+	if _, err := os.Stat(rule.Path); err != nil || userWritable(rule.Path) {
+		return LintFinding{}, false
+	}
+	return LintFinding{
+		Path:      rule.Path,
+		Message:   fmt.Sprintf("write allow from %s has no effect: the current user cannot write to this path", formatRuleSource(rule)),
+		Heuristic: true,
+	}, true
+}
+
+// lintBroadCarveOuts flags carve-outs that leave little of a deny. It is a
+// heuristic with three checks: a carve-out covering the whole denied path, a
+// carve-out directly below a deny on /, and carve-outs covering more than
+// fraction of the entries directly inside the denied directory. Carve-outs
+// directly below home are common (dotfiles, project directories), so a deny
+// on home is only judged by the fraction.
+func lintBroadCarveOuts(rule ResolvedRule, fraction float64) []LintFinding {
+	if len(rule.Except) == 0 || rule.IsGlob {
+		return nil
+	}
+
+	var findings []LintFinding
+	warn := func(format string, args ...any) {
+		findings = append(findings, LintFinding{Path: rule.Path, Message: fmt.Sprintf(format, args...), Heuristic: true})
+	}
+
+	covers := func(except, path string) bool {
+		return except == path || pathContains(except, path)
+	}
+	for _, except := range rule.Except {
+		switch {
+		case covers(except, rule.Path):
+			warn("carve-out %s restores read access to the whole denied path", except)
+			return findings
+		case rule.Path == "/" && filepath.Dir(except) == "/":
+			warn("carve-out %s restores read access to a top-level directory, which may defeat a deny on /", except)
+		}
+	}
+
+	entries, err := os.ReadDir(rule.Path)
+	if err != nil || len(entries) == 0 {
+		return findings
+	}
+	covered := 0
+	for _, entry := range entries {
+		child := filepath.Join(rule.Path, entry.Name())
+		for _, except := range rule.Except {
+			if covers(except, child) {
+				covered++
+				break
+			}
+		}
+	}
+	if float64(covered) > fraction*float64(len(entries)) {
+		warn("carve-outs restore read access to %d of %d entries in the denied directory (more than %.0f%%)",
+			covered, len(entries), fraction*100)
+	}
+	return findings
+}
+
+// lintGlobDeny flags glob deny rules on Linux, where Landlock only accepts literal paths
+func lintGlobDeny(rule ResolvedRule, goos string) (LintFinding, bool) {
+	if !rule.IsGlob || goos != "linux" {
+		return LintFinding{}, false
+	}
+
+	kind := "single-level glob (*)"
+	if strings.Contains(rule.Path, "**") {
+		kind = "recursive glob (**)"
+	}
+	return LintFinding{
+		Path: rule.Path,
+		Message: fmt.Sprintf(
+			"deny uses a %s which Landlock cannot enforce; use --strict and allow only the paths you need instead",
+			kind,
+		),
+	}, true
+}
+
+// portableDevices are device files that exist under the same name on macOS and Linux
+var portableDevices = map[string]bool{
+	"/dev/null":    true,
+	"/dev/zero":    true,
+	"/dev/random":  true,
+	"/dev/urandom": true,
+	"/dev/tty":     true,
+	"/dev/stdin":   true,
+	"/dev/stdout":  true,
+	"/dev/stderr":  true,
+	"/dev/fd":      true,
+	"/dev/ptmx":    true,
+}
+
+// platformPathPrefixes are path prefixes that only exist on one platform
+var platformPathPrefixes = []struct {
+	goos     string
+	prefixes []string
+}{
+	{"darwin", []string{"/Library/", "/System/", "/Applications/", "/Volumes/", "/private/", "/Users/"}},
+	{"linux", []string{"/proc/", "/sys/", "/run/", "/snap/", "/home/"}},
+}
+
+// portabilityNotes returns warnings for a preset rule in section (allow, read or deny)
+// that will not behave as written on goos
+func portabilityNotes(section string, path AllowPath, goos string) []string {
+	if path.OS != "" && path.OS != goos {
+		// The path is left out on goos
+		return nil
+	}
+	var notes []string
+
+	if goos == "linux" && section == "deny" {
+		if isGlobPattern(path.Path) {
+			notes = append(notes, "glob deny is ignored on linux (Landlock requires literal paths)")
+		} else {
+			notes = append(notes, "read deny is not enforced on linux (Landlock is allowlist-only); only writes are blocked")
+		}
+	}
+
+	if goos == "linux" && section == "deny-write" && isGlobPattern(path.Path) {
+		notes = append(notes, "glob deny is ignored on linux (Landlock requires literal paths)")
+	}
+
+	if goos != "linux" && path.Refer != nil {
+		notes = append(notes, "refer only applies on linux")
+	}
+
+	if strings.HasPrefix(path.Path, "/dev/") && !portableDevices[path.Path] {
+		notes = append(notes, "device names differ between macOS and linux")
+	}
+
+	for _, platform := range platformPathPrefixes {
+		if platform.goos == goos || path.OS != "" {
+			continue
+		}
+		for _, prefix := range platform.prefixes {
+			if strings.HasPrefix(path.Path+"/", prefix) {
+				notes = append(notes, fmt.Sprintf("path is specific to %s", platform.goos))
+				break
+			}
+		}
+	}
+
+	return notes
+}
+
+// printLintAndExit prints the lint findings and exits non-zero if there are any
+// besides heuristic ones
+func printLintAndExit(findings []LintFinding) {
+	if len(findings) == 0 {
+		fmt.Println("No problems found")
+		os.Exit(0)
+	}
+	failed := false
+	for _, finding := range findings {
+		logger.logf(LogWarn, "cage: lint: ", "%s: %s", finding.Path, finding.Message)
+		failed = failed || !finding.Heuristic
+	}
+	if failed {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLintRulesGlobDeny(t *testing.T) {
+	resolver := NewRuleResolver()
+	source := RuleSource{PresetName: "test"}
+	resolver.AddDenyRule("/home/user/*.pem", nil, source)
+	resolver.AddDenyRule("/home/user/**/secrets", nil, source)
+	resolver.AddDenyRule("/home/user/.ssh", nil, source)
+	resolver.AddAllowRule("/home/user/*/build", source)
+
+	writeRules, readRules, _ := resolver.Resolve()
+
+	t.Run("flagged on linux", func(t *testing.T) {
+		findings := lintRules(writeRules, readRules, "linux", 0.5)
+		if len(findings) != 2 {
+			t.Fatalf("expected 2 findings, got %d: %v", len(findings), findings)
+		}
+
+		byPath := make(map[string]string)
+		for _, f := range findings {
+			byPath[f.Path] = f.Message
+		}
+		if msg := byPath["/home/user/*.pem"]; !strings.Contains(msg, "single-level glob") {
+			t.Errorf("expected single-level glob finding, got %q", msg)
+		}
+		if msg := byPath["/home/user/**/secrets"]; !strings.Contains(msg, "recursive glob") {
+			t.Errorf("expected recursive glob finding, got %q", msg)
+		}
+		for _, msg := range byPath {
+			if !strings.Contains(msg, "--strict") {
+				t.Errorf("expected finding to suggest --strict, got %q", msg)
+			}
+		}
+	})
+
+	t.Run("accepted on macOS", func(t *testing.T) {
+		findings := lintRules(writeRules, readRules, "darwin", 0.5)
+		if len(findings) != 0 {
+			t.Errorf("expected no findings on darwin, got %v", findings)
+		}
+	})
+}
+
+func TestLintBroadCarveOuts(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "d"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deny := func(except ...string) ResolvedRule {
+		return ResolvedRule{Path: dir, Mode: AccessReadWrite, Action: ActionDeny, Except: except}
+	}
+
+	t.Run("narrow carve-out", func(t *testing.T) {
+		findings := lintBroadCarveOuts(deny(filepath.Join(dir, "a", "cache")), 0.5)
+		if len(findings) != 0 {
+			t.Errorf("expected no findings, got %v", findings)
+		}
+	})
+
+	t.Run("carve-outs cover most entries", func(t *testing.T) {
+		findings := lintBroadCarveOuts(deny(filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")), 0.5)
+		if len(findings) != 1 || !strings.Contains(findings[0].Message, "3 of 4 entries") || !findings[0].Heuristic {
+			t.Errorf("expected a heuristic finding for 3 of 4 entries, got %v", findings)
+		}
+	})
+
+	t.Run("carve-out covers the deny", func(t *testing.T) {
+		findings := lintBroadCarveOuts(deny(dir), 0.5)
+		if len(findings) != 1 || !strings.Contains(findings[0].Message, "whole denied path") {
+			t.Errorf("expected a whole-path finding, got %v", findings)
+		}
+	})
+
+	t.Run("top-level carve-out of root", func(t *testing.T) {
+		rule := ResolvedRule{Path: "/", Mode: AccessReadWrite, Action: ActionDeny, Except: []string{"/home"}}
+		findings := lintBroadCarveOuts(rule, 1)
+		if len(findings) != 1 || !strings.Contains(findings[0].Message, "top-level directory") {
+			t.Errorf("expected a top-level finding, got %v", findings)
+		}
+	})
+}
+
+func TestLintUnwritableAllow(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	writable := t.TempDir()
+	readOnly := filepath.Join(t.TempDir(), "ro")
+	if err := os.Mkdir(readOnly, 0o555); err != nil {
+		t.Fatal(err)
+	}
+	allow := func(path string) ResolvedRule {
+		return ResolvedRule{Path: path, Mode: AccessWrite, Action: ActionAllow, Source: RuleSource{Origin: OriginCLI}}
+	}
+
+	if finding, ok := lintUnwritableAllow(allow(writable)); ok {
+		t.Errorf("expected no finding for a writable directory, got %v", finding)
+	}
+	finding, ok := lintUnwritableAllow(allow(readOnly))
+	if !ok || !finding.Heuristic || !strings.Contains(finding.Message, "cannot write") {
+		t.Errorf("expected a heuristic finding for a read-only directory, got %v, %v", finding, ok)
+	}
+	if _, ok := lintUnwritableAllow(allow(filepath.Join(writable, "missing"))); ok {
+		t.Error("expected no finding for a path that does not exist")
+	}
+}
+
+func TestPortabilityNotes(t *testing.T) {
+	tests := []struct {
+		name    string
+		section string
+		path    AllowPath
+		goos    string
+		want    []string
+	}{
+		{
+			name:    "glob deny on linux",
+			section: "deny",
+			path:    AllowPath{Path: "$HOME/**/.env"},
+			goos:    "linux",
+			want:    []string{"glob deny is ignored on linux (Landlock requires literal paths)"},
+		},
+		{
+			name:    "read deny on linux",
+			section: "deny",
+			path:    AllowPath{Path: "$HOME/.ssh"},
+			goos:    "linux",
+			want:    []string{"read deny is not enforced on linux (Landlock is allowlist-only); only writes are blocked"},
+		},
+		{
+			name:    "deny is portable on darwin",
+			section: "deny",
+			path:    AllowPath{Path: "$HOME/**/.env"},
+			goos:    "darwin",
+			want:    nil,
+		},
+		{
+			name:    "macOS path on linux",
+			section: "read",
+			path:    AllowPath{Path: "/Library/Developer"},
+			goos:    "linux",
+			want:    []string{"path is specific to darwin"},
+		},
+		{
+			name:    "linux path on darwin",
+			section: "read",
+			path:    AllowPath{Path: "/proc"},
+			goos:    "darwin",
+			want:    []string{"path is specific to linux"},
+		},
+		{
+			name:    "macOS path selected for darwin",
+			section: "read",
+			path:    AllowPath{Path: "/Library/Developer", OS: "darwin"},
+			goos:    "linux",
+			want:    nil,
+		},
+		{
+			name:    "platform specific device",
+			section: "allow",
+			path:    AllowPath{Path: "/dev/pts"},
+			goos:    "linux",
+			want:    []string{"device names differ between macOS and linux"},
+		},
+		{
+			name:    "portable device",
+			section: "allow",
+			path:    AllowPath{Path: "/dev/null"},
+			goos:    "linux",
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := portabilityNotes(tt.section, tt.path, tt.goos)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("portabilityNotes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// LogLevel orders log messages by severity
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+// logLevelNames are the values accepted by --log-level, indexed by LogLevel
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l LogLevel) String() string {
+	if l < 0 || int(l) >= len(logLevelNames) {
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+	return logLevelNames[l]
+}
+
+// parseLogLevel converts a --log-level value to a LogLevel
+func parseLogLevel(name string) (LogLevel, error) {
+	for i, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return LogLevel(i), nil
+		}
+	}
+	return LogInfo, fmt.Errorf("invalid log level %q (must be one of: %s)", name, strings.Join(logLevelNames, ", "))
+}
+
+// logEntry is one JSON line written to the log file
+type logEntry struct {
+	Time    string         `json:"time"`
+	Level   string         `json:"level"`
+	Message string         `json:"msg"`
+	Fields  map[string]any `json:"fields,omitempty"`
+}
+
+// Logger writes cage's diagnostics to stderr and, when a log file is configured,
+// records them together with structured events as JSON lines
+type Logger struct {
+	stderr io.Writer
+	file   io.Writer
+	level  LogLevel // minimum level recorded in the log file
+	now    func() time.Time
+}
+
+// logger is the process-wide logger; main attaches the --log-file to it
+var logger = &Logger{stderr: os.Stderr, level: LogInfo, now: time.Now}
+
+// openLogFile appends JSON lines at or above level to the file at path
+// The file is opened close-on-exec, so it stays with cage and is not inherited by
+// the command; it is opened before the sandbox is applied and needs no rule
+func (l *Logger) openLogFile(path string, level LogLevel) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	l.file = file
+	l.level = level
+	return nil
+}
+
+// Errorf prints "cage: <message>" to stderr and records it at error level
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(LogError, "cage: ", format, args...)
+}
+
+// Warnf prints "cage: warning: <message>" to stderr and records it at warn level
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(LogWarn, "cage: warning: ", format, args...)
+}
+
+// Infof prints "cage: info: <message>" to stderr and records it at info level
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(LogInfo, "cage: info: ", format, args...)
+}
+
+// Event records a structured event in the log file only
+func (l *Logger) Event(level LogLevel, msg string, fields map[string]any) {
+	l.record(level, msg, fields)
+}
+
+func (l *Logger) logf(level LogLevel, prefix, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Fprintf(l.stderr, "%s%s\n", prefix, msg)
+	l.record(level, msg, nil)
+}
+
+func (l *Logger) record(level LogLevel, msg string, fields map[string]any) {
+	if l.file == nil || level < l.level {
+		return
+	}
+	data, err := json.Marshal(logEntry{
+		Time:    l.now().UTC().Format(time.RFC3339Nano),
+		Level:   level.String(),
+		Message: msg,
+		Fields:  fields,
+	})
+	if err != nil {
+		return
+	}
+	l.file.Write(append(data, '\n'))
+}
+
+// logResolution records the resolved rules and conflicts in the log file
+// Individual rules are logged at debug level, the summary and conflicts at info
+func logResolution(presets []string, writeRules, readRules []ResolvedRule, conflicts []RuleConflict) {
+	report := buildPreviewReport(presets, writeRules, readRules, conflicts)
+	for _, rule := range report.Rules {
+		logger.Event(LogDebug, "rule", map[string]any{
+			"path":   rule.Path,
+			"mode":   rule.Mode,
+			"action": rule.Action,
+			"source": rule.Source,
+			"except": rule.Except,
+		})
+	}
+	for _, conflict := range report.Conflicts {
+		logger.Event(LogInfo, "conflict", map[string]any{
+			"path":         conflict.Path,
+			"cross_preset": conflict.CrossPreset,
+			"winner":       conflict.Resolution.Source,
+			"reason":       conflict.Reason,
+		})
+	}
+	logger.Event(LogInfo, "resolved", map[string]any{
+		"presets":     report.Presets,
+		"write_rules": len(writeRules),
+		"read_rules":  len(readRules),
+		"conflicts":   len(conflicts),
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLogger(level LogLevel) (*Logger, *bytes.Buffer, *bytes.Buffer) {
+	var stderr, file bytes.Buffer
+	l := &Logger{
+		stderr: &stderr,
+		file:   &file,
+		level:  level,
+		now:    func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	return l, &stderr, &file
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for i, name := range []string{"debug", "info", "WARN", "error"} {
+		level, err := parseLogLevel(name)
+		if err != nil || level != LogLevel(i) {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v", name, level, err, LogLevel(i))
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("parseLogLevel should reject unknown levels")
+	}
+}
+
+func TestLoggerStderrAndFile(t *testing.T) {
+	l, stderr, file := newTestLogger(LogInfo)
+
+	l.Warnf("preset '%s' has duplicate allow/deny for %s", "npm", "/tmp")
+	l.Event(LogDebug, "rule", map[string]any{"path": "/tmp"})
+	l.Event(LogInfo, "exec", map[string]any{"command": "ls"})
+
+	if stderr.String() != "cage: warning: preset 'npm' has duplicate allow/deny for /tmp\n" {
+		t.Errorf("unexpected stderr output: %q", stderr.String())
+	}
+
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines (debug filtered out), got %d: %q", len(lines), file.String())
+	}
+
+	var entry logEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if entry.Level != "warn" || entry.Message != "preset 'npm' has duplicate allow/deny for /tmp" || entry.Time != "2024-01-02T03:04:05Z" {
+		t.Errorf("unexpected warning entry: %+v", entry)
+	}
+
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatalf("log line is not JSON: %v", err)
+	}
+	if entry.Message != "exec" || entry.Fields["command"] != "ls" {
+		t.Errorf("unexpected exec entry: %+v", entry)
+	}
+}
+
+func TestLoggerWithoutFile(t *testing.T) {
+	var stderr bytes.Buffer
+	l := &Logger{stderr: &stderr, level: LogDebug, now: time.Now}
+
+	l.Errorf("error loading config: %v", "boom")
+	l.Event(LogError, "ignored", nil)
+
+	if stderr.String() != "cage: error loading config: boom\n" {
+		t.Errorf("unexpected stderr output: %q", stderr.String())
+	}
+}
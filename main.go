@@ -1,12 +1,17 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"runtime"
 	"runtime/debug"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 )
 
 const inCageEnv = "IN_CAGE"
@@ -28,19 +33,99 @@ func Version() string {
 type flags struct {
 	allowAll      bool
 	allowKeychain bool
+	keychainFiles []string
+	allowPTY      bool
+	noTTY         bool
 	allowGit      bool
+	allowDNS      bool
+	allowGo       bool
+	allowNode     bool
+	allowDesktop  bool
+	allowPython   bool
+	allowRust     bool
+	protectGit    bool
 	allowPaths    []string
+	allowOutput   []string
+	allowAppend   []string
+	appSupport    []string
+	allowDevices  []string
 	presets       []string
+	presetInline  []string
+	presetDir     string
+	ruleReasons   map[string]string // reasons from "# comment" rule flags, by path
 	listPresets   bool
 	showPreset    string
+	explainPreset string
 	outputFormat  string
+	outputSet     bool // true if -o was given on the command line
 	configPath    string
+	configCheck   bool
 	version       bool
+	printDefault  bool
 	dryRun        bool
+	dryRunStrict  string
 	strict        bool
 	allowRead     []string
+	allowMounts   []string
+	allowConnect  []string
 	deny          []string
+	denyFileLevel []string
 	noDefaults    bool
+	presetOrder   string
+	autoLibs      bool
+	preview       bool
+	allowFrom     []string
+	readFrom      []string
+	denyFrom      []string
+	allowEnv      []string
+	readEnv       []string
+	denyEnv       []string
+	profileTiming bool
+	watch         bool
+	rerun         bool
+	traceDeny     bool
+	validate      bool
+	noDefaultTmp  bool
+	requireABI    int
+	maxConflicts  int
+	carveFraction float64
+	summaryOnly   bool
+	collapse      bool
+	annotate      bool
+	profileLint   bool
+	printEnv      bool
+	maskEnv       bool
+	caseFold      bool
+	compatRead    bool
+	verbose       bool
+	quiet         bool
+	keepFDs       bool
+	maxMemory     string
+	maxCPU        string
+	maxFiles      int
+	maxProcs      int
+	timeout       time.Duration
+	workDir       string
+	killSignal    string
+	killGrace     time.Duration
+	noRefer       bool
+	allowNewPrivs bool
+	user          string
+	uid           int
+	gid           int
+	profileFile   string
+	seatbeltArgs  []string
+	rulesJSON     string
+	dumpRules     bool
+	logFile       string
+	portability   bool
+	strictSafety  bool
+	compareRun    bool
+	reallyMeanIt  bool
+	downgrade     bool
+	initPreset    string
+	save          bool
+	logLevel      string
 }
 
 func parseFlags() (*flags, []string) {
@@ -57,7 +142,36 @@ func parseFlags() (*flags, []string) {
 		&f.allowKeychain,
 		"allow-keychain",
 		false,
-		"Allow write access to the macOS keychain (only for macOS)",
+		"Allow read and write access to the macOS keychain (only for macOS)",
+	)
+
+	// Custom flag parsing to handle multiple --allow-keychain-file flags
+	var keychainFileFlags arrayFlags
+	flag.Var(
+		&keychainFileFlags,
+		"allow-keychain-file",
+		"Allow read and write access to a single keychain in ~/Library/Keychains, e.g. login.keychain-db (macOS only, can be used multiple times)",
+	)
+
+	flag.BoolVar(
+		&f.allowPTY,
+		"allow-pty",
+		false,
+		"Allow access to pseudo-terminal devices (enabled automatically when attached to a terminal)",
+	)
+
+	flag.BoolVar(
+		&f.noTTY,
+		"no-tty",
+		false,
+		"Do not keep the controlling terminal (/dev/tty and the terminal device) accessible despite deny rules",
+	)
+
+	flag.BoolVar(
+		&f.noDefaultTmp,
+		"no-default-tmp",
+		false,
+		"Do not allow writes to the system temporary directories (macOS only; breaks many tools)",
 	)
 
 	flag.BoolVar(
@@ -67,6 +181,62 @@ func parseFlags() (*flags, []string) {
 		"Allow access to git common directory (enables git operations in worktrees)",
 	)
 
+	flag.BoolVar(
+		&f.protectGit,
+		"protect-git",
+		false,
+		"Deny writes to the git common directory, keeping the rest of the working tree writable",
+	)
+
+	flag.BoolVar(
+		&f.allowDNS,
+		"allow-dns",
+		false,
+		"Allow reading the files needed for DNS resolution (resolv.conf, hosts, nsswitch.conf, NSS modules) in strict mode",
+	)
+
+	flag.BoolVar(
+		&f.allowGo,
+		"allow-go",
+		false,
+		"Allow access to the Go build cache and module cache (from go env GOCACHE GOMODCACHE)",
+	)
+
+	flag.BoolVar(
+		&f.allowNode,
+		"allow-node",
+		false,
+		"Allow access to the npm cache, node-gyp cache and $npm_config_prefix",
+	)
+
+	flag.BoolVar(
+		&f.allowPython,
+		"allow-python",
+		false,
+		"Allow access to the pip cache and the active virtualenv ($VIRTUAL_ENV)",
+	)
+
+	flag.BoolVar(
+		&f.allowRust,
+		"allow-rust",
+		false,
+		"Allow access to $CARGO_HOME and $CARGO_TARGET_DIR, and reading $RUSTUP_HOME",
+	)
+
+	flag.BoolVar(
+		&f.allowRust,
+		"allow-cargo",
+		false,
+		"Alias for --allow-rust",
+	)
+
+	flag.BoolVar(
+		&f.allowDesktop,
+		"allow-desktop",
+		false,
+		"Allow access to $XDG_RUNTIME_DIR and the DBus, Wayland and X11 sockets for desktop tools (Linux only)",
+	)
+
 	flag.BoolVar(
 		&f.strict,
 		"strict",
@@ -82,6 +252,46 @@ func parseFlags() (*flags, []string) {
 		"Grant write access to specific paths (can be used multiple times)",
 	)
 
+	// Custom flag parsing to handle multiple --allow-output flags
+	var allowOutputFlags arrayFlags
+	flag.Var(
+		&allowOutputFlags,
+		"allow-output",
+		"Grant write access to a single file, including creating it (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple --allow-append flags
+	var allowAppendFlags arrayFlags
+	flag.Var(
+		&allowAppendFlags,
+		"allow-append",
+		"Grant creating and writing files in a directory, but not deleting, renaming or truncating them (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple --allow-app-support flags
+	var appSupportFlags arrayFlags
+	flag.Var(
+		&appSupportFlags,
+		"allow-app-support",
+		"Grant write access to an app's data and cache directories: ~/Library/Application Support/<name> and ~/Library/Caches/<name> on macOS, ~/.local/share/<name> and ~/.cache/<name> on Linux (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple --seatbelt-param flags
+	var seatbeltParamFlags arrayFlags
+	flag.Var(
+		&seatbeltParamFlags,
+		"seatbelt-param",
+		"Pass key=value to sandbox-exec as -D key=value for profiles using (param \"key\") (macOS only, can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple --allow-dev flags
+	var allowDevFlags arrayFlags
+	flag.Var(
+		&allowDevFlags,
+		"allow-dev",
+		"Grant read, write and ioctl access to device nodes, e.g. /dev/bpf* (can be used multiple times)",
+	)
+
 	// Custom flag parsing to handle multiple --allow-read flags
 	var allowReadFlags arrayFlags
 	flag.Var(
@@ -90,6 +300,20 @@ func parseFlags() (*flags, []string) {
 		"Grant read access to specific paths (only used with --strict)",
 	)
 
+	var allowMountFlags arrayFlags
+	flag.Var(
+		&allowMountFlags,
+		"allow-mount",
+		"Grant read access to a mounted volume such as /Volumes/Data or /mnt/x (only used with --strict)",
+	)
+
+	var allowConnectFlags arrayFlags
+	flag.Var(
+		&allowConnectFlags,
+		"allow-connect",
+		"Allow connecting to the Unix socket at this path, without write access to it",
+	)
+
 	// Custom flag parsing to handle multiple --deny flags
 	var denyFlags arrayFlags
 	flag.Var(
@@ -98,6 +322,66 @@ func parseFlags() (*flags, []string) {
 		"Deny read and write access to paths; use 'except' in presets for read-only carve-outs",
 	)
 
+	var denyFileLevelFlags arrayFlags
+	flag.Var(
+		&denyFileLevelFlags,
+		"deny-file-level",
+		"Deny read and write access to the direct entries of a directory, but not its subdirectories' contents (macOS only)",
+	)
+
+	// --allow-list, --allow-read-list and --deny-list add to the same lists
+	flag.Var(
+		pathListFlag{&allowFlags},
+		"allow-list",
+		"Like --allow, for a list of paths separated by ':' (can be used multiple times)",
+	)
+	flag.Var(
+		pathListFlag{&allowReadFlags},
+		"allow-read-list",
+		"Like --allow-read, for a list of paths separated by ':' (can be used multiple times)",
+	)
+	flag.Var(
+		pathListFlag{&denyFlags},
+		"deny-list",
+		"Like --deny, for a list of paths separated by ':' (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple path list files
+	var allowFromFlags, readFromFlags, denyFromFlags arrayFlags
+	flag.Var(
+		&allowFromFlags,
+		"allow-from",
+		"Read write-allow paths from a file, one per line (can be used multiple times)",
+	)
+	flag.Var(
+		&readFromFlags,
+		"read-from",
+		"Read read-allow paths from a file, one per line (can be used multiple times)",
+	)
+	flag.Var(
+		&denyFromFlags,
+		"deny-from",
+		"Read deny paths from a file, one per line (can be used multiple times)",
+	)
+
+	// Custom flag parsing to handle multiple environment variable references
+	var allowEnvFlags, readEnvFlags, denyEnvFlags arrayFlags
+	flag.Var(
+		&allowEnvFlags,
+		"allow-env",
+		"Allow write access to the path in the named environment variable (can be used multiple times)",
+	)
+	flag.Var(
+		&readEnvFlags,
+		"read-env",
+		"Allow read access to the path in the named environment variable (can be used multiple times)",
+	)
+	flag.Var(
+		&denyEnvFlags,
+		"deny-env",
+		"Deny access to the path in the named environment variable (can be used multiple times)",
+	)
+
 	// Custom flag parsing to handle multiple --preset flags
 	var presetFlags arrayFlags
 	flag.Var(
@@ -106,6 +390,20 @@ func parseFlags() (*flags, []string) {
 		"Use a predefined preset configuration (can be used multiple times)",
 	)
 
+	flag.StringVar(
+		&f.presetDir,
+		"preset-dir",
+		"",
+		"Load presets from <name>.yaml files in this directory (default: presets.d in the config directory)",
+	)
+
+	var presetInlineFlags arrayFlags
+	flag.Var(
+		&presetInlineFlags,
+		"preset-inline",
+		"Use a preset given as inline JSON or YAML, named cli-inline-N (can be used multiple times)",
+	)
+
 	flag.BoolVar(
 		&f.listPresets,
 		"list-presets",
@@ -120,11 +418,18 @@ func parseFlags() (*flags, []string) {
 		"Show the contents of a preset",
 	)
 
+	flag.StringVar(
+		&f.explainPreset,
+		"explain-preset",
+		"",
+		"Show how a preset is resolved through its extends chain, tagging each rule with its origin",
+	)
+
 	flag.StringVar(
 		&f.outputFormat,
 		"o",
 		"text",
-		"Output format for --show-preset: text, yaml (resolved), or raw (unresolved YAML)",
+		"Output format for --show-preset: text, yaml (resolved), or raw (unresolved YAML); for --preview: text or json",
 	)
 
 	flag.StringVar(
@@ -134,6 +439,13 @@ func parseFlags() (*flags, []string) {
 		"Path to custom configuration file",
 	)
 
+	flag.BoolVar(
+		&f.configCheck,
+		"config-check",
+		false,
+		"Validate the configuration file and every preset's extends chain, then exit",
+	)
+
 	flag.BoolVar(
 		&f.version,
 		"version",
@@ -141,6 +453,13 @@ func parseFlags() (*flags, []string) {
 		"Print version information and exit",
 	)
 
+	flag.BoolVar(
+		&f.printDefault,
+		"print-default-config",
+		false,
+		"Print the built-in default config, used when there is no config file, and exit",
+	)
+
 	flag.BoolVar(
 		&f.dryRun,
 		"dry-run",
@@ -148,6 +467,83 @@ func parseFlags() (*flags, []string) {
 		"Show the generated sandbox profile without executing",
 	)
 
+	flag.BoolVar(
+		&f.summaryOnly,
+		"summary-only",
+		false,
+		"With --dry-run, print only the rule summary and conflicts, not the raw profile",
+	)
+
+	flag.BoolVar(
+		&f.collapse,
+		"collapse",
+		false,
+		"With --dry-run, list sibling allow paths with the same source as one brace pattern, e.g. /work/{a,b,c}",
+	)
+
+	flag.StringVar(
+		&f.dryRunStrict,
+		"dry-run-strict",
+		"",
+		"With --dry-run, exit with status 2 if the config has problems: conflicts (rule conflicts) or all (also lint findings and missing allow paths)",
+	)
+
+	flag.BoolVar(
+		&f.annotate,
+		"annotate-profile",
+		false,
+		"Precede each group of rules in the generated profile with a comment naming its source (macOS only)",
+	)
+
+	flag.BoolVar(
+		&f.profileLint,
+		"profile-lint",
+		false,
+		"With --dry-run, warn about likely mistakes in the generated profile, such as denies a later allow overrides (macOS only)",
+	)
+
+	flag.BoolVar(
+		&f.printEnv,
+		"print-env",
+		false,
+		"With --dry-run, list the environment variables the command will receive",
+	)
+
+	flag.BoolVar(
+		&f.maskEnv,
+		"mask-env",
+		false,
+		"With --print-env, hide the values of variables whose names look like secrets (TOKEN, SECRET, PASSWORD, ...)",
+	)
+
+	flag.BoolVar(
+		&f.caseFold,
+		"case-insensitive",
+		false,
+		"Also match deny rules against case variants of their paths (macOS only; detected automatically on case-insensitive volumes)",
+	)
+
+	flag.BoolVar(
+		&f.compatRead,
+		"compat-file-read",
+		false,
+		"Deny file-read* instead of file-read-data, hiding that denied paths exist; may break path resolution (macOS only)",
+	)
+
+	flag.Float64Var(
+		&f.carveFraction,
+		"carve-out-fraction",
+		0.5,
+		"Share of a denied directory's entries that carve-outs may restore before --validate warns that they are too broad",
+	)
+
+	flag.IntVar(
+		&f.maxConflicts,
+		"max-conflicts",
+		20,
+		"Maximum number of rule conflicts --dry-run lists in detail (0 lists all)",
+	)
+
 	flag.BoolVar(
 		&f.noDefaults,
 		"no-defaults",
@@ -155,182 +551,1137 @@ func parseFlags() (*flags, []string) {
 		"Skip default presets defined in config",
 	)
 
-	flag.Parse()
+	flag.StringVar(
+		&f.presetOrder,
+		"preset-order",
+		"cli-first",
+		"How --preset presets rank in conflicts: cli-first (above auto and default presets) or cli-last (below them)",
+	)
 
-	f.allowPaths = []string(allowFlags)
-	f.presets = []string(presetFlags)
-	f.allowRead = []string(allowReadFlags)
-	f.deny = []string(denyFlags)
+	flag.BoolVar(
+		&f.autoLibs,
+		"auto-libs",
+		false,
+		"Allow reading the command's shared libraries (Linux only, used with --strict)",
+	)
 
-	return f, flag.Args()
-}
+	flag.BoolVar(
+		&f.preview,
+		"preview",
+		false,
+		"Preview how the selected presets combine (conflicts and final rules) without executing",
+	)
 
-// arrayFlags is a custom flag type that accumulates values
-type arrayFlags []string
+	flag.BoolVar(
+		&f.profileTiming,
+		"profile-timing",
+		false,
+		"Print time spent in config loading, preset and rule resolution, and profile generation to stderr",
+	)
 
-func (a *arrayFlags) String() string {
-	return strings.Join(*a, ", ")
-}
+	flag.BoolVar(
+		&f.watch,
+		"watch",
+		false,
+		"Show the dry-run again whenever the config file or a preset file changes (for writing presets)",
+	)
 
-func (a *arrayFlags) Set(value string) error {
-	*a = append(*a, value)
-	return nil
-}
+	flag.BoolVar(
+		&f.rerun,
+		"rerun",
+		false,
+		"With --watch, run the command again instead of showing the dry-run",
+	)
 
-func printPreset(name string, p *Preset, format string, extends []string) {
-	if format == "yaml" {
-		printPresetYAML(name, p, extends)
-		return
-	}
-	printPresetText(name, p, extends)
-}
+	flag.BoolVar(
+		&f.traceDeny,
+		"trace-deny",
+		false,
+		"Run the command under strace and report the paths whose access was denied (Linux only, needs strace)",
+	)
 
-func sortedPaths(paths []AllowPath) []AllowPath {
-	// Deduplicate by path, keeping first occurrence
-	seen := make(map[string]bool)
-	unique := make([]AllowPath, 0, len(paths))
-	for _, p := range paths {
-		if !seen[p.Path] {
-			seen[p.Path] = true
-			unique = append(unique, p)
-		}
-	}
-	// Sort by path
-	sort.Slice(unique, func(i, j int) bool {
-		return unique[i].Path < unique[j].Path
-	})
-	return unique
-}
+	flag.IntVar(
+		&f.requireABI,
+		"require-landlock-abi",
+		0,
+		"Refuse to run unless the kernel enforces at least this Landlock ABI version (Linux only)",
+	)
 
-func printPresetText(name string, p *Preset, extends []string) {
-	fmt.Printf("Preset: %s\n", name)
-	fmt.Println("========================================")
+	flag.StringVar(
+		&f.workDir,
+		"working-dir",
+		"",
+		"Run the command in this directory; relative rule paths resolve against it",
+	)
 
-	if len(extends) > 0 {
-		fmt.Printf("Extends: %s\n", strings.Join(extends, " → "))
-		fmt.Println()
+	flag.DurationVar(
+		&f.timeout,
+		"timeout",
+		0,
+		"Kill the command after this duration, e.g. 30s or 5m (runs the command as a child process)",
+	)
+
+	flag.StringVar(
+		&f.killSignal,
+		"kill-signal",
+		"SIGTERM",
+		"Signal sent to the command's process group when --timeout expires",
+	)
+
+	flag.DurationVar(
+		&f.killGrace,
+		"kill-grace",
+		5*time.Second,
+		"Time to wait after --kill-signal before sending SIGKILL",
+	)
+
+	flag.StringVar(
+		&f.user,
+		"user",
+		"",
+		"Run the command as this user and its primary group (requires root; only drops privileges)",
+	)
+
+	flag.IntVar(
+		&f.uid,
+		"uid",
+		-1,
+		"Run the command with this user ID (requires root; overrides --user)",
+	)
+
+	flag.IntVar(
+		&f.gid,
+		"gid",
+		-1,
+		"Run the command with this group ID (requires root; overrides --user)",
+	)
+
+	flag.BoolVar(
+		&f.noRefer,
+		"no-refer",
+		false,
+		"Do not allow moving or linking files out of allowed directories (Linux only)",
+	)
+
+	flag.BoolVar(
+		&f.allowNewPrivs,
+		"allow-new-privs",
+		false,
+		"Let the command gain privileges through setuid/setgid binaries, e.g. sudo (Linux only)",
+	)
+
+	flag.StringVar(
+		&f.initPreset,
+		"init-preset",
+		"",
+		"Print a preset with this name built from the given allow, read and deny flags",
+	)
+
+	flag.BoolVar(
+		&f.save,
+		"save",
+		false,
+		"With --init-preset, add the preset to the config file instead of printing it",
+	)
+
+	flag.BoolVar(
+		&f.portability,
+		"portability",
+		false,
+		"With --show-preset, warn about rules that will not work as written on this platform",
+	)
+
+	flag.BoolVar(
+		&f.compareRun,
+		"compare-run",
+		false,
+		"Run the command unsandboxed under strace and report which accesses the sandbox would deny (Linux only)",
+	)
+
+	flag.BoolVar(
+		&f.strictSafety,
+		"strict-safety",
+		false,
+		"Refuse to run when a write allow covers a system directory such as /usr or /",
+	)
+
+	flag.BoolVar(
+		&f.downgrade,
+		"downgrade-writes",
+		false,
+		"Turn every write allow, from presets and flags, into a read-only allow",
+	)
+
+	flag.BoolVar(
+		&f.reallyMeanIt,
+		"i-really-mean-it",
+		false,
+		"Allow write access to system directories without a warning",
+	)
+
+	flag.StringVar(
+		&f.logFile,
+		"log-file",
+		"",
+		"Append cage's decisions and warnings to this file as JSON lines",
+	)
+
+	flag.StringVar(
+		&f.logLevel,
+		"log-level",
+		"info",
+		"Minimum level written to --log-file (debug, info, warn, error); debug includes every applied rule",
+	)
+
+	flag.StringVar(
+		&f.profileFile,
+		"profile-file",
+		"",
+		"Run the command under a prebuilt sandbox-exec profile instead of generating one (macOS only)",
+	)
+
+	flag.BoolVar(
+		&f.keepFDs,
+		"keep-fds",
+		false,
+		"Pass file descriptors above stderr through to the command (closed by default)",
+	)
+
+	flag.StringVar(
+		&f.maxMemory,
+		"max-memory",
+		"",
+		"Limit the command's address space, e.g. 512M or 2G (RLIMIT_AS, not enforced on macOS)",
+	)
+
+	flag.StringVar(
+		&f.maxCPU,
+		"max-cpu",
+		"",
+		"Limit the command's CPU time, in seconds or as a duration such as 5m (RLIMIT_CPU)",
+	)
+
+	flag.IntVar(
+		&f.maxFiles,
+		"max-files",
+		0,
+		"Limit the number of files the command can have open (RLIMIT_NOFILE)",
+	)
+
+	flag.IntVar(
+		&f.maxProcs,
+		"max-procs",
+		0,
+		"Limit the number of processes of the user the command runs as (RLIMIT_NPROC)",
+	)
+
+	flag.BoolVar(
+		&f.verbose,
+		"verbose",
+		false,
+		"Print additional information about the applied sandbox to stderr",
+	)
+
+	flag.StringVar(
+		&f.rulesJSON,
+		"rules-from-json",
+		"",
+		"Use the resolved rules in this JSON file (as written by --dump-rules) instead of presets and rule flags",
+	)
+
+	flag.BoolVar(
+		&f.dumpRules,
+		"dump-rules",
+		false,
+		"Print the resolved rules as JSON and exit (input for --rules-from-json)",
+	)
+
+	flag.BoolVar(
+		&f.quiet,
+		"quiet",
+		false,
+		"Do not warn about allow/deny conflicts between presets resolved on this run",
+	)
+
+	flag.BoolVar(
+		&f.validate,
+		"validate",
+		false,
+		"Check the resolved rules for problems on this platform and exit (non-zero if any are found)",
+	)
+
+	flag.Parse()
+
+	flag.Visit(func(fl *flag.Flag) {
+		if fl.Name == "o" {
+			f.outputSet = true
+		}
+	})
+
+	f.allowPaths = []string(allowFlags)
+	f.allowOutput = []string(allowOutputFlags)
+	f.allowAppend = []string(allowAppendFlags)
+	f.appSupport = []string(appSupportFlags)
+	f.keychainFiles = []string(keychainFileFlags)
+	f.seatbeltArgs = []string(seatbeltParamFlags)
+	f.allowDevices = []string(allowDevFlags)
+	f.presets = []string(presetFlags)
+	f.presetInline = []string(presetInlineFlags)
+	f.allowRead = []string(allowReadFlags)
+	f.allowMounts = []string(allowMountFlags)
+	f.allowConnect = []string(allowConnectFlags)
+	f.deny = []string(denyFlags)
+	f.denyFileLevel = []string(denyFileLevelFlags)
+	f.allowFrom = []string(allowFromFlags)
+	f.readFrom = []string(readFromFlags)
+	f.denyFrom = []string(denyFromFlags)
+	f.allowEnv = []string(allowEnvFlags)
+	f.readEnv = []string(readEnvFlags)
+	f.denyEnv = []string(denyEnvFlags)
+
+	return f, flag.Args()
+}
+
+// arrayFlags is a custom flag type that accumulates values
+type arrayFlags []string
+
+func (a *arrayFlags) String() string {
+	return strings.Join(*a, ", ")
+}
+
+func (a *arrayFlags) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+// ttyDevices returns the terminal devices to keep accessible, none with --no-tty
+func ttyDevices(noTTY bool) []string {
+	if noTTY {
+		return nil
+	}
+	return terminalDevices()
+}
+
+// pathListFlag splits a path list at os.PathListSeparator (":" on Unix) and adds
+// each path to a repeatable path flag, for --allow-list, --allow-read-list and
+// --deny-list; the plain flags keep paths containing the separator intact
+type pathListFlag struct {
+	paths *arrayFlags
+}
+
+func (p pathListFlag) String() string {
+	if p.paths == nil {
+		return ""
+	}
+	return p.paths.String()
+}
+
+func (p pathListFlag) Set(value string) error {
+	added := false
+	for _, path := range strings.Split(value, string(os.PathListSeparator)) {
+		if path != "" {
+			p.paths.Set(path)
+			added = true
+		}
+	}
+	if !added {
+		return fmt.Errorf("empty path list %q", value)
+	}
+	return nil
+}
+
+// readPathsFile reads paths from a file, one per line
+// Blank lines and lines starting with # are ignored; environment variables are expanded
+func readPathsFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		paths = append(paths, expandEnvOnly(line))
+	}
+	return paths, nil
+}
+
+// loadPathFiles appends the paths listed in --allow-from, --read-from and --deny-from files
+// to the corresponding command-line rule lists
+func (f *flags) loadPathFiles() error {
+	lists := []struct {
+		files []string
+		dst   *[]string
+	}{
+		{f.allowFrom, &f.allowPaths},
+		{f.readFrom, &f.allowRead},
+		{f.denyFrom, &f.deny},
+	}
+	for _, list := range lists {
+		for _, file := range list.files {
+			paths, err := readPathsFile(file)
+			if err != nil {
+				return fmt.Errorf("reading paths from %s: %w", file, err)
+			}
+			*list.dst = append(*list.dst, paths...)
+		}
+	}
+	return nil
+}
+
+// redundancyNote describes a redundant allow for --verbose output
+func redundancyNote(r RuleRedundancy) string {
+	if r.Rule.Source.IsCLI() {
+		return fmt.Sprintf("%s %s is redundant: %s already allows %s",
+			cliAllowFlag(r.Rule), r.Rule.Path, formatRuleSource(r.Covered), r.Covered.Path)
+	}
+	return fmt.Sprintf("%s allow %s is redundant: %s %s already allows it",
+		formatRuleSource(r.Rule), r.Rule.Path, cliAllowFlag(r.Covered), r.Covered.Path)
+}
+
+// cliAllowFlag returns the command-line flag that produces an allow rule
+func cliAllowFlag(rule ResolvedRule) string {
+	switch {
+	case rule.Mode == AccessRead:
+		return "--allow-read"
+	case rule.IsFile:
+		return "--allow-output"
+	case rule.Append:
+		return "--allow-append"
+	default:
+		return "--allow"
+	}
+}
+
+// profileFileConflicts returns the rule-generating flags that were given together
+// with --profile-file, which replaces cage's rule generation entirely
+func (f *flags) profileFileConflicts() []string {
+	return f.ruleFlagsSet(true)
+}
+
+// rulesJSONConflicts returns the flags that add rules given together with
+// --rules-from-json, whose rule set replaces presets and rule flags
+func (f *flags) rulesJSONConflicts() []string {
+	return f.ruleFlagsSet(false)
+}
+
+// ruleFlagsSet returns the rule-generating flags that were given; withOptions
+// adds the flags that shape the generated profile without adding rules
+func (f *flags) ruleFlagsSet(withOptions bool) []string {
+	checks := []struct {
+		name string
+		set  bool
+	}{
+		{"--allow", len(f.allowPaths) > 0},
+		{"--allow-output", len(f.allowOutput) > 0},
+		{"--allow-append", len(f.allowAppend) > 0},
+		{"--allow-app-support", len(f.appSupport) > 0},
+		{"--allow-dev", len(f.allowDevices) > 0},
+		{"--allow-read", len(f.allowRead) > 0},
+		{"--allow-mount", len(f.allowMounts) > 0},
+		{"--allow-connect", len(f.allowConnect) > 0},
+		{"--deny", len(f.deny) > 0},
+		{"--deny-file-level", len(f.denyFileLevel) > 0},
+		{"--allow-from", len(f.allowFrom) > 0},
+		{"--read-from", len(f.readFrom) > 0},
+		{"--deny-from", len(f.denyFrom) > 0},
+		{"--allow-env", len(f.allowEnv) > 0},
+		{"--read-env", len(f.readEnv) > 0},
+		{"--deny-env", len(f.denyEnv) > 0},
+		{"--preset", len(f.presets) > 0},
+		{"--allow-git", f.allowGit},
+		{"--protect-git", f.protectGit},
+		{"--preset-inline", len(f.presetInline) > 0},
+		{"--allow-dns", f.allowDNS},
+		{"--allow-go", f.allowGo},
+		{"--allow-node", f.allowNode},
+		{"--allow-desktop", f.allowDesktop},
+		{"--allow-python", f.allowPython},
+		{"--allow-rust", f.allowRust},
+		{"--auto-libs", f.autoLibs},
+	}
+	if withOptions {
+		checks = append(checks, []struct {
+			name string
+			set  bool
+		}{
+			{"--strict", f.strict},
+			{"--allow-all", f.allowAll},
+			{"--allow-keychain", f.allowKeychain},
+			{"--allow-keychain-file", len(f.keychainFiles) > 0},
+			{"--allow-pty", f.allowPTY},
+			{"--no-default-tmp", f.noDefaultTmp},
+			{"--no-refer", f.noRefer},
+			{"--rules-from-json", f.rulesJSON != ""},
+		}...)
+	}
+
+	var conflicts []string
+	for _, check := range checks {
+		if check.set {
+			conflicts = append(conflicts, check.name)
+		}
+	}
+	return conflicts
+}
+
+// loadPathEnvVars appends the paths named by --allow-env, --read-env and --deny-env
+// It fails if a referenced variable is unset or empty
+func (f *flags) loadPathEnvVars() error {
+	lists := []struct {
+		names []string
+		dst   *[]string
+	}{
+		{f.allowEnv, &f.allowPaths},
+		{f.readEnv, &f.allowRead},
+		{f.denyEnv, &f.deny},
+	}
+	for _, list := range lists {
+		for _, name := range list.names {
+			value, ok := os.LookupEnv(name)
+			if !ok || value == "" {
+				return fmt.Errorf("environment variable %s is not set", name)
+			}
+			*list.dst = append(*list.dst, value)
+		}
+	}
+	return nil
+}
+
+// expandBracePaths expands brace patterns in --allow, --allow-read, --deny,
+// --allow-output and --allow-append
+// Each expanded path keeps the reason given for its pattern
+func (f *flags) expandBracePaths() error {
+	for _, list := range []*[]string{&f.allowPaths, &f.allowRead, &f.deny, &f.allowOutput, &f.allowAppend} {
+		var result []string
+		for _, pattern := range *list {
+			expanded, err := expandBraces(pattern)
+			if err != nil {
+				return err
+			}
+			if reason, ok := f.ruleReasons[pattern]; ok {
+				for _, path := range expanded {
+					f.ruleReasons[path] = reason
+				}
+			}
+			result = append(result, expanded...)
+		}
+		*list = result
+	}
+	return nil
+}
+
+// stripRuleComments removes "# reason" annotations from --allow, --allow-output,
+// --allow-append, --allow-read and --deny values and records the reasons by path
+func (f *flags) stripRuleComments() {
+	for _, list := range []*[]string{&f.allowPaths, &f.allowOutput, &f.allowAppend, &f.allowRead, &f.deny} {
+		for i, value := range *list {
+			path, reason := splitRuleComment(value)
+			(*list)[i] = path
+			if reason != "" {
+				if f.ruleReasons == nil {
+					f.ruleReasons = make(map[string]string)
+				}
+				f.ruleReasons[path] = reason
+			}
+		}
+	}
+}
+
+// splitRuleComment splits a rule flag value at the first unescaped '#' that
+// follows whitespace into the path and the reason after it, so a '#' inside a
+// path segment stays part of the path; "\#" stands for a literal '#' anywhere
+func splitRuleComment(value string) (string, string) {
+	var path strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == '#':
+			path.WriteByte('#')
+			i++
+		case value[i] == '#' && i > 0 && (value[i-1] == ' ' || value[i-1] == '\t'):
+			return strings.TrimRight(path.String(), " \t"), strings.TrimSpace(value[i+1:])
+		default:
+			path.WriteByte(value[i])
+		}
+	}
+	return path.String(), ""
+}
+
+// addProtectGitRule denies writes to the current repository's git common directory
+// Reads stay allowed, so git commands and hooks still run; an allow nested inside
+// it (e.g. .git/hooks) remains a write carve-out
+func addProtectGitRule(resolver *RuleResolver) error {
+	gitCommonDir, err := getGitCommonDir()
+	if err != nil {
+		return err
+	}
+	if gitCommonDir == "" {
+		return fmt.Errorf("not in a git repository")
+	}
+	resolver.AddWriteDenyRule(gitCommonDir, RuleSource{PresetName: "-protect-git", Origin: OriginCLI})
+	return nil
+}
+
+// effectiveOutputFormat returns the -o value to use: the command line wins,
+// then defaults.output-format from the config, then the flag default
+func effectiveOutputFormat(f *flags, config *Config) (string, error) {
+	if f.outputSet || config.Defaults.OutputFormat == "" {
+		return f.outputFormat, nil
+	}
+	if err := validateOutputFormat(config.Defaults.OutputFormat); err != nil {
+		return "", fmt.Errorf("defaults.output-format: %w", err)
+	}
+	return config.Defaults.OutputFormat, nil
+}
+
+// reportTiming prints the wall-clock time spent in a phase to stderr when enabled
+func reportTiming(enabled bool, phase string, start time.Time) {
+	if enabled {
+		logger.logf(LogDebug, "cage: timing: ", "%s: %s", phase, time.Since(start))
+	}
+}
+
+// printPreset prints a preset as text or YAML; a non-empty portability (a GOOS value)
+// annotates text output with rules that will not work as written on that platform
+func printPreset(name string, p *Preset, format string, extends []string, portability string) {
+	if format == "yaml" {
+		printPresetYAML(name, p, extends)
+		return
+	}
+	printPresetText(name, p, extends, portability)
+}
+
+func sortedEnvNames(env map[string]string) []string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedPaths(paths []AllowPath) []AllowPath {
+	// Deduplicate by path, keeping first occurrence
+	seen := make(map[string]bool)
+	unique := make([]AllowPath, 0, len(paths))
+	for _, p := range paths {
+		if !seen[p.Path] {
+			seen[p.Path] = true
+			unique = append(unique, p)
+		}
+	}
+	// Sort by path
+	sort.Slice(unique, func(i, j int) bool {
+		return unique[i].Path < unique[j].Path
+	})
+	return unique
+}
+
+func printPresetText(name string, p *Preset, extends []string, portability string) {
+	printNotes := func(section string, path AllowPath) {
+		if portability == "" {
+			return
+		}
+		for _, note := range portabilityNotes(section, path, portability) {
+			fmt.Printf("    warning: %s\n", note)
+		}
+	}
+
+	fmt.Printf("Preset: %s\n", name)
+	fmt.Println("========================================")
+
+	if len(extends) > 0 {
+		fmt.Printf("Extends: %s\n", strings.Join(extends, " → "))
+		fmt.Println()
+	}
+
+	if len(p.Extends) > 0 {
+		fmt.Println("extends:")
+		for _, ext := range p.Extends {
+			fmt.Printf("  - %s\n", ext)
+		}
+	}
+	if len(p.SoftExtends) > 0 {
+		fmt.Println("optional-extends:")
+		for _, ext := range p.SoftExtends {
+			fmt.Printf("  - %s\n", ext)
+		}
+	}
+
+	if p.AllowGit {
+		fmt.Println("allow-git: true")
+	}
+	if p.AllowDNS {
+		fmt.Println("allow-dns: true")
+	}
+	if p.AllowGo {
+		fmt.Println("allow-go: true")
+	}
+	if p.AllowKeychain {
+		fmt.Println("allow-keychain: true")
+		if portability != "" && portability != "darwin" {
+			fmt.Println("  warning: keychain access only applies on darwin")
+		}
+	}
+	if p.SkipDefaults {
+		fmt.Println("skip-defaults: true")
+	}
+	if p.Strict {
+		fmt.Println("strict: true")
+	}
+	if p.Priority != 0 {
+		fmt.Printf("priority: %d\n", p.Priority)
+	}
+
+	if len(p.Allow) > 0 {
+		fmt.Println("\nallow (write paths):")
+		for _, path := range sortedPaths(p.Allow) {
+			fmt.Printf("  - %s\n", path.Path)
+			printNotes("allow", path)
+		}
+	}
+
+	if len(p.Read) > 0 {
+		fmt.Println("\nread (read-only paths):")
+		for _, path := range sortedPaths(p.Read) {
+			fmt.Printf("  - %s\n", path.Path)
+			printNotes("read", path)
+		}
+	}
+
+	if len(p.Deny) > 0 {
+		fmt.Println("\ndeny (read+write, except restores read-only):")
+		for _, path := range sortedPaths(p.Deny) {
+			fmt.Printf("  - %s\n", path.Path)
+			printNotes("deny", path)
+			for _, exc := range path.Except {
+				fmt.Printf("    except: %s\n", exc)
+			}
+		}
+	}
+
+	if len(p.DenyWrite) > 0 {
+		fmt.Println("\ndeny-write (write only, reads unaffected):")
+		for _, path := range sortedPaths(p.DenyWrite) {
+			fmt.Printf("  - %s\n", path.Path)
+			printNotes("deny-write", path)
+		}
+	}
+
+	if len(p.Env) > 0 {
+		fmt.Println("\nenv:")
+		for _, name := range sortedEnvNames(p.Env) {
+			fmt.Printf("  %s=%s\n", name, p.Env[name])
+		}
+	}
+
+	if p.Remove != nil {
+		fmt.Println("\nremove (inherited rules dropped):")
+		for _, path := range p.Remove.Allow {
+			fmt.Printf("  - allow: %s\n", path)
+		}
+		for _, path := range p.Remove.Read {
+			fmt.Printf("  - read: %s\n", path)
+		}
+		for _, path := range p.Remove.Deny {
+			fmt.Printf("  - deny: %s\n", path)
+		}
+	}
+}
+
+func printPresetExplanation(name string, p *Preset, trace []PresetTraceEvent) {
+	fmt.Printf("Preset: %s\n", name)
+	fmt.Println("========================================")
+	fmt.Println("Resolution trace:")
+
+	for _, event := range trace {
+		indent := strings.Repeat("  ", event.Depth+1)
+		switch event.Kind {
+		case "extends":
+			fmt.Printf("%s%s extends: %s\n", indent, event.Preset, strings.Join(event.Parents, ", "))
+		case "skip":
+			fmt.Printf("%s%s: skipped missing optional base %s\n", indent, event.Preset, strings.Join(event.Parents, ", "))
+		case "apply":
+			fmt.Printf("%s%s: applied %d allow, %d read, %d deny\n",
+				indent, event.Preset, event.Counts[0], event.Counts[1], event.Counts[2])
+		case "remove":
+			fmt.Printf("%s%s: removed %s %s (from %s)\n", indent, event.Preset, event.Section, event.Path, event.From)
+		case "override":
+			fmt.Printf("%s%s: overrides %s %s (from %s)\n", indent, event.Preset, event.Section, event.Path, event.From)
+		}
+	}
+
+	sections := []struct {
+		title string
+		paths []AllowPath
+	}{
+		{"allow (write paths)", p.Allow},
+		{"read (read-only paths)", p.Read},
+		{"deny (read+write, except restores read-only)", p.Deny},
+		{"deny-write (write only, reads unaffected)", p.DenyWrite},
+	}
+	for _, section := range sections {
+		if len(section.paths) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", section.title)
+		for _, path := range section.paths {
+			fmt.Printf("  - %s [%s]\n", path.Path, path.Origin)
+			for _, exc := range path.Except {
+				fmt.Printf("    except: %s\n", exc)
+			}
+		}
+	}
+}
+
+// writePresetPaths writes one path section of a preset; paths limited to one OS,
+// in time or to some commands use the mapping form so those keys survive
+func writePresetPaths(w io.Writer, key string, paths []AllowPath) {
+	if len(paths) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "    %s:\n", key)
+	for _, path := range sortedPaths(paths) {
+		if path.OS != "" || path.Until != "" || path.WhenCommand != "" || path.Recursive != nil {
+			fmt.Fprintf(w, "      - path: %q\n", path.Path)
+			if path.OS != "" {
+				fmt.Fprintf(w, "        os: %s\n", path.OS)
+			}
+			if path.Until != "" {
+				fmt.Fprintf(w, "        until: %q\n", path.Until)
+			}
+			if path.WhenCommand != "" {
+				fmt.Fprintf(w, "        when-command: %q\n", path.WhenCommand)
+			}
+			if path.Recursive != nil {
+				fmt.Fprintf(w, "        recursive: %t\n", *path.Recursive)
+			}
+			continue
+		}
+		fmt.Fprintf(w, "      - %q\n", path.Path)
+	}
+}
+
+func printPresetYAML(name string, p *Preset, extends []string) {
+	writePresetYAML(os.Stdout, name, p, extends)
+}
+
+// writePresetYAML writes a preset as a config file snippet
+func writePresetYAML(w io.Writer, name string, p *Preset, extends []string) {
+	presetName := name
+	if strings.HasPrefix(name, "builtin:") {
+		presetName = strings.TrimPrefix(name, "builtin:")
+	}
+
+	if len(extends) > 0 {
+		fmt.Fprintf(w, "# Extends: %s\n", strings.Join(extends, " → "))
+	}
+	fmt.Fprintln(w, "presets:")
+	fmt.Fprintf(w, "  %s:\n", presetName)
+
+	if len(p.Extends) > 0 {
+		fmt.Fprintln(w, "    extends:")
+		for _, ext := range p.Extends {
+			fmt.Fprintf(w, "      - %q\n", ext)
+		}
+	}
+	if len(p.SoftExtends) > 0 {
+		fmt.Fprintln(w, "    optional-extends:")
+		for _, ext := range p.SoftExtends {
+			fmt.Fprintf(w, "      - %q\n", ext)
+		}
+	}
+
+	if p.AllowGit {
+		fmt.Fprintln(w, "    allow-git: true")
+	}
+	if p.AllowDNS {
+		fmt.Fprintln(w, "    allow-dns: true")
+	}
+	if p.AllowGo {
+		fmt.Fprintln(w, "    allow-go: true")
+	}
+	if p.AllowKeychain {
+		fmt.Fprintln(w, "    allow-keychain: true")
+	}
+	if p.SkipDefaults {
+		fmt.Fprintln(w, "    skip-defaults: true")
+	}
+	if p.Strict {
+		fmt.Fprintln(w, "    strict: true")
+	}
+	if p.Priority != 0 {
+		fmt.Fprintf(w, "    priority: %d\n", p.Priority)
+	}
+
+	writePresetPaths(w, "allow", p.Allow)
+
+	writePresetPaths(w, "read", p.Read)
+
+	writePresetPaths(w, "deny", p.Deny)
+
+	writePresetPaths(w, "deny-write", p.DenyWrite)
+
+	if len(p.Env) > 0 {
+		fmt.Fprintln(w, "    env:")
+		for _, name := range sortedEnvNames(p.Env) {
+			fmt.Fprintf(w, "      %s: %q\n", name, p.Env[name])
+		}
+	}
+
+	if p.Remove != nil {
+		fmt.Fprintln(w, "    remove:")
+		sections := []struct {
+			name  string
+			paths []string
+		}{
+			{"allow", p.Remove.Allow},
+			{"read", p.Remove.Read},
+			{"deny", p.Remove.Deny},
+		}
+		for _, section := range sections {
+			if len(section.paths) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "      %s:\n", section.name)
+			for _, path := range section.paths {
+				fmt.Fprintf(w, "        - %q\n", path)
+			}
+		}
+	}
+}
+
+func main() {
+	// Indicate that we are running inside a cage
+	if err := os.Setenv(inCageEnv, "1"); err != nil {
+		logger.Errorf("error setting environment variable %s: %v", inCageEnv, err)
+		os.Exit(1)
+	}
+
+	// `cage preset ...` manages installed presets; use `cage -- preset` to run a
+	// command named preset
+	if len(os.Args) > 1 && os.Args[1] == "preset" {
+		if err := runPresetCommand(os.Args[2:]); err != nil {
+			logger.Errorf("preset: %v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	// `cage exec-sync ...` keeps cage running as the command's supervisor
+	execSync := len(os.Args) > 1 && os.Args[1] == "exec-sync"
+	if execSync {
+		os.Args = append(os.Args[:1:1], os.Args[2:]...)
+	}
+
+	flags, args := parseFlags()
+	whichPaths, isWhich := whichQuery(os.Args[1:], args)
+
+	// Handle version flag
+	if flags.version {
+		fmt.Printf("cage version %s\n", Version())
+		os.Exit(0)
+	}
+
+	// Handle print-default-config flag
+	if flags.printDefault {
+		os.Stdout.Write(defaultConfigYAML)
+		os.Exit(0)
+	}
+
+	// Handle config-check flag; it needs no command
+	if flags.configCheck {
+		os.Exit(runConfigCheck(os.Stdout, flags.configPath))
 	}
 
-	if len(p.Extends) > 0 {
-		fmt.Println("extends:")
-		for _, ext := range p.Extends {
-			fmt.Printf("  - %s\n", ext)
+	for _, name := range flags.appSupport {
+		if err := validateBaseName(name); err != nil {
+			logger.Errorf("--allow-app-support: %v", err)
+			os.Exit(1)
+		}
+	}
+	for _, name := range flags.keychainFiles {
+		if err := validateBaseName(name); err != nil {
+			logger.Errorf("--allow-keychain-file: %v", err)
+			os.Exit(1)
 		}
 	}
 
-	if p.AllowGit {
-		fmt.Println("allow-git: true")
+	if flags.workDir != "" {
+		dir := cleanPath(expandUserPath(flags.workDir))
+		info, err := os.Stat(dir)
+		if err == nil && !info.IsDir() {
+			err = fmt.Errorf("%s is not a directory", dir)
+		}
+		if err != nil {
+			logger.Errorf("--working-dir: %v", err)
+			os.Exit(1)
+		}
+		flags.workDir = dir
 	}
-	if p.AllowKeychain {
-		fmt.Println("allow-keychain: true")
+
+	if flags.carveFraction <= 0 || flags.carveFraction > 1 {
+		logger.Errorf("--carve-out-fraction: must be greater than 0 and at most 1, got %g", flags.carveFraction)
+		os.Exit(1)
 	}
-	if p.SkipDefaults {
-		fmt.Println("skip-defaults: true")
+
+	if flags.profileLint && !flags.dryRun {
+		logger.Errorf("--profile-lint requires --dry-run")
+		os.Exit(1)
 	}
-	if p.Strict {
-		fmt.Println("strict: true")
+	if flags.printEnv && !flags.dryRun {
+		logger.Errorf("--print-env requires --dry-run")
+		os.Exit(1)
+	}
+	if flags.maskEnv && !flags.printEnv {
+		logger.Errorf("--mask-env requires --print-env")
+		os.Exit(1)
 	}
 
-	if len(p.Allow) > 0 {
-		fmt.Println("\nallow (write paths):")
-		for _, path := range sortedPaths(p.Allow) {
-			fmt.Printf("  - %s\n", path.Path)
+	if flags.dryRunStrict != "" {
+		if !flags.dryRun {
+			logger.Errorf("--dry-run-strict requires --dry-run")
+			os.Exit(1)
+		}
+		if flags.dryRunStrict != "conflicts" && flags.dryRunStrict != "all" {
+			logger.Errorf("--dry-run-strict: invalid level %q (must be conflicts or all)", flags.dryRunStrict)
+			os.Exit(1)
 		}
 	}
 
-	if len(p.Read) > 0 {
-		fmt.Println("\nread (read-only paths):")
-		for _, path := range sortedPaths(p.Read) {
-			fmt.Printf("  - %s\n", path.Path)
+	// --watch runs cage again as a child on every config change
+	if flags.watch {
+		if err := runWatch(flags, args); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(1)
 		}
+		os.Exit(0)
+	}
+	if flags.rerun {
+		logger.Errorf("--rerun requires --watch")
+		os.Exit(1)
 	}
 
-	if len(p.Deny) > 0 {
-		fmt.Println("\ndeny (read+write, except restores read-only):")
-		for _, path := range sortedPaths(p.Deny) {
-			fmt.Printf("  - %s\n", path.Path)
-			for _, exc := range path.Except {
-				fmt.Printf("    except: %s\n", exc)
+	// --trace-deny runs cage again under strace and reports what was denied
+	if flags.traceDeny {
+		if runtime.GOOS != "linux" {
+			logger.Errorf("--trace-deny is only supported on Linux")
+			os.Exit(1)
+		}
+		if flags.dryRun {
+			logger.Errorf("--trace-deny cannot be combined with --dry-run")
+			os.Exit(1)
+		}
+		code, err := runTraceDeny(args, execSync)
+		if err != nil {
+			logger.Errorf("--trace-deny: %v", err)
+			if code == 0 {
+				code = 1
 			}
 		}
+		os.Exit(code)
 	}
-}
 
-func printPresetYAML(name string, p *Preset, extends []string) {
-	presetName := name
-	if strings.HasPrefix(name, "builtin:") {
-		presetName = strings.TrimPrefix(name, "builtin:")
+	// Open the structured log before anything worth recording happens
+	if flags.logFile != "" {
+		level, err := parseLogLevel(flags.logLevel)
+		if err != nil {
+			logger.Errorf("--log-level: %v", err)
+			os.Exit(1)
+		}
+		if err := logger.openLogFile(flags.logFile, level); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(1)
+		}
 	}
 
-	if len(extends) > 0 {
-		fmt.Printf("# Extends: %s\n", strings.Join(extends, " → "))
+	if flags.allowGit && flags.protectGit {
+		logger.Errorf("--allow-git and --protect-git cannot be combined")
+		os.Exit(1)
 	}
-	fmt.Println("presets:")
-	fmt.Printf("  %s:\n", presetName)
 
-	if len(p.Extends) > 0 {
-		fmt.Println("    extends:")
-		for _, ext := range p.Extends {
-			fmt.Printf("      - %q\n", ext)
+	// Split "# reason" annotations off the rule flags
+	flags.stripRuleComments()
+
+	// A prebuilt profile replaces rule generation, so rule flags cannot be combined with it
+	if flags.profileFile != "" {
+		if conflicts := flags.profileFileConflicts(); len(conflicts) > 0 {
+			logger.Errorf("--profile-file cannot be combined with %s", strings.Join(conflicts, ", "))
+			os.Exit(1)
 		}
 	}
 
-	if p.AllowGit {
-		fmt.Println("    allow-git: true")
-	}
-	if p.AllowKeychain {
-		fmt.Println("    allow-keychain: true")
-	}
-	if p.SkipDefaults {
-		fmt.Println("    skip-defaults: true")
-	}
-	if p.Strict {
-		fmt.Println("    strict: true")
+	seatbeltParams, err := parseSeatbeltParams(flags.seatbeltArgs)
+	if err != nil {
+		logger.Errorf("--seatbelt-param: %v", err)
+		os.Exit(1)
 	}
 
-	if len(p.Allow) > 0 {
-		fmt.Println("    allow:")
-		for _, path := range sortedPaths(p.Allow) {
-			fmt.Printf("      - %q\n", path.Path)
+	// A rule file replaces presets and rule flags
+	if flags.rulesJSON != "" {
+		if conflicts := flags.rulesJSONConflicts(); len(conflicts) > 0 {
+			logger.Errorf("--rules-from-json cannot be combined with %s", strings.Join(conflicts, ", "))
+			os.Exit(1)
 		}
 	}
 
-	if len(p.Read) > 0 {
-		fmt.Println("    read:")
-		for _, path := range sortedPaths(p.Read) {
-			fmt.Printf("      - %q\n", path.Path)
-		}
+	// Load paths from --allow-from, --read-from and --deny-from files
+	if err := flags.loadPathFiles(); err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
 	}
 
-	if len(p.Deny) > 0 {
-		fmt.Println("    deny:")
-		for _, path := range sortedPaths(p.Deny) {
-			fmt.Printf("      - %q\n", path.Path)
-		}
+	// Load paths from --allow-env, --read-env and --deny-env variables
+	if err := flags.loadPathEnvVars(); err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
 	}
-}
 
-func main() {
-	// Indicate that we are running inside a cage
-	if err := os.Setenv(inCageEnv, "1"); err != nil {
-		fmt.Fprintf(os.Stderr, "cage: error setting environment variable %s: %v\n", inCageEnv, err)
+	// Expand brace patterns such as ~/src/{a,b} in the path flags
+	if err := flags.expandBracePaths(); err != nil {
+		logger.Errorf("%v", err)
 		os.Exit(1)
 	}
 
-	flags, args := parseFlags()
+	// Load configuration
+	phaseStart := time.Now()
+	config, err := loadConfig(flags.configPath)
+	if err != nil {
+		logger.Errorf("error loading config: %v", err)
+		os.Exit(1)
+	}
+	// Add the presets installed with `cage preset add`
+	presetDir := flags.presetDir
+	if presetDir == "" {
+		// Without a config directory there is nothing installed to load
+		presetDir, _ = defaultPresetDir()
+	}
+	if presetDir != "" {
+		if err := loadPresetDir(config, presetDir); err != nil {
+			logger.Errorf("error loading presets: %v", err)
+			os.Exit(1)
+		}
+	}
+	reportTiming(flags.profileTiming, "config loading", phaseStart)
 
-	// Handle version flag
-	if flags.version {
-		fmt.Printf("cage version %s\n", Version())
-		os.Exit(0)
+	// Apply the configured default output format unless -o was given
+	flags.outputFormat, err = effectiveOutputFormat(flags, config)
+	if err != nil {
+		logger.Errorf("error loading config: %v", err)
+		os.Exit(1)
 	}
 
-	// Load configuration
-	config, err := loadConfig(flags.configPath)
+	// Register --preset-inline presets; they join the active set after --init-preset
+	// is handled, as a saved preset cannot extend them
+	inlineNames, err := addInlinePresets(config, flags.presetInline)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "cage: error loading config: %v\n", err)
+		logger.Errorf("%v", err)
 		os.Exit(1)
 	}
+	flags.presets = config.ExpandPresetNames(flags.presets)
 
 	// Handle list-presets flag
 	if flags.listPresets {
@@ -346,28 +1697,80 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Handle explain-preset flag
+	if flags.explainPreset != "" {
+		resolved, trace, err := config.ExplainPreset(flags.explainPreset)
+		if err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(1)
+		}
+		printPresetExplanation(flags.explainPreset, resolved, trace)
+		os.Exit(0)
+	}
+
 	// Handle show-preset flag
 	if flags.showPreset != "" {
 		rawPreset, ok := config.GetPreset(flags.showPreset)
 		if !ok {
-			fmt.Fprintf(os.Stderr, "cage: preset not found: %s\n", flags.showPreset)
+			logger.Errorf("preset not found: %s", flags.showPreset)
 			os.Exit(1)
 		}
 
 		if flags.outputFormat == "raw" {
-			printPreset(flags.showPreset, &rawPreset, "yaml", nil)
+			printPreset(flags.showPreset, &rawPreset, "yaml", nil, "")
 		} else {
 			resolved, err := config.ResolvePreset(flags.showPreset, nil)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+				logger.Errorf("%v", err)
 				os.Exit(1)
 			}
-			printPreset(flags.showPreset, resolved, flags.outputFormat, rawPreset.Extends)
+			portability := ""
+			if flags.portability {
+				portability = runtime.GOOS
+			}
+			printPreset(flags.showPreset, resolved, flags.outputFormat, rawPreset.Extends, portability)
+		}
+		os.Exit(0)
+	}
+
+	// Handle init-preset flag
+	if flags.initPreset != "" {
+		preset := presetFromFlags(flags)
+		if len(flags.allowOutput) > 0 {
+			logger.Warnf("--allow-output paths cannot be expressed in a preset and were left out")
+		}
+		if len(flags.allowAppend) > 0 {
+			logger.Warnf("--allow-append paths cannot be expressed in a preset and were left out")
+		}
+		if len(inlineNames) > 0 {
+			logger.Warnf("--preset-inline presets cannot be extended by a saved preset and were left out")
+		}
+		if !flags.save {
+			printPresetYAML(flags.initPreset, preset, nil)
+			os.Exit(0)
+		}
+		path, err := configFilePath(flags.configPath)
+		if err == nil {
+			err = savePreset(path, flags.initPreset, preset)
+		}
+		if err != nil {
+			logger.Errorf("--save: %v", err)
+			os.Exit(1)
 		}
+		fmt.Printf("Saved preset %s to %s\n", flags.initPreset, path)
 		os.Exit(0)
 	}
+	if flags.save {
+		logger.Errorf("--save requires --init-preset")
+		os.Exit(1)
+	}
+	for _, name := range inlineNames {
+		if !slices.Contains(flags.presets, name) {
+			flags.presets = append(flags.presets, name)
+		}
+	}
 
-	if len(args) == 0 {
+	if len(args) == 0 && !flags.preview && !flags.validate && !flags.dumpRules && !isWhich {
 		fmt.Fprintf(os.Stderr, "Usage: cage [flags] <command> [command-args...]\n")
 		fmt.Fprintf(
 			os.Stderr,
@@ -377,153 +1780,476 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Remember how each preset was selected; rules from presets named with --preset
+	// (the zero value) take precedence over auto-detected and default presets
+	presetOrigins := make(map[string]RuleOrigin)
+
 	// Auto-detect presets and merge with command-line presets
-	if len(config.AutoPresets) > 0 {
+	phaseStart = time.Now()
+	if len(config.AutoPresets) > 0 && len(args) > 0 && flags.profileFile == "" && flags.rulesJSON == "" {
 		autoPresets, err := config.GetAutoPresets(args[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cage: error detecting auto-presets: %v\n", err)
+			logger.Errorf("error detecting auto-presets: %v", err)
 			os.Exit(1)
 		}
 
-		// Merge auto-detected presets with command-line presets
-		// Command-line presets come first to maintain priority
+		// Merge auto-detected presets with command-line presets; the list order
+		// only decides which preset's env wins, conflicts are ranked by origin
+		for _, name := range autoPresets {
+			if !slices.Contains(flags.presets, name) {
+				presetOrigins[name] = OriginAutoPreset
+			}
+		}
 		flags.presets = append(flags.presets, autoPresets...)
 	}
 
 	// Determine if we should skip defaults
-	skipDefaults := flags.noDefaults
+	skipDefaults := flags.noDefaults || flags.profileFile != "" || flags.rulesJSON != ""
 
-	// Check if any preset has skip-defaults: true
-	if !skipDefaults {
-		for _, presetName := range flags.presets {
-			resolved, err := config.ResolvePreset(presetName, nil)
-			if err != nil {
-				// Will be reported later during processing
-				continue
-			}
-			if resolved.SkipDefaults {
-				skipDefaults = true
-				break
+	// Check if any preset has skip-defaults: true; one that was not named with
+	// --preset is pointed out, or ignored with the explicit scope
+	if !skipDefaults && len(config.Defaults.Presets) > 0 {
+		scope, err := skipDefaultsScope(config.Defaults)
+		if err != nil {
+			logger.Errorf("error: %v", err)
+			os.Exit(1)
+		}
+		var notes []string
+		skipDefaults, notes = decideSkipDefaults(scope, skipDefaultsSources(config, flags.presets, presetOrigins))
+		if !flags.quiet {
+			for _, note := range notes {
+				logger.Warnf("%s", note)
 			}
 		}
 	}
 
 	// Apply default presets (prepend to preset list so they're processed first)
 	if !skipDefaults && len(config.Defaults.Presets) > 0 {
+		for _, name := range config.Defaults.Presets {
+			if !slices.Contains(flags.presets, name) {
+				presetOrigins[name] = OriginDefaultPreset
+			}
+		}
 		flags.presets = append(config.Defaults.Presets, flags.presets...)
 	}
 
 	// Create a RuleResolver instance
 	resolver := NewRuleResolver()
+	presetOrder, err := parsePresetOrder(flags.presetOrder)
+	if err != nil {
+		logger.Errorf("--preset-order: %v", err)
+		os.Exit(1)
+	}
+	resolver.SetPresetOrder(presetOrder)
+	resolver.SetBaseDir(flags.workDir)
 
 	// Add CLI rules first
-	cliSource := RuleSource{IsCLI: true}
+	cliSource := func(path string) RuleSource {
+		return RuleSource{Origin: OriginCLI, Reason: flags.ruleReasons[path]}
+	}
 	for _, path := range flags.allowPaths {
-		resolver.AddAllowRule(path, cliSource)
+		resolver.AddAllowRule(path, cliSource(path))
+	}
+	for _, path := range flags.allowOutput {
+		resolver.AddOutputRule(path, cliSource(path))
+	}
+	for _, path := range flags.allowAppend {
+		resolver.AddAppendRule(path, cliSource(path))
+	}
+	if len(flags.appSupport) > 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			logger.Errorf("--allow-app-support: %v", err)
+			os.Exit(1)
+		}
+		for _, name := range flags.appSupport {
+			for _, path := range appSupportPaths(runtime.GOOS, home, name) {
+				resolver.AddAllowRule(path, cliSource(path))
+			}
+		}
+	}
+	for _, path := range flags.allowMounts {
+		if warning := mountWarning(runtime.GOOS, cleanPathIn(flags.workDir, path)); warning != "" {
+			logger.Warnf("--allow-mount: %s", warning)
+		}
+		resolver.AddReadRule(path, cliSource(path))
 	}
 	for _, path := range flags.allowRead {
-		resolver.AddReadRule(path, cliSource)
+		resolver.AddReadRule(path, cliSource(path))
+	}
+	for _, path := range flags.allowDevices {
+		resolver.AddAllowRule(path, cliSource(path))
 	}
 	for _, path := range flags.deny {
-		resolver.AddDenyRule(os.ExpandEnv(path), nil, cliSource)
+		resolver.AddDenyRule(expandUserPath(path), nil, cliSource(path))
+	}
+	for _, path := range flags.denyFileLevel {
+		resolver.AddFileLevelDenyRule(expandUserPath(path), AccessReadWrite, cliSource(path))
 	}
 
 	// Track global settings from presets
 	allowKeychain := flags.allowKeychain
 	allowGit := flags.allowGit
+	allowDNS := flags.allowDNS
+	allowGo := flags.allowGo
 	strict := flags.strict
+	var presetEnv map[string]string
+
+	// Paths with a when-command apply only to a matching command; which has none
+	presetCommand := ""
+	if len(args) > 0 && !isWhich {
+		presetCommand = args[0]
+	}
 
 	// Process each preset and add their rules
 	for _, presetName := range flags.presets {
 		resolved, err := config.ResolvePreset(presetName, nil)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+			logger.Errorf("%v", err)
 			os.Exit(1)
 		}
 
 		// Process preset to expand dynamic values
-		processedPreset, err := resolved.ProcessPreset()
+		processedPreset, err := resolved.ProcessPresetFor(presetCommand)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cage: error processing preset '%s': %v\n", presetName, err)
+			logger.Errorf("error processing preset '%s': %v", presetName, err)
 			os.Exit(1)
 		}
 
 		// Validate preset for internal conflicts
-		presetSource := RuleSource{PresetName: presetName}
+		presetSource := RuleSource{PresetName: presetName, Origin: presetOrigins[presetName], Priority: processedPreset.Priority}
 
 		// Add preset rules to resolver first, then validate
 		for _, path := range processedPreset.Allow {
+			if path.Refer != nil && !*path.Refer {
+				resolver.AddAllowRuleNoRefer(path.Path, presetSource)
+				continue
+			}
 			resolver.AddAllowRule(path.Path, presetSource)
 		}
 		for _, path := range processedPreset.Read {
 			resolver.AddReadRule(path.Path, presetSource)
 		}
 		for _, path := range processedPreset.Deny {
+			if path.Recursive != nil && !*path.Recursive {
+				resolver.AddFileLevelDenyRule(path.Path, AccessReadWrite, presetSource)
+				continue
+			}
 			resolver.AddDenyRule(path.Path, path.Except, presetSource)
 		}
+		for _, path := range processedPreset.DenyWrite {
+			if path.Recursive != nil && !*path.Recursive {
+				resolver.AddFileLevelDenyRule(path.Path, AccessWrite, presetSource)
+				continue
+			}
+			resolver.AddWriteDenyRule(path.Path, presetSource)
+		}
 
 		// Validate for intra-preset conflicts
 		validationErrors := resolver.ValidatePreset(presetName)
 		for _, err := range validationErrors {
 			ruleErr := err.(*RuleError)
 			if ruleErr.Type == ErrorConflict {
-				fmt.Fprintf(os.Stderr, "cage: error: preset '%s' has conflicting rules for %s\n", presetName, ruleErr.Path)
+				logger.Errorf("error: preset '%s' has conflicting rules for %s", presetName, ruleErr.Path)
 				os.Exit(1)
 			} else if ruleErr.Type == ErrorDuplicate {
-				fmt.Fprintf(os.Stderr, "cage: warning: preset '%s' has duplicate allow/deny for %s\n", presetName, ruleErr.Path)
+				logger.Warnf("preset '%s' has duplicate allow/deny for %s", presetName, ruleErr.Path)
 			}
 		}
 
 		// Preset's settings are ORed with command-line flags
 		allowKeychain = allowKeychain || processedPreset.AllowKeychain
 		allowGit = allowGit || processedPreset.AllowGit
+		allowDNS = allowDNS || processedPreset.AllowDNS
+		allowGo = allowGo || processedPreset.AllowGo
 		strict = strict || processedPreset.Strict
+
+		// Later presets override environment variables set by earlier ones
+		for name, value := range processedPreset.Env {
+			if presetEnv == nil {
+				presetEnv = make(map[string]string)
+			}
+			presetEnv[name] = value
+		}
 	}
 
 	// Add git common directory if enabled
 	if allowGit {
 		gitCommonDir, err := getGitCommonDir()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "cage: warning: --allow-git: %v\n", err)
+			logger.Warnf("--allow-git: %v", err)
 		} else if gitCommonDir != "" {
 			resolver.AddAllowRule(gitCommonDir, RuleSource{PresetName: "-allow-git"})
 		}
 	}
 
+	// Add the caches and config of the enabled toolchain helpers
+	enabledToolchains := map[string]bool{
+		"go":     allowGo,
+		"node":   flags.allowNode,
+		"python": flags.allowPython,
+		"rust":   flags.allowRust,
+	}
+	home, _ := os.UserHomeDir()
+	env := toolchainEnv{goos: runtime.GOOS, home: home, getenv: os.Getenv}
+	for _, helper := range toolchainHelpers {
+		if !enabledToolchains[helper.name] {
+			continue
+		}
+		paths, err := helper.resolve(env)
+		if err != nil {
+			logger.Warnf("--allow-%s: %v", helper.name, err)
+		}
+		source := RuleSource{PresetName: "-allow-" + helper.name}
+		for _, path := range paths.Allow {
+			resolver.AddAllowRule(path, source)
+		}
+		for _, path := range paths.Read {
+			resolver.AddReadRule(path, source)
+		}
+	}
+
+	// Add the runtime directory and display and session bus sockets if enabled
+	if flags.allowDesktop {
+		paths, err := desktopPaths(env)
+		if errors.Is(err, errDesktopUnsupported) {
+			logger.Infof("--allow-desktop %v", err)
+		} else if err != nil {
+			logger.Warnf("--allow-desktop: %v", err)
+		}
+		source := RuleSource{PresetName: "-allow-desktop"}
+		for _, path := range paths.Allow {
+			resolver.AddAllowRule(path, source)
+		}
+		for _, path := range paths.Read {
+			resolver.AddReadRule(path, source)
+		}
+	}
+
+	// Protect git history; as a command-line rule it wins over presets with allow-git
+	if flags.protectGit {
+		if err := addProtectGitRule(resolver); err != nil {
+			logger.Warnf("--protect-git: %v", err)
+		}
+	}
+
+	// Add the files needed for DNS resolution if enabled
+	if allowDNS {
+		for _, path := range dnsReadPaths(runtime.GOOS) {
+			resolver.AddReadRule(path, RuleSource{PresetName: "-allow-dns"})
+		}
+	}
+
+	// Add the command's shared libraries if enabled
+	if flags.autoLibs && len(args) > 0 {
+		libs, err := commandLibraryPaths(args[0])
+		if err != nil {
+			logger.Warnf("--auto-libs: %v", err)
+		}
+		for _, lib := range libs {
+			resolver.AddReadRule(lib, RuleSource{PresetName: "-auto-libs"})
+		}
+	}
+
+	reportTiming(flags.profileTiming, "preset resolution", phaseStart)
+
 	// Resolve all rules and detect conflicts
+	phaseStart = time.Now()
 	writeRules, readRules, conflicts := resolver.Resolve()
+	if flags.rulesJSON != "" {
+		writeRules, readRules, err = loadRulesJSON(flags.rulesJSON)
+		if err != nil {
+			logger.Errorf("--rules-from-json: %v", err)
+			os.Exit(1)
+		}
+	}
+	reportTiming(flags.profileTiming, "rule resolution", phaseStart)
+
+	// Keep what the command can see, but take away every write allow
+	if flags.downgrade {
+		var downgraded []ResolvedRule
+		writeRules, readRules, downgraded = downgradeWrites(writeRules, readRules)
+		if !flags.quiet {
+			for _, rule := range downgraded {
+				logger.Infof("--downgrade-writes: %s is read-only (from %s)", formatRulePath(rule), formatRuleSource(rule))
+			}
+		}
+		if !strict && runtime.GOOS == "linux" && len(downgraded) > 0 {
+			logger.Warnf("--downgrade-writes without --strict: every path stays readable on Linux, only writes are removed")
+		}
+	}
+	logResolution(flags.presets, writeRules, readRules, conflicts)
+
+	// Point out allows that duplicate access granted elsewhere, and paths that
+	// were normalized
+	if flags.verbose {
+		for _, note := range resolver.RedundantAllows() {
+			logger.Infof("%s", redundancyNote(note))
+		}
+		for _, rule := range canonicalizedRules(writeRules, readRules) {
+			logger.Infof("path %s (from %s)", formatRulePath(rule), formatRuleSource(rule))
+		}
+	}
+
+	// Reject paths that could break out of a string in the generated profile
+	if err := checkRulePaths(writeRules, readRules); err != nil {
+		logger.Errorf("error: %v", err)
+		os.Exit(1)
+	}
+
+	// Guard against presets that would produce an unloadable profile
+	limits, err := ruleLimits(config.Defaults)
+	if err != nil {
+		logger.Errorf("error: %v", err)
+		os.Exit(1)
+	}
+	if err := checkRuleLimits(writeRules, readRules, limits); err != nil {
+		logger.Errorf("error: %v", err)
+		os.Exit(1)
+	}
+
+	// Catch write allows that would open system directories
+	if !flags.reallyMeanIt {
+		risky := sensitiveWrites(writeRules, runtime.GOOS)
+		for _, write := range risky {
+			if flags.strictSafety {
+				logger.Errorf("error: write access to %s from %s covers system directory %s (use --i-really-mean-it to allow it)",
+					write.Rule.Path, formatRuleSource(write.Rule), write.Sensitive)
+			} else {
+				logger.Warnf("write access to %s from %s covers system directory %s",
+					write.Rule.Path, formatRuleSource(write.Rule), write.Sensitive)
+			}
+		}
+		if flags.strictSafety && len(risky) > 0 {
+			os.Exit(1)
+		}
+	}
+
+	// Handle validate flag
+	if flags.validate {
+		printLintAndExit(lintRules(writeRules, readRules, runtime.GOOS, flags.carveFraction))
+	}
+
+	// Handle dump-rules flag
+	if flags.dumpRules {
+		printRulesAndExit(writeRules, readRules)
+	}
+
+	// Handle preview flag
+	if flags.preview {
+		printPreviewAndExit(flags.presets, writeRules, readRules, conflicts, flags.outputFormat)
+	}
+
+	// Handle `cage which <path>...`
+	if isWhich {
+		printWhichAndExit(whichPaths, writeRules, readRules, strict, runtime.GOOS)
+	}
 
-	// Count and warn about cross-preset conflicts
-	crossPresetConflicts := 0
-	for _, conflict := range conflicts {
-		if !conflict.IsSamePreset {
-			crossPresetConflicts++
+	// Warn about each cross-preset conflict so disagreeing presets are noticed
+	if !flags.quiet {
+		for _, warning := range crossPresetWarnings(conflicts) {
+			logger.Warnf("presets disagree on %s", warning)
 		}
 	}
-	if crossPresetConflicts > 0 {
-		fmt.Fprintf(os.Stderr, "cage: warning: %d cross-preset conflicts resolved (use --dry-run to see details)\n", crossPresetConflicts)
+
+	killSignal, err := parseSignal(flags.killSignal)
+	if err != nil {
+		logger.Errorf("--kill-signal: %v", err)
+		os.Exit(1)
+	}
+
+	runAs, err := resolveCredentials(flags.user, flags.uid, flags.gid)
+	if err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	rlimits, err := resourceLimits(flags)
+	if err != nil {
+		logger.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	connectSockets, err := connectSocketPaths(flags.workDir, flags.allowConnect)
+	if err != nil {
+		logger.Errorf("--allow-connect: %v", err)
+		os.Exit(1)
 	}
 
 	// Create sandbox configuration
 	sandboxConfig := &SandboxConfig{
-		AllowAll:      flags.allowAll,
-		AllowKeychain: allowKeychain,
-		Strict:        strict,
-		WriteRules:    writeRules,
-		ReadRules:     readRules,
-		Conflicts:     conflicts,
-		Command:       args[0],
-		Args:          args[1:],
+		AllowAll:           flags.allowAll,
+		AllowKeychain:      allowKeychain,
+		KeychainFiles:      flags.keychainFiles,
+		NoDefaultTmp:       flags.noDefaultTmp,
+		AllowPTY:           flags.allowPTY,
+		TTYDevices:         ttyDevices(flags.noTTY),
+		Strict:             strict,
+		WriteRules:         writeRules,
+		ReadRules:          readRules,
+		Conflicts:          conflicts,
+		MaxConflicts:       flags.maxConflicts,
+		SummaryOnly:        flags.summaryOnly,
+		Collapse:           flags.collapse,
+		AnnotateProfile:    flags.annotate,
+		ProfileLint:        flags.profileLint,
+		PrintEnv:           flags.printEnv,
+		MaskEnv:            flags.maskEnv,
+		CaseInsensitive:    flags.caseFold,
+		CompatFileRead:     flags.compatRead,
+		AllowDevices:       flags.allowDevices,
+		ConnectSockets:     connectSockets,
+		Command:            args[0],
+		Args:               args[1:],
+		ProfileTiming:      flags.profileTiming,
+		WorkingDir:         flags.workDir,
+		Supervise:          execSync,
+		Timeout:            flags.timeout,
+		KillSignal:         killSignal,
+		KillGrace:          flags.killGrace,
+		NoRefer:            flags.noRefer,
+		AllowNewPrivs:      flags.allowNewPrivs,
+		RunAs:              runAs,
+		KeepFDs:            flags.keepFDs,
+		Limits:             rlimits,
+		RequireLandlockABI: flags.requireABI,
+		Env:                presetEnv,
+		ProfileFile:        flags.profileFile,
+		SeatbeltParams:     seatbeltParams,
+		Verbose:            flags.verbose,
 	}
 
 	// Handle dry-run flag
 	if flags.dryRun {
-		printDryRunAndExit(sandboxConfig)
+		var problems []string
+		if flags.dryRunStrict != "" {
+			problems = dryRunProblems(flags.dryRunStrict, sandboxConfig, lintRules(writeRules, readRules, runtime.GOOS, flags.carveFraction))
+		}
+		printDryRunAndExit(sandboxConfig, problems)
+	}
+
+	// Handle compare-run flag
+	if flags.compareRun {
+		if err := compareRun(sandboxConfig); err != nil {
+			logger.Errorf("%v", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
 	}
 
 	// Execute in sandbox
+	logger.Event(LogInfo, "exec", map[string]any{
+		"command": sandboxConfig.Command,
+		"args":    sandboxConfig.Args,
+		"strict":  sandboxConfig.Strict,
+	})
 	if err := RunInSandbox(sandboxConfig); err != nil {
-		fmt.Fprintf(os.Stderr, "cage: %v\n", err)
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			logger.Event(LogInfo, "exit", map[string]any{"code": exitErr.code})
+			os.Exit(exitErr.code)
+		}
+		logger.Errorf("%v", err)
 		os.Exit(1)
 	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"reflect"
 	"sort"
@@ -619,7 +620,7 @@ func TestPrintPresetText(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			output := captureOutput(func() {
-				printPresetText(tt.presetName, tt.preset, tt.extends)
+				printPresetText(tt.presetName, tt.preset, tt.extends, "")
 			})
 
 			for _, want := range tt.wantContains {
@@ -736,7 +737,7 @@ func TestPrintPresetFormats(t *testing.T) {
 
 	t.Run("text format", func(t *testing.T) {
 		output := captureOutput(func() {
-			printPreset("test", preset, "text", extends)
+			printPreset("test", preset, "text", extends, "")
 		})
 		if !containsString(output, "Preset: test") {
 			t.Errorf("text format should contain 'Preset: test', got:\n%s", output)
@@ -748,7 +749,7 @@ func TestPrintPresetFormats(t *testing.T) {
 
 	t.Run("yaml format", func(t *testing.T) {
 		output := captureOutput(func() {
-			printPreset("test", preset, "yaml", extends)
+			printPreset("test", preset, "yaml", extends, "")
 		})
 		if !containsString(output, "presets:") {
 			t.Errorf("yaml format should contain 'presets:', got:\n%s", output)
@@ -765,7 +766,7 @@ func TestPrintPresetFormats(t *testing.T) {
 			Allow:    []AllowPath{{Path: "/tmp"}},
 		}
 		output := captureOutput(func() {
-			printPreset("test", rawPreset, "yaml", nil)
+			printPreset("test", rawPreset, "yaml", nil, "")
 		})
 		if !containsString(output, "presets:") {
 			t.Errorf("raw format should use yaml output, got:\n%s", output)
@@ -797,3 +798,386 @@ func captureOutput(f func()) string {
 func containsString(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+func TestReadPathsFile(t *testing.T) {
+	t.Setenv("CAGE_TEST_DIR", "/test/env")
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "paths.txt")
+
+	content := `# Build outputs
+/tmp/build
+
+  # indented comment
+  /var/log/app  
+
+$CAGE_TEST_DIR/cache
+./relative
+`
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write paths file: %v", err)
+	}
+
+	paths, err := readPathsFile(file)
+	if err != nil {
+		t.Fatalf("readPathsFile() error = %v", err)
+	}
+
+	expected := []string{"/tmp/build", "/var/log/app", "/test/env/cache", "./relative"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("readPathsFile() = %v, want %v", paths, expected)
+	}
+}
+
+func TestReadPathsFileMissing(t *testing.T) {
+	_, err := readPathsFile(filepath.Join(t.TempDir(), "missing.txt"))
+	if err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	if !os.IsNotExist(err) {
+		t.Errorf("expected not-exist error, got %v", err)
+	}
+}
+
+func TestLoadPathFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	allowFile := filepath.Join(tmpDir, "allow.txt")
+	denyFile := filepath.Join(tmpDir, "deny.txt")
+	os.WriteFile(allowFile, []byte("/from/file\n"), 0o644)
+	os.WriteFile(denyFile, []byte("# secrets\n/secret\n"), 0o644)
+
+	f := &flags{
+		allowPaths: []string{"/from/flag"},
+		allowFrom:  []string{allowFile},
+		denyFrom:   []string{denyFile},
+	}
+	if err := f.loadPathFiles(); err != nil {
+		t.Fatalf("loadPathFiles() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(f.allowPaths, []string{"/from/flag", "/from/file"}) {
+		t.Errorf("unexpected allow paths: %v", f.allowPaths)
+	}
+	if !reflect.DeepEqual(f.deny, []string{"/secret"}) {
+		t.Errorf("unexpected deny paths: %v", f.deny)
+	}
+
+	f.readFrom = []string{filepath.Join(tmpDir, "missing.txt")}
+	err := f.loadPathFiles()
+	if err == nil || !strings.Contains(err.Error(), "missing.txt") {
+		t.Errorf("expected error mentioning missing file, got %v", err)
+	}
+}
+
+func TestLoadPathEnvVars(t *testing.T) {
+	t.Setenv("CAGE_TEST_GOPATH", "/home/user/go")
+	t.Setenv("CAGE_TEST_SECRETS", "/home/user/.secrets")
+	t.Setenv("CAGE_TEST_EMPTY", "")
+
+	f := &flags{
+		allowPaths: []string{"/from/flag"},
+		allowEnv:   []string{"CAGE_TEST_GOPATH"},
+		denyEnv:    []string{"CAGE_TEST_SECRETS"},
+	}
+	if err := f.loadPathEnvVars(); err != nil {
+		t.Fatalf("loadPathEnvVars() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(f.allowPaths, []string{"/from/flag", "/home/user/go"}) {
+		t.Errorf("unexpected allow paths: %v", f.allowPaths)
+	}
+	if !reflect.DeepEqual(f.deny, []string{"/home/user/.secrets"}) {
+		t.Errorf("unexpected deny paths: %v", f.deny)
+	}
+
+	for _, name := range []string{"CAGE_TEST_UNSET_VARIABLE", "CAGE_TEST_EMPTY"} {
+		f := &flags{readEnv: []string{name}}
+		err := f.loadPathEnvVars()
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("expected error mentioning %s, got %v", name, err)
+		}
+	}
+}
+
+func TestEffectiveOutputFormat(t *testing.T) {
+	tests := []struct {
+		name          string
+		flagValue     string
+		flagSet       bool
+		configDefault string
+		expected      string
+		wantErr       bool
+	}{
+		{"flag default without config", "text", false, "", "text", false},
+		{"config default applies", "text", false, "yaml", "yaml", false},
+		{"CLI overrides config", "raw", true, "yaml", "raw", false},
+		{"CLI text overrides config", "text", true, "yaml", "text", false},
+		{"invalid config value", "text", false, "xml", "", true},
+		{"invalid config value ignored with CLI override", "yaml", true, "xml", "yaml", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &flags{outputFormat: tt.flagValue, outputSet: tt.flagSet}
+			config := &Config{Defaults: Defaults{OutputFormat: tt.configDefault}}
+
+			got, err := effectiveOutputFormat(f, config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("effectiveOutputFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("effectiveOutputFormat() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadConfigWithOutputFormat(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+	content := `defaults:
+  output-format: yaml
+`
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	config, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if config.Defaults.OutputFormat != "yaml" {
+		t.Errorf("expected output-format yaml, got %q", config.Defaults.OutputFormat)
+	}
+}
+
+func TestPrintPresetExplanation(t *testing.T) {
+	config := &Config{
+		Presets: map[string]Preset{
+			"base":  {Deny: []AllowPath{{Path: "/secret", Except: []string{"/secret/public"}}}},
+			"child": {Extends: []string{"base"}, Allow: []AllowPath{{Path: "/work"}}},
+		},
+	}
+	resolved, trace, err := config.ExplainPreset("child")
+	if err != nil {
+		t.Fatalf("ExplainPreset() error = %v", err)
+	}
+
+	output := captureOutput(func() {
+		printPresetExplanation("child", resolved, trace)
+	})
+
+	for _, want := range []string{
+		"child extends: base",
+		"    base: applied 0 allow, 0 read, 1 deny",
+		"  child: applied 1 allow, 0 read, 0 deny",
+		"  - /work [child]",
+		"  - /secret [base]",
+		"    except: /secret/public",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output missing %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestProfileFileConflicts(t *testing.T) {
+	f := &flags{profileFile: "custom.sb"}
+	if conflicts := f.profileFileConflicts(); len(conflicts) != 0 {
+		t.Errorf("expected no conflicts without rule flags, got %v", conflicts)
+	}
+
+	f = &flags{
+		profileFile: "custom.sb",
+		allowPaths:  []string{"."},
+		presets:     []string{"builtin:secure"},
+		strict:      true,
+	}
+	expected := []string{"--allow", "--preset", "--strict"}
+	if conflicts := f.profileFileConflicts(); !reflect.DeepEqual(conflicts, expected) {
+		t.Errorf("profileFileConflicts() = %v, want %v", conflicts, expected)
+	}
+}
+
+func TestPrintPresetTextPortability(t *testing.T) {
+	preset := &Preset{
+		AllowKeychain: true,
+		Allow:         []AllowPath{{Path: "."}},
+		Deny:          []AllowPath{{Path: "$HOME/.ssh"}},
+	}
+
+	output := captureOutput(func() {
+		printPresetText("test", preset, nil, "linux")
+	})
+	for _, want := range []string{
+		"warning: keychain access only applies on darwin",
+		"warning: read deny is not enforced on linux",
+	} {
+		if !containsString(output, want) {
+			t.Errorf("output missing %q\nGot:\n%s", want, output)
+		}
+	}
+
+	output = captureOutput(func() {
+		printPresetText("test", preset, nil, "")
+	})
+	if containsString(output, "warning:") {
+		t.Errorf("warnings should only be shown with --portability\nGot:\n%s", output)
+	}
+}
+
+func TestRedundancyNote(t *testing.T) {
+	cliRule := ResolvedRule{Path: "/work", Mode: AccessWrite, Action: ActionAllow, Source: RuleSource{Origin: OriginCLI}}
+	presetRule := ResolvedRule{Path: "/work", Mode: AccessWrite, Action: ActionAllow, Source: RuleSource{PresetName: "dev"}}
+
+	note := redundancyNote(RuleRedundancy{Rule: cliRule, Covered: presetRule})
+	if note != "--allow /work is redundant: dev already allows /work" {
+		t.Errorf("unexpected note for redundant CLI allow: %q", note)
+	}
+
+	note = redundancyNote(RuleRedundancy{Rule: presetRule, Covered: cliRule})
+	if note != "dev allow /work is redundant: --allow /work already allows it" {
+		t.Errorf("unexpected note for redundant preset allow: %q", note)
+	}
+}
+
+func TestAddProtectGitRule(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", repo).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, output)
+	}
+	subdir := filepath.Join(repo, "src")
+	if err := os.Mkdir(subdir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(subdir)
+
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule(repo, RuleSource{Origin: OriginCLI})
+	resolver.AddAllowRule(filepath.Join(repo, ".git", "hooks"), RuleSource{Origin: OriginCLI})
+	if err := addProtectGitRule(resolver); err != nil {
+		t.Fatalf("addProtectGitRule() error = %v", err)
+	}
+	writeRules, readRules, conflicts := resolver.Resolve()
+	if len(conflicts) != 0 {
+		t.Errorf("unexpected conflicts: %+v", conflicts)
+	}
+	if len(readRules) != 0 {
+		t.Errorf("--protect-git should not add read rules, got %+v", readRules)
+	}
+
+	gitDir, err := filepath.EvalSymlinks(filepath.Join(repo, ".git"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := make(map[string]RuleAction)
+	for _, rule := range writeRules {
+		path, err := filepath.EvalSymlinks(rule.Path)
+		if err != nil {
+			path = rule.Path
+		}
+		actions[path] = rule.Action
+		if rule.Action == ActionDeny && rule.Mode != AccessWrite {
+			t.Errorf("git directory deny should be write-only, got %s", rule.Mode)
+		}
+	}
+	if action, ok := actions[gitDir]; !ok || action != ActionDeny {
+		t.Errorf("expected a write deny for %s, got rules %+v", gitDir, writeRules)
+	}
+	if action, ok := actions[filepath.Join(gitDir, "hooks")]; !ok || action != ActionAllow {
+		t.Errorf("the .git/hooks allow should be kept as a carve-out, got rules %+v", writeRules)
+	}
+
+	t.Chdir(t.TempDir())
+	if err := addProtectGitRule(NewRuleResolver()); err == nil {
+		t.Error("addProtectGitRule() outside a repository succeeded, want error")
+	}
+}
+
+func TestSplitRuleComment(t *testing.T) {
+	tests := []struct {
+		value      string
+		wantPath   string
+		wantReason string
+	}{
+		{"/work # build output", "/work", "build output"},
+		{"/work#cache", "/work#cache", ""},
+		{"/data/proj#1", "/data/proj#1", ""},
+		{"/tmp/rv/a#b # scratch", "/tmp/rv/a#b", "scratch"},
+		{"/work\t# tabbed", "/work", "tabbed"},
+		{`/data/issue\#42`, "/data/issue#42", ""},
+		{`/data/\#tmp # scratch`, "/data/#tmp", "scratch"},
+		{"/plain path ", "/plain path ", ""},
+		{"/work #", "/work", ""},
+	}
+
+	for _, tt := range tests {
+		path, reason := splitRuleComment(tt.value)
+		if path != tt.wantPath || reason != tt.wantReason {
+			t.Errorf("splitRuleComment(%q) = %q, %q; want %q, %q", tt.value, path, reason, tt.wantPath, tt.wantReason)
+		}
+	}
+}
+
+func TestStripRuleCommentsKeepsReasons(t *testing.T) {
+	f := &flags{
+		allowPaths: []string{"/work/{a,b} # build output", `/tmp/\#1`},
+		deny:       []string{"/secrets # keys"},
+	}
+	f.stripRuleComments()
+	if err := f.expandBracePaths(); err != nil {
+		t.Fatalf("expandBracePaths() error = %v", err)
+	}
+
+	if want := []string{"/work/a", "/work/b", "/tmp/#1"}; !reflect.DeepEqual(f.allowPaths, want) {
+		t.Errorf("allowPaths = %v, want %v", f.allowPaths, want)
+	}
+	for path, want := range map[string]string{"/work/a": "build output", "/work/b": "build output", "/secrets": "keys", "/tmp/#1": ""} {
+		if got := f.ruleReasons[path]; got != want {
+			t.Errorf("reason for %s = %q, want %q", path, got, want)
+		}
+	}
+
+	rule := ResolvedRule{Path: "/work/a", Source: RuleSource{Origin: OriginCLI, Reason: "build output"}}
+	if got := formatRuleSource(rule); got != "CLI flag # build output" {
+		t.Errorf("formatRuleSource() = %q", got)
+	}
+}
+
+func TestPathListFlag(t *testing.T) {
+	var paths arrayFlags
+	list := pathListFlag{&paths}
+
+	if err := list.Set("/a:/b::/c"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if err := list.Set("/single"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	want := []string{"/a", "/b", "/c", "/single"}
+	if !reflect.DeepEqual([]string(paths), want) {
+		t.Errorf("paths = %q, want %q", paths, want)
+	}
+
+	if err := list.Set(":"); err == nil {
+		t.Error("Set() of an empty list should fail")
+	}
+
+	// The plain flag keeps a path with the separator as one path
+	var plain arrayFlags
+	plain.Set("/data/a:b")
+	if !reflect.DeepEqual([]string(plain), []string{"/data/a:b"}) {
+		t.Errorf("arrayFlags.Set() = %q, want the path unsplit", plain)
+	}
+}
+
+func TestTTYDevicesByDefault(t *testing.T) {
+	if devices := ttyDevices(false); len(devices) == 0 || devices[0] != "/dev/tty" {
+		t.Errorf("ttyDevices(false) = %v, want /dev/tty first", devices)
+	}
+	if devices := ttyDevices(true); devices != nil {
+		t.Errorf("ttyDevices(true) = %v, want none with --no-tty", devices)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// mountWarning returns a warning for an --allow-mount path on goos, or "" if it
+// is a mounted volume. Landlock grants access to the inode found at launch, so
+// on Linux a volume mounted later is not covered; the macOS sandbox matches
+// paths and covers it once it is mounted.
+func mountWarning(goos, path string) string {
+	mounted, err := isMountPoint(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if goos == "linux" {
+			return fmt.Sprintf("%s does not exist; a volume mounted there after cage starts is not readable", path)
+		}
+		return ""
+	case err != nil:
+		return fmt.Sprintf("%s: %v", path, err)
+	case !mounted:
+		return fmt.Sprintf("%s is not a mount point; it is allowed like --allow-read", path)
+	}
+	return ""
+}
@@ -0,0 +1,12 @@
+//go:build !darwin && !linux
+
+package main
+
+import "os"
+
+// isMountPoint cannot tell mounts apart on this platform, so an existing path
+// counts as one
+func isMountPoint(path string) (bool, error) {
+	_, err := os.Stat(path)
+	return err == nil, err
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMountWarning(t *testing.T) {
+	// The root directory is always a mount point
+	if warning := mountWarning("linux", "/"); warning != "" {
+		t.Errorf("expected no warning for /, got %q", warning)
+	}
+
+	dir := t.TempDir()
+	if warning := mountWarning("linux", dir); !strings.Contains(warning, "not a mount point") {
+		t.Errorf("expected a not-a-mount-point warning for %s, got %q", dir, warning)
+	}
+
+	// A volume that is not mounted yet only matters on Linux
+	missing := filepath.Join(dir, "Volumes", "Data")
+	if warning := mountWarning("linux", missing); !strings.Contains(warning, "does not exist") {
+		t.Errorf("expected a missing mount point warning on Linux, got %q", warning)
+	}
+	if warning := mountWarning("darwin", missing); warning != "" {
+		t.Errorf("expected no warning for a missing mount point on macOS, got %q", warning)
+	}
+}
+
+func TestRuleResolverAllowMount(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddReadRule("/mnt/data/", RuleSource{Origin: OriginCLI})
+	resolver.AddReadRule("/Volumes/Not Mounted", RuleSource{Origin: OriginCLI})
+
+	_, readRules, _ := resolver.Resolve()
+	var paths []string
+	for _, rule := range readRules {
+		if rule.Mode != AccessRead || rule.Action != ActionAllow {
+			t.Errorf("expected a read allow, got %+v", rule)
+		}
+		paths = append(paths, rule.Path)
+	}
+	// A missing mount point is kept, so it is granted once mounted (macOS)
+	if !reflect.DeepEqual(paths, []string{"/Volumes/Not Mounted", "/mnt/data"}) {
+		t.Errorf("unexpected read rules %v", paths)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// isMountPoint reports whether path is the root of a mounted filesystem: its
+// device differs from its parent's, or it is "/"
+func isMountPoint(path string) (bool, error) {
+	var st, parent unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return false, err
+	}
+	dir := filepath.Dir(filepath.Clean(path))
+	if dir == filepath.Clean(path) {
+		return true, nil
+	}
+	if err := unix.Stat(dir, &parent); err != nil {
+		return false, err
+	}
+	return st.Dev != parent.Dev, nil
+}
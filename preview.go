@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// previewRule is the JSON representation of a rule in the merge preview
+type previewRule struct {
+	Path   string   `json:"path"`
+	Mode   string   `json:"mode"`
+	Action string   `json:"action"`
+	Source string   `json:"source"`
+	Except []string `json:"except,omitempty"`
+}
+
+// previewConflict is the JSON representation of a conflict in the merge preview
+type previewConflict struct {
+	Path        string        `json:"path"`
+	CrossPreset bool          `json:"cross_preset"`
+	Rules       []previewRule `json:"rules"`
+	Resolution  previewRule   `json:"resolution"`
+	Reason      string        `json:"reason"`
+}
+
+// previewReport is the JSON document printed by --preview -o json
+type previewReport struct {
+	Presets   []string          `json:"presets"`
+	Conflicts []previewConflict `json:"conflicts"`
+	Rules     []previewRule     `json:"rules"`
+}
+
+// printPreviewAndExit displays the merge preview and exits
+func printPreviewAndExit(presets []string, writeRules, readRules []ResolvedRule, conflicts []RuleConflict, format string) {
+	if err := showPreview(presets, writeRules, readRules, conflicts, format); err != nil {
+		logger.Errorf("error showing preview: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// showPreview prints how the given presets combine: the conflicts and the final rule decisions
+func showPreview(presets []string, writeRules, readRules []ResolvedRule, conflicts []RuleConflict, format string) error {
+	report := buildPreviewReport(presets, writeRules, readRules, conflicts)
+
+	if format == "json" {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshal preview: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+
+	fmt.Println("Preset Merge Preview:")
+	fmt.Println("========================================")
+	if len(presets) > 0 {
+		fmt.Printf("Presets: %s\n", strings.Join(presets, ", "))
+	} else {
+		fmt.Println("Presets: (none)")
+	}
+
+	crossPreset := 0
+	for _, conflict := range report.Conflicts {
+		if conflict.CrossPreset {
+			crossPreset++
+		}
+	}
+	fmt.Printf("Conflicts: %d (%d cross-preset)\n", len(report.Conflicts), crossPreset)
+
+	for _, conflict := range report.Conflicts {
+		conflictType := "Intra-preset"
+		if conflict.CrossPreset {
+			conflictType = "Cross-preset"
+		}
+		fmt.Println()
+		fmt.Printf("%s conflict for path: %s\n", conflictType, conflict.Path)
+		for _, rule := range conflict.Rules {
+			fmt.Printf("    - %s %s (%s) from %s\n", rule.Action, rule.Path, rule.Mode, rule.Source)
+		}
+		fmt.Printf("  Resolution: %s from %s (%s)\n", conflict.Resolution.Action, conflict.Resolution.Source, conflict.Reason)
+	}
+
+	fmt.Println()
+	fmt.Println("Final rules:")
+	fmt.Println("----------------------------------------")
+	if len(report.Rules) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, rule := range report.Rules {
+		fmt.Printf("  %s %s %s (%s)\n", rule.Action, rule.Mode, rule.Path, rule.Source)
+		for _, exc := range rule.Except {
+			fmt.Printf("    except: %s\n", exc)
+		}
+	}
+
+	return nil
+}
+
+// buildPreviewReport converts resolved rules and conflicts into their preview representation
+// Conflicts are sorted by path so the report is stable across runs
+func buildPreviewReport(presets []string, writeRules, readRules []ResolvedRule, conflicts []RuleConflict) previewReport {
+	report := previewReport{
+		Presets:   presets,
+		Conflicts: []previewConflict{},
+		Rules:     []previewRule{},
+	}
+	if report.Presets == nil {
+		report.Presets = []string{}
+	}
+
+	sorted := make([]RuleConflict, len(conflicts))
+	copy(sorted, conflicts)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Path < sorted[j].Path
+	})
+
+	for _, conflict := range sorted {
+		pc := previewConflict{
+			Path:        conflict.Path,
+			CrossPreset: !conflict.IsSamePreset,
+			Resolution:  toPreviewRule(conflict.Resolution),
+			Reason:      conflictReason(conflict),
+		}
+		for _, rule := range conflict.Rules {
+			pc.Rules = append(pc.Rules, toPreviewRule(rule))
+		}
+		report.Conflicts = append(report.Conflicts, pc)
+	}
+
+	for _, rule := range writeRules {
+		report.Rules = append(report.Rules, toPreviewRule(rule))
+	}
+	for _, rule := range readRules {
+		report.Rules = append(report.Rules, toPreviewRule(rule))
+	}
+
+	return report
+}
+
+func toPreviewRule(rule ResolvedRule) previewRule {
+	action := "allow"
+	if rule.Action == ActionDeny {
+		action = "deny"
+	}
+	return previewRule{
+		Path:   rule.Path,
+		Mode:   rule.Mode.String(),
+		Action: action,
+		Source: formatRuleSource(rule),
+		Except: rule.Except,
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuildPreviewReport(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.addRule(ResolvedRule{
+		Path:   "/shared",
+		Mode:   AccessWrite,
+		Action: ActionDeny,
+		Source: RuleSource{PresetName: "a"},
+	})
+	resolver.addRule(ResolvedRule{
+		Path:   "/shared",
+		Mode:   AccessWrite,
+		Action: ActionAllow,
+		Source: RuleSource{PresetName: "b"},
+	})
+	resolver.AddReadRule("/usr", RuleSource{PresetName: "a"})
+
+	writeRules, readRules, conflicts := resolver.Resolve()
+	report := buildPreviewReport([]string{"a", "b"}, writeRules, readRules, conflicts)
+
+	if len(report.Conflicts) != 1 {
+		t.Fatalf("expected 1 conflict, got %d", len(report.Conflicts))
+	}
+	conflict := report.Conflicts[0]
+	if !conflict.CrossPreset {
+		t.Error("expected conflict to be cross-preset")
+	}
+	if conflict.Resolution.Action != "allow" || conflict.Resolution.Source != "b" {
+		t.Errorf("unexpected resolution: %+v", conflict.Resolution)
+	}
+	if conflict.Reason != "allow beats deny" {
+		t.Errorf("expected reason 'allow beats deny', got %q", conflict.Reason)
+	}
+	if len(report.Rules) != 2 {
+		t.Errorf("expected 2 final rules, got %d", len(report.Rules))
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("json.Unmarshal failed: %v", err)
+	}
+	for _, key := range []string{"presets", "conflicts", "rules"} {
+		if _, ok := decoded[key]; !ok {
+			t.Errorf("expected key %q in JSON output", key)
+		}
+	}
+}
+
+func TestBuildPreviewReportEmpty(t *testing.T) {
+	report := buildPreviewReport(nil, nil, nil, nil)
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	expected := `{"presets":[],"conflicts":[],"rules":[]}`
+	if string(data) != expected {
+		t.Errorf("expected %s, got %s", expected, string(data))
+	}
+}
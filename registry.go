@@ -0,0 +1,215 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxPresetFileSize bounds preset files installed with `cage preset add`
+	maxPresetFileSize = 1 << 20
+	// presetFetchTimeout bounds fetching a remote preset
+	presetFetchTimeout = 30 * time.Second
+)
+
+// presetNamePattern restricts installed preset names to safe file names
+var presetNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// defaultPresetDir returns the directory `cage preset add` installs presets to
+// and cage loads them from unless --preset-dir is given
+func defaultPresetDir() (string, error) {
+	configDir, err := userConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("get config directory: %w", err)
+	}
+	return filepath.Join(configDir, "cage", "presets.d"), nil
+}
+
+// loadPresetDir adds the presets in dir to config, one preset per <name>.yaml or
+// <name>.yml file in the same format as --preset-inline. A missing directory is
+// not an error; a name that the config file already defines is (presets of the
+// embedded default config are replaced instead).
+func loadPresetDir(config *Config, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read preset directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), ext)
+		path := filepath.Join(dir, entry.Name())
+		if _, exists := config.Presets[name]; exists && !config.embedded {
+			return fmt.Errorf("preset %q in %s is already defined", name, path)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("read preset: %w", err)
+		}
+		preset, err := parseInlinePreset(string(data))
+		if err != nil {
+			return fmt.Errorf("preset %s: %w", path, err)
+		}
+		if config.Presets == nil {
+			config.Presets = make(map[string]Preset)
+		}
+		config.Presets[name] = preset
+	}
+	return nil
+}
+
+// presetInstallOptions configures installPreset
+type presetInstallOptions struct {
+	Dir         string       // directory to install into
+	SHA256      string       // expected hex digest of the preset file, if set
+	AllowRemote bool         // permit fetching https:// sources
+	Force       bool         // replace an installed preset with the same name
+	Client      *http.Client // client for remote sources
+}
+
+// installPreset copies the preset at src (a file path or, with AllowRemote, an
+// https URL) to <Dir>/<name>.yaml after validating it, and returns the installed
+// path and the file's SHA-256 digest
+func installPreset(src, name string, opts presetInstallOptions) (string, string, error) {
+	if !presetNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid preset name %q (use letters, digits, '.', '_' and '-')", name)
+	}
+
+	data, err := readPresetSource(src, opts)
+	if err != nil {
+		return "", "", err
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if opts.SHA256 != "" && !strings.EqualFold(opts.SHA256, digest) {
+		return "", "", fmt.Errorf("checksum mismatch for %s: got sha256 %s, want %s", src, digest, opts.SHA256)
+	}
+	if _, err := parseInlinePreset(string(data)); err != nil {
+		return "", "", fmt.Errorf("invalid preset in %s: %w", src, err)
+	}
+
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return "", "", fmt.Errorf("create preset directory: %w", err)
+	}
+	path := filepath.Join(opts.Dir, name+".yaml")
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if opts.Force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return "", "", fmt.Errorf("preset %q is already installed at %s (use --force to replace it)", name, path)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("install preset: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return "", "", fmt.Errorf("install preset: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", "", fmt.Errorf("install preset: %w", err)
+	}
+	return path, digest, nil
+}
+
+// readPresetSource reads a preset file from a local path or an https URL
+// Remote sources must be enabled explicitly; plain http is always refused
+func readPresetSource(src string, opts presetInstallOptions) ([]byte, error) {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme == "" || len(u.Scheme) == 1 {
+		// A local path (a one-letter scheme is a Windows drive)
+		return readLimited(src, func() (io.ReadCloser, error) { return os.Open(src) })
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported preset source %s (use a file path or an https:// URL)", src)
+	}
+	if !opts.AllowRemote {
+		return nil, fmt.Errorf("fetching remote presets is disabled (use --allow-remote to fetch %s)", src)
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{Timeout: presetFetchTimeout}
+	}
+	return readLimited(src, func() (io.ReadCloser, error) {
+		resp, err := client.Get(src)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return resp.Body, nil
+	})
+}
+
+// readLimited reads at most maxPresetFileSize bytes from the opened source
+func readLimited(src string, open func() (io.ReadCloser, error)) ([]byte, error) {
+	r, err := open()
+	if err != nil {
+		return nil, fmt.Errorf("fetch preset %s: %w", src, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, maxPresetFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetch preset %s: %w", src, err)
+	}
+	if len(data) > maxPresetFileSize {
+		return nil, fmt.Errorf("preset %s is larger than %d bytes", src, maxPresetFileSize)
+	}
+	return data, nil
+}
+
+// runPresetCommand implements `cage preset add [flags] <path|url> <name>`
+func runPresetCommand(args []string) error {
+	if len(args) == 0 || args[0] != "add" {
+		return fmt.Errorf("usage: cage preset add [--sha256 <hex>] [--allow-remote] [--force] [--preset-dir <dir>] <path|url> <name>")
+	}
+
+	fs := flag.NewFlagSet("preset add", flag.ContinueOnError)
+	var opts presetInstallOptions
+	fs.StringVar(&opts.SHA256, "sha256", "", "Refuse to install unless the preset file has this SHA-256 digest")
+	fs.BoolVar(&opts.AllowRemote, "allow-remote", false, "Allow fetching the preset from an https:// URL")
+	fs.BoolVar(&opts.Force, "force", false, "Replace an installed preset with the same name")
+	fs.StringVar(&opts.Dir, "preset-dir", "", "Install into this directory instead of the config directory's presets.d")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("preset add needs a source and a name, got %d arguments", fs.NArg())
+	}
+
+	if opts.Dir == "" {
+		dir, err := defaultPresetDir()
+		if err != nil {
+			return err
+		}
+		opts.Dir = dir
+	}
+	path, digest, err := installPreset(fs.Arg(0), fs.Arg(1), opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed preset %s to %s (sha256 %s)\n", fs.Arg(1), path, digest)
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPresetFile = "allow:\n  - /work\nstrict: true\n"
+
+func TestInstallPresetFromFile(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "team.yaml")
+	if err := os.WriteFile(src, []byte(testPresetFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "presets.d")
+	sum := sha256.Sum256([]byte(testPresetFile))
+	want := hex.EncodeToString(sum[:])
+
+	path, digest, err := installPreset(src, "team", presetInstallOptions{Dir: dir, SHA256: strings.ToUpper(want)})
+	if err != nil {
+		t.Fatalf("installPreset() error = %v", err)
+	}
+	if path != filepath.Join(dir, "team.yaml") || digest != want {
+		t.Errorf("installPreset() = %s, %s; want %s, %s", path, digest, filepath.Join(dir, "team.yaml"), want)
+	}
+
+	if _, _, err := installPreset(src, "team", presetInstallOptions{Dir: dir}); err == nil {
+		t.Error("installing over an existing preset succeeded, want error")
+	}
+	if _, _, err := installPreset(src, "team", presetInstallOptions{Dir: dir, Force: true}); err != nil {
+		t.Errorf("installPreset() with Force error = %v", err)
+	}
+
+	config := &Config{}
+	if err := loadPresetDir(config, dir); err != nil {
+		t.Fatalf("loadPresetDir() error = %v", err)
+	}
+	preset, ok := config.GetPreset("team")
+	if !ok || !preset.Strict || len(preset.Allow) != 1 || preset.Allow[0].Path != "/work" {
+		t.Errorf("loaded preset = %+v, %v; want strict with allow /work", preset, ok)
+	}
+}
+
+func TestInstallPresetRejects(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "bad.yaml")
+	if err := os.WriteFile(src, []byte("alow: [/work]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	good := filepath.Join(t.TempDir(), "good.yaml")
+	if err := os.WriteFile(good, []byte(testPresetFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		src  string
+		as   string
+		opts presetInstallOptions
+		want string
+	}{
+		{"invalid preset", src, "bad", presetInstallOptions{Dir: dir}, "invalid preset"},
+		{"checksum mismatch", good, "good", presetInstallOptions{Dir: dir, SHA256: strings.Repeat("0", 64)}, "checksum mismatch"},
+		{"path in name", good, "../evil", presetInstallOptions{Dir: dir}, "invalid preset name"},
+		{"remote not enabled", "https://example.com/p.yaml", "remote", presetInstallOptions{Dir: dir}, "--allow-remote"},
+		{"plain http", "http://example.com/p.yaml", "remote", presetInstallOptions{Dir: dir, AllowRemote: true}, "unsupported preset source"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := installPreset(tt.src, tt.as, tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("installPreset() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallPresetRemote(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/team.yaml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testPresetFile))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	opts := presetInstallOptions{Dir: dir, AllowRemote: true, Client: server.Client()}
+	if _, _, err := installPreset(server.URL+"/team.yaml", "team", opts); err != nil {
+		t.Fatalf("installPreset() error = %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "team.yaml")); err != nil || string(data) != testPresetFile {
+		t.Errorf("installed preset = %q, %v; want %q", data, err, testPresetFile)
+	}
+
+	if _, _, err := installPreset(server.URL+"/missing.yaml", "missing", opts); err == nil {
+		t.Error("installPreset() for a missing URL succeeded, want error")
+	}
+}
+
+func TestLoadPresetDirConflicts(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "team.yml"), []byte(testPresetFile), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("not a preset"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &Config{Presets: map[string]Preset{"team": {}}}
+	if err := loadPresetDir(config, dir); err == nil {
+		t.Error("loadPresetDir() redefined a config preset, want error")
+	}
+
+	if err := loadPresetDir(&Config{}, filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("loadPresetDir() on a missing directory error = %v", err)
+	}
+}
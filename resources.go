@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ResourceLimits are the rlimits the command runs with; a zero
+// field leaves that limit alone. Soft and hard limits are both set, so the
+// command cannot raise them again.
+type ResourceLimits struct {
+	Memory uint64 // RLIMIT_AS, in bytes (--max-memory)
+	CPU    uint64 // RLIMIT_CPU, in seconds (--max-cpu)
+	Files  uint64 // RLIMIT_NOFILE (--max-files)
+	Procs  uint64 // RLIMIT_NPROC, counted per user (--max-procs)
+}
+
+// IsZero reports whether no limit is set
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
+
+// String lists the limits that are set, e.g. "memory 512M, cpu 60s"
+func (l ResourceLimits) String() string {
+	var parts []string
+	if l.Memory > 0 {
+		parts = append(parts, "memory "+formatByteSize(l.Memory))
+	}
+	if l.CPU > 0 {
+		parts = append(parts, fmt.Sprintf("cpu %ds", l.CPU))
+	}
+	if l.Files > 0 {
+		parts = append(parts, fmt.Sprintf("files %d", l.Files))
+	}
+	if l.Procs > 0 {
+		parts = append(parts, fmt.Sprintf("processes %d", l.Procs))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// byteSizeUnits are the binary size suffixes parseByteSize accepts
+var byteSizeUnits = []struct {
+	suffix string
+	size   uint64
+}{
+	{"T", 1 << 40},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+}
+
+// parseByteSize parses a size such as 512M, 2G, 1.5GiB or 1048576 (bytes);
+// the K, M, G and T suffixes are powers of 1024 and may be followed by B or iB
+func parseByteSize(value string) (uint64, error) {
+	number := strings.TrimSpace(value)
+	upper := strings.ToUpper(number)
+	multiplier := uint64(1)
+	for _, unit := range byteSizeUnits {
+		for _, suffix := range []string{unit.suffix + "IB", unit.suffix + "B", unit.suffix} {
+			if strings.HasSuffix(upper, suffix) {
+				number, multiplier = number[:len(number)-len(suffix)], unit.size
+				break
+			}
+		}
+		if multiplier > 1 {
+			break
+		}
+	}
+	if multiplier == 1 {
+		number = strings.TrimSuffix(strings.TrimSuffix(number, "B"), "b")
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512M or 2G)", value)
+	}
+	return uint64(size * float64(multiplier)), nil
+}
+
+// formatByteSize formats size with the largest suffix that divides it
+func formatByteSize(size uint64) string {
+	for _, unit := range byteSizeUnits {
+		if size%unit.size == 0 {
+			return fmt.Sprintf("%d%s", size/unit.size, unit.suffix)
+		}
+	}
+	return strconv.FormatUint(size, 10)
+}
+
+// parseCPUTime parses a CPU time limit in seconds, or as a duration such as 90s
+// or 5m, which is rounded up to whole seconds
+func parseCPUTime(value string) (uint64, error) {
+	if seconds, err := strconv.ParseUint(value, 10, 64); err == nil && seconds > 0 {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid CPU time %q (expected seconds or a duration such as 5m)", value)
+	}
+	return uint64((d + time.Second - 1) / time.Second), nil
+}
+
+// resourceLimits parses the --max-memory, --max-cpu, --max-files and
+// --max-procs flags
+func resourceLimits(f *flags) (ResourceLimits, error) {
+	var limits ResourceLimits
+	var err error
+	if f.maxMemory != "" {
+		if limits.Memory, err = parseByteSize(f.maxMemory); err != nil {
+			return limits, fmt.Errorf("--max-memory: %w", err)
+		}
+	}
+	if f.maxCPU != "" {
+		if limits.CPU, err = parseCPUTime(f.maxCPU); err != nil {
+			return limits, fmt.Errorf("--max-cpu: %w", err)
+		}
+	}
+	if f.maxFiles < 0 {
+		return limits, fmt.Errorf("--max-files: must be positive, got %d", f.maxFiles)
+	}
+	if f.maxProcs < 0 {
+		return limits, fmt.Errorf("--max-procs: must be positive, got %d", f.maxProcs)
+	}
+	limits.Files, limits.Procs = uint64(f.maxFiles), uint64(f.maxProcs)
+	return limits, nil
+}
@@ -0,0 +1,20 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// startWithLimits starts cmd; macOS cannot set the limits of another process,
+// so a command with resource limits is refused rather than limiting cage itself
+func startWithLimits(cmd *exec.Cmd, limits ResourceLimits) error {
+	if !limits.IsZero() {
+		return errLimitStartedCommand
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start command: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// startWithLimits starts cmd with the resource limits set on the command only,
+// leaving cage's own limits as they are. The command is traced so that it stops
+// right after exec, before its first instruction, while the limits are set with
+// prlimit; it is then detached and runs as usual
+func startWithLimits(cmd *exec.Cmd, limits ResourceLimits) error {
+	if limits.IsZero() {
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("start command: %w", err)
+		}
+		return nil
+	}
+
+	// ptrace requests must come from the thread that started the tracee
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cmd.SysProcAttr.Ptrace = true
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start command: %w", err)
+	}
+	pid := cmd.Process.Pid
+
+	var status unix.WaitStatus
+	_, err := unix.Wait4(pid, &status, 0, nil)
+	if err == nil && !status.Stopped() {
+		err = fmt.Errorf("command did not stop after exec (status %v)", status)
+	}
+	if err == nil {
+		err = limitProcess(pid, limits)
+		if detachErr := unix.PtraceDetach(pid); err == nil && detachErr != nil {
+			err = fmt.Errorf("detach command: %w", detachErr)
+		}
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return fmt.Errorf("resource limits: %w", err)
+	}
+	return nil
+}
+
+// limitProcess sets the soft and hard limit of each resource in limits for
+// process pid. A hard limit that is already lower is kept.
+func limitProcess(pid int, limits ResourceLimits) error {
+	for _, limit := range resourceLimitList(limits) {
+		var current unix.Rlimit
+		if err := unix.Prlimit(pid, limit.resource, nil, &current); err != nil {
+			return fmt.Errorf("get %s limit: %w", limit.name, err)
+		}
+		value := min(limit.value, current.Max)
+		if err := unix.Prlimit(pid, limit.resource, &unix.Rlimit{Cur: value, Max: value}, nil); err != nil {
+			return fmt.Errorf("set %s limit to %d: %w", limit.name, value, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestStartInSandbox_ResourceLimits(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	var before unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &before); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, timeout := range []time.Duration{0, time.Minute} {
+		output := filepath.Join(t.TempDir(), "limits")
+		config := &SandboxConfig{
+			AllowAll: true,
+			Command:  "sh",
+			Args:     []string{"-c", "{ ulimit -n; ulimit -t; ulimit -v; } > " + output},
+			Limits:   ResourceLimits{Memory: 1 << 30, CPU: 30, Files: 64},
+			Timeout:  timeout,
+		}
+		cmd, err := StartInSandbox(config)
+		if err != nil {
+			t.Fatalf("StartInSandbox() error = %v", err)
+		}
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+		out, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := strings.Fields(string(out)), []string{"64", "30", "1048576"}; strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("limits in the command = %v, want %v", got, want)
+		}
+	}
+
+	// The limits bind the command only, not the process that started it
+	var after unix.Rlimit
+	if err := unix.Getrlimit(unix.RLIMIT_NOFILE, &after); err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("caller's file limit changed from %+v to %+v", before, after)
+	}
+}
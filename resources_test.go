@@ -0,0 +1,73 @@
+package main
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{"1048576", 1 << 20, false},
+		{"512M", 512 << 20, false},
+		{"512m", 512 << 20, false},
+		{"2G", 2 << 30, false},
+		{"2GB", 2 << 30, false},
+		{"2GiB", 2 << 30, false},
+		{"1.5G", 3 << 29, false},
+		{"64K", 64 << 10, false},
+		{"1T", 1 << 40, false},
+		{"100B", 100, false},
+		{"", 0, true},
+		{"M", 0, true},
+		{"0", 0, true},
+		{"-1G", 0, true},
+		{"12X", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseByteSize(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseCPUTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    uint64
+		wantErr bool
+	}{
+		{"60", 60, false},
+		{"90s", 90, false},
+		{"5m", 300, false},
+		{"1500ms", 2, false},
+		{"0", 0, true},
+		{"-5s", 0, true},
+		{"soon", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCPUTime(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCPUTime(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseCPUTime(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestResourceLimitsString(t *testing.T) {
+	limits := ResourceLimits{Memory: 512 << 20, CPU: 60, Files: 256}
+	if got, want := limits.String(), "memory 512M, cpu 60s, files 256"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if !(ResourceLimits{}).IsZero() {
+		t.Error("expected an empty ResourceLimits to be zero")
+	}
+}
@@ -0,0 +1,54 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// errLimitStartedCommand is returned for resource limits on a command that cage
+// starts rather than execs in place where limitProcess is not available
+var errLimitStartedCommand = errors.New("resource limits on a command cage starts (--timeout, exec-sync or the library API) are only supported on Linux")
+
+// resourceLimit is one rlimit to set, named for error messages
+type resourceLimit struct {
+	name     string
+	resource int
+	value    uint64
+}
+
+// resourceLimitList returns the limits that are set, with their resources
+func resourceLimitList(limits ResourceLimits) []resourceLimit {
+	var list []resourceLimit
+	for _, limit := range []resourceLimit{
+		{"memory", unix.RLIMIT_AS, limits.Memory},
+		{"cpu", unix.RLIMIT_CPU, limits.CPU},
+		{"files", unix.RLIMIT_NOFILE, limits.Files},
+		{"processes", unix.RLIMIT_NPROC, limits.Procs},
+	} {
+		if limit.value != 0 {
+			list = append(list, limit)
+		}
+	}
+	return list
+}
+
+// applyResourceLimits sets the soft and hard limit of each resource in limits
+// for the current process, right before it execs the command in place. A hard
+// limit that is already lower is kept, as only root may raise it.
+func applyResourceLimits(limits ResourceLimits) error {
+	for _, limit := range resourceLimitList(limits) {
+		var current unix.Rlimit
+		if err := unix.Getrlimit(limit.resource, &current); err != nil {
+			return fmt.Errorf("get %s limit: %w", limit.name, err)
+		}
+		value := min(limit.value, current.Max)
+		if err := unix.Setrlimit(limit.resource, &unix.Rlimit{Cur: value, Max: value}); err != nil {
+			return fmt.Errorf("set %s limit to %d: %w", limit.name, value, err)
+		}
+	}
+	return nil
+}
@@ -1,13 +1,42 @@
 package main
 
 import (
+	"fmt"
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode"
 )
 
 // cleanPath normalizes a path by converting to absolute and cleaning it
 func cleanPath(path string) string {
+	return cleanPathIn("", path)
+}
+
+// isGlobPattern reports whether path is a glob: it has a * or ?, or a bracket
+// expression such as [a-z] that is closed within its path element
+func isGlobPattern(path string) bool {
+	if strings.ContainsAny(path, "*?") {
+		return true
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '[' {
+			continue
+		}
+		if end := strings.IndexAny(path[i+1:], "]/"); end > 0 && path[i+1+end] == ']' {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanPathIn is cleanPath with relative paths resolved against base instead of
+// the current directory (when base is empty)
+func cleanPathIn(base, path string) string {
+	if base != "" && !filepath.IsAbs(path) {
+		return filepath.Clean(filepath.Join(base, path))
+	}
+
 	// Convert to absolute path if not already
 	absPath, err := filepath.Abs(path)
 	if err != nil {
@@ -27,40 +56,176 @@ const (
 	ActionDeny
 )
 
+func (a RuleAction) String() string {
+	if a == ActionDeny {
+		return "deny"
+	}
+	return "allow"
+}
+
+// MarshalText writes the action as "allow" or "deny"
+func (a RuleAction) MarshalText() ([]byte, error) {
+	if a != ActionAllow && a != ActionDeny {
+		return nil, fmt.Errorf("invalid rule action %d", int(a))
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText accepts "allow" and "deny"
+func (a *RuleAction) UnmarshalText(text []byte) error {
+	for _, action := range []RuleAction{ActionAllow, ActionDeny} {
+		if string(text) == action.String() {
+			*a = action
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid action %q (must be allow or deny)", text)
+}
+
+// RuleOrigin is the kind of source a rule came from
+// Conflicts are resolved in the order CLI > manual preset > auto preset > default
+// preset, or with CLIPresetsLast CLI > auto preset > default preset > manual preset
+type RuleOrigin int
+
+const (
+	OriginManualPreset  RuleOrigin = iota // --preset, or a helper such as --allow-git
+	OriginAutoPreset                      // auto-presets matched against the command
+	OriginDefaultPreset                   // defaults.presets from the config
+	OriginCLI                             // command-line flag
+)
+
+// PresetOrder chooses where presets named with --preset rank among the presets
+type PresetOrder int
+
+const (
+	// CLIPresetsFirst ranks --preset presets above auto and default presets
+	CLIPresetsFirst PresetOrder = iota
+	// CLIPresetsLast ranks them below, as a base that the other presets refine
+	CLIPresetsLast
+)
+
+// parsePresetOrder converts a --preset-order value to a PresetOrder
+func parsePresetOrder(name string) (PresetOrder, error) {
+	switch name {
+	case "", "cli-first":
+		return CLIPresetsFirst, nil
+	case "cli-last":
+		return CLIPresetsLast, nil
+	}
+	return CLIPresetsFirst, fmt.Errorf("invalid preset order %q (must be cli-first or cli-last)", name)
+}
+
+// precedence ranks origins for conflict resolution; higher wins
+// Command-line flags always win and auto presets beat default presets; order
+// places --preset presets above both or below both
+func (o RuleOrigin) precedence(order PresetOrder) int {
+	switch o {
+	case OriginCLI:
+		return 4
+	case OriginManualPreset:
+		if order == CLIPresetsLast {
+			return 0
+		}
+		return 3
+	case OriginAutoPreset:
+		return 2
+	default:
+		return 1
+	}
+}
+
+func (o RuleOrigin) String() string {
+	switch o {
+	case OriginCLI:
+		return "CLI"
+	case OriginManualPreset:
+		return "manual preset"
+	case OriginAutoPreset:
+		return "auto preset"
+	case OriginDefaultPreset:
+		return "default preset"
+	default:
+		return "unknown"
+	}
+}
+
+// ruleOrigins lists the origins by their JSON names
+var ruleOrigins = []RuleOrigin{OriginManualPreset, OriginAutoPreset, OriginDefaultPreset, OriginCLI}
+
+// MarshalText writes the origin as it is shown in conflict reasons, e.g. "auto preset"
+func (o RuleOrigin) MarshalText() ([]byte, error) {
+	if o < OriginManualPreset || o > OriginCLI {
+		return nil, fmt.Errorf("invalid rule origin %d", int(o))
+	}
+	return []byte(o.String()), nil
+}
+
+// UnmarshalText accepts the names written by MarshalText
+func (o *RuleOrigin) UnmarshalText(text []byte) error {
+	for _, origin := range ruleOrigins {
+		if string(text) == origin.String() {
+			*o = origin
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid origin %q (must be CLI, manual preset, auto preset or default preset)", text)
+}
+
 // RuleSource tracks where a rule came from
 type RuleSource struct {
-	PresetName string // e.g., "builtin:secure", "my-preset", or "" for CLI
-	IsCLI      bool   // true if from command-line flag
+	PresetName string     `json:"preset,omitempty"`   // e.g., "builtin:secure", "my-preset", or "" for CLI
+	Origin     RuleOrigin `json:"origin"`             // kind of source, used for precedence
+	Reason     string     `json:"reason,omitempty"`   // why the rule exists, from a "# comment" on a rule flag
+	Priority   int        `json:"priority,omitempty"` // preset priority; higher wins among rules of the same origin
+}
+
+// IsCLI reports whether the rule came from a command-line flag
+func (s RuleSource) IsCLI() bool {
+	return s.Origin == OriginCLI
 }
 
 // ResolvedRule represents a resolved file access rule
+// The JSON form is written by --dump-rules and read by --rules-from-json
 type ResolvedRule struct {
-	Path   string
-	Mode   AccessMode // from sandbox.go
-	Action RuleAction // Allow or Deny
-	Source RuleSource
-	IsGlob bool
-	Except []string // for deny rules with carve-outs
+	Path     string     `json:"path"`
+	Original string     `json:"original,omitempty"` // path as given, before cleanPath made it absolute and clean
+	Mode     AccessMode `json:"mode"`               // from sandbox.go
+	Action   RuleAction `json:"action"`             // Allow or Deny
+	Source   RuleSource `json:"source"`
+	IsGlob   bool       `json:"glob,omitempty"`
+	Except   []string   `json:"except,omitempty"`   // for deny rules with carve-outs
+	IsFile   bool       `json:"file,omitempty"`     // write allow for a single file (and creating it), not a subtree
+	NoRefer  bool       `json:"no_refer,omitempty"` // do not allow moving files into or out of the allowed directory (Linux)
+	Append   bool       `json:"append,omitempty"`   // create and write files, but not delete, rename or truncate them
+	// FileLevel limits a deny to the directory's direct entries, leaving the
+	// contents of its subdirectories alone (macOS only)
+	FileLevel bool `json:"file_level,omitempty"`
 }
 
 // RuleConflict represents a conflict between rules
 type RuleConflict struct {
-	Path         string
-	Rules        []ResolvedRule // the conflicting rules
-	Resolution   ResolvedRule   // which rule won
-	IsSamePreset bool           // true if conflict within one preset
+	Path         string         `json:"path"`
+	Rules        []ResolvedRule `json:"rules"`       // the conflicting rules
+	Resolution   ResolvedRule   `json:"resolution"`  // which rule won
+	IsSamePreset bool           `json:"same_preset"` // true if conflict within one preset
 }
 
 // RuleResolver resolves rules from multiple sources with conflict detection
 type RuleResolver struct {
 	// Map of (path, mode) -> list of rules
 	rules map[ruleKey][]ResolvedRule
+	// order ranks --preset presets against auto and default presets
+	order PresetOrder
+	// baseDir resolves relative rule paths instead of the current directory
+	baseDir string
 }
 
 // ruleKey uniquely identifies a rule by path and access mode
 type ruleKey struct {
 	path string
 	mode AccessMode
+	// fileLevel keeps a single-level deny apart from rules for the whole subtree
+	fileLevel bool
 }
 
 // NewRuleResolver creates a new rule resolver
@@ -70,56 +235,194 @@ func NewRuleResolver() *RuleResolver {
 	}
 }
 
+// SetPresetOrder sets how Resolve ranks --preset presets against auto and
+// default presets (CLIPresetsFirst by default)
+func (r *RuleResolver) SetPresetOrder(order PresetOrder) {
+	r.order = order
+}
+
+// SetBaseDir makes rules added afterwards resolve relative paths against dir
+// (--working-dir) rather than the current directory
+func (r *RuleResolver) SetBaseDir(dir string) {
+	r.baseDir = dir
+}
+
 // AddAllowRule adds an allow rule for write access
 func (r *RuleResolver) AddAllowRule(path string, source RuleSource) {
-	normalizedPath := cleanPath(path)
+	normalizedPath := cleanPathIn(r.baseDir, path)
+	r.addRule(ResolvedRule{
+		Path:     normalizedPath,
+		Original: path,
+		Mode:     AccessWrite,
+		Action:   ActionAllow,
+		Source:   source,
+		IsGlob:   isGlobPattern(path),
+	})
+}
+
+// AddAllowRuleNoRefer adds an allow rule for write access that does not permit
+// renaming or linking files across the allowed directory's boundary
+func (r *RuleResolver) AddAllowRuleNoRefer(path string, source RuleSource) {
+	normalizedPath := cleanPathIn(r.baseDir, path)
 	r.addRule(ResolvedRule{
-		Path:   normalizedPath,
-		Mode:   AccessWrite,
-		Action: ActionAllow,
-		Source: source,
-		IsGlob: strings.Contains(path, "*"),
+		Path:     normalizedPath,
+		Original: path,
+		Mode:     AccessWrite,
+		Action:   ActionAllow,
+		Source:   source,
+		IsGlob:   isGlobPattern(path),
+		NoRefer:  true,
+	})
+}
+
+// AddOutputRule adds an allow rule for writing (and creating) a single output file
+func (r *RuleResolver) AddOutputRule(path string, source RuleSource) {
+	normalizedPath := cleanPathIn(r.baseDir, path)
+	r.addRule(ResolvedRule{
+		Path:     normalizedPath,
+		Original: path,
+		Mode:     AccessWrite,
+		Action:   ActionAllow,
+		Source:   source,
+		IsFile:   true,
+	})
+}
+
+// AddAppendRule adds an allow rule for creating and writing files below path
+// without deleting, renaming or truncating them (e.g. for append-only logs)
+func (r *RuleResolver) AddAppendRule(path string, source RuleSource) {
+	normalizedPath := cleanPathIn(r.baseDir, path)
+	r.addRule(ResolvedRule{
+		Path:     normalizedPath,
+		Original: path,
+		Mode:     AccessWrite,
+		Action:   ActionAllow,
+		Source:   source,
+		IsGlob:   isGlobPattern(path),
+		Append:   true,
 	})
 }
 
 // AddDenyRule adds a deny rule for read+write access
 func (r *RuleResolver) AddDenyRule(path string, except []string, source RuleSource) {
-	normalizedPath := cleanPath(path)
+	normalizedPath := cleanPathIn(r.baseDir, path)
 
 	// Clean exception paths
 	cleanExcept := make([]string, len(except))
 	for i, excPath := range except {
-		cleanExcept[i] = cleanPath(excPath)
+		cleanExcept[i] = cleanPathIn(r.baseDir, excPath)
 	}
 
 	r.addRule(ResolvedRule{
-		Path:   normalizedPath,
-		Mode:   AccessReadWrite,
-		Action: ActionDeny,
-		Source: source,
-		IsGlob: strings.Contains(path, "*"),
-		Except: cleanExcept,
+		Path:     normalizedPath,
+		Original: path,
+		Mode:     AccessReadWrite,
+		Action:   ActionDeny,
+		Source:   source,
+		IsGlob:   isGlobPattern(path),
+		Except:   cleanExcept,
+	})
+}
+
+// AddWriteDenyRule adds a deny rule for write access only; reads stay allowed
+func (r *RuleResolver) AddWriteDenyRule(path string, source RuleSource) {
+	normalizedPath := cleanPathIn(r.baseDir, path)
+	r.addRule(ResolvedRule{
+		Path:     normalizedPath,
+		Original: path,
+		Mode:     AccessWrite,
+		Action:   ActionDeny,
+		Source:   source,
+		IsGlob:   isGlobPattern(path),
+	})
+}
+
+// AddFileLevelDenyRule adds a deny rule for mode (AccessReadWrite or AccessWrite)
+// that covers the direct entries of the directory at path but not what is
+// inside its subdirectories
+func (r *RuleResolver) AddFileLevelDenyRule(path string, mode AccessMode, source RuleSource) {
+	normalizedPath := cleanPathIn(r.baseDir, path)
+	r.addRule(ResolvedRule{
+		Path:      normalizedPath,
+		Original:  path,
+		Mode:      mode,
+		Action:    ActionDeny,
+		Source:    source,
+		IsGlob:    isGlobPattern(path),
+		FileLevel: true,
 	})
 }
 
 // AddReadRule adds an allow rule for read access (used in strict mode)
 func (r *RuleResolver) AddReadRule(path string, source RuleSource) {
-	normalizedPath := cleanPath(path)
+	normalizedPath := cleanPathIn(r.baseDir, path)
 	r.addRule(ResolvedRule{
-		Path:   normalizedPath,
-		Mode:   AccessRead,
-		Action: ActionAllow,
-		Source: source,
-		IsGlob: strings.Contains(path, "*"),
+		Path:     normalizedPath,
+		Original: path,
+		Mode:     AccessRead,
+		Action:   ActionAllow,
+		Source:   source,
+		IsGlob:   isGlobPattern(path),
 	})
 }
 
 // addRule adds a rule to the resolver
 func (r *RuleResolver) addRule(rule ResolvedRule) {
-	key := ruleKey{path: rule.Path, mode: rule.Mode}
+	key := ruleKey{path: rule.Path, mode: rule.Mode, fileLevel: rule.FileLevel}
 	r.rules[key] = append(r.rules[key], rule)
 }
 
+// RemoveRule drops every rule added for path with exactly the access mode mode,
+// from any source, including single-level denies; it reports whether any was removed
+func (r *RuleResolver) RemoveRule(path string, mode AccessMode) bool {
+	normalizedPath := cleanPathIn(r.baseDir, path)
+	removed := false
+	for _, fileLevel := range []bool{false, true} {
+		key := ruleKey{path: normalizedPath, mode: mode, fileLevel: fileLevel}
+		if len(r.rules[key]) > 0 {
+			removed = true
+		}
+		delete(r.rules, key)
+	}
+	return removed
+}
+
+// HasRule reports whether a rule was added for path with exactly the access mode mode
+func (r *RuleResolver) HasRule(path string, mode AccessMode) bool {
+	normalizedPath := cleanPathIn(r.baseDir, path)
+	for _, fileLevel := range []bool{false, true} {
+		if len(r.rules[ruleKey{path: normalizedPath, mode: mode, fileLevel: fileLevel}]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// AllRules returns every rule added so far, before conflicts are resolved,
+// ordered by path and then mode; rules for the same path and mode keep the
+// order they were added in
+func (r *RuleResolver) AllRules() []ResolvedRule {
+	keys := make([]ruleKey, 0, len(r.rules))
+	for key := range r.rules {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		if keys[i].mode != keys[j].mode {
+			return keys[i].mode < keys[j].mode
+		}
+		return !keys[i].fileLevel && keys[j].fileLevel
+	})
+
+	var rules []ResolvedRule
+	for _, key := range keys {
+		rules = append(rules, r.rules[key]...)
+	}
+	return rules
+}
+
 // ValidatePreset validates a single preset for internal conflicts and duplicates
 func (r *RuleResolver) ValidatePreset(presetName string) []error {
 	var errors []error
@@ -221,7 +524,7 @@ func (r *RuleResolver) Resolve() (writeRules, readRules []ResolvedRule, conflict
 		}
 
 		// Multiple rules for the same path+mode - resolve conflict
-		winner := resolveConflict(rules)
+		winner := resolveConflictOrdered(rules, r.order)
 
 		// Detect if this is a same-preset conflict
 		isSamePreset := true
@@ -267,6 +570,9 @@ func (r *RuleResolver) Resolve() (writeRules, readRules []ResolvedRule, conflict
 		}
 	}
 
+	writeRules = dropCoveredWriteDenies(writeRules)
+	writeRules, readRules = mergeReadWriteAllows(writeRules, readRules)
+
 	// Sort rules by path specificity (shortest path first for emission order)
 	sortRulesBySpecificity(writeRules)
 	sortRulesBySpecificity(readRules)
@@ -274,8 +580,119 @@ func (r *RuleResolver) Resolve() (writeRules, readRules []ResolvedRule, conflict
 	return writeRules, readRules, conflicts
 }
 
+// dropCoveredWriteDenies removes write-only denies (e.g. from --protect-git) for
+// paths that also have a read+write deny, which denies the same writes. An
+// AccessReadWrite deny lives only in writeRules and backends emit its write and
+// read parts from there, so each (path, operation) deny is emitted exactly once.
+func dropCoveredWriteDenies(rules []ResolvedRule) []ResolvedRule {
+	readWriteDenies := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Action == ActionDeny && rule.Mode == AccessReadWrite {
+			readWriteDenies[rule.Path] = true
+		}
+	}
+	kept := rules[:0]
+	for _, rule := range rules {
+		if rule.Action == ActionDeny && rule.Mode == AccessWrite && readWriteDenies[rule.Path] {
+			continue
+		}
+		kept = append(kept, rule)
+	}
+	return kept
+}
+
+// mergeReadWriteAllows folds a read allow into the write allow for the same
+// path, which then grants AccessReadWrite. Write allows already grant reads in
+// strict mode, so the read allow only duplicated the emitted rules. Output file
+// allows are left alone, as they only cover the file itself; deny rules and their
+// except carve-outs are not touched.
+func mergeReadWriteAllows(writeRules, readRules []ResolvedRule) ([]ResolvedRule, []ResolvedRule) {
+	writeAllows := make(map[string]int)
+	for i, rule := range writeRules {
+		if rule.Action == ActionAllow && !rule.IsFile {
+			writeAllows[rule.Path] = i
+		}
+	}
+	kept := readRules[:0]
+	for _, rule := range readRules {
+		if rule.Action == ActionAllow {
+			if i, ok := writeAllows[rule.Path]; ok && writeRules[i].IsGlob == rule.IsGlob {
+				writeRules[i].Mode = AccessReadWrite
+				continue
+			}
+		}
+		kept = append(kept, rule)
+	}
+	return writeRules, kept
+}
+
+// RuleRedundancy describes an allow rule that adds nothing because a rule from the
+// other side (CLI or preset) already grants the same access to the path or a parent
+type RuleRedundancy struct {
+	Rule    ResolvedRule // the redundant rule
+	Covered ResolvedRule // the rule that already grants the access
+}
+
+// RedundantAllows finds CLI allows already granted by a preset, and preset allows
+// already granted by the CLI
+// A parent only covers a path when no deny rule lies between them
+func (r *RuleResolver) RedundantAllows() []RuleRedundancy {
+	var cliAllows, presetAllows, denies []ResolvedRule
+	for _, rules := range r.rules {
+		for _, rule := range rules {
+			switch {
+			case rule.Action == ActionDeny:
+				denies = append(denies, rule)
+			case rule.Source.IsCLI():
+				cliAllows = append(cliAllows, rule)
+			default:
+				presetAllows = append(presetAllows, rule)
+			}
+		}
+	}
+	sortRulesBySpecificity(cliAllows)
+	sortRulesBySpecificity(presetAllows)
+
+	// covers reports whether parent already grants child's access
+	covers := func(parent, child ResolvedRule) bool {
+		if parent.Mode != child.Mode || parent.IsGlob || child.IsGlob || (parent.Append && !child.Append) {
+			return false
+		}
+		if parent.Path == child.Path {
+			return parent.IsFile == child.IsFile || child.IsFile
+		}
+		if parent.IsFile || !pathContains(parent.Path, child.Path) {
+			return false
+		}
+		for _, deny := range denies {
+			if pathContains(parent.Path, deny.Path) && (deny.Path == child.Path || pathContains(deny.Path, child.Path)) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var redundant []RuleRedundancy
+	for _, cli := range cliAllows {
+		for _, preset := range presetAllows {
+			switch {
+			case covers(preset, cli):
+				redundant = append(redundant, RuleRedundancy{Rule: cli, Covered: preset})
+			case covers(cli, preset):
+				redundant = append(redundant, RuleRedundancy{Rule: preset, Covered: cli})
+			}
+		}
+	}
+	return redundant
+}
+
 // resolveConflict resolves a conflict between multiple rules using precedence rules
 func resolveConflict(rules []ResolvedRule) ResolvedRule {
+	return resolveConflictOrdered(rules, CLIPresetsFirst)
+}
+
+// resolveConflictOrdered is resolveConflict with --preset presets ranked by order
+func resolveConflictOrdered(rules []ResolvedRule, order PresetOrder) ResolvedRule {
 	if len(rules) == 0 {
 		panic("resolveConflict called with empty rules")
 	}
@@ -284,13 +701,20 @@ func resolveConflict(rules []ResolvedRule) ResolvedRule {
 		return rules[0]
 	}
 
-	// Sort by precedence: CLI > preset, allow > deny, more specific path > less specific
+	// Sort by precedence: CLI > manual > auto > default preset (manual last with
+	// CLIPresetsLast), higher preset priority, allow > deny, more specific path
+	// > less specific
 	sort.Slice(rules, func(i, j int) bool {
 		rule1, rule2 := rules[i], rules[j]
 
-		// CLI beats preset
-		if rule1.Source.IsCLI != rule2.Source.IsCLI {
-			return rule1.Source.IsCLI // CLI wins
+		// CLI beats presets, manual presets beat auto-presets beat default presets
+		if rule1.Source.Origin != rule2.Source.Origin {
+			return rule1.Source.Origin.precedence(order) > rule2.Source.Origin.precedence(order)
+		}
+
+		// A higher preset priority wins
+		if rule1.Source.Priority != rule2.Source.Priority {
+			return rule1.Source.Priority > rule2.Source.Priority
 		}
 
 		// Allow beats deny
@@ -305,6 +729,55 @@ func resolveConflict(rules []ResolvedRule) ResolvedRule {
 	return rules[0] // Return highest precedence rule
 }
 
+// conflictReason explains which precedence rule decided a conflict
+// It mirrors the ordering used by resolveConflict
+func conflictReason(conflict RuleConflict) string {
+	winner := conflict.Resolution
+	for _, rule := range conflict.Rules {
+		if rule.Source.Origin == winner.Source.Origin {
+			continue
+		}
+		if winner.Source.IsCLI() {
+			return "CLI beats preset"
+		}
+		return winner.Source.Origin.String() + " beats " + rule.Source.Origin.String()
+	}
+	for _, rule := range conflict.Rules {
+		if rule.Source.Priority != winner.Source.Priority {
+			return fmt.Sprintf("priority %d beats priority %d", winner.Source.Priority, rule.Source.Priority)
+		}
+	}
+	for _, rule := range conflict.Rules {
+		if rule.Action != winner.Action {
+			return "allow beats deny"
+		}
+	}
+	return "more specific path wins"
+}
+
+// crossPresetWarnings describes each conflict between rules from different
+// sources on one line, naming the winning and losing sources, sorted by path
+func crossPresetWarnings(conflicts []RuleConflict) []string {
+	var warnings []string
+	for _, conflict := range conflicts {
+		if conflict.IsSamePreset {
+			continue
+		}
+		winner := conflict.Resolution
+		var losers []string
+		for _, rule := range conflict.Rules {
+			if rule.Action != winner.Action {
+				losers = append(losers, rule.Action.String()+" from "+formatRuleSource(rule))
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf("%s (%s): %s from %s wins over %s (%s)",
+			conflict.Path, winner.Mode, winner.Action, formatRuleSource(winner),
+			strings.Join(losers, ", "), conflictReason(conflict)))
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
 // isCarveOut checks if rule2 is a carve-out of rule1
 // A carve-out is when we have a broad deny with a specific allow inside it
 func isCarveOut(rule1, rule2 ResolvedRule) bool {
@@ -349,11 +822,37 @@ func isMoreSpecific(path1, path2 string) bool {
 	return len(path1) > len(path2)
 }
 
+// checkPathChars rejects a path containing a control character such as a
+// newline, CR or NUL; in a generated SBPL profile it could end the path's
+// string early and add directives of its own
+func checkPathChars(path string) error {
+	for _, c := range path {
+		if unicode.IsControl(c) {
+			return fmt.Errorf("path %q contains control character %U", path, c)
+		}
+	}
+	return nil
+}
+
+// checkRulePaths runs checkPathChars on the path and except paths of every rule
+func checkRulePaths(writeRules, readRules []ResolvedRule) error {
+	for _, rules := range [][]ResolvedRule{writeRules, readRules} {
+		for _, rule := range rules {
+			for _, path := range append([]string{rule.Path}, rule.Except...) {
+				if err := checkPathChars(path); err != nil {
+					return fmt.Errorf("%w (from %s)", err, formatRuleSource(rule))
+				}
+			}
+		}
+	}
+	return nil
+}
+
 // sortRulesBySpecificity sorts rules alphabetically by path
-// This groups paths by parent directory for readability while maintaining
-// correct sandbox behavior (deny rules are emitted first separately)
+// This groups paths by parent directory for readability; backends do not rely
+// on it for correctness, as they order denies and allows by nesting instead
 func sortRulesBySpecificity(rules []ResolvedRule) {
-	sort.Slice(rules, func(i, j int) bool {
+	sort.SliceStable(rules, func(i, j int) bool {
 		return rules[i].Path < rules[j].Path
 	})
 }
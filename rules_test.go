@@ -1,11 +1,56 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
+func TestCheckRulePaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    ResolvedRule
+		wantErr string
+	}{
+		{name: "plain path", rule: ResolvedRule{Path: `/work/odd "name" \ dir/café`}},
+		{
+			name:    "newline injecting a directive",
+			rule:    ResolvedRule{Path: "/work/x\")\n(allow file-write* (subpath \"/\"))"},
+			wantErr: "control character U+000A",
+		},
+		{name: "carriage return", rule: ResolvedRule{Path: "/work/x\r"}, wantErr: "U+000D"},
+		{name: "NUL", rule: ResolvedRule{Path: "/work/x\x00y"}, wantErr: "U+0000"},
+		{name: "tab", rule: ResolvedRule{Path: "/work/x\ty"}, wantErr: "U+0009"},
+		{
+			name:    "except path",
+			rule:    ResolvedRule{Path: "/home", Except: []string{"/home/a\nb"}, Source: RuleSource{PresetName: "evil"}},
+			wantErr: "(from evil)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRulePaths(nil, []ResolvedRule{tt.rule})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if err != nil && strings.Contains(err.Error(), "\n") {
+				t.Errorf("error should quote the path, got %q", err)
+			}
+		})
+	}
+}
+
 func TestPathContains(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -93,7 +138,7 @@ func TestPathContains(t *testing.T) {
 
 func TestRuleResolver_AddAllowRule(t *testing.T) {
 	resolver := NewRuleResolver()
-	source := RuleSource{PresetName: "test-preset", IsCLI: false}
+	source := RuleSource{PresetName: "test-preset", Origin: OriginManualPreset}
 
 	// Test adding a rule
 	resolver.AddAllowRule("/home/user/project", source)
@@ -123,14 +168,14 @@ func TestRuleResolver_AddAllowRule(t *testing.T) {
 	if rule.Source.PresetName != "test-preset" {
 		t.Errorf("Expected preset %q, got %q", "test-preset", rule.Source.PresetName)
 	}
-	if rule.Source.IsCLI != false {
-		t.Errorf("Expected IsCLI false, got %v", rule.Source.IsCLI)
+	if rule.Source.IsCLI() != false {
+		t.Errorf("Expected IsCLI false, got %v", rule.Source.IsCLI())
 	}
 }
 
 func TestRuleResolver_AddAllowRule_PathNormalization(t *testing.T) {
 	resolver := NewRuleResolver()
-	source := RuleSource{PresetName: "test", IsCLI: false}
+	source := RuleSource{PresetName: "test", Origin: OriginManualPreset}
 
 	// Test that relative path is converted to absolute
 	resolver.AddAllowRule("./relative/path", source)
@@ -156,7 +201,7 @@ func TestRuleResolver_AddAllowRule_PathNormalization(t *testing.T) {
 
 func TestRuleResolver_AddDenyRule(t *testing.T) {
 	resolver := NewRuleResolver()
-	source := RuleSource{PresetName: "security", IsCLI: true}
+	source := RuleSource{PresetName: "security", Origin: OriginCLI}
 	exceptions := []string{"/sensitive/allowed", "./relative/exception"}
 
 	// Test adding a deny rule with exceptions
@@ -184,8 +229,8 @@ func TestRuleResolver_AddDenyRule(t *testing.T) {
 	if rule.Action != ActionDeny {
 		t.Errorf("Expected action %v, got %v", ActionDeny, rule.Action)
 	}
-	if rule.Source.IsCLI != true {
-		t.Errorf("Expected IsCLI true, got %v", rule.Source.IsCLI)
+	if rule.Source.IsCLI() != true {
+		t.Errorf("Expected IsCLI true, got %v", rule.Source.IsCLI())
 	}
 
 	// Verify exceptions are normalized
@@ -216,7 +261,7 @@ func TestRuleResolver_ValidatePreset(t *testing.T) {
 		{
 			name: "duplicate allow rules in same preset",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test-preset", IsCLI: false}
+				source := RuleSource{PresetName: "test-preset", Origin: OriginManualPreset}
 				r.AddAllowRule("/path", source)
 				r.AddAllowRule("/path", source)
 			},
@@ -227,7 +272,7 @@ func TestRuleResolver_ValidatePreset(t *testing.T) {
 		{
 			name: "duplicate deny rules in same preset",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test-preset", IsCLI: false}
+				source := RuleSource{PresetName: "test-preset", Origin: OriginManualPreset}
 				r.AddDenyRule("/path", []string{}, source)
 				r.AddDenyRule("/path", []string{}, source)
 			},
@@ -238,7 +283,7 @@ func TestRuleResolver_ValidatePreset(t *testing.T) {
 		{
 			name: "conflict - allow and deny same path in same preset",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test-preset", IsCLI: false}
+				source := RuleSource{PresetName: "test-preset", Origin: OriginManualPreset}
 				r.AddAllowRule("/path", source)
 				// Note: AddDenyRule uses AccessReadWrite, but we need to test same mode conflict
 				// We'll add a deny rule manually for this test
@@ -256,7 +301,7 @@ func TestRuleResolver_ValidatePreset(t *testing.T) {
 		{
 			name: "no error for carve-out pattern - deny broad, allow specific",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test-preset", IsCLI: false}
+				source := RuleSource{PresetName: "test-preset", Origin: OriginManualPreset}
 				r.AddDenyRule("/broad", []string{}, source)
 				// Manually add an allow rule for same mode to test carve-out
 				r.addRule(ResolvedRule{
@@ -273,8 +318,8 @@ func TestRuleResolver_ValidatePreset(t *testing.T) {
 		{
 			name: "no error when rules are from different presets",
 			setupRules: func(r *RuleResolver) {
-				source1 := RuleSource{PresetName: "preset1", IsCLI: false}
-				source2 := RuleSource{PresetName: "preset2", IsCLI: false}
+				source1 := RuleSource{PresetName: "preset1", Origin: OriginManualPreset}
+				source2 := RuleSource{PresetName: "preset2", Origin: OriginManualPreset}
 				r.AddAllowRule("/path", source1)
 				r.addRule(ResolvedRule{
 					Path:   cleanPath("/path"),
@@ -290,7 +335,7 @@ func TestRuleResolver_ValidatePreset(t *testing.T) {
 		{
 			name: "no errors for valid preset",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test-preset", IsCLI: false}
+				source := RuleSource{PresetName: "test-preset", Origin: OriginManualPreset}
 				r.AddAllowRule("/path1", source)
 				r.AddAllowRule("/path2", source)
 				r.AddDenyRule("/path3", []string{}, source)
@@ -346,7 +391,7 @@ func TestRuleResolver_Resolve(t *testing.T) {
 		{
 			name: "single rule returns unchanged",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test", IsCLI: false}
+				source := RuleSource{PresetName: "test", Origin: OriginManualPreset}
 				r.AddAllowRule("/path", source)
 			},
 			expectedWriteRules: 1,
@@ -356,7 +401,7 @@ func TestRuleResolver_Resolve(t *testing.T) {
 		{
 			name: "most specific path wins - longer path beats shorter",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test", IsCLI: false}
+				source := RuleSource{PresetName: "test", Origin: OriginManualPreset}
 				r.addRule(ResolvedRule{
 					Path:   "/home",
 					Mode:   AccessWrite,
@@ -377,8 +422,8 @@ func TestRuleResolver_Resolve(t *testing.T) {
 		{
 			name: "CLI rule beats preset rule for same path",
 			setupRules: func(r *RuleResolver) {
-				presetSource := RuleSource{PresetName: "test", IsCLI: false}
-				cliSource := RuleSource{PresetName: "", IsCLI: true}
+				presetSource := RuleSource{PresetName: "test", Origin: OriginManualPreset}
+				cliSource := RuleSource{PresetName: "", Origin: OriginCLI}
 				r.addRule(ResolvedRule{
 					Path:   "/path",
 					Mode:   AccessWrite,
@@ -396,7 +441,7 @@ func TestRuleResolver_Resolve(t *testing.T) {
 			expectedReadRules:  0,
 			expectedConflicts:  1,
 			validateResult: func(t *testing.T, writeRules, readRules []ResolvedRule, conflicts []RuleConflict) {
-				if len(writeRules) > 0 && !writeRules[0].Source.IsCLI {
+				if len(writeRules) > 0 && !writeRules[0].Source.IsCLI() {
 					t.Error("Expected CLI rule to win, but preset rule won")
 				}
 			},
@@ -404,7 +449,7 @@ func TestRuleResolver_Resolve(t *testing.T) {
 		{
 			name: "allow beats deny for same path and source type",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test", IsCLI: false}
+				source := RuleSource{PresetName: "test", Origin: OriginManualPreset}
 				r.addRule(ResolvedRule{
 					Path:   "/path",
 					Mode:   AccessWrite,
@@ -430,7 +475,7 @@ func TestRuleResolver_Resolve(t *testing.T) {
 		{
 			name: "carve-out pattern is NOT reported as conflict",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test", IsCLI: false}
+				source := RuleSource{PresetName: "test", Origin: OriginManualPreset}
 				r.addRule(ResolvedRule{
 					Path:   "/broad",
 					Mode:   AccessWrite,
@@ -451,7 +496,7 @@ func TestRuleResolver_Resolve(t *testing.T) {
 		{
 			name: "rules sorted alphabetically",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test", IsCLI: false}
+				source := RuleSource{PresetName: "test", Origin: OriginManualPreset}
 				r.AddAllowRule("/very/long/path/here", source)
 				r.AddAllowRule("/short", source)
 				r.AddAllowRule("/medium/path", source)
@@ -472,7 +517,7 @@ func TestRuleResolver_Resolve(t *testing.T) {
 		{
 			name: "read and write rules separated correctly",
 			setupRules: func(r *RuleResolver) {
-				source := RuleSource{PresetName: "test", IsCLI: false}
+				source := RuleSource{PresetName: "test", Origin: OriginManualPreset}
 				r.AddAllowRule("/write/path", source)                // AccessWrite
 				r.AddReadRule("/read/path", source)                  // AccessRead
 				r.AddDenyRule("/readwrite/path", []string{}, source) // AccessReadWrite
@@ -687,18 +732,18 @@ func TestResolveConflict(t *testing.T) {
 				{
 					Path:   "/path",
 					Action: ActionDeny,
-					Source: RuleSource{PresetName: "preset", IsCLI: false},
+					Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 				},
 				{
 					Path:   "/path",
 					Action: ActionAllow,
-					Source: RuleSource{PresetName: "", IsCLI: true},
+					Source: RuleSource{PresetName: "", Origin: OriginCLI},
 				},
 			},
 			expected: ResolvedRule{
 				Path:   "/path",
 				Action: ActionAllow,
-				Source: RuleSource{PresetName: "", IsCLI: true},
+				Source: RuleSource{PresetName: "", Origin: OriginCLI},
 			},
 		},
 		{
@@ -707,18 +752,18 @@ func TestResolveConflict(t *testing.T) {
 				{
 					Path:   "/path",
 					Action: ActionDeny,
-					Source: RuleSource{PresetName: "preset", IsCLI: false},
+					Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 				},
 				{
 					Path:   "/path",
 					Action: ActionAllow,
-					Source: RuleSource{PresetName: "preset", IsCLI: false},
+					Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 				},
 			},
 			expected: ResolvedRule{
 				Path:   "/path",
 				Action: ActionAllow,
-				Source: RuleSource{PresetName: "preset", IsCLI: false},
+				Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 			},
 		},
 		{
@@ -727,18 +772,18 @@ func TestResolveConflict(t *testing.T) {
 				{
 					Path:   "/broad",
 					Action: ActionAllow,
-					Source: RuleSource{PresetName: "preset", IsCLI: false},
+					Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 				},
 				{
 					Path:   "/broad/specific",
 					Action: ActionAllow,
-					Source: RuleSource{PresetName: "preset", IsCLI: false},
+					Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 				},
 			},
 			expected: ResolvedRule{
 				Path:   "/broad/specific",
 				Action: ActionAllow,
-				Source: RuleSource{PresetName: "preset", IsCLI: false},
+				Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 			},
 		},
 		{
@@ -747,13 +792,13 @@ func TestResolveConflict(t *testing.T) {
 				{
 					Path:   "/path",
 					Action: ActionAllow,
-					Source: RuleSource{PresetName: "preset", IsCLI: false},
+					Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 				},
 			},
 			expected: ResolvedRule{
 				Path:   "/path",
 				Action: ActionAllow,
-				Source: RuleSource{PresetName: "preset", IsCLI: false},
+				Source: RuleSource{PresetName: "preset", Origin: OriginManualPreset},
 			},
 		},
 	}
@@ -769,8 +814,8 @@ func TestResolveConflict(t *testing.T) {
 			if result.Action != tt.expected.Action {
 				t.Errorf("Expected action %v, got %v", tt.expected.Action, result.Action)
 			}
-			if result.Source.IsCLI != tt.expected.Source.IsCLI {
-				t.Errorf("Expected IsCLI %v, got %v", tt.expected.Source.IsCLI, result.Source.IsCLI)
+			if result.Source.IsCLI() != tt.expected.Source.IsCLI() {
+				t.Errorf("Expected IsCLI %v, got %v", tt.expected.Source.IsCLI(), result.Source.IsCLI())
 			}
 			if result.Source.PresetName != tt.expected.Source.PresetName {
 				t.Errorf("Expected preset %q, got %q", tt.expected.Source.PresetName, result.Source.PresetName)
@@ -941,6 +986,34 @@ func TestDenyRuleWithReadOnlyAppearsInReadListOnly(t *testing.T) {
 	}
 }
 
+func TestResolve_DenyPerOperationOnce(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddDenyRule("/work/.git", nil, RuleSource{PresetName: "secure"})
+	resolver.AddWriteDenyRule("/work/.git", RuleSource{PresetName: "-protect-git", Origin: OriginCLI})
+	resolver.AddWriteDenyRule("/work/build", RuleSource{Origin: OriginCLI})
+	resolver.AddReadRule("/work/.git", RuleSource{PresetName: "secure"})
+
+	writeRules, readRules, _ := resolver.Resolve()
+
+	// Count each (path, operation) a deny covers across both rule lists
+	denies := make(map[string]int)
+	for _, rule := range append(append([]ResolvedRule{}, writeRules...), readRules...) {
+		if rule.Action != ActionDeny {
+			continue
+		}
+		if rule.Mode&AccessWrite != 0 {
+			denies[rule.Path+" write"]++
+		}
+		if rule.Mode&AccessRead != 0 {
+			denies[rule.Path+" read"]++
+		}
+	}
+	expected := map[string]int{"/work/.git write": 1, "/work/.git read": 1, "/work/build write": 1}
+	if !reflect.DeepEqual(denies, expected) {
+		t.Errorf("deny operations = %v, want %v", denies, expected)
+	}
+}
+
 func TestResolveConditionLogic(t *testing.T) {
 	testCases := []struct {
 		name             string
@@ -999,3 +1072,738 @@ func TestResolveConditionLogic(t *testing.T) {
 		})
 	}
 }
+
+func TestConflictReason(t *testing.T) {
+	cli := RuleSource{Origin: OriginCLI}
+	preset := RuleSource{PresetName: "test"}
+
+	tests := []struct {
+		name     string
+		conflict RuleConflict
+		expected string
+	}{
+		{
+			name: "CLI beats preset",
+			conflict: RuleConflict{
+				Rules: []ResolvedRule{
+					{Path: "/path", Action: ActionAllow, Source: cli},
+					{Path: "/path", Action: ActionDeny, Source: preset},
+				},
+				Resolution: ResolvedRule{Path: "/path", Action: ActionAllow, Source: cli},
+			},
+			expected: "CLI beats preset",
+		},
+		{
+			name: "manual preset beats auto preset",
+			conflict: RuleConflict{
+				Rules: []ResolvedRule{
+					{Path: "/path", Action: ActionAllow, Source: RuleSource{PresetName: "auto", Origin: OriginAutoPreset}},
+					{Path: "/path", Action: ActionDeny, Source: preset},
+				},
+				Resolution: ResolvedRule{Path: "/path", Action: ActionDeny, Source: preset},
+			},
+			expected: "manual preset beats auto preset",
+		},
+		{
+			name: "higher priority beats lower",
+			conflict: RuleConflict{
+				Rules: []ResolvedRule{
+					{Path: "/path", Action: ActionAllow, Source: preset},
+					{Path: "/path", Action: ActionDeny, Source: RuleSource{PresetName: "locked", Priority: 10}},
+				},
+				Resolution: ResolvedRule{Path: "/path", Action: ActionDeny, Source: RuleSource{PresetName: "locked", Priority: 10}},
+			},
+			expected: "priority 10 beats priority 0",
+		},
+		{
+			name: "allow beats deny",
+			conflict: RuleConflict{
+				Rules: []ResolvedRule{
+					{Path: "/path", Action: ActionAllow, Source: preset},
+					{Path: "/path", Action: ActionDeny, Source: preset},
+				},
+				Resolution: ResolvedRule{Path: "/path", Action: ActionAllow, Source: preset},
+			},
+			expected: "allow beats deny",
+		},
+		{
+			name: "same action falls back to specificity",
+			conflict: RuleConflict{
+				Rules: []ResolvedRule{
+					{Path: "/path", Action: ActionDeny, Source: preset},
+					{Path: "/path", Action: ActionDeny, Source: preset},
+				},
+				Resolution: ResolvedRule{Path: "/path", Action: ActionDeny, Source: preset},
+			},
+			expected: "more specific path wins",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := conflictReason(tt.conflict); got != tt.expected {
+				t.Errorf("conflictReason() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRuleResolver_AddOutputRule(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddOutputRule("/tmp/out/../build.log", RuleSource{Origin: OriginCLI})
+
+	writeRules, readRules, _ := resolver.Resolve()
+	if len(writeRules) != 1 || len(readRules) != 0 {
+		t.Fatalf("expected 1 write rule and 0 read rules, got %d and %d", len(writeRules), len(readRules))
+	}
+
+	rule := writeRules[0]
+	if rule.Path != "/tmp/build.log" {
+		t.Errorf("expected normalized path /tmp/build.log, got %s", rule.Path)
+	}
+	if !rule.IsFile || rule.Action != ActionAllow || rule.Mode != AccessWrite {
+		t.Errorf("expected file write allow rule, got %+v", rule)
+	}
+}
+
+func TestRuleResolver_AddAllowRuleNoRefer(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddAllowRuleNoRefer("/work", RuleSource{PresetName: "test"})
+	resolver.AddAllowRule("/other", RuleSource{PresetName: "test"})
+
+	writeRules, _, _ := resolver.Resolve()
+	if len(writeRules) != 2 {
+		t.Fatalf("expected 2 write rules, got %d", len(writeRules))
+	}
+	for _, rule := range writeRules {
+		if rule.NoRefer != (rule.Path == "/work") {
+			t.Errorf("unexpected NoRefer=%v for %s", rule.NoRefer, rule.Path)
+		}
+	}
+}
+
+func TestRuleResolver_AddFileLevelDenyRule(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule("/work", RuleSource{Origin: OriginCLI})
+	resolver.AddFileLevelDenyRule("/work", AccessWrite, RuleSource{Origin: OriginCLI})
+
+	// A single-level deny does not cover the directory itself, so it does not
+	// conflict with an allow of the same path
+	writeRules, _, conflicts := resolver.Resolve()
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %+v", conflicts)
+	}
+	if len(writeRules) != 2 {
+		t.Fatalf("expected 2 write rules, got %+v", writeRules)
+	}
+	for _, rule := range writeRules {
+		if rule.FileLevel != (rule.Action == ActionDeny) {
+			t.Errorf("unexpected FileLevel=%v for %+v", rule.FileLevel, rule)
+		}
+	}
+}
+
+func TestResolve_ScopedDefaultDeny(t *testing.T) {
+	// Denying a directory and allowing some of its children is a carve-out,
+	// not a conflict: the deny and both allows all reach the backends
+	resolver := NewRuleResolver()
+	cli := RuleSource{Origin: OriginCLI}
+	resolver.AddDenyRule("/work", nil, cli)
+	resolver.AddAllowRule("/work/src", cli)
+	resolver.AddAllowRule("/work/build", cli)
+
+	writeRules, readRules, conflicts := resolver.Resolve()
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %+v", conflicts)
+	}
+	if len(readRules) != 0 {
+		t.Errorf("expected no read rules, got %+v", readRules)
+	}
+
+	var got []string
+	for _, rule := range writeRules {
+		got = append(got, fmt.Sprintf("%s %s %s", rule.Action, rule.Path, rule.Mode))
+	}
+	want := []string{"deny /work read+write", "allow /work/build write", "allow /work/src write"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("write rules = %v, want %v", got, want)
+	}
+}
+
+func TestResolve_MergesReadAndWriteAllows(t *testing.T) {
+	resolver := NewRuleResolver()
+	cli := RuleSource{Origin: OriginCLI}
+	resolver.AddAllowRule("/work", cli)
+	resolver.AddReadRule("/work", cli)
+	resolver.AddReadRule("/docs", cli)
+	resolver.AddOutputRule("/logs/build.log", cli)
+	resolver.AddReadRule("/logs/build.log", cli)
+	resolver.AddDenyRule("/secrets", []string{"/secrets/public"}, RuleSource{PresetName: "lockdown"})
+	resolver.AddAllowRule("/secrets/public", cli)
+	resolver.AddReadRule("/secrets/public", cli)
+
+	writeRules, readRules, conflicts := resolver.Resolve()
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %+v", conflicts)
+	}
+
+	modes := make(map[string]AccessMode)
+	for _, rule := range writeRules {
+		modes[rule.Action.String()+" "+rule.Path] = rule.Mode
+	}
+	want := map[string]AccessMode{
+		"allow /work":           AccessReadWrite,
+		"allow /secrets/public": AccessReadWrite,
+		"allow /logs/build.log": AccessWrite,
+		"deny /secrets":         AccessReadWrite,
+	}
+	if !reflect.DeepEqual(modes, want) {
+		t.Errorf("write rule modes = %v, want %v", modes, want)
+	}
+
+	var readPaths []string
+	for _, rule := range readRules {
+		readPaths = append(readPaths, rule.Path)
+	}
+	// The output file only covers the file itself, so its read allow stays
+	if !reflect.DeepEqual(readPaths, []string{"/docs", "/logs/build.log"}) {
+		t.Errorf("read rules = %v, want [/docs /logs/build.log]", readPaths)
+	}
+
+	for _, rule := range writeRules {
+		if rule.Action == ActionDeny && !reflect.DeepEqual(rule.Except, []string{"/secrets/public"}) {
+			t.Errorf("carve-out lost from %+v", rule)
+		}
+	}
+}
+
+func TestRuleResolver_RemoveAndQuery(t *testing.T) {
+	resolver := NewRuleResolver()
+	cli := RuleSource{Origin: OriginCLI}
+	preset := RuleSource{PresetName: "base"}
+	resolver.AddAllowRule("/work", preset)
+	resolver.AddAllowRule("/work/", cli)
+	resolver.AddReadRule("/work", cli)
+	resolver.AddDenyRule("/work/secrets", nil, preset)
+	resolver.AddFileLevelDenyRule("/work/top", AccessWrite, cli)
+
+	all := resolver.AllRules()
+	var got []string
+	for _, rule := range all {
+		got = append(got, rule.Action.String()+" "+rule.Mode.String()+" "+rule.Path)
+	}
+	want := []string{
+		"allow read /work",
+		"allow write /work",
+		"allow write /work",
+		"deny read+write /work/secrets",
+		"deny write /work/top",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("AllRules() = %v, want %v", got, want)
+	}
+	// Rules for the same path and mode keep the order they were added in
+	if all[1].Source.PresetName != "base" || !all[2].Source.IsCLI() {
+		t.Errorf("expected the preset rule before the CLI rule, got %+v, %+v", all[1].Source, all[2].Source)
+	}
+
+	if !resolver.HasRule("/work/./", AccessWrite) || !resolver.HasRule("/work/top", AccessWrite) {
+		t.Error("HasRule() should find rules by cleaned path, including single-level denies")
+	}
+	if resolver.HasRule("/work/secrets", AccessWrite) {
+		t.Error("HasRule() should match the access mode exactly")
+	}
+
+	if !resolver.RemoveRule("/work", AccessWrite) {
+		t.Error("RemoveRule() should report that rules were removed")
+	}
+	if resolver.RemoveRule("/work", AccessWrite) {
+		t.Error("RemoveRule() of a removed rule should report false")
+	}
+	if resolver.HasRule("/work", AccessWrite) || !resolver.HasRule("/work", AccessRead) {
+		t.Error("RemoveRule() should only drop the given mode")
+	}
+	resolver.RemoveRule("/work/top", AccessWrite)
+
+	writeRules, readRules, _ := resolver.Resolve()
+	if len(writeRules) != 1 || writeRules[0].Path != "/work/secrets" {
+		t.Errorf("expected only the deny to remain in the write rules, got %+v", writeRules)
+	}
+	if len(readRules) != 1 || readRules[0].Path != "/work" {
+		t.Errorf("expected the read allow to remain, got %+v", readRules)
+	}
+}
+
+func TestResolveConflict_OriginPrecedence(t *testing.T) {
+	cli := RuleSource{Origin: OriginCLI}
+	manual := RuleSource{PresetName: "chosen"}
+	auto := RuleSource{PresetName: "detected", Origin: OriginAutoPreset}
+	defaults := RuleSource{PresetName: "base", Origin: OriginDefaultPreset}
+
+	tests := []struct {
+		name     string
+		rules    []ResolvedRule
+		expected RuleSource
+	}{
+		{
+			name: "manual preset deny beats auto-preset allow",
+			rules: []ResolvedRule{
+				{Path: "/work", Action: ActionAllow, Source: auto},
+				{Path: "/work", Action: ActionDeny, Source: manual},
+			},
+			expected: manual,
+		},
+		{
+			name: "auto-preset beats default preset",
+			rules: []ResolvedRule{
+				{Path: "/work", Action: ActionAllow, Source: defaults},
+				{Path: "/work", Action: ActionDeny, Source: auto},
+			},
+			expected: auto,
+		},
+		{
+			name: "CLI beats manual preset",
+			rules: []ResolvedRule{
+				{Path: "/work", Action: ActionAllow, Source: manual},
+				{Path: "/work", Action: ActionDeny, Source: cli},
+			},
+			expected: cli,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveConflict(tt.rules); got.Source != tt.expected {
+				t.Errorf("resolveConflict() winner from %+v, want %+v", got.Source, tt.expected)
+			}
+		})
+	}
+}
+
+func TestResolveConflict_Priority(t *testing.T) {
+	low := RuleSource{PresetName: "dev"}
+	high := RuleSource{PresetName: "locked-down", Priority: 10}
+	autoHigh := RuleSource{PresetName: "detected", Origin: OriginAutoPreset, Priority: 100}
+
+	tests := []struct {
+		name     string
+		rules    []ResolvedRule
+		expected RuleSource
+	}{
+		{
+			name: "higher priority deny beats allow",
+			rules: []ResolvedRule{
+				{Path: "/work", Action: ActionAllow, Source: low},
+				{Path: "/work", Action: ActionDeny, Source: high},
+			},
+			expected: high,
+		},
+		{
+			name: "higher priority allow beats deny",
+			rules: []ResolvedRule{
+				{Path: "/work", Action: ActionDeny, Source: low},
+				{Path: "/work", Action: ActionAllow, Source: high},
+			},
+			expected: high,
+		},
+		{
+			name: "negative priority loses to the default",
+			rules: []ResolvedRule{
+				{Path: "/work", Action: ActionAllow, Source: RuleSource{PresetName: "weak", Priority: -1}},
+				{Path: "/work", Action: ActionDeny, Source: low},
+			},
+			expected: low,
+		},
+		{
+			name: "origin is decided before priority",
+			rules: []ResolvedRule{
+				{Path: "/work", Action: ActionAllow, Source: autoHigh},
+				{Path: "/work", Action: ActionDeny, Source: low},
+			},
+			expected: low,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveConflict(tt.rules); got.Source != tt.expected {
+				t.Errorf("resolveConflict() winner from %+v, want %+v", got.Source, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRuleResolver_RedundantAllows(t *testing.T) {
+	cli := RuleSource{Origin: OriginCLI}
+	preset := RuleSource{PresetName: "dev"}
+
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule("/work", cli)
+	resolver.AddAllowRule("/work", preset)       // same path as the CLI allow
+	resolver.AddAllowRule("/cache/npm", cli)     // inside a preset allow
+	resolver.AddAllowRule("/cache", preset)      // covers the CLI allow above
+	resolver.AddAllowRule("/data/secret/x", cli) // a deny lies in between
+	resolver.AddAllowRule("/data", preset)       // does not cover the CLI allow
+	resolver.AddDenyRule("/data/secret", nil, preset)
+	resolver.AddReadRule("/usr", preset) // different mode from the CLI allow
+	resolver.AddAllowRule("/usr/local", cli)
+
+	redundant := resolver.RedundantAllows()
+	got := make(map[string]string)
+	for _, r := range redundant {
+		got[r.Rule.Path] = r.Covered.Path
+	}
+	expected := map[string]string{
+		"/work":      "/work",
+		"/cache/npm": "/cache",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("RedundantAllows() = %v, want %v", got, expected)
+	}
+	for _, r := range redundant {
+		if !r.Rule.Source.IsCLI() {
+			t.Errorf("expected the CLI rule to be reported as redundant, got %+v", r.Rule)
+		}
+	}
+
+	// A preset allow nested inside a CLI allow is the redundant one
+	resolver = NewRuleResolver()
+	resolver.AddAllowRule("/work", cli)
+	resolver.AddAllowRule("/work/node_modules", preset)
+	redundant = resolver.RedundantAllows()
+	if len(redundant) != 1 || redundant[0].Rule.Source.IsCLI() || redundant[0].Covered.Path != "/work" {
+		t.Errorf("expected preset allow to be covered by the CLI allow, got %+v", redundant)
+	}
+}
+
+func TestResolvedRuleKeepsOriginalPath(t *testing.T) {
+	base := t.TempDir()
+	work := filepath.Join(base, "work")
+	if err := os.Mkdir(work, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(work)
+
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule("../shared/./out", RuleSource{Origin: OriginCLI})
+	resolver.AddReadRule(work, RuleSource{Origin: OriginCLI})
+	writeRules, readRules, _ := resolver.Resolve()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(filepath.Dir(cwd), "shared", "out")
+	if len(writeRules) != 1 || writeRules[0].Path != want || writeRules[0].Original != "../shared/./out" {
+		t.Fatalf("write rules = %+v, want %s from ../shared/./out", writeRules, want)
+	}
+	if got := formatRulePath(writeRules[0]); got != "../shared/./out → "+want {
+		t.Errorf("formatRulePath() = %q", got)
+	}
+
+	changed := canonicalizedRules(writeRules, readRules)
+	if len(changed) != 1 || changed[0].Path != want {
+		t.Errorf("canonicalizedRules() = %+v, want only the ../ rule", changed)
+	}
+	if got := formatRulePath(readRules[0]); got != readRules[0].Path {
+		t.Errorf("formatRulePath() for an unchanged path = %q, want %q", got, readRules[0].Path)
+	}
+}
+
+func TestCrossPresetWarnings(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule("/work", RuleSource{PresetName: "npm"})
+	resolver.AddWriteDenyRule("/work", RuleSource{PresetName: "lockdown", Priority: 10})
+	resolver.AddDenyRule("/work/secrets", nil, RuleSource{PresetName: "lockdown"})
+	resolver.AddAllowRule("/work/secrets/public", RuleSource{PresetName: "npm"})
+
+	_, _, conflicts := resolver.Resolve()
+	warnings := crossPresetWarnings(conflicts)
+	expected := []string{
+		"/work (write): deny from lockdown wins over allow from npm (priority 10 beats priority 0)",
+	}
+	if !reflect.DeepEqual(warnings, expected) {
+		t.Errorf("crossPresetWarnings() = %q, want %q", warnings, expected)
+	}
+
+	same := []RuleConflict{{Path: "/tmp", IsSamePreset: true}}
+	if warnings := crossPresetWarnings(same); len(warnings) != 0 {
+		t.Errorf("expected no warnings for a same-preset conflict, got %q", warnings)
+	}
+}
+
+func TestRuleConflictJSONRoundTrip(t *testing.T) {
+	allow := ResolvedRule{
+		Path:   "/work",
+		Mode:   AccessWrite,
+		Action: ActionAllow,
+		Source: RuleSource{PresetName: "dev", Origin: OriginAutoPreset, Priority: 2},
+	}
+	deny := ResolvedRule{
+		Path:   "/work",
+		Mode:   AccessWrite,
+		Action: ActionDeny,
+		Source: RuleSource{Origin: OriginCLI, Reason: "generated"},
+	}
+	conflict := RuleConflict{Path: "/work", Rules: []ResolvedRule{allow, deny}, Resolution: deny}
+
+	data, err := json.Marshal(conflict)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	want := `{"path":"/work","rules":[` +
+		`{"path":"/work","mode":"write","action":"allow","source":{"preset":"dev","origin":"auto preset","priority":2}},` +
+		`{"path":"/work","mode":"write","action":"deny","source":{"origin":"CLI","reason":"generated"}}],` +
+		`"resolution":{"path":"/work","mode":"write","action":"deny","source":{"origin":"CLI","reason":"generated"}},` +
+		`"same_preset":false}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() =\n%s\nwant\n%s", data, want)
+	}
+
+	var got RuleConflict
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, conflict) {
+		t.Errorf("round trip = %+v, want %+v", got, conflict)
+	}
+}
+
+func TestRuleActionAndOriginJSON(t *testing.T) {
+	for _, action := range []RuleAction{ActionAllow, ActionDeny} {
+		data, err := json.Marshal(action)
+		if err != nil {
+			t.Fatalf("json.Marshal(%v) error = %v", action, err)
+		}
+		var got RuleAction
+		if err := json.Unmarshal(data, &got); err != nil || got != action {
+			t.Errorf("json.Unmarshal(%s) = %v, %v; want %v", data, got, err, action)
+		}
+	}
+	for _, origin := range []RuleOrigin{OriginManualPreset, OriginAutoPreset, OriginDefaultPreset, OriginCLI} {
+		data, err := json.Marshal(origin)
+		if err != nil {
+			t.Fatalf("json.Marshal(%v) error = %v", origin, err)
+		}
+		var got RuleOrigin
+		if err := json.Unmarshal(data, &got); err != nil || got != origin {
+			t.Errorf("json.Unmarshal(%s) = %v, %v; want %v", data, got, err, origin)
+		}
+	}
+
+	if _, err := json.Marshal(RuleAction(7)); err == nil {
+		t.Error("json.Marshal should reject an invalid action")
+	}
+	if _, err := json.Marshal(RuleOrigin(7)); err == nil {
+		t.Error("json.Marshal should reject an invalid origin")
+	}
+	var action RuleAction
+	if err := json.Unmarshal([]byte(`"permit"`), &action); err == nil {
+		t.Error("json.Unmarshal should reject an unknown action")
+	}
+}
+
+func TestAddAppendRule(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddAppendRule("/var/log/app", RuleSource{Origin: OriginCLI})
+	resolver.AddAllowRule("/var/log", RuleSource{PresetName: "logs"})
+
+	writeRules, _, conflicts := resolver.Resolve()
+	if len(conflicts) != 0 {
+		t.Errorf("expected no conflicts, got %v", conflicts)
+	}
+	var found bool
+	for _, rule := range writeRules {
+		if rule.Path == "/var/log/app" {
+			found = true
+			if !rule.Append || rule.Action != ActionAllow || rule.Mode != AccessWrite {
+				t.Errorf("unexpected append rule %+v", rule)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("append rule missing from the write rules")
+	}
+
+	// A full allow covers an append allow, but not the other way around
+	if notes := resolver.RedundantAllows(); len(notes) != 1 || notes[0].Rule.Path != "/var/log/app" {
+		t.Errorf("RedundantAllows() = %+v, want the append rule covered by /var/log", notes)
+	}
+	resolver = NewRuleResolver()
+	resolver.AddAllowRule("/var/log/app", RuleSource{Origin: OriginCLI})
+	resolver.AddAppendRule("/var/log", RuleSource{PresetName: "logs"})
+	if notes := resolver.RedundantAllows(); len(notes) != 0 {
+		t.Errorf("an append allow must not cover a full allow, got %+v", notes)
+	}
+}
+
+func TestResolvePresetOrder(t *testing.T) {
+	manual := RuleSource{PresetName: "base"}
+	auto := RuleSource{PresetName: "npm", Origin: OriginAutoPreset}
+	defaults := RuleSource{PresetName: "home", Origin: OriginDefaultPreset}
+	cli := RuleSource{Origin: OriginCLI}
+
+	tests := []struct {
+		name  string
+		order PresetOrder
+		add   func(r *RuleResolver)
+		want  RuleSource
+	}{
+		{
+			name:  "cli-first: --preset beats auto preset",
+			order: CLIPresetsFirst,
+			add: func(r *RuleResolver) {
+				r.AddWriteDenyRule("/work", manual)
+				r.AddAllowRule("/work", auto)
+			},
+			want: manual,
+		},
+		{
+			name:  "cli-last: auto preset beats --preset",
+			order: CLIPresetsLast,
+			add: func(r *RuleResolver) {
+				r.AddWriteDenyRule("/work", manual)
+				r.AddAllowRule("/work", auto)
+			},
+			want: auto,
+		},
+		{
+			name:  "cli-last: default preset beats --preset",
+			order: CLIPresetsLast,
+			add: func(r *RuleResolver) {
+				r.AddAllowRule("/work", manual)
+				r.AddWriteDenyRule("/work", defaults)
+			},
+			want: defaults,
+		},
+		{
+			name:  "cli-last: auto preset still beats default preset",
+			order: CLIPresetsLast,
+			add: func(r *RuleResolver) {
+				r.AddWriteDenyRule("/work", auto)
+				r.AddAllowRule("/work", defaults)
+			},
+			want: auto,
+		},
+		{
+			name:  "cli-last: command-line flag still wins",
+			order: CLIPresetsLast,
+			add: func(r *RuleResolver) {
+				r.AddWriteDenyRule("/work", cli)
+				r.AddAllowRule("/work", auto)
+			},
+			want: cli,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := NewRuleResolver()
+			resolver.SetPresetOrder(tt.order)
+			tt.add(resolver)
+			_, _, conflicts := resolver.Resolve()
+			if len(conflicts) != 1 {
+				t.Fatalf("expected 1 conflict, got %d", len(conflicts))
+			}
+			if got := conflicts[0].Resolution.Source; got != tt.want {
+				t.Errorf("winner from %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePresetOrder(t *testing.T) {
+	for name, want := range map[string]PresetOrder{"": CLIPresetsFirst, "cli-first": CLIPresetsFirst, "cli-last": CLIPresetsLast} {
+		if got, err := parsePresetOrder(name); err != nil || got != want {
+			t.Errorf("parsePresetOrder(%q) = %v, %v; want %v", name, got, err, want)
+		}
+	}
+	if _, err := parsePresetOrder("last"); err == nil {
+		t.Error("parsePresetOrder should reject unknown orders")
+	}
+}
+
+func TestRuleResolverBaseDir(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.SetBaseDir("/work/project")
+	source := RuleSource{Origin: OriginCLI}
+	resolver.AddAllowRule("./build", source)
+	resolver.AddReadRule("../shared", source)
+	resolver.AddDenyRule("secrets", []string{"secrets/public"}, source)
+	resolver.AddAllowRule("/tmp/abs", source)
+
+	writeRules, readRules, _ := resolver.Resolve()
+	paths := make(map[string]ResolvedRule)
+	for _, rule := range append(writeRules, readRules...) {
+		paths[rule.Path] = rule
+	}
+	for _, want := range []string{"/work/project/build", "/work/shared", "/work/project/secrets", "/tmp/abs"} {
+		if _, ok := paths[want]; !ok {
+			t.Errorf("expected a rule for %s, got %v", want, paths)
+		}
+	}
+	if rule := paths["/work/project/secrets"]; !reflect.DeepEqual(rule.Except, []string{"/work/project/secrets/public"}) {
+		t.Errorf("Except = %v, want the carve-out resolved against the base dir", rule.Except)
+	}
+	if rule := paths["/work/project/build"]; rule.Original != "./build" {
+		t.Errorf("Original = %q, want the path as given", rule.Original)
+	}
+}
+
+func TestCleanPathIn(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		base, path, want string
+	}{
+		{"/work", "build", "/work/build"},
+		{"/work", "./a/../b", "/work/b"},
+		{"/work", "/abs/path", "/abs/path"},
+		{"", "build", filepath.Join(cwd, "build")},
+	}
+	for _, tt := range tests {
+		if got := cleanPathIn(tt.base, tt.path); got != tt.want {
+			t.Errorf("cleanPathIn(%q, %q) = %q, want %q", tt.base, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIsGlobPattern(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/work/*.log", true},
+		{"/dev/tty?", true},
+		{"/data/[a-z]", true},
+		{"/data/[!.]cache", true},
+		{"/work/project", false},
+		{"/work/[draft", false},
+		{"/work/[]", false},
+		{"/work/[a/b]", false},
+		{"/work/a]b", false},
+	}
+	for _, tt := range tests {
+		if got := isGlobPattern(tt.path); got != tt.want {
+			t.Errorf("isGlobPattern(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRuleResolver_GlobWithoutStar(t *testing.T) {
+	resolver := NewRuleResolver()
+	source := RuleSource{Origin: OriginCLI}
+	resolver.AddAllowRule("/data/[a-z]", source)
+	resolver.AddReadRule("/dev/tty?", source)
+	resolver.AddDenyRule("/data/[!.]cache", nil, source)
+	resolver.AddAllowRule("/work/[draft", source)
+
+	writeRules, readRules, _ := resolver.Resolve()
+	for _, rule := range append(writeRules, readRules...) {
+		if want := rule.Path != "/work/[draft"; rule.IsGlob != want {
+			t.Errorf("rule %s: IsGlob = %v, want %v", rule.Path, rule.IsGlob, want)
+		}
+	}
+}
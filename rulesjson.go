@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// writeRulesJSON writes the resolved write and read rules as one JSON array,
+// the format --rules-from-json reads
+func writeRulesJSON(w io.Writer, writeRules, readRules []ResolvedRule) error {
+	rules := append(append([]ResolvedRule{}, writeRules...), readRules...)
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// parseRulesJSON reads a rule array written by --dump-rules and splits it like
+// Resolve: rules with write access are write rules, read-only rules read rules.
+// Every rule needs an absolute path, a mode and an action; unknown fields are
+// rejected.
+func parseRulesJSON(data []byte) ([]ResolvedRule, []ResolvedRule, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, nil, fmt.Errorf("parse rules: %w", err)
+	}
+
+	var writeRules, readRules []ResolvedRule
+	for i, entry := range raw {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(entry, &fields); err != nil {
+			return nil, nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		for _, required := range []string{"path", "mode", "action"} {
+			if _, ok := fields[required]; !ok {
+				return nil, nil, fmt.Errorf("rule %d: missing %q", i+1, required)
+			}
+		}
+
+		var rule ResolvedRule
+		decoder := json.NewDecoder(bytes.NewReader(entry))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&rule); err != nil {
+			return nil, nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if !filepath.IsAbs(rule.Path) {
+			return nil, nil, fmt.Errorf("rule %d: path %q is not absolute", i+1, rule.Path)
+		}
+
+		if rule.Mode&AccessWrite != 0 {
+			writeRules = append(writeRules, rule)
+		} else {
+			readRules = append(readRules, rule)
+		}
+	}
+
+	sortRulesBySpecificity(writeRules)
+	sortRulesBySpecificity(readRules)
+	return writeRules, readRules, nil
+}
+
+// loadRulesJSON reads the rule file given with --rules-from-json
+func loadRulesJSON(path string) ([]ResolvedRule, []ResolvedRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read rules: %w", err)
+	}
+	writeRules, readRules, err := parseRulesJSON(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return writeRules, readRules, nil
+}
+
+// printRulesAndExit implements --dump-rules
+func printRulesAndExit(writeRules, readRules []ResolvedRule) {
+	if err := writeRulesJSON(os.Stdout, writeRules, readRules); err != nil {
+		logger.Errorf("error dumping rules: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRulesJSONRoundTrip(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule("/work", RuleSource{Origin: OriginCLI, Reason: "build tree"})
+	resolver.AddAllowRuleNoRefer("/work/cache", RuleSource{PresetName: "dev", Priority: 5})
+	resolver.AddOutputRule("/tmp/out.log", RuleSource{PresetName: "dev", Origin: OriginAutoPreset})
+	resolver.AddDenyRule("/home/me/.ssh", []string{"/home/me/.ssh/config"}, RuleSource{PresetName: "no-exfil", Origin: OriginDefaultPreset})
+	resolver.AddWriteDenyRule("/work/*.lock", RuleSource{PresetName: "dev"})
+	resolver.AddReadRule("/etc", RuleSource{PresetName: "dev"})
+	writeRules, readRules, _ := resolver.Resolve()
+
+	var dump bytes.Buffer
+	if err := writeRulesJSON(&dump, writeRules, readRules); err != nil {
+		t.Fatalf("writeRulesJSON() error = %v", err)
+	}
+	gotWrite, gotRead, err := parseRulesJSON(dump.Bytes())
+	if err != nil {
+		t.Fatalf("parseRulesJSON() error = %v", err)
+	}
+	if !reflect.DeepEqual(gotWrite, writeRules) {
+		t.Errorf("write rules = %+v, want %+v", gotWrite, writeRules)
+	}
+	if !reflect.DeepEqual(gotRead, readRules) {
+		t.Errorf("read rules = %+v, want %+v", gotRead, readRules)
+	}
+
+	// Identical rules give an identical profile; dumping them again changes nothing
+	var again bytes.Buffer
+	if err := writeRulesJSON(&again, gotWrite, gotRead); err != nil {
+		t.Fatalf("writeRulesJSON() error = %v", err)
+	}
+	if again.String() != dump.String() {
+		t.Errorf("dumping loaded rules changed them:\n%s\nwant:\n%s", again.String(), dump.String())
+	}
+}
+
+func TestParseRulesJSONRejectsInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		want string
+	}{
+		{"not an array", `{"path": "/work"}`, "parse rules"},
+		{"unknown mode", `[{"path": "/work", "mode": "execute", "action": "allow"}]`, `invalid mode "execute"`},
+		{"unknown action", `[{"path": "/work", "mode": "write", "action": "permit"}]`, `invalid action "permit"`},
+		{"unknown origin", `[{"path": "/work", "mode": "write", "action": "allow", "source": {"origin": "env"}}]`, `invalid origin "env"`},
+		{"unknown field", `[{"path": "/work", "mode": "write", "action": "allow", "recursive": true}]`, `unknown field "recursive"`},
+		{"missing action", `[{"path": "/work", "mode": "write"}]`, `rule 1: missing "action"`},
+		{"relative path", `[{"path": "work", "mode": "write", "action": "allow"}]`, "not absolute"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := parseRulesJSON([]byte(tt.json))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseRulesJSON() error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// sensitiveWritePaths are system directories that a write allow should never cover;
+// granting write to one of them, or to a parent such as /, defeats the sandbox
+var sensitiveWritePaths = map[string][]string{
+	"darwin": {
+		"/",
+		"/bin",
+		"/sbin",
+		"/usr",
+		"/etc",
+		"/private/etc",
+		"/System",
+		"/Library",
+		"/Applications",
+	},
+	"linux": {
+		"/",
+		"/bin",
+		"/sbin",
+		"/usr",
+		"/lib",
+		"/lib64",
+		"/etc",
+		"/boot",
+	},
+}
+
+// SensitiveWrite is a write allow that covers a sensitive system path
+type SensitiveWrite struct {
+	Rule      ResolvedRule
+	Sensitive string // the system path the rule covers
+}
+
+// sensitiveWrites returns the write allows that target a sensitive system path on goos
+// or one of its parents; allows below a system path (e.g. /usr/local) are not reported
+func sensitiveWrites(writeRules []ResolvedRule, goos string) []SensitiveWrite {
+	var result []SensitiveWrite
+	for _, rule := range writeRules {
+		if rule.Action != ActionAllow || rule.IsGlob {
+			continue
+		}
+		path := filepath.Clean(rule.Path)
+		for _, sensitive := range sensitiveWritePaths[goos] {
+			if path == sensitive || strings.HasPrefix(sensitive, path+"/") {
+				result = append(result, SensitiveWrite{Rule: rule, Sensitive: sensitive})
+				break
+			}
+		}
+	}
+	return result
+}
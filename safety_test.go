@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestSensitiveWrites(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		goos   string
+		action RuleAction
+		want   string // sensitive path reported, or "" for none
+	}{
+		{"root", "/", "linux", ActionAllow, "/"},
+		{"root on darwin", "/", "darwin", ActionAllow, "/"},
+		{"usr", "/usr", "linux", ActionAllow, "/usr"},
+		{"usr with trailing slash", "/usr/", "darwin", ActionAllow, "/usr"},
+		{"parent of a system path", "/private", "darwin", ActionAllow, "/private/etc"},
+		{"below a system path", "/usr/local", "linux", ActionAllow, ""},
+		{"benign path", "/home/user/project", "linux", ActionAllow, ""},
+		{"platform specific", "/System", "linux", ActionAllow, ""},
+		{"deny rules are ignored", "/usr", "linux", ActionDeny, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := []ResolvedRule{{Path: tt.path, Mode: AccessWrite, Action: tt.action}}
+			got := sensitiveWrites(rules, tt.goos)
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Errorf("sensitiveWrites(%q) = %+v, want none", tt.path, got)
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Sensitive != tt.want {
+				t.Errorf("sensitiveWrites(%q) = %+v, want %s", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,5 +1,15 @@
 package main
 
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
 // AccessMode represents the type of file access
 type AccessMode uint8
 
@@ -9,6 +19,40 @@ const (
 	AccessReadWrite = AccessRead | AccessWrite
 )
 
+// String returns "read", "write" or "read+write"
+// Values outside the defined bits are rendered as AccessMode(n)
+func (m AccessMode) String() string {
+	switch m {
+	case AccessRead:
+		return "read"
+	case AccessWrite:
+		return "write"
+	case AccessReadWrite:
+		return "read+write"
+	default:
+		return fmt.Sprintf("AccessMode(%d)", uint8(m))
+	}
+}
+
+// MarshalText writes the mode as "read", "write" or "read+write"
+func (m AccessMode) MarshalText() ([]byte, error) {
+	if m != AccessRead && m != AccessWrite && m != AccessReadWrite {
+		return nil, fmt.Errorf("invalid access mode %d", uint8(m))
+	}
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText accepts the names written by MarshalText
+func (m *AccessMode) UnmarshalText(text []byte) error {
+	for _, mode := range []AccessMode{AccessRead, AccessWrite, AccessReadWrite} {
+		if string(text) == mode.String() {
+			*m = mode
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid mode %q (must be read, write or read+write)", text)
+}
+
 // SandboxConfig contains the configuration for running a command in a sandbox
 type SandboxConfig struct {
 	// AllowAll disables all restrictions (for testing/debugging)
@@ -17,6 +61,29 @@ type SandboxConfig struct {
 	// AllowKeychain allows access to the keychain (macOS only)
 	AllowKeychain bool
 
+	// KeychainFiles allows access to single keychain files in ~/Library/Keychains,
+	// e.g. login.keychain-db; AllowKeychain covers them all (macOS only)
+	KeychainFiles []string
+
+	// NoDefaultTmp removes the implicit write access to the per-user temporary
+	// directories (macOS only); many tools fail without a writable temp directory
+	NoDefaultTmp bool
+
+	// AllowPTY allows access to pseudo-terminal devices for interactive tools
+	AllowPTY bool
+
+	// TTYDevices are the controlling terminal's devices (/dev/tty and the resolved
+	// device), kept readable and writable whatever the deny rules cover
+	TTYDevices []string
+
+	// AllowDevices are device node paths or globs that also get ioctl access on
+	// macOS; on Linux, write-allowed /dev paths already do
+	AllowDevices []string
+
+	// ConnectSockets are Unix socket paths the command may connect to
+	// (--allow-connect); they are not made writable
+	ConnectSockets []string
+
 	// Strict enables strict mode where "/" is NOT added to read allowlist
 	// When true, only explicit read rules are readable
 	Strict bool
@@ -30,11 +97,151 @@ type SandboxConfig struct {
 	// Conflicts detected during rule resolution (for dry-run display)
 	Conflicts []RuleConflict
 
+	// SummaryOnly makes dry-run print the rule summary without the raw profile
+	// (on Linux, without the Landlock details)
+	SummaryOnly bool
+
+	// Collapse makes dry-run list sibling allow paths with the same source as one
+	// brace pattern, e.g. /work/{a,b,c}
+	Collapse bool
+
+	// ProfileLint makes dry-run check the generated profile for likely mistakes
+	// (macOS only)
+	ProfileLint bool
+
+	// PrintEnv makes dry-run list the complete environment the command receives;
+	// MaskEnv hides the values of variables that look like secrets
+	PrintEnv bool
+	MaskEnv  bool
+
+	// AnnotateProfile precedes each group of SBPL rules with a comment naming
+	// its source (macOS only)
+	AnnotateProfile bool
+
+	// CaseInsensitive also matches deny rules against case variants of their
+	// paths; denies on a case-insensitive volume get this without it (macOS only)
+	CaseInsensitive bool
+
+	// CompatFileRead denies file-read* instead of file-read-data for read denies,
+	// so denied paths cannot be stat'ed either (macOS only)
+	CompatFileRead bool
+
+	// MaxConflicts limits how many conflicts dry-run lists in detail (0 lists all)
+	MaxConflicts int
+
 	// Command is the command to execute
 	Command string
 
 	// Args are the arguments to pass to the command
 	Args []string
+
+	// WorkingDir is the directory the command runs in (empty keeps cage's)
+	WorkingDir string
+
+	// Supervise runs the command as a child that cage waits for, forwarding
+	// SIGINT, SIGTERM and SIGHUP and exiting with its status (cage exec-sync)
+	Supervise bool
+
+	// Timeout kills the command after this duration (0 disables it)
+	// With a timeout the command runs as a supervised child instead of replacing cage
+	Timeout time.Duration
+
+	// KillSignal is sent to the command's process group when the timeout expires
+	KillSignal syscall.Signal
+
+	// KillGrace is how long to wait after KillSignal before sending SIGKILL
+	KillGrace time.Duration
+
+	// NoRefer drops the Landlock refer right from all allowed directories so files
+	// cannot be renamed or linked across their boundary (Linux only)
+	NoRefer bool
+
+	// AllowNewPrivs lets the command gain privileges through setuid/setgid binaries
+	// and file capabilities; by default no_new_privs is set before exec (Linux only)
+	AllowNewPrivs bool
+
+	// RunAs runs the command as a different (less privileged) user and group
+	// nil keeps cage's own credentials
+	RunAs *Credentials
+
+	// KeepFDs passes file descriptors above stderr through to the command, also
+	// one started as a child process (Timeout, Supervise, StartInSandbox), under
+	// the same numbers. By default they are closed on exec so they do not leak
+	// into the sandbox
+	KeepFDs bool
+
+	// Limits are the resource limits of the command. When cage execs it in place
+	// they are set right before; a command that is started gets them on its own
+	// process, so the caller's limits are left alone (Linux only: on macOS a
+	// started command with limits is refused)
+	Limits ResourceLimits
+
+	// PreExec, for programs that embed cage, runs in the calling process right
+	// before the command is executed or started, after the working directory is
+	// changed (and Limits are set, when the command is executed in place), and
+	// before RunAs drops privileges; an error
+	// aborts the run. On Linux it runs under the Landlock restrictions; on macOS
+	// sandbox-exec only applies them afterwards, so it runs unrestricted there.
+	PreExec func() error
+
+	// RequireLandlockABI refuses to run unless the kernel enforces at least this
+	// Landlock ABI version (Linux only, 0 disables the check)
+	RequireLandlockABI int
+
+	// ProfileFile is a prebuilt sandbox-exec profile used instead of the generated
+	// one; the rule fields are empty when it is set (macOS only)
+	ProfileFile string
+
+	// SeatbeltParams are "key=value" parameters passed to sandbox-exec with -D,
+	// for profiles that read them with (param "key") (macOS only)
+	SeatbeltParams []string
+
+	// Env sets or overrides variables in the command's environment
+	Env map[string]string
+
+	// Verbose prints additional information about the applied sandbox to stderr
+	Verbose bool
+
+	// ProfileTiming prints the time spent generating the sandbox profile to stderr
+	ProfileTiming bool
+}
+
+// symlinkTarget returns the fully resolved target of a path that involves a symlink
+// It reports false when the path does not exist, already is its own target, or
+// resolves to a path with a control character (see checkPathChars)
+func symlinkTarget(path string) (string, bool) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil || resolved == path || checkPathChars(resolved) != nil {
+		return "", false
+	}
+	return resolved, true
+}
+
+// commandEnv returns base with the variables in overrides set, replacing existing values
+// New variables are appended in sorted order so the result is deterministic
+func commandEnv(base []string, overrides map[string]string) []string {
+	if len(overrides) == 0 {
+		return base
+	}
+
+	env := make([]string, 0, len(base)+len(overrides))
+	for _, entry := range base {
+		name, _, _ := strings.Cut(entry, "=")
+		if _, ok := overrides[name]; ok {
+			continue
+		}
+		env = append(env, entry)
+	}
+
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, name+"="+overrides[name])
+	}
+	return env
 }
 
 // RunInSandbox executes the given command with sandbox restrictions
@@ -42,3 +249,31 @@ type SandboxConfig struct {
 func RunInSandbox(config *SandboxConfig) error {
 	return runInSandbox(config)
 }
+
+// StartInSandbox starts the command as a sandboxed child process instead of
+// replacing the current process, for programs that embed cage and manage the
+// command themselves; the caller must Wait for the returned command
+// The child uses the process's stdio, Env and RunAs, runs in its own process
+// group, which is left in the background of a terminal, and ignores Timeout. On Linux the Landlock restrictions also apply to the
+// calling process, as children inherit them from it; on macOS only the child
+// runs under sandbox-exec.
+func StartInSandbox(config *SandboxConfig) (*exec.Cmd, error) {
+	return startInSandbox(config)
+}
+
+// parseSeatbeltParams validates --seatbelt-param values: each must be key=value
+// with a non-empty key, and no key may be given twice
+func parseSeatbeltParams(values []string) ([]string, error) {
+	seen := make(map[string]bool)
+	for _, value := range values {
+		key, _, ok := strings.Cut(value, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid parameter %q (use key=value)", value)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("parameter %q given more than once", key)
+		}
+		seen[key] = true
+	}
+	return values, nil
+}
@@ -4,30 +4,90 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
-	"syscall"
+	"time"
+	"unicode"
+
+	"golang.org/x/sys/unix"
 )
 
 func runInSandbox(config *SandboxConfig) error {
-	profile, err := generateSandboxProfile(config)
+	keep, err := keptFDs(config, supervised(config))
+	if err != nil {
+		return err
+	}
+	path, argv, err := sandboxCommand(config)
 	if err != nil {
-		return fmt.Errorf("generate sandbox profile: %w", err)
+		return err
 	}
+	return execCommand(path, argv, config, keep)
+}
 
+func startInSandbox(config *SandboxConfig) (*exec.Cmd, error) {
+	keep, err := keptFDs(config, true)
+	if err != nil {
+		return nil, err
+	}
+	path, argv, err := sandboxCommand(config)
+	if err != nil {
+		return nil, err
+	}
+	return startSandboxed(path, argv, config, false, keep)
+}
+
+// sandboxCommand returns the sandbox-exec invocation that runs the command under
+// the generated (or prebuilt) profile; cage itself stays unrestricted
+func sandboxCommand(config *SandboxConfig) (string, []string, error) {
 	sandboxPath, err := exec.LookPath("sandbox-exec")
 	if err != nil {
-		return fmt.Errorf("sandbox-exec not found: %w", err)
+		return "", nil, fmt.Errorf("sandbox-exec not found: %w", err)
+	}
+
+	profile := ""
+	if config.ProfileFile == "" {
+		start := time.Now()
+		profile, err = generateSandboxProfile(config)
+		if err != nil {
+			return "", nil, fmt.Errorf("generate sandbox profile: %w", err)
+		}
+		reportTiming(config.ProfileTiming, "profile generation", start)
 	}
+	args := sandboxExecArgs(config, profile)
 
-	args := []string{"sandbox-exec", "-p", profile, config.Command}
-	args = append(args, config.Args...)
+	if !config.KeepFDs {
+		if err := closeInheritedFDs(); err != nil {
+			return "", nil, fmt.Errorf("close inherited file descriptors: %w", err)
+		}
+	}
 
-	return syscall.Exec(sandboxPath, args, os.Environ())
+	return sandboxPath, args, nil
 }
 
+// sandboxExecArgs returns sandbox-exec's argv: the --seatbelt-param values as
+// -D parameters, then the profile file or the generated profile, then the command
+func sandboxExecArgs(config *SandboxConfig, profile string) []string {
+	args := []string{"sandbox-exec"}
+	for _, param := range config.SeatbeltParams {
+		args = append(args, "-D", param)
+	}
+	if config.ProfileFile != "" {
+		args = append(args, "-f", config.ProfileFile)
+	} else {
+		args = append(args, "-p", profile)
+	}
+	args = append(args, config.Command)
+	return append(args, config.Args...)
+}
+
+// defaultTmpRegex matches the per-user temporary and cache directories below
+// /private/var/folders ($TMPDIR is the T one), writable unless NoDefaultTmp is set
+const defaultTmpRegex = `^/private/var/folders/[^/]+/[^/]+/(C|T|0)($|/)`
+
 func generateSandboxProfile(config *SandboxConfig) (string, error) {
 	var profile bytes.Buffer
 
@@ -39,54 +99,207 @@ func generateSandboxProfile(config *SandboxConfig) (string, error) {
 		return profile.String(), nil
 	}
 
+	// escapePathForSandbox cannot make a control character safe, so a path
+	// with one is refused rather than emitted
+	if err := checkRulePaths(config.WriteRules, config.ReadRules); err != nil {
+		return "", err
+	}
+	for _, paths := range [][]string{config.AllowDevices, config.ConnectSockets, config.TTYDevices, config.KeychainFiles} {
+		for _, path := range paths {
+			if err := checkPathChars(path); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	// With AnnotateProfile, each group of rules is preceded by a comment naming
+	// where it comes from; consecutive rules from the same source share one
+	lastComment := ""
+	annotate := func(comment string) {
+		if config.AnnotateProfile && comment != lastComment {
+			// Preset names and rule reasons must not end the comment line
+			fmt.Fprintf(&profile, "; %s\n", strings.Map(func(c rune) rune {
+				if unicode.IsControl(c) {
+					return '?'
+				}
+				return c
+			}, comment))
+			lastComment = comment
+		}
+	}
+	annotateRule := func(rule ResolvedRule) {
+		if rule.Source.IsCLI() {
+			annotate("from CLI flag")
+			return
+		}
+		annotate("from preset: " + formatRuleSource(rule))
+	}
+
 	// Deny all file writes by default
+	annotate("cage defaults")
 	profile.WriteString("(deny file-write*)\n")
 
 	// Allow system temporary directories
-	profile.WriteString(
-		`(allow file-write* (regex #"^/private/var/folders/[^/]+/[^/]+/(C|T|0)($|/)"))` + "\n",
-	)
+	if !config.NoDefaultTmp {
+		fmt.Fprintf(&profile, "(allow file-write* (regex #\"%s\"))\n", defaultTmpRegex)
+	}
 
-	// Allow keychain access if requested
-	if config.AllowKeychain {
+	// Allow keychain access if requested: the whole directory, or single
+	// keychain files with the temporary files they are saved through
+	keychainFilter := ""
+	if config.AllowKeychain || len(config.KeychainFiles) > 0 {
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
 			return "", fmt.Errorf("get home directory: %w", err)
 		}
-		fmt.Fprintf(&profile, `(allow file-write* (subpath "%s/Library/Keychains"))`+"\n", homeDir)
+		keychainDir := filepath.Join(homeDir, "Library", "Keychains")
+		if config.AllowKeychain {
+			keychainFilter = fmt.Sprintf(`(subpath "%s")`, escapePathForSandbox(keychainDir))
+		} else {
+			keychainFilter = keychainFileFilter(keychainDir, config.KeychainFiles)
+		}
+		annotate(keychainComment(config))
+		fmt.Fprintf(&profile, "(allow file-write* %s)\n", keychainFilter)
+		// Keychain operations go through securityd
+		profile.WriteString(`(allow mach-lookup (global-name "com.apple.SecurityServer"))` + "\n")
+	}
+
+	// Allow pseudo-terminal devices for interactive tools
+	if config.AllowPTY {
+		annotate("from --allow-pty")
+		profile.WriteString(`(allow file-write* (literal "/dev/ptmx") (literal "/dev/tty") (regex #"^/dev/ttys[0-9]+$"))` + "\n")
+	}
+
+	// On a case-insensitive volume "/Users/me/Secrets" is also reachable as
+	// "/users/me/secrets", which a subpath filter does not match
+	foldCase := func(rule ResolvedRule) bool {
+		return config.CaseInsensitive || caseInsensitiveFS(rule.Path)
+	}
+
+	// A write deny nested inside a write allow is emitted after the allows
+	// instead, so that every deny is emitted exactly once
+	nestedDeny := func(rule ResolvedRule) bool {
+		if rule.Action != ActionDeny || rule.IsGlob {
+			return false
+		}
+		// A file-level deny covers the entries of its directory, so an allow
+		// of the directory itself encloses it too
+		return insideWriteAllow(rule.Path, config.WriteRules) ||
+			rule.FileLevel && hasWriteAllow(rule.Path, config.WriteRules)
+	}
+
+	// In strict mode reads are granted after the read denies, so a read deny
+	// nested inside a read-allowed directory is held back until after the
+	// read allows instead
+	nestedReadDeny := func(rule ResolvedRule) bool {
+		if !config.Strict || rule.Action != ActionDeny || rule.Mode&AccessRead == 0 || rule.IsGlob {
+			return false
+		}
+		return insideReadAllow(rule.Path, rule.FileLevel, config.ReadRules, config.WriteRules)
+	}
+
+	// Reads restored inside a read deny must cover what the deny takes away
+	readOp := readDenyOperation(config.CompatFileRead)
+
+	emitReadCarveOut := func(rule ResolvedRule, exc string) {
+		annotateRule(rule)
+		escapedExc := escapePathForSandbox(exc)
+		fmt.Fprintf(&profile, "(allow %s (subpath \"%s\"))\n", readOp, escapedExc)
+		fmt.Fprintf(&profile, "(allow %s (literal \"%s\"))\n", readOp, escapedExc)
 	}
 
 	// Emit write deny rules first (sorted alphabetically, grouped by directory)
 	for _, rule := range config.WriteRules {
-		if rule.Action == ActionDeny {
-			emitDenyRule(&profile, rule, AccessWrite)
+		if rule.Action == ActionDeny && !nestedDeny(rule) {
+			annotateRule(rule)
+			emitDenyRule(&profile, rule, AccessWrite, foldCase(rule), config.CompatFileRead)
 		}
 	}
 
 	// Emit read denies for AccessReadWrite rules (applies in all modes)
 	for _, rule := range config.WriteRules {
-		if rule.Action == ActionDeny && rule.Mode&AccessRead != 0 {
-			emitDenyRule(&profile, rule, AccessRead)
+		if rule.Action == ActionDeny && rule.Mode&AccessRead != 0 && !nestedReadDeny(rule) {
+			annotateRule(rule)
+			emitDenyRule(&profile, rule, AccessRead, foldCase(rule), config.CompatFileRead)
 		}
 	}
 
+	emitWriteAllow := func(rule ResolvedRule) {
+		annotateRule(rule)
+		escapedPath := escapePathForSandbox(rule.Path)
+		if rule.Append {
+			// Creating and writing files, but not unlinking (which also covers
+			// renaming them away); truncation is part of file-write-data and
+			// cannot be denied separately
+			fmt.Fprintf(&profile, "(allow file-write-create (subpath \"%s\"))\n", escapedPath)
+			fmt.Fprintf(&profile, "(allow file-write-data (subpath \"%s\"))\n", escapedPath)
+			fmt.Fprintf(&profile, "(deny file-write-unlink (subpath \"%s\"))\n", escapedPath)
+			return
+		}
+		if rule.IsFile {
+			// Output files only get the literal: creating the file is checked
+			// against its own path, so the parent directory stays write-denied
+			fmt.Fprintf(&profile, "(allow file-write-create (literal \"%s\"))\n", escapedPath)
+			fmt.Fprintf(&profile, "(allow file-write* (literal \"%s\"))\n", escapedPath)
+			return
+		}
+		fmt.Fprintf(&profile, "(allow file-write* (subpath \"%s\"))\n", escapedPath)
+		fmt.Fprintf(&profile, "(allow file-write* (literal \"%s\"))\n", escapedPath)
+	}
+
 	// Emit write allow rules (more specific, so they come after denies)
 	for _, rule := range config.WriteRules {
 		if rule.Action == ActionAllow {
-			escapedPath := escapePathForSandbox(rule.Path)
-			fmt.Fprintf(&profile, "(allow file-write* (subpath \"%s\"))\n", escapedPath)
-			fmt.Fprintf(&profile, "(allow file-write* (literal \"%s\"))\n", escapedPath)
+			emitWriteAllow(rule)
+		}
+	}
+
+	// Device nodes need ioctl as well as read and write access
+	for _, device := range config.AllowDevices {
+		annotate("from --allow-dev")
+		filter := deviceFilter(device)
+		fmt.Fprintf(&profile, "(allow file-ioctl %s)\n", filter)
+		fmt.Fprintf(&profile, "(allow file-write* %s)\n", filter)
+	}
+
+	// A write deny nested inside a write allow (e.g. --protect-git in an allowed
+	// project) must follow that allow, as the last matching rule wins; allows
+	// nested inside the deny follow again to stay carve-outs
+	for _, rule := range config.WriteRules {
+		if !nestedDeny(rule) {
+			continue
+		}
+		annotateRule(rule)
+		emitDenyRule(&profile, rule, AccessWrite, foldCase(rule), config.CompatFileRead)
+		for _, allow := range config.WriteRules {
+			if allow.Action == ActionAllow && pathContains(rule.Path, allow.Path) {
+				emitWriteAllow(allow)
+			}
 		}
 	}
 
 	// Emit read carve-outs from deny rules (exceptions restore read access)
 	for _, rule := range config.WriteRules {
-		if rule.Action == ActionDeny {
+		if rule.Action == ActionDeny && !nestedReadDeny(rule) {
 			for _, exc := range rule.Except {
-				escapedExc := escapePathForSandbox(exc)
-				fmt.Fprintf(&profile, "(allow file-read-data (subpath \"%s\"))\n", escapedExc)
-				fmt.Fprintf(&profile, "(allow file-read-data (literal \"%s\"))\n", escapedExc)
+				emitReadCarveOut(rule, exc)
+			}
+		}
+	}
+
+	// Write carve-outs: an allow inside a read-denied directory must be readable too
+	// (strict mode restores reads for every write allow below)
+	if !config.Strict {
+		for _, rule := range config.WriteRules {
+			if rule.Action != ActionAllow || !insideReadDeny(rule.Path, config.WriteRules) {
+				continue
+			}
+			annotateRule(rule)
+			escapedPath := escapePathForSandbox(rule.Path)
+			if !rule.IsFile {
+				fmt.Fprintf(&profile, "(allow %s (subpath \"%s\"))\n", readOp, escapedPath)
 			}
+			fmt.Fprintf(&profile, "(allow %s (literal \"%s\"))\n", readOp, escapedPath)
 		}
 	}
 
@@ -95,51 +308,199 @@ func generateSandboxProfile(config *SandboxConfig) (string, error) {
 		// Use file-read-data instead of file-read* to allow stat/lstat (metadata)
 		// while blocking actual file content reads. This enables path resolution
 		// for tools like Node.js/npm that need to call lstat() on parent directories.
+		annotate("strict mode")
 		profile.WriteString("(deny file-read-data)\n")
 
 		// Allow reading root directory - required for process startup and path resolution
 		profile.WriteString("(allow file-read-data (literal \"/\"))\n")
 
+		// The system temporary directories are readable like they are writable,
+		// so a tool can read back what it wrote there
+		if !config.NoDefaultTmp {
+			fmt.Fprintf(&profile, "(allow file-read-data (regex #\"%s\"))\n", defaultTmpRegex)
+		}
+
+		// Keychain files must stay readable for keychain lookups
+		if keychainFilter != "" {
+			annotate(keychainComment(config))
+			fmt.Fprintf(&profile, "(allow file-read-data %s)\n", keychainFilter)
+		}
+
+		// Pseudo-terminal devices stay readable in strict mode
+		if config.AllowPTY {
+			annotate("from --allow-pty")
+			profile.WriteString(`(allow file-read-data (literal "/dev/ptmx") (literal "/dev/tty") (regex #"^/dev/ttys[0-9]+$"))` + "\n")
+		}
+
+		// Allowed device nodes stay readable in strict mode
+		for _, device := range config.AllowDevices {
+			annotate("from --allow-dev")
+			fmt.Fprintf(&profile, "(allow file-read-data %s)\n", deviceFilter(device))
+		}
+
 		// Emit read deny rules from ReadRules (for pure read denies in strict mode)
 		for _, rule := range config.ReadRules {
-			if rule.Action == ActionDeny {
-				emitDenyRule(&profile, rule, AccessRead)
+			if rule.Action == ActionDeny && !nestedReadDeny(rule) {
+				annotateRule(rule)
+				emitDenyRule(&profile, rule, AccessRead, foldCase(rule), config.CompatFileRead)
+			}
+		}
+
+		// The sandbox matches resolved paths, so a symlinked allow path also
+		// needs its target readable for the link to be followed
+		emitReadAllow := func(rule ResolvedRule) {
+			annotateRule(rule)
+			paths := []string{rule.Path}
+			if target, ok := symlinkTarget(rule.Path); ok {
+				paths = append(paths, target)
+			}
+			for _, path := range paths {
+				escapedPath := escapePathForSandbox(path)
+				if !rule.IsFile {
+					fmt.Fprintf(&profile, "(allow %s (subpath \"%s\"))\n", readOp, escapedPath)
+				}
+				fmt.Fprintf(&profile, "(allow %s (literal \"%s\"))\n", readOp, escapedPath)
 			}
 		}
 
 		// Emit read allow rules
 		for _, rule := range config.ReadRules {
 			if rule.Action == ActionAllow {
-				escapedPath := escapePathForSandbox(rule.Path)
-				fmt.Fprintf(&profile, "(allow file-read-data (subpath \"%s\"))\n", escapedPath)
-				fmt.Fprintf(&profile, "(allow file-read-data (literal \"%s\"))\n", escapedPath)
+				emitReadAllow(rule)
 			}
 		}
 
 		// Write-allowed paths also need read access
 		for _, rule := range config.WriteRules {
 			if rule.Action == ActionAllow {
-				escapedPath := escapePathForSandbox(rule.Path)
-				fmt.Fprintf(&profile, "(allow file-read-data (subpath \"%s\"))\n", escapedPath)
-				fmt.Fprintf(&profile, "(allow file-read-data (literal \"%s\"))\n", escapedPath)
+				emitReadAllow(rule)
 			}
 		}
 
 		// Emit read carve-outs from read deny rules
 		for _, rule := range config.ReadRules {
-			if rule.Action == ActionDeny {
+			if rule.Action == ActionDeny && !nestedReadDeny(rule) {
 				for _, exc := range rule.Except {
-					escapedExc := escapePathForSandbox(exc)
-					fmt.Fprintf(&profile, "(allow file-read-data (subpath \"%s\"))\n", escapedExc)
-					fmt.Fprintf(&profile, "(allow file-read-data (literal \"%s\"))\n", escapedExc)
+					emitReadCarveOut(rule, exc)
 				}
 			}
 		}
+
+		// A read deny nested inside a read-allowed directory (e.g. --deny of a
+		// secret in an allowed project) must follow that allow, as the last
+		// matching rule wins; allows and exceptions nested inside the deny
+		// follow again to stay carve-outs
+		for _, ruleSet := range [][]ResolvedRule{config.WriteRules, config.ReadRules} {
+			for _, rule := range ruleSet {
+				if !nestedReadDeny(rule) {
+					continue
+				}
+				annotateRule(rule)
+				emitDenyRule(&profile, rule, AccessRead, foldCase(rule), config.CompatFileRead)
+				for _, allows := range [][]ResolvedRule{config.ReadRules, config.WriteRules} {
+					for _, allow := range allows {
+						if allow.Action == ActionAllow && pathContains(rule.Path, allow.Path) {
+							emitReadAllow(allow)
+						}
+					}
+				}
+				for _, exc := range rule.Except {
+					emitReadCarveOut(rule, exc)
+				}
+			}
+		}
+	}
+
+	// Sockets for --allow-connect follow the denies too. Connecting is a
+	// network-outbound operation; reading the socket's metadata lets clients
+	// find it in strict mode. No file-write access is granted.
+	if len(config.ConnectSockets) > 0 {
+		annotate("--allow-connect sockets")
+		var files, sockets []string
+		for _, socket := range config.ConnectSockets {
+			paths := []string{socket}
+			if target, ok := symlinkTarget(socket); ok {
+				paths = append(paths, target)
+			}
+			for _, path := range paths {
+				files = append(files, fmt.Sprintf(`(literal "%s")`, escapePathForSandbox(path)))
+				sockets = append(sockets, fmt.Sprintf(`(path-literal "%s")`, escapePathForSandbox(path)))
+			}
+		}
+		fmt.Fprintf(&profile, "(allow file-read-data file-read-metadata %s)\n", strings.Join(files, " "))
+		fmt.Fprintf(&profile, "(allow network-outbound (remote unix-socket %s))\n", strings.Join(sockets, " "))
+	}
+
+	// The controlling terminal comes last so no deny above can take it away
+	if len(config.TTYDevices) > 0 {
+		annotate("controlling terminal")
+		var filters []string
+		for _, tty := range config.TTYDevices {
+			filters = append(filters, fmt.Sprintf(`(literal "%s")`, escapePathForSandbox(tty)))
+		}
+		fmt.Fprintf(&profile, "(allow file-read-data %s)\n", strings.Join(filters, " "))
+		fmt.Fprintf(&profile, "(allow file-write* %s)\n", strings.Join(filters, " "))
 	}
 
 	return profile.String(), nil
 }
 
+// deviceFilter returns the SBPL filter matching an --allow-dev path: a regex for
+// globs such as /dev/bpf*, otherwise the path and anything below it
+func deviceFilter(path string) string {
+	if isGlobPattern(path) {
+		return fmt.Sprintf(`(regex #"%s")`, globToSBPLRegex(path))
+	}
+	return fmt.Sprintf(`(subpath "%s")`, escapePathForSandbox(path))
+}
+
+// insideReadDeny reports whether path lies within a non-glob read+write deny rule
+func insideReadDeny(path string, rules []ResolvedRule) bool {
+	for _, rule := range rules {
+		if rule.Action == ActionDeny && rule.Mode&AccessRead != 0 && !rule.IsGlob && pathContains(rule.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// insideReadAllow reports whether strict mode grants reads on a directory
+// enclosing path: a non-glob, non-file allow in any of ruleSets. With orSelf an
+// allow of path itself counts too, as for a file-level deny.
+func insideReadAllow(path string, orSelf bool, ruleSets ...[]ResolvedRule) bool {
+	for _, rules := range ruleSets {
+		for _, rule := range rules {
+			if rule.Action != ActionAllow || rule.IsGlob || rule.IsFile {
+				continue
+			}
+			if pathContains(rule.Path, path) || orSelf && rule.Path == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// insideWriteAllow reports whether path lies within a non-glob, non-file write allow
+func insideWriteAllow(path string, rules []ResolvedRule) bool {
+	for _, rule := range rules {
+		if rule.Action == ActionAllow && !rule.IsGlob && !rule.IsFile && pathContains(rule.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWriteAllow reports whether a directory write allow exists for exactly path
+func hasWriteAllow(path string, rules []ResolvedRule) bool {
+	for _, rule := range rules {
+		if rule.Action == ActionAllow && !rule.IsGlob && !rule.IsFile && rule.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
 // emitDenyRule emits a deny rule for the specified access mode.
 //
 // For read denies, we use file-read-data instead of file-read* to allow
@@ -151,12 +512,26 @@ func generateSandboxProfile(config *SandboxConfig) (string, error) {
 //   - stat/lstat (metadata): ALLOWED - needed for path resolution
 //   - readdir (ls): BLOCKED - can't enumerate directory contents
 //   - read (cat): BLOCKED - can't read file contents
-func emitDenyRule(profile *bytes.Buffer, rule ResolvedRule, mode AccessMode) {
+//
+// fullRead (--compat-file-read) denies file-read* instead, which blocks the
+// metadata too: existence is hidden, at the cost of breaking path resolution.
+//
+// With foldCase the deny is followed by a regex matching every case variant of
+// the path. Allows stay case-sensitive, so a case variant of a carve-out inside
+// the deny is denied rather than allowed.
+func emitDenyRule(profile *bytes.Buffer, rule ResolvedRule, mode AccessMode, foldCase, fullRead bool) {
 	modeStr := "file-write*"
 	if mode == AccessRead {
-		// Use file-read-data instead of file-read* to allow stat/lstat
-		// while still blocking actual file content reads
-		modeStr = "file-read-data"
+		modeStr = readDenyOperation(fullRead)
+	}
+
+	if rule.FileLevel {
+		regexPattern := fileLevelRegex(rule.Path, rule.IsGlob)
+		fmt.Fprintf(profile, "(deny %s (regex #\"%s\"))\n", modeStr, regexPattern)
+		if foldCase {
+			fmt.Fprintf(profile, "(deny %s (regex #\"%s\"))\n", modeStr, caseFoldRegex(regexPattern))
+		}
+		return
 	}
 
 	if rule.IsGlob {
@@ -166,14 +541,168 @@ func emitDenyRule(profile *bytes.Buffer, rule ResolvedRule, mode AccessMode) {
 		escapedPath := escapePathForSandbox(rule.Path)
 		fmt.Fprintf(profile, "(deny %s (subpath \"%s\"))\n", modeStr, escapedPath)
 	}
+
+	if foldCase {
+		regexPattern := literalToSBPLRegex(rule.Path)
+		if rule.IsGlob {
+			regexPattern = globToSBPLRegex(rule.Path)
+		}
+		fmt.Fprintf(profile, "(deny %s (regex #\"%s\"))\n", modeStr, caseFoldRegex(regexPattern))
+	}
+}
+
+// readDenyOperation returns the SBPL operation read denies block: file-read-data,
+// or file-read* with fullRead
+func readDenyOperation(fullRead bool) string {
+	if fullRead {
+		return "file-read*"
+	}
+	return "file-read-data"
+}
+
+// fileLevelRegex matches the direct entries of the directory (or directories,
+// for a glob) at path, such as "/work/notes.txt" but not "/work/src/main.go"
+func fileLevelRegex(path string, isGlob bool) string {
+	regex := literalToSBPLRegex(path)
+	if isGlob {
+		regex = globToSBPLRegex(path)
+	}
+	return strings.TrimSuffix(regex, "($|/)") + "/[^/]+$"
+}
+
+// caseFoldRegex makes every letter in an SBPL regex match either case, leaving
+// escaped characters and bracket expressions alone
+func caseFoldRegex(regex string) string {
+	var result strings.Builder
+	for i := 0; i < len(regex); i++ {
+		c := regex[i]
+		switch {
+		case c == '\\' && i+1 < len(regex):
+			result.WriteByte(c)
+			result.WriteByte(regex[i+1])
+			i++
+		case c == '[':
+			end := strings.IndexByte(regex[i:], ']')
+			if end < 0 {
+				result.WriteString(regex[i:])
+				return result.String()
+			}
+			result.WriteString(regex[i : i+end+1])
+			i += end
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			lower, upper := c|0x20, c&^0x20
+			fmt.Fprintf(&result, "[%c%c]", lower, upper)
+		default:
+			result.WriteByte(c)
+		}
+	}
+	return result.String()
+}
+
+// caseInsensitiveFS reports whether the volume holding path (or, for a path
+// that does not exist yet, its nearest existing ancestor) ignores case. It
+// looks the ancestor up again with the case of its name flipped.
+func caseInsensitiveFS(path string) bool {
+	if i := strings.IndexAny(path, "*?["); i >= 0 {
+		path = filepath.Dir(path[:i] + "x")
+	}
+	for p := filepath.Clean(path); p != "/" && p != "."; p = filepath.Dir(p) {
+		base := filepath.Base(p)
+		flipped := strings.Map(func(r rune) rune {
+			if unicode.IsUpper(r) {
+				return unicode.ToLower(r)
+			}
+			return unicode.ToUpper(r)
+		}, base)
+		if flipped == base {
+			continue
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			continue
+		}
+		other, err := os.Lstat(filepath.Join(filepath.Dir(p), flipped))
+		return err == nil && os.SameFile(info, other)
+	}
+	return false
+}
+
+// keychainFileFilter matches the named keychain files in keychainDir and the
+// temporary files next to them that the keychain is saved through
+// (e.g. login.keychain-db.sb-1a2b3c4d-XyZ)
+func keychainFileFilter(keychainDir string, names []string) string {
+	var filters []string
+	for _, name := range names {
+		path := filepath.Join(keychainDir, name)
+		filters = append(filters,
+			fmt.Sprintf(`(literal "%s")`, escapePathForSandbox(path)),
+			fmt.Sprintf(`(regex #"%s")`, globToSBPLRegex(path+".*")),
+		)
+	}
+	return strings.Join(filters, " ")
+}
+
+// keychainComment names the flag a keychain rule comes from
+func keychainComment(config *SandboxConfig) string {
+	if config.AllowKeychain {
+		return "from --allow-keychain"
+	}
+	return "from --allow-keychain-file"
+}
+
+// errProfileNotRun is returned by checkSandboxProfile for a profile that compiled
+// but under which /usr/bin/true could not run, such as a strict profile without /usr
+var errProfileNotRun = errors.New("profile compiled but /usr/bin/true could not run")
+
+// checkSandboxProfile asks sandbox-exec to compile the profile by running /usr/bin/true under it
+// SBPL syntax errors (bad escaping, invalid regexes) are returned with sandbox-exec's message
+func checkSandboxProfile(profile string) error {
+	sandboxPath, err := exec.LookPath("sandbox-exec")
+	if err != nil {
+		return fmt.Errorf("sandbox-exec not found: %w", err)
+	}
+
+	output, err := exec.Command(sandboxPath, "-p", profile, "/usr/bin/true").CombinedOutput()
+	if err != nil {
+		return sandboxExecError(string(output), err)
+	}
+	return nil
+}
+
+// sandboxExecError turns a failed sandbox-exec run of /usr/bin/true into an error
+// sandbox-exec reports a failed exec as "execvp() of ... failed"; anything else
+// means it could not compile or apply the profile
+func sandboxExecError(output string, err error) error {
+	msg := strings.TrimSpace(output)
+	if msg == "" {
+		msg = err.Error()
+	}
+	if strings.Contains(msg, "execvp()") {
+		return fmt.Errorf("%w: %s", errProfileNotRun, msg)
+	}
+	return fmt.Errorf("sandbox-exec rejected profile: %s", msg)
 }
 
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), unix.TIOCGETA)
+	return err == nil
+}
+
+// escapePathForSandbox escapes backslashes and quotes for an SBPL string; paths
+// with control characters must have been rejected with checkPathChars
 func escapePathForSandbox(path string) string {
 	path = strings.ReplaceAll(path, "\\", "\\\\")
 	path = strings.ReplaceAll(path, "\"", "\\\"")
 	return path
 }
 
+// globToSBPLRegex translates a glob to an SBPL regex: * matches within a path
+// element, ** across elements, ? one character other than / and [...] a
+// character class ([!...] negates it, never matching /). Other regex
+// metacharacters are escaped. The regex is anchored at the start and matches
+// the paths the glob matches and everything below them, like a subpath filter,
+// but never their parents.
 func globToSBPLRegex(pattern string) string {
 	var result strings.Builder
 	result.WriteString("^")
@@ -190,14 +719,70 @@ func globToSBPLRegex(pattern string) string {
 			}
 		case '?':
 			result.WriteString("[^/]")
-		case '.', '(', ')', '[', ']', '{', '}', '+', '^', '$', '|', '\\':
-			result.WriteByte('\\')
-			result.WriteByte(c)
+		case '[':
+			if class, length, ok := globClass(pattern[i:]); ok {
+				result.WriteString(class)
+				i += length - 1
+			} else {
+				result.WriteString(`\[`)
+			}
 		default:
-			result.WriteByte(c)
+			writeSBPLRegexChar(&result, c)
 		}
 	}
 
 	result.WriteString("($|/)")
 	return result.String()
 }
+
+// literalToSBPLRegex is globToSBPLRegex for a path that is not a glob, whose
+// *, ? and [ match themselves
+func literalToSBPLRegex(path string) string {
+	var result strings.Builder
+	result.WriteString("^")
+	for i := 0; i < len(path); i++ {
+		writeSBPLRegexChar(&result, path[i])
+	}
+	result.WriteString("($|/)")
+	return result.String()
+}
+
+// writeSBPLRegexChar writes c to an SBPL regex, escaping regex metacharacters
+// and the quote that would end the #"..." string
+func writeSBPLRegexChar(result *strings.Builder, c byte) {
+	if strings.IndexByte(`.()[]{}*?+^$|\"`, c) >= 0 {
+		result.WriteByte('\\')
+	}
+	result.WriteByte(c)
+}
+
+// globClass translates the bracket expression at the start of s, such as [a-z]
+// or [!0-9], to a regex class and returns its length in s. ok is false for an
+// unterminated or empty class, a reversed range, and members (], [, \, " or /)
+// the translation cannot carry over; the [ is then taken literally.
+func globClass(s string) (class string, length int, ok bool) {
+	body := s[1:]
+	negate := strings.HasPrefix(body, "!") || strings.HasPrefix(body, "^")
+	if negate {
+		body = body[1:]
+	}
+	end := strings.IndexByte(body, ']')
+	if end <= 0 {
+		return "", 0, false
+	}
+	members := body[:end]
+	if strings.ContainsAny(members, `[\"/`) {
+		return "", 0, false
+	}
+	for i := 1; i+1 < len(members); i++ {
+		if members[i] == '-' && members[i-1] > members[i+1] {
+			return "", 0, false
+		}
+	}
+
+	length = len(s) - len(body) + end + 1
+	if negate {
+		return "[^/" + members + "]", length, true
+	}
+	return "[" + members + "]", length, true
+}
@@ -3,6 +3,13 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 )
@@ -349,3 +356,895 @@ func TestSandboxProfileWithCorrectedRules(t *testing.T) {
 		t.Errorf("With corrected rules, read deny should appear exactly once, got %d", readDenyCount)
 	}
 }
+
+func TestGenerateSandboxProfile_AllowDevices(t *testing.T) {
+	config := &SandboxConfig{AllowDevices: []string{"/dev/disk2", "/dev/bpf*"}, Strict: true}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`(allow file-ioctl (subpath "/dev/disk2"))`,
+		`(allow file-write* (subpath "/dev/disk2"))`,
+		`(allow file-read-data (subpath "/dev/disk2"))`,
+		`(allow file-ioctl (regex #"^/dev/bpf[^/]*($|/)"))`,
+	} {
+		if !strings.Contains(profile, want) {
+			t.Errorf("Profile should contain %s, got:\n%s", want, profile)
+		}
+	}
+	if strings.Index(profile, `(allow file-write* (subpath "/dev/disk2"))`) < strings.Index(profile, "(deny file-write*)") {
+		t.Error("Device write allow must follow the default write deny")
+	}
+}
+
+func TestGenerateSandboxProfile_AllowPTY(t *testing.T) {
+	config := &SandboxConfig{AllowPTY: true, Strict: true}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	if !strings.Contains(profile, `(allow file-write* (literal "/dev/ptmx")`) {
+		t.Error("Profile should allow writes to /dev/ptmx when AllowPTY is set")
+	}
+	if !strings.Contains(profile, `(allow file-read-data (literal "/dev/ptmx")`) {
+		t.Error("Profile should allow reads of /dev/ptmx in strict mode when AllowPTY is set")
+	}
+
+	profile, err = generateSandboxProfile(&SandboxConfig{})
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if strings.Contains(profile, "/dev/ptmx") {
+		t.Error("Profile should not mention /dev/ptmx when AllowPTY is not set")
+	}
+}
+
+func TestGenerateSandboxProfile_OutputFileAllowsCreate(t *testing.T) {
+	config := &SandboxConfig{
+		Strict: true,
+		WriteRules: []ResolvedRule{
+			{
+				Path:   "/Users/test/project/out.log",
+				Action: ActionAllow,
+				Mode:   AccessWrite,
+				IsFile: true,
+			},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	if !strings.Contains(profile, `(allow file-write-create (literal "/Users/test/project/out.log"))`) {
+		t.Error("Profile should allow creating the output file")
+	}
+	if !strings.Contains(profile, `(allow file-write* (literal "/Users/test/project/out.log"))`) {
+		t.Error("Profile should allow writing the output file")
+	}
+	if strings.Contains(profile, `(subpath "/Users/test/project/out.log")`) {
+		t.Error("Profile should not grant a subpath for an output file")
+	}
+	if strings.Contains(profile, `"/Users/test/project"`) {
+		t.Error("Profile should not open the parent directory for writes")
+	}
+}
+
+func TestGenerateSandboxProfile_AllowKeychainReadAndMachLookup(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %v", err)
+	}
+	keychainDir := home + "/Library/Keychains"
+
+	profile, err := generateSandboxProfile(&SandboxConfig{AllowKeychain: true, Strict: true})
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	if !strings.Contains(profile, `(allow file-write* (subpath "`+keychainDir+`"))`) {
+		t.Error("Profile should allow writes to the keychain directory")
+	}
+	if !strings.Contains(profile, `(allow file-read-data (subpath "`+keychainDir+`"))`) {
+		t.Error("Profile should allow reads of the keychain directory in strict mode")
+	}
+	if !strings.Contains(profile, `(allow mach-lookup (global-name "com.apple.SecurityServer"))`) {
+		t.Error("Profile should allow the SecurityServer mach service")
+	}
+
+	// The read allow must come after the strict-mode read deny to take effect
+	denyIdx := strings.Index(profile, "(deny file-read-data)")
+	readIdx := strings.Index(profile, `(allow file-read-data (subpath "`+keychainDir+`"))`)
+	if readIdx < denyIdx {
+		t.Error("Keychain read allow should be emitted after the strict-mode read deny")
+	}
+}
+
+func TestGenerateSandboxProfile_AllowKeychainFile(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skipf("no home directory: %v", err)
+	}
+	keychainDir := home + "/Library/Keychains"
+	keychain := keychainDir + "/login.keychain-db"
+
+	profile, err := generateSandboxProfile(&SandboxConfig{KeychainFiles: []string{"login.keychain-db"}, Strict: true})
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	filter := `(literal "` + keychain + `") (regex #"` + globToSBPLRegex(keychain+".*") + `")`
+	for _, want := range []string{
+		"(allow file-write* " + filter + ")",
+		"(allow file-read-data " + filter + ")",
+		`(allow mach-lookup (global-name "com.apple.SecurityServer"))`,
+	} {
+		if !strings.Contains(profile, want) {
+			t.Errorf("Profile should contain %s, got:\n%s", want, profile)
+		}
+	}
+	if strings.Contains(profile, `(subpath "`+keychainDir+`")`) {
+		t.Errorf("Profile should not grant the whole keychain directory, got:\n%s", profile)
+	}
+
+	// The regex covers the temporary files a keychain is saved through, not other keychains
+	re := regexp.MustCompile(globToSBPLRegex(keychain + ".*"))
+	if !re.MatchString(keychain + ".sb-1a2b3c4d-XyZ") {
+		t.Error("Keychain regex should match the keychain's temporary files")
+	}
+	if re.MatchString(keychainDir + "/other.keychain-db") {
+		t.Error("Keychain regex should not match other keychains")
+	}
+}
+
+func TestGenerateSandboxProfile_ConnectSocket(t *testing.T) {
+	config := &SandboxConfig{
+		Strict:         true,
+		ConnectSockets: []string{"/work/run/agent.sock"},
+		WriteRules: []ResolvedRule{
+			{Path: "/work/run", Mode: AccessReadWrite, Action: ActionDeny},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	for _, allow := range []string{
+		`(allow file-read-data file-read-metadata (literal "/work/run/agent.sock"))`,
+		`(allow network-outbound (remote unix-socket (path-literal "/work/run/agent.sock")))`,
+	} {
+		idx := strings.Index(profile, allow)
+		if idx < 0 {
+			t.Fatalf("Profile should contain %s, got:\n%s", allow, profile)
+		}
+		if idx < strings.LastIndex(profile, `(subpath "/work/run"))`) {
+			t.Errorf("%s should come after the deny, got:\n%s", allow, profile)
+		}
+	}
+	if strings.Contains(profile, `(allow file-write* (literal "/work/run/agent.sock"))`) {
+		t.Errorf("socket should not be writable, got:\n%s", profile)
+	}
+}
+
+func TestGenerateSandboxProfile_TTYSurvivesDeny(t *testing.T) {
+	config := &SandboxConfig{
+		Strict:     true,
+		TTYDevices: []string{"/dev/tty", "/dev/ttys003"},
+		WriteRules: []ResolvedRule{
+			{Path: "/dev", Mode: AccessReadWrite, Action: ActionDeny},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	filter := `(literal "/dev/tty") (literal "/dev/ttys003")`
+	for _, allow := range []string{"(allow file-read-data " + filter + ")", "(allow file-write* " + filter + ")"} {
+		idx := strings.Index(profile, allow)
+		if idx < 0 {
+			t.Fatalf("Profile should contain %s, got:\n%s", allow, profile)
+		}
+		// The last matching rule wins, so the terminal allow must follow the deny
+		if idx < strings.LastIndex(profile, `(subpath "/dev"))`) {
+			t.Errorf("%s should come after the /dev deny, got:\n%s", allow, profile)
+		}
+	}
+}
+
+func TestGenerateSandboxProfile_NoDefaultTmp(t *testing.T) {
+	tmpRegex := `/private/var/folders/[^/]+/[^/]+/(C|T|0)`
+
+	profile, err := generateSandboxProfile(&SandboxConfig{})
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if !strings.Contains(profile, tmpRegex) {
+		t.Error("Profile should allow the system temp directories by default")
+	}
+
+	profile, err = generateSandboxProfile(&SandboxConfig{NoDefaultTmp: true})
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if strings.Contains(profile, tmpRegex) {
+		t.Error("Profile should not allow the system temp directories with NoDefaultTmp")
+	}
+}
+
+func TestGenerateSandboxProfile_StrictModeReadsTmp(t *testing.T) {
+	readTmp := `(allow file-read-data (regex #"` + defaultTmpRegex + `"))`
+	if !regexp.MustCompile(defaultTmpRegex).MatchString("/private/var/folders/zz/zyxvpxvq6csfxvn_n0000000000000/T/tool.out") {
+		t.Fatalf("%s should match a file in $TMPDIR", defaultTmpRegex)
+	}
+
+	profile, err := generateSandboxProfile(&SandboxConfig{Strict: true})
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	// The read allow must follow the strict-mode read deny to take effect
+	denyIdx := strings.Index(profile, "(deny file-read-data)\n")
+	if idx := strings.Index(profile, readTmp); denyIdx < 0 || idx < denyIdx {
+		t.Errorf("temp directories should be readable in strict mode, got:\n%s", profile)
+	}
+
+	for _, config := range []*SandboxConfig{{Strict: true, NoDefaultTmp: true}, {}} {
+		profile, err := generateSandboxProfile(config)
+		if err != nil {
+			t.Fatalf("generateSandboxProfile failed: %v", err)
+		}
+		if strings.Contains(profile, readTmp) {
+			t.Errorf("unexpected temp read allow with strict=%v, NoDefaultTmp=%v:\n%s", config.Strict, config.NoDefaultTmp, profile)
+		}
+	}
+}
+
+func TestGenerateSandboxProfile_StrictModeReadsSymlinkTarget(t *testing.T) {
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("EvalSymlinks failed: %v", err)
+	}
+	target := filepath.Join(tmpDir, "target")
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatalf("failed to create target: %v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	config := &SandboxConfig{
+		Strict: true,
+		WriteRules: []ResolvedRule{
+			{Path: link, Action: ActionAllow, Mode: AccessWrite},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	if !strings.Contains(profile, `(allow file-read-data (subpath "`+link+`"))`) {
+		t.Error("Profile should allow reading the symlinked allow path")
+	}
+	if !strings.Contains(profile, `(allow file-read-data (subpath "`+target+`"))`) {
+		t.Error("Profile should allow reading the symlink target in strict mode")
+	}
+}
+
+func TestCheckSandboxProfile_TrickyPaths(t *testing.T) {
+	if _, err := exec.LookPath("sandbox-exec"); err != nil {
+		t.Skip("sandbox-exec not available")
+	}
+
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{
+				Path:   `/tmp/cage "quoted" dir`,
+				Action: ActionAllow,
+				Mode:   AccessWrite,
+			},
+			{
+				Path:   `/tmp/back\slash`,
+				Action: ActionAllow,
+				Mode:   AccessWrite,
+			},
+			{
+				Path:   `/tmp/deny (1)/*.[ch]+`,
+				Action: ActionDeny,
+				Mode:   AccessReadWrite,
+				IsGlob: true,
+			},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if err := checkSandboxProfile(profile); err != nil {
+		t.Errorf("checkSandboxProfile() error = %v\nprofile:\n%s", err, profile)
+	}
+}
+
+func TestGenerateSandboxProfile_RejectsControlCharacters(t *testing.T) {
+	injected := "/tmp/x\"))\n(allow file-write* (subpath \"/\"))\n(allow file-write* (literal \"/tmp/x"
+	for _, config := range []*SandboxConfig{
+		{WriteRules: []ResolvedRule{{Path: injected, Action: ActionAllow, Mode: AccessWrite}}},
+		{WriteRules: []ResolvedRule{{Path: "/Users/test", Action: ActionDeny, Mode: AccessReadWrite, Except: []string{injected}}}},
+		{Strict: true, ReadRules: []ResolvedRule{{Path: "/tmp/x\r", Action: ActionAllow, Mode: AccessRead}}},
+		{AllowDevices: []string{"/dev/x\x00"}},
+		{ConnectSockets: []string{injected}},
+	} {
+		profile, err := generateSandboxProfile(config)
+		if err == nil || !strings.Contains(err.Error(), "control character") {
+			t.Errorf("expected a control character error, got %v\nprofile:\n%s", err, profile)
+		}
+	}
+}
+
+func TestGenerateSandboxProfile_AnnotationCannotInject(t *testing.T) {
+	config := &SandboxConfig{
+		AnnotateProfile: true,
+		WriteRules: []ResolvedRule{{
+			Path:   "/work",
+			Action: ActionAllow,
+			Mode:   AccessWrite,
+			Source: RuleSource{PresetName: "evil\n(allow file-write* (subpath \"/\"))"},
+		}},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	for _, line := range strings.Split(profile, "\n") {
+		if line == `(allow file-write* (subpath "/"))` {
+			t.Errorf("preset name injected a directive:\n%s", profile)
+		}
+	}
+	if !strings.Contains(profile, `; from preset: evil?(allow file-write* (subpath "/"))`) {
+		t.Errorf("expected the control character replaced in the comment, got:\n%s", profile)
+	}
+}
+
+func TestCheckSandboxProfile_RejectsInvalidProfile(t *testing.T) {
+	if _, err := exec.LookPath("sandbox-exec"); err != nil {
+		t.Skip("sandbox-exec not available")
+	}
+
+	if err := checkSandboxProfile("(version 1)\n(allow default)\n(deny file-write* (subpath \"/tmp))\n"); err == nil {
+		t.Error("checkSandboxProfile() should reject a profile with an unterminated string")
+	}
+}
+
+func TestSandboxExecError(t *testing.T) {
+	exitErr := errors.New("exit status 71")
+
+	err := sandboxExecError("sandbox-exec: execvp() of '/usr/bin/true' failed: Operation not permitted\n", exitErr)
+	if !errors.Is(err, errProfileNotRun) || !strings.Contains(err.Error(), "Operation not permitted") {
+		t.Errorf("exec failure: got %v, want errProfileNotRun with sandbox-exec's message", err)
+	}
+
+	err = sandboxExecError("sandbox-exec: unbound variable: bogus\n", exitErr)
+	if errors.Is(err, errProfileNotRun) || err.Error() != "sandbox-exec rejected profile: sandbox-exec: unbound variable: bogus" {
+		t.Errorf("compile error: got %v", err)
+	}
+
+	if err := sandboxExecError("", exitErr); !strings.Contains(err.Error(), "exit status 71") {
+		t.Errorf("without output: got %v, want the exit status", err)
+	}
+}
+
+func TestGenerateSandboxProfile_WriteCarveOutIsReadable(t *testing.T) {
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: "/Users/test", Action: ActionDeny, Mode: AccessReadWrite},
+			{Path: "/Users/test/project", Action: ActionAllow, Mode: AccessWrite},
+			{Path: "/tmp/out", Action: ActionAllow, Mode: AccessWrite},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	denyIdx := strings.Index(profile, `(deny file-read-data (subpath "/Users/test"))`)
+	readIdx := strings.Index(profile, `(allow file-read-data (subpath "/Users/test/project"))`)
+	if denyIdx == -1 || readIdx == -1 || readIdx < denyIdx {
+		t.Errorf("write carve-out should be readable after the read deny\nprofile:\n%s", profile)
+	}
+	if !strings.Contains(profile, `(allow file-write* (subpath "/Users/test/project"))`) {
+		t.Error("write carve-out should be writable")
+	}
+	if strings.Contains(profile, `(allow file-read-data (subpath "/tmp/out"))`) {
+		t.Error("allows outside a denied directory should not get extra read rules")
+	}
+}
+
+func TestGenerateSandboxProfile_WriteDenyInsideAllow(t *testing.T) {
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: "/Users/test/project", Action: ActionAllow, Mode: AccessWrite},
+			{Path: "/Users/test/project/.git", Action: ActionDeny, Mode: AccessWrite},
+			{Path: "/Users/test/project/.git/hooks", Action: ActionAllow, Mode: AccessWrite},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	allowIdx := strings.Index(profile, `(allow file-write* (subpath "/Users/test/project"))`)
+	denyIdx := strings.LastIndex(profile, `(deny file-write* (subpath "/Users/test/project/.git"))`)
+	hooksIdx := strings.LastIndex(profile, `(allow file-write* (subpath "/Users/test/project/.git/hooks"))`)
+	if allowIdx == -1 || denyIdx < allowIdx {
+		t.Errorf("write deny should follow the enclosing allow\nprofile:\n%s", profile)
+	}
+	if hooksIdx < denyIdx {
+		t.Errorf("write carve-out should follow the nested deny\nprofile:\n%s", profile)
+	}
+	if strings.Contains(profile, `(deny file-read-data (subpath "/Users/test/project/.git"))`) {
+		t.Error("a write-only deny should not deny reads")
+	}
+	if count := strings.Count(profile, `(deny file-write* (subpath "/Users/test/project/.git"))`); count != 1 {
+		t.Errorf("nested write deny should be emitted exactly once, got %d\nprofile:\n%s", count, profile)
+	}
+}
+
+func TestSandboxProfileWriteDenyCoveredByReadWriteDeny(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddDenyRule("/Users/test/.git", nil, RuleSource{PresetName: "builtin:secure"})
+	resolver.AddWriteDenyRule("/Users/test/.git", RuleSource{PresetName: "-protect-git", Origin: OriginCLI})
+
+	writeRules, readRules, _ := resolver.Resolve()
+	profile, err := generateSandboxProfile(&SandboxConfig{WriteRules: writeRules, ReadRules: readRules, Strict: true})
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	for _, deny := range []string{
+		`(deny file-write* (subpath "/Users/test/.git"))`,
+		`(deny file-read-data (subpath "/Users/test/.git"))`,
+	} {
+		if count := strings.Count(profile, deny); count != 1 {
+			t.Errorf("%s should appear exactly once, got %d", deny, count)
+		}
+	}
+}
+
+func TestGenerateSandboxProfile_AnnotateProfile(t *testing.T) {
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: "/work", Mode: AccessWrite, Action: ActionAllow, Source: RuleSource{PresetName: "dev"}},
+			{Path: "/work/build", Mode: AccessWrite, Action: ActionAllow, Source: RuleSource{PresetName: "dev"}},
+			{Path: "/tmp/out", Mode: AccessWrite, Action: ActionAllow, Source: RuleSource{Origin: OriginCLI}},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if strings.Contains(profile, ";") {
+		t.Errorf("Profile should have no comments unless AnnotateProfile is set, got:\n%s", profile)
+	}
+
+	config.AnnotateProfile = true
+	profile, err = generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if n := strings.Count(profile, "; from preset: dev\n"); n != 1 {
+		t.Errorf("Expected one comment for the dev group, got %d in:\n%s", n, profile)
+	}
+	comment := strings.Index(profile, "; from preset: dev\n")
+	if rule := strings.Index(profile, `(allow file-write* (subpath "/work"))`); comment == -1 || rule < comment {
+		t.Errorf("The dev comment should precede its rules, got:\n%s", profile)
+	}
+	if !strings.Contains(profile, "; from CLI flag\n") {
+		t.Errorf("Profile should name the CLI flag source, got:\n%s", profile)
+	}
+}
+
+func TestGenerateSandboxProfile_AllowAppend(t *testing.T) {
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: "/work", Mode: AccessWrite, Action: ActionAllow},
+			{Path: "/work/logs", Mode: AccessWrite, Action: ActionAllow, Append: true},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	for _, want := range []string{
+		`(allow file-write-create (subpath "/work/logs"))`,
+		`(allow file-write-data (subpath "/work/logs"))`,
+		`(deny file-write-unlink (subpath "/work/logs"))`,
+	} {
+		if !strings.Contains(profile, want) {
+			t.Errorf("Profile should contain %s, got:\n%s", want, profile)
+		}
+	}
+	if strings.Contains(profile, `(allow file-write* (subpath "/work/logs"))`) {
+		t.Errorf("Append-only path must not get full write access, got:\n%s", profile)
+	}
+	// The unlink deny must follow the enclosing allow, as the last matching rule wins
+	if strings.Index(profile, `(deny file-write-unlink (subpath "/work/logs"))`) < strings.Index(profile, `(allow file-write* (subpath "/work"))`) {
+		t.Errorf("Unlink deny must follow the enclosing write allow, got:\n%s", profile)
+	}
+}
+
+func TestGenerateSandboxProfile_MergedReadWriteAllow(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule("/work", RuleSource{Origin: OriginCLI})
+	resolver.AddReadRule("/work", RuleSource{Origin: OriginCLI})
+	writeRules, readRules, _ := resolver.Resolve()
+
+	profile, err := generateSandboxProfile(&SandboxConfig{Strict: true, WriteRules: writeRules, ReadRules: readRules})
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	for _, line := range []string{
+		`(allow file-write* (subpath "/work"))`,
+		`(allow file-read-data (subpath "/work"))`,
+	} {
+		if n := strings.Count(profile, line); n != 1 {
+			t.Errorf("Expected %s once, found %d times in:\n%s", line, n, profile)
+		}
+	}
+}
+
+func TestGenerateSandboxProfile_FileLevelDeny(t *testing.T) {
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: "/work", Mode: AccessWrite, Action: ActionAllow},
+			{Path: "/work", Mode: AccessWrite, Action: ActionDeny, FileLevel: true},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	deny := `(deny file-write* (regex #"^/work/[^/]+$"))`
+	if !strings.Contains(profile, deny) {
+		t.Fatalf("Expected single-level deny %s, got:\n%s", deny, profile)
+	}
+	if strings.Contains(profile, `(deny file-write* (subpath "/work"))`) {
+		t.Errorf("File-level deny should not be emitted as a subpath, got:\n%s", profile)
+	}
+	// The deny sits inside the allow of /work, so it must come after it
+	if strings.Index(profile, deny) < strings.Index(profile, `(allow file-write* (subpath "/work"))`) {
+		t.Errorf("File-level deny must follow the allow of its directory, got:\n%s", profile)
+	}
+
+	re := regexp.MustCompile(fileLevelRegex("/work", false))
+	for path, want := range map[string]bool{
+		"/work/notes.txt":    true,
+		"/work/src":          true,
+		"/work/src/main.go":  false,
+		"/work":              false,
+		"/workshop/file.txt": false,
+	} {
+		if got := re.MatchString(path); got != want {
+			t.Errorf("fileLevelRegex(/work) matches %s = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestGenerateSandboxProfile_CaseInsensitiveDeny(t *testing.T) {
+	config := &SandboxConfig{
+		CaseInsensitive: true,
+		WriteRules: []ResolvedRule{
+			{Path: "/Users/me/Secrets", Mode: AccessReadWrite, Action: ActionDeny},
+			{Path: "/Users/*/.ssh", Mode: AccessWrite, Action: ActionDeny, IsGlob: true},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if !strings.Contains(profile, `(deny file-write* (subpath "/Users/me/Secrets"))`) {
+		t.Errorf("Case-sensitive subpath deny should be kept, got:\n%s", profile)
+	}
+
+	var regexes []*regexp.Regexp
+	for _, line := range strings.Split(profile, "\n") {
+		if !strings.HasPrefix(line, "(deny file-write* (regex #\"") {
+			continue
+		}
+		pattern := strings.TrimSuffix(strings.TrimPrefix(line, "(deny file-write* (regex #\""), "\"))")
+		regexes = append(regexes, regexp.MustCompile(pattern))
+	}
+	matches := func(path string) bool {
+		for _, re := range regexes {
+			if re.MatchString(path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, path := range []string{
+		"/Users/me/Secrets",
+		"/users/me/secrets",
+		"/USERS/ME/SECRETS/key.pem",
+		"/users/someone/.SSH/id_ed25519",
+	} {
+		if !matches(path) {
+			t.Errorf("Write deny should cover case variant %s, got:\n%s", path, profile)
+		}
+	}
+	for _, path := range []string{"/users/me/secrets2", "/users/a/b/.ssh"} {
+		if matches(path) {
+			t.Errorf("Write deny should not cover %s", path)
+		}
+	}
+}
+
+func TestGlobToSBPLRegex(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+		match   []string
+		noMatch []string
+	}{
+		{
+			pattern: "/work/*.log",
+			want:    `^/work/[^/]*\.log($|/)`,
+			match:   []string{"/work/a.log", "/work/a.log/rotated"},
+			noMatch: []string{"/work", "/work/sub/a.log", "/work/alog"},
+		},
+		{
+			pattern: "/work/**/secret",
+			want:    `^/work/.*/secret($|/)`,
+			match:   []string{"/work/a/secret", "/work/a/b/secret/key"},
+			noMatch: []string{"/work", "/work/a", "/work/a/secrets"},
+		},
+		{
+			pattern: "/dev/tty?",
+			want:    `^/dev/tty[^/]($|/)`,
+			match:   []string{"/dev/ttyS"},
+			noMatch: []string{"/dev/tty", "/dev/ttyS0"},
+		},
+		{
+			pattern: "/logs/app[0-9].log",
+			want:    `^/logs/app[0-9]\.log($|/)`,
+			match:   []string{"/logs/app1.log"},
+			noMatch: []string{"/logs/appx.log", "/logs/app12.log"},
+		},
+		{
+			pattern: "/data/[a-z]*",
+			want:    `^/data/[a-z][^/]*($|/)`,
+			match:   []string{"/data/x", "/data/abc/def"},
+			noMatch: []string{"/data/Xyz", "/data"},
+		},
+		{
+			pattern: "/data/[!.]*",
+			want:    `^/data/[^/.][^/]*($|/)`,
+			match:   []string{"/data/visible"},
+			noMatch: []string{"/data/.hidden"},
+		},
+		{
+			// Escaped literals: regex metacharacters, a quote and brackets that
+			// are not a class
+			pattern: `/tmp/a+b (1)/{x}|$^"q"/[]/[z-a]/[/*`,
+			want:    `^/tmp/a\+b \(1\)/\{x\}\|\$\^\"q\"/\[\]/\[z-a\]/\[/[^/]*($|/)`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			got := globToSBPLRegex(tt.pattern)
+			if got != tt.want {
+				t.Fatalf("globToSBPLRegex(%q) = %q, want %q", tt.pattern, got, tt.want)
+			}
+			re := regexp.MustCompile(got)
+			for _, path := range tt.match {
+				if !re.MatchString(path) {
+					t.Errorf("%s should match %s", got, path)
+				}
+			}
+			for _, path := range tt.noMatch {
+				if re.MatchString(path) {
+					t.Errorf("%s should not match %s", got, path)
+				}
+			}
+		})
+	}
+}
+
+func TestLiteralToSBPLRegex(t *testing.T) {
+	if got, want := literalToSBPLRegex("/work/what?[1]*"), `^/work/what\?\[1\]\*($|/)`; got != want {
+		t.Errorf("literalToSBPLRegex() = %q, want %q", got, want)
+	}
+}
+
+func TestCaseFoldRegex(t *testing.T) {
+	tests := []struct {
+		regex string
+		want  string
+	}{
+		{`^/a\.b($|/)`, `^/[aA]\.[bB]($|/)`},
+		{`^/x[^/]*y`, `^/[xX][^/]*[yY]`},
+		{`^/1-2`, `^/1-2`},
+	}
+	for _, tt := range tests {
+		if got := caseFoldRegex(tt.regex); got != tt.want {
+			t.Errorf("caseFoldRegex(%q) = %q, want %q", tt.regex, got, tt.want)
+		}
+	}
+}
+
+func TestLintSandboxProfile_GeneratedProfileIsClean(t *testing.T) {
+	config := &SandboxConfig{
+		Strict:     true,
+		AllowPTY:   true,
+		TTYDevices: []string{"/dev/tty"},
+		WriteRules: []ResolvedRule{
+			{Path: "/Users/test/project", Mode: AccessWrite, Action: ActionAllow},
+			{Path: `/Users/test/odd "name" \ dir`, Mode: AccessWrite, Action: ActionAllow},
+			{Path: "/Users/test/project/.git", Mode: AccessWrite, Action: ActionDeny},
+			{Path: "/Users/test/.ssh", Mode: AccessReadWrite, Action: ActionDeny},
+			{Path: "/Users/*/secret", Mode: AccessReadWrite, Action: ActionDeny, IsGlob: true},
+		},
+		ReadRules: []ResolvedRule{
+			{Path: "/usr", Mode: AccessRead, Action: ActionAllow},
+		},
+	}
+
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if findings := lintSandboxProfile(profile); len(findings) != 0 {
+		t.Errorf("expected no findings for a generated profile, got %v in:\n%s", findings, profile)
+	}
+}
+
+func TestGenerateSandboxProfile_ScopedDefaultDeny(t *testing.T) {
+	// --deny /work --allow /work/src --allow /work/build: within /work only the
+	// two children are usable, siblings such as /work/docs stay denied
+	resolver := NewRuleResolver()
+	resolver.AddDenyRule("/work", nil, RuleSource{})
+	resolver.AddAllowRule("/work/src", RuleSource{})
+	resolver.AddAllowRule("/work/build", RuleSource{})
+	writeRules, readRules, _ := resolver.Resolve()
+
+	for _, strict := range []bool{false, true} {
+		config := &SandboxConfig{Strict: strict, WriteRules: writeRules, ReadRules: readRules}
+		profile, err := generateSandboxProfile(config)
+		if err != nil {
+			t.Fatalf("generateSandboxProfile failed: %v", err)
+		}
+
+		for _, op := range []string{"file-write*", "file-read-data"} {
+			denyIdx := strings.LastIndex(profile, fmt.Sprintf(`(deny %s (subpath "/work"))`, op))
+			if denyIdx < 0 {
+				t.Fatalf("strict=%v: expected a %s deny on /work, got:\n%s", strict, op, profile)
+			}
+			for _, child := range []string{"/work/src", "/work/build"} {
+				allow := fmt.Sprintf(`(allow %s (subpath "%s"))`, op, child)
+				if idx := strings.LastIndex(profile, allow); idx < denyIdx {
+					t.Errorf("strict=%v: %s should follow the /work deny, got:\n%s", strict, allow, profile)
+				}
+			}
+		}
+		for _, sibling := range []string{`(subpath "/work")`, "/work/docs"} {
+			if strings.Contains(profile, "(allow file-write* "+sibling) || strings.Contains(profile, "(allow file-read-data "+sibling) {
+				t.Errorf("strict=%v: %s should stay denied, got:\n%s", strict, sibling, profile)
+			}
+		}
+		if findings := lintSandboxProfile(profile); len(findings) != 0 {
+			t.Errorf("strict=%v: expected no findings, got %v in:\n%s", strict, findings, profile)
+		}
+	}
+}
+
+func TestGenerateSandboxProfile_StrictReadDenyInsideAllow(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule("/work", RuleSource{})
+	resolver.AddDenyRule("/work/secret", []string{"/work/secret/public"}, RuleSource{})
+	resolver.AddReadRule("/work/secret/keys/README", RuleSource{})
+	writeRules, readRules, _ := resolver.Resolve()
+
+	config := &SandboxConfig{Strict: true, WriteRules: writeRules, ReadRules: readRules}
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+
+	// The last matching rule wins: the read deny must follow the read allow of
+	// /work, and the carve-outs inside the deny must follow it again
+	allowIdx := strings.LastIndex(profile, `(allow file-read-data (subpath "/work"))`)
+	denyIdx := strings.LastIndex(profile, `(deny file-read-data (subpath "/work/secret"))`)
+	if allowIdx < 0 || denyIdx < allowIdx {
+		t.Errorf("read deny should follow the enclosing read allow, got:\n%s", profile)
+	}
+	for _, carveOut := range []string{
+		`(allow file-read-data (subpath "/work/secret/public"))`,
+		`(allow file-read-data (literal "/work/secret/keys/README"))`,
+	} {
+		if idx := strings.LastIndex(profile, carveOut); idx < denyIdx {
+			t.Errorf("%s should follow the nested read deny, got:\n%s", carveOut, profile)
+		}
+	}
+	if count := strings.Count(profile, `(deny file-read-data (subpath "/work/secret"))`); count != 1 {
+		t.Errorf("nested read deny should be emitted exactly once, got %d\nprofile:\n%s", count, profile)
+	}
+	if findings := lintSandboxProfile(profile); len(findings) != 0 {
+		t.Errorf("expected no findings, got %v in:\n%s", findings, profile)
+	}
+}
+
+func TestGenerateSandboxProfile_CompatFileRead(t *testing.T) {
+	resolver := NewRuleResolver()
+	resolver.AddAllowRule("/work", RuleSource{})
+	resolver.AddDenyRule("/work/secret", []string{"/work/secret/public"}, RuleSource{})
+	writeRules, readRules, _ := resolver.Resolve()
+
+	for _, strict := range []bool{false, true} {
+		config := &SandboxConfig{Strict: strict, CompatFileRead: true, WriteRules: writeRules, ReadRules: readRules}
+		profile, err := generateSandboxProfile(config)
+		if err != nil {
+			t.Fatalf("generateSandboxProfile failed: %v", err)
+		}
+
+		if !strings.Contains(profile, `(deny file-read* (subpath "/work/secret"))`) {
+			t.Errorf("strict=%v: expected a file-read* deny, got:\n%s", strict, profile)
+		}
+		if strings.Contains(profile, `(deny file-read-data (subpath "/work/secret"))`) {
+			t.Errorf("strict=%v: unexpected file-read-data deny, got:\n%s", strict, profile)
+		}
+		// The carve-out must restore the metadata the deny takes away
+		if !strings.Contains(profile, `(allow file-read* (subpath "/work/secret/public"))`) {
+			t.Errorf("strict=%v: expected a file-read* carve-out, got:\n%s", strict, profile)
+		}
+	}
+
+	config := &SandboxConfig{WriteRules: writeRules, ReadRules: readRules}
+	profile, err := generateSandboxProfile(config)
+	if err != nil {
+		t.Fatalf("generateSandboxProfile failed: %v", err)
+	}
+	if strings.Contains(profile, "file-read*") {
+		t.Errorf("expected no file-read* without CompatFileRead, got:\n%s", profile)
+	}
+}
+
+func TestSandboxExecArgs(t *testing.T) {
+	config := &SandboxConfig{
+		Command:        "make",
+		Args:           []string{"-j4"},
+		SeatbeltParams: []string{"PROJECT=/work", "CACHE=/tmp/cache"},
+	}
+	got := sandboxExecArgs(config, "(version 1)")
+	want := []string{"sandbox-exec", "-D", "PROJECT=/work", "-D", "CACHE=/tmp/cache", "-p", "(version 1)", "make", "-j4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sandboxExecArgs() = %q, want %q", got, want)
+	}
+
+	config.ProfileFile = "custom.sb"
+	got = sandboxExecArgs(config, "")
+	want = []string{"sandbox-exec", "-D", "PROJECT=/work", "-D", "CACHE=/tmp/cache", "-f", "custom.sb", "make", "-j4"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sandboxExecArgs() = %q, want %q", got, want)
+	}
+}
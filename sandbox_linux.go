@@ -3,71 +3,254 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
-	"syscall"
+	"time"
 
 	"github.com/landlock-lsm/go-landlock/landlock"
+	ll "github.com/landlock-lsm/go-landlock/landlock/syscall"
+	"golang.org/x/sys/unix"
 )
 
+// errProfileFileUnsupported is returned for --profile-file, which takes a sandbox-exec profile
+var errProfileFileUnsupported = errors.New("--profile-file is only supported on macOS (sandbox-exec profiles cannot be applied with Landlock)")
+
 func runInSandbox(config *SandboxConfig) error {
+	keep, err := keptFDs(config, supervised(config))
+	if err != nil {
+		return err
+	}
+	path, argv, err := sandboxCommand(config)
+	if err != nil {
+		return err
+	}
+	return execCommand(path, argv, config, keep)
+}
+
+func startInSandbox(config *SandboxConfig) (*exec.Cmd, error) {
+	keep, err := keptFDs(config, true)
+	if err != nil {
+		return nil, err
+	}
+	path, argv, err := sandboxCommand(config)
+	if err != nil {
+		return nil, err
+	}
+	return startSandboxed(path, argv, config, false, keep)
+}
+
+// sandboxCommand applies the Landlock restrictions to the current process, which
+// every command it starts inherits, and returns the command's path and argv
+func sandboxCommand(config *SandboxConfig) (string, []string, error) {
+	if config.ProfileFile != "" {
+		return "", nil, errProfileFileUnsupported
+	}
+
 	if config.AllowAll {
 		path, err := exec.LookPath(config.Command)
 		if err != nil {
-			return fmt.Errorf("command not found: %w", err)
+			return "", nil, fmt.Errorf("command not found: %w", err)
+		}
+		return path, append([]string{config.Command}, config.Args...), nil
+	}
+
+	kernelABI, _ := ll.LandlockGetABIVersion()
+	effectiveABI, err := checkLandlockABI(kernelABI, config.RequireLandlockABI)
+	if err != nil {
+		return "", nil, err
+	}
+	if config.Verbose {
+		logger.Infof("enforcing Landlock ABI v%d (kernel supports v%d)", effectiveABI, kernelABI)
+	}
+	if config.AllowNewPrivs && effectiveABI > 0 {
+		logger.Warnf("--allow-new-privs has no effect: enforcing Landlock sets no_new_privs")
+	}
+
+	start := time.Now()
+	warnUnenforceableRules(config)
+	grants := landlockGrants(config, false)
+
+	// Listing /dev/fd needs read access, which strict mode takes away, so the
+	// descriptors are marked before the restrictions apply
+	if !config.KeepFDs {
+		if err := closeInheritedFDs(); err != nil {
+			return "", nil, fmt.Errorf("close inherited file descriptors: %w", err)
 		}
-		argv := append([]string{config.Command}, config.Args...)
-		return syscall.Exec(path, argv, os.Environ())
 	}
 
-	var rules []landlock.Rule
+	// Landlock sets no_new_privs itself, but not when the kernel lacks Landlock
+	if !config.AllowNewPrivs {
+		if err := setNoNewPrivs(); err != nil {
+			return "", nil, err
+		}
+	}
+
+	rules := make([]landlock.Rule, 0, len(grants))
+	for _, grant := range grants {
+		rules = append(rules, grant.rule())
+	}
+	err = landlock.V5.BestEffort().RestrictPaths(rules...)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to apply Landlock restrictions: %w", err)
+	}
+	reportTiming(config.ProfileTiming, "profile generation", start)
+
+	path, err := exec.LookPath(config.Command)
+	if err != nil {
+		return "", nil, fmt.Errorf("command not found: %w", err)
+	}
+
+	return path, append([]string{config.Command}, config.Args...), nil
+}
+
+// landlockGrants returns the Landlock rules for config; --compare-run checks traced
+// accesses against the same list. With preview set nothing is reported or created:
+// a missing output file is granted as the file it would become
+func landlockGrants(config *SandboxConfig, preview bool) []landlockGrant {
+	var grants []landlockGrant
 
 	if config.Strict {
+		// rulePaths resolves symlinks, so a symlinked allow path grants access to
+		// its target; the link itself can still be followed, as Landlock does not
+		// restrict path walks
 		for _, rule := range config.ReadRules {
 			if rule.Action == ActionAllow {
-				absPath, err := filepath.Abs(rule.Path)
-				if err != nil {
-					absPath = rule.Path
-				}
-				if info, err := os.Stat(absPath); err == nil && info.IsDir() {
-					rules = append(rules, landlock.RODirs(absPath))
-				} else if err == nil {
-					rules = append(rules, landlock.ROFiles(absPath))
+				for _, absPath := range rulePaths(rule, !preview) {
+					if grant, ok := readGrant(absPath); ok {
+						grants = append(grants, grant)
+					}
 				}
 			}
 		}
 
 		for _, rule := range config.WriteRules {
 			if rule.Action == ActionAllow {
-				absPath, err := filepath.Abs(rule.Path)
+				for _, absPath := range rulePaths(rule, false) {
+					if grant, ok := readGrant(absPath); ok {
+						grants = append(grants, grant)
+					}
+				}
+			}
+		}
+	} else {
+		grants = append(grants, landlockGrant{"/", accessReadDirs})
+	}
+
+	grants = append(grants, landlockGrant{"/dev/null", accessRWFiles})
+
+	// Allow pseudo-terminal devices for interactive tools
+	if config.AllowPTY {
+		for _, tty := range []string{"/dev/ptmx", "/dev/tty"} {
+			if _, err := os.Stat(tty); err == nil {
+				grants = append(grants, landlockGrant{tty, accessRWFiles | ll.AccessFSIoctlDev})
+			}
+		}
+		if info, err := os.Stat("/dev/pts"); err == nil && info.IsDir() {
+			grants = append(grants, landlockGrant{"/dev/pts", accessRWDirs | ll.AccessFSIoctlDev})
+		}
+	}
+
+	// The controlling terminal stays usable, also in strict mode
+	grants = append(grants, ttyRules(config.TTYDevices)...)
+	grants = append(grants, connectRules(config.ConnectSockets)...)
+
+	// Build write deny set
+	// Note: exceptions (carve-outs) only restore READ access, not write.
+	// Use explicit 'allow:' paths inside the denied directory to grant write access.
+	writeDenySet := buildWriteDenySet(config.WriteRules)
+
+	for _, rule := range config.WriteRules {
+		if rule.Action != ActionAllow {
+			continue
+		}
+		for _, absPath := range rulePaths(rule, !preview) {
+			if writeAllowDenied(absPath, writeDenySet) {
+				if !preview {
+					logger.Infof(
+						"skipping write allow for %s (matches deny rule)",
+						absPath,
+					)
+				}
+				continue
+			}
+
+			if rule.IsFile {
+				if preview {
+					mode := os.FileMode(0)
+					if info, err := os.Stat(absPath); err == nil {
+						mode = info.Mode()
+					}
+					grants = append(grants, allowFileRule(absPath, mode))
+					continue
+				}
+				fileRule, err := outputFileRule(absPath)
 				if err != nil {
-					absPath = rule.Path
+					logger.Warnf("skipping output file %s: %v", absPath, err)
+					continue
 				}
-				if info, err := os.Stat(absPath); err == nil && info.IsDir() {
-					rules = append(rules, landlock.RODirs(absPath))
-				} else if err == nil {
-					rules = append(rules, landlock.ROFiles(absPath))
+				grants = append(grants, fileRule)
+				continue
+			}
+
+			info, err := os.Stat(absPath)
+			if err != nil {
+				continue
+			}
+
+			if rule.Append {
+				grants = append(grants, appendRule(absPath, info.IsDir()))
+				continue
+			}
+
+			if info.IsDir() {
+				if isDeviceDir(absPath) {
+					grants = append(grants, landlockGrant{absPath, accessRWDirs | ll.AccessFSIoctlDev})
+					continue
 				}
+				grants = append(grants, allowDirRule(absPath, !config.NoRefer && !rule.NoRefer))
+			} else {
+				grants = append(grants, allowFileRule(absPath, info.Mode()))
 			}
 		}
-	} else {
-		rules = append(rules, landlock.RODirs("/"))
+	}
+	return grants
+}
+
+// warnUnenforceableRules warns about the rules in config that Landlock cannot enforce
+func warnUnenforceableRules(config *SandboxConfig) {
+	// Landlock grants whole directories, so it cannot single out a directory's
+	// direct entries
+	warnedFileLevel := make(map[string]bool)
+	for _, ruleSet := range [][]ResolvedRule{config.WriteRules, config.ReadRules} {
+		for _, rule := range ruleSet {
+			if rule.Action == ActionDeny && rule.FileLevel && !warnedFileLevel[rule.Path] {
+				warnedFileLevel[rule.Path] = true
+				logger.Warnf(
+					"file-level deny %q cannot be enforced on Linux "+
+						"(Landlock rules cover whole directories); it will be ignored",
+					rule.Path,
+				)
+			}
+		}
+	}
 
+	if !config.Strict {
 		for _, rule := range config.ReadRules {
-			if rule.Action == ActionDeny && rule.Mode&AccessRead != 0 {
+			if rule.Action == ActionDeny && rule.Mode&AccessRead != 0 && !rule.FileLevel {
 				if rule.IsGlob {
-					fmt.Fprintf(os.Stderr,
-						"cage: warning: glob pattern %q cannot be enforced on Linux "+
-							"(Landlock requires literal paths); pattern will be ignored\n",
+					logger.Warnf(
+						"glob pattern %q cannot be enforced on Linux "+
+							"(Landlock requires literal paths); pattern will be ignored",
 						rule.Path,
 					)
 				} else {
-					fmt.Fprintf(os.Stderr,
-						"cage: warning: read deny %q cannot be enforced on Linux "+
-							"(Landlock is allowlist-only); use --strict for read protection\n",
+					logger.Warnf(
+						"read deny %q cannot be enforced on Linux "+
+							"(Landlock is allowlist-only); use --strict for read protection",
 						rule.Path,
 					)
 				}
@@ -75,17 +258,17 @@ func runInSandbox(config *SandboxConfig) error {
 		}
 
 		for _, rule := range config.WriteRules {
-			if rule.Action == ActionDeny && rule.Mode&AccessRead != 0 {
+			if rule.Action == ActionDeny && rule.Mode&AccessRead != 0 && !rule.FileLevel {
 				if rule.IsGlob {
-					fmt.Fprintf(os.Stderr,
-						"cage: warning: glob pattern %q cannot be enforced on Linux "+
-							"(Landlock requires literal paths); pattern will be ignored\n",
+					logger.Warnf(
+						"glob pattern %q cannot be enforced on Linux "+
+							"(Landlock requires literal paths); pattern will be ignored",
 						rule.Path,
 					)
 				} else {
-					fmt.Fprintf(os.Stderr,
-						"cage: warning: read deny %q cannot be enforced on Linux "+
-							"(Landlock is allowlist-only); use --strict for read protection\n",
+					logger.Warnf(
+						"read deny %q cannot be enforced on Linux "+
+							"(Landlock is allowlist-only); use --strict for read protection",
 						rule.Path,
 					)
 				}
@@ -93,84 +276,290 @@ func runInSandbox(config *SandboxConfig) error {
 		}
 	}
 
-	rules = append(rules, landlock.RWFiles("/dev/null"))
-
-	// Build write deny set
-	// Note: exceptions (carve-outs) only restore READ access, not write.
-	// Use explicit 'allow:' paths to grant write access.
-	writeDenySet := make(map[string]bool)
+	// Landlock cannot take write access back below an allowed directory
 	for _, rule := range config.WriteRules {
-		if rule.Action == ActionDeny && rule.Mode&AccessWrite != 0 && !rule.IsGlob {
-			absPath, err := filepath.Abs(rule.Path)
-			if err != nil {
-				absPath = rule.Path
+		if rule.Action == ActionDeny && rule.Mode&AccessWrite != 0 && !rule.IsGlob && !rule.FileLevel {
+			if parent, ok := enclosingWriteAllow(rule.Path, config.WriteRules); ok {
+				logger.Warnf(
+					"write deny %q inside allowed %q cannot be enforced on Linux "+
+						"(Landlock is allowlist-only)",
+					rule.Path, parent,
+				)
 			}
-			writeDenySet[absPath] = true
 		}
 	}
+}
 
-	// Helper to check if a path should be denied (is under a deny path)
-	shouldDenyWrite := func(path string) bool {
-		// Check if path matches a deny rule
-		if writeDenySet[path] {
-			return true
+// setNoNewPrivs sets no_new_privs on every thread of cage, so the command and
+// its descendants cannot gain privileges through setuid/setgid binaries or file
+// capabilities; it cannot be unset again
+func setNoNewPrivs() error {
+	if err := ll.AllThreadsPrctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+	return nil
+}
+
+// buildWriteDenySet returns the resolved paths of the literal write deny rules
+func buildWriteDenySet(rules []ResolvedRule) map[string]bool {
+	writeDenySet := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Action == ActionDeny && rule.Mode&AccessWrite != 0 && !rule.IsGlob && !rule.FileLevel {
+			writeDenySet[resolveRulePath(absRulePath(rule.Path))] = true
 		}
-		// Check if path is under a denied directory
-		for denied := range writeDenySet {
-			if strings.HasPrefix(path, denied+"/") {
-				return true
-			}
+	}
+	return writeDenySet
+}
+
+// writeAllowDenied reports whether a write allow is overridden by a deny rule
+// An allow nested inside a denied directory is a write carve-out: the more specific
+// path wins, as on macOS, so only a deny of the very same path overrides it
+func writeAllowDenied(absPath string, writeDenySet map[string]bool) bool {
+	return writeDenySet[absPath]
+}
+
+// absRulePath makes a rule path absolute before it is handed to Landlock
+func absRulePath(path string) string {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return absPath
+}
+
+// expandGlob resolves a glob pattern against the filesystem; Landlock only takes
+// literal paths, so a glob covers what matches at launch. "**" matches like "*"
+// (a single path element), as filepath.Glob has no recursive wildcard.
+func expandGlob(pattern string) ([]string, error) {
+	return filepath.Glob(strings.ReplaceAll(pattern, "**", "*"))
+}
+
+// resolveRulePath returns the real location of path with symlinks resolved, as
+// Landlock ties a rule to the inode it finds; missing paths are kept as they are
+func resolveRulePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// rulePaths returns the absolute, symlink-resolved paths an allow rule applies to:
+// its path, or for a glob the paths it matches now; warn reports globs that match nothing
+func rulePaths(rule ResolvedRule, warn bool) []string {
+	absPath := absRulePath(rule.Path)
+	if !rule.IsGlob {
+		return []string{resolveRulePath(absPath)}
+	}
+	matches, err := expandGlob(absPath)
+	if err != nil {
+		if warn {
+			logger.Warnf("invalid glob pattern %q: %v", rule.Path, err)
 		}
-		return false
+		return nil
+	}
+	if len(matches) == 0 && warn {
+		logger.Warnf("glob pattern %q matches nothing; it grants no access", rule.Path)
+	}
+	for i, match := range matches {
+		matches[i] = resolveRulePath(match)
 	}
+	return matches
+}
 
-	for _, rule := range config.WriteRules {
-		if rule.Action == ActionAllow {
-			absPath, err := filepath.Abs(rule.Path)
-			if err != nil {
-				absPath = rule.Path
-			}
+// enclosingWriteAllow returns a write allow directory that contains path
+func enclosingWriteAllow(path string, rules []ResolvedRule) (string, bool) {
+	for _, rule := range rules {
+		if rule.Action == ActionAllow && !rule.IsGlob && !rule.IsFile && pathContains(rule.Path, path) {
+			return rule.Path, true
+		}
+	}
+	return "", false
+}
 
-			if shouldDenyWrite(absPath) {
-				fmt.Fprintf(os.Stderr,
-					"cage: info: skipping write allow for %s (matches deny rule)\n",
-					rule.Path,
-				)
-				continue
-			}
+// landlockTargetABI is the Landlock ABI version cage asks for (landlock.V5)
+const landlockTargetABI = 5
 
-			info, err := os.Stat(absPath)
-			if err != nil {
-				continue
-			}
+// checkLandlockABI returns the ABI version that will actually be enforced given the
+// kernel's version, and an error if it is below the required version
+// BestEffort silently downgrades to what the kernel supports, so this is the only guard
+func checkLandlockABI(kernelABI, required int) (int, error) {
+	effective := min(kernelABI, landlockTargetABI)
+	if effective < 0 {
+		effective = 0
+	}
+	if required > 0 && effective < required {
+		return effective, fmt.Errorf(
+			"kernel enforces Landlock ABI v%d, but --require-landlock-abi %d was requested",
+			effective, required,
+		)
+	}
+	return effective, nil
+}
 
-			if info.IsDir() {
-				if absPath == "/dev" || strings.HasPrefix(absPath, "/dev/") {
-					rules = append(rules, landlock.RWDirs(absPath).WithIoctlDev())
-					continue
-				}
-				rules = append(rules, landlock.RWDirs(absPath).WithRefer())
-			} else {
-				if strings.HasPrefix(absPath, "/dev/") {
-					rules = append(rules, landlock.RWFiles(absPath).WithIoctlDev())
-					continue
-				}
-				rules = append(rules, landlock.RWFiles(absPath))
-			}
+// landlockGrant is a Landlock rule: the access rights granted on a path and,
+// for a directory, everything beneath it. go-landlock's rules cannot be
+// inspected, so cage keeps its own to check traced accesses against them
+type landlockGrant struct {
+	path   string
+	access landlock.AccessFSSet
+}
+
+// The access rights of go-landlock's RODirs, ROFiles, RWDirs and RWFiles
+const (
+	accessReadDirs  = landlock.AccessFSSet(ll.AccessFSExecute | ll.AccessFSReadFile | ll.AccessFSReadDir)
+	accessReadFiles = landlock.AccessFSSet(ll.AccessFSExecute | ll.AccessFSReadFile)
+	accessRWFiles   = accessReadFiles | landlock.AccessFSSet(ll.AccessFSWriteFile|ll.AccessFSTruncate)
+	accessRWDirs    = accessReadDirs | landlock.AccessFSSet(ll.AccessFSWriteFile|ll.AccessFSTruncate|
+		ll.AccessFSRemoveDir|ll.AccessFSRemoveFile|ll.AccessFSMakeChar|ll.AccessFSMakeDir|ll.AccessFSMakeReg|
+		ll.AccessFSMakeSock|ll.AccessFSMakeFifo|ll.AccessFSMakeBlock|ll.AccessFSMakeSym)
+)
+
+// rule returns the go-landlock rule that enforces the grant
+func (g landlockGrant) rule() landlock.Rule {
+	return landlock.PathAccess(g.access, g.path)
+}
+
+func (g landlockGrant) String() string {
+	return landlock.PathAccess(g.access, g.path).String()
+}
+
+// covers reports whether the grant applies to path
+func (g landlockGrant) covers(path string) bool {
+	return g.path == path || g.path == "/" || pathContains(g.path, path)
+}
+
+// readGrant returns read access to an existing file or directory
+func readGrant(absPath string) (landlockGrant, bool) {
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return landlockGrant{}, false
+	}
+	if info.IsDir() {
+		return landlockGrant{absPath, accessReadDirs}, true
+	}
+	return landlockGrant{absPath, accessReadFiles}, true
+}
+
+// allowDirRule returns the Landlock rule for a write-allowed directory
+// RWDirs includes execute, so binaries built inside the directory can be run in place
+// refer permits renaming and linking files across the directory's boundary, which
+// some tools need (e.g. atomic saves via a temp dir) but also lets files be moved out
+func allowDirRule(absPath string, refer bool) landlockGrant {
+	if refer {
+		return landlockGrant{absPath, accessRWDirs | ll.AccessFSRefer}
+	}
+	return landlockGrant{absPath, accessRWDirs}
+}
+
+// appendRule returns the Landlock rule for an --allow-append path: creating
+// regular files and writing to them, without removing, renaming or truncating
+// files (truncation is only restricted from Landlock ABI v3)
+func appendRule(absPath string, isDir bool) landlockGrant {
+	if !isDir {
+		return landlockGrant{absPath, ll.AccessFSWriteFile}
+	}
+	return landlockGrant{absPath, ll.AccessFSMakeReg | ll.AccessFSWriteFile}
+}
+
+// ttyRules returns read, write and ioctl access to the existing terminal devices
+func ttyRules(devices []string) []landlockGrant {
+	var grants []landlockGrant
+	for _, tty := range devices {
+		if _, err := os.Stat(tty); err == nil {
+			grants = append(grants, landlockGrant{tty, accessRWFiles | ll.AccessFSIoctlDev})
+		}
+	}
+	return grants
+}
+
+// connectRules returns the rules for --allow-connect sockets. Landlock does not
+// mediate connect(2) on pathname Unix sockets, so the only access granted is
+// LANDLOCK_ACCESS_FS_READ_FILE on the socket itself, which keeps it reachable
+// in strict mode. It never gets WRITE_FILE, MAKE_SOCK or REMOVE_FILE, so the
+// command can neither replace the socket nor create one next to it. Landlock
+// needs the socket to exist at launch; missing ones are skipped with a warning.
+func connectRules(sockets []string) []landlockGrant {
+	var grants []landlockGrant
+	for _, socket := range sockets {
+		if _, err := os.Stat(socket); err != nil {
+			logger.Warnf("--allow-connect: %s does not exist; it must exist when cage starts on Linux", socket)
+			continue
+		}
+		grants = append(grants, landlockGrant{socket, ll.AccessFSReadFile})
+	}
+	return grants
+}
+
+// devPseudoFilesystems are directories under /dev that hold ordinary files
+// rather than devices, so they get no ioctl access
+var devPseudoFilesystems = []string{"/dev/shm", "/dev/mqueue", "/dev/hugepages"}
+
+// inDevPseudoFilesystem reports whether absPath is or is below one of devPseudoFilesystems
+func inDevPseudoFilesystem(absPath string) bool {
+	for _, dir := range devPseudoFilesystems {
+		if absPath == dir || pathContains(dir, absPath) {
+			return true
 		}
 	}
+	return false
+}
 
-	err := landlock.V5.BestEffort().RestrictPaths(rules...)
+// isDeviceDir reports whether a write-allowed directory needs ioctl access for
+// devices: /dev itself, or a directory holding character or block devices
+// (e.g. /dev/pts), but not a pseudo-filesystem such as /dev/shm
+func isDeviceDir(absPath string) bool {
+	if absPath == "/dev" {
+		return true
+	}
+	if inDevPseudoFilesystem(absPath) {
+		return false
+	}
+	entries, err := os.ReadDir(absPath)
 	if err != nil {
-		return fmt.Errorf("failed to apply Landlock restrictions: %w", err)
+		return false
+	}
+	for _, entry := range entries {
+		if entry.Type()&os.ModeDevice != 0 {
+			return true
+		}
 	}
+	return false
+}
 
-	path, err := exec.LookPath(config.Command)
+// allowFileRule returns the Landlock rule for a write-allowed file that exists
+// Devices also get ioctl access. Named pipes and sockets are only opened for
+// reading and writing, so they get just those rights: truncate and execute do
+// not apply to them
+func allowFileRule(absPath string, mode os.FileMode) landlockGrant {
+	switch {
+	case mode&os.ModeDevice != 0, strings.HasPrefix(absPath, "/dev/") && !inDevPseudoFilesystem(absPath):
+		return landlockGrant{absPath, accessRWFiles | ll.AccessFSIoctlDev}
+	case mode&(os.ModeNamedPipe|os.ModeSocket) != 0:
+		return landlockGrant{absPath, ll.AccessFSReadFile | ll.AccessFSWriteFile}
+	}
+	return landlockGrant{absPath, accessRWFiles}
+}
+
+// outputFileRule returns the Landlock rule for writing a single output file
+// Landlock can only grant creation on a whole directory tree, so a missing file is
+// created empty before the restrictions apply and then granted like an existing one
+func outputFileRule(absPath string) (landlockGrant, error) {
+	info, err := os.Stat(absPath)
+	if os.IsNotExist(err) {
+		var file *os.File
+		if file, err = os.OpenFile(absPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666); err == nil {
+			file.Close()
+			info, err = os.Stat(absPath)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("command not found: %w", err)
+		return landlockGrant{}, fmt.Errorf("create output file: %w", err)
 	}
+	return allowFileRule(absPath, info.Mode()), nil
+}
 
-	argv := append([]string{config.Command}, config.Args...)
-	err = syscall.Exec(path, argv, os.Environ())
-	return fmt.Errorf("syscall.Exec failed: %w", err)
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	_, err := unix.IoctlGetTermios(int(f.Fd()), unix.TCGETS)
+	return err == nil
 }
@@ -0,0 +1,603 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestOutputFileRule_ExistingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "out.log")
+	if err := os.WriteFile(file, []byte("kept"), 0o644); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	rule, err := outputFileRule(file)
+	if err != nil {
+		t.Fatalf("outputFileRule() error = %v", err)
+	}
+	if !strings.Contains(rule.String(), "["+file+"]") {
+		t.Errorf("expected rule for existing file %s, got %s", file, rule)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "kept" {
+		t.Errorf("existing output file was changed to %q", data)
+	}
+}
+
+func TestOutputFileRule_CreatesMissingFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "new.log")
+
+	rule, err := outputFileRule(file)
+	if err != nil {
+		t.Fatalf("outputFileRule() error = %v", err)
+	}
+	if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() || info.Size() != 0 {
+		t.Errorf("expected an empty output file to be created, got %v, %v", info, err)
+	}
+	ruleStr := rule.String()
+	if !strings.Contains(ruleStr, "["+file+"]") {
+		t.Errorf("expected rule on the file itself, got %s", ruleStr)
+	}
+	if strings.Contains(ruleStr, "make_reg") || strings.Contains(ruleStr, "["+tmpDir+"]") {
+		t.Errorf("parent directory should get no access, got %s", ruleStr)
+	}
+
+	if _, err := outputFileRule(filepath.Join(tmpDir, "missing", "new.log")); err == nil {
+		t.Error("expected an error when the parent directory does not exist")
+	}
+}
+
+// TestStartInSandbox_OutputFileKeepsSiblingsReadOnly restricts the test process,
+// so it re-runs in a child test binary; the parent owns the directory
+func TestStartInSandbox_OutputFileKeepsSiblingsReadOnly(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := os.Getenv("CAGE_TEST_OUTPUT_DIR")
+	if dir == "" {
+		dir = t.TempDir()
+		if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"sibling", filepath.Join("sub", "nested")} {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte("original"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cmd := exec.Command(os.Args[0], "-test.run=^TestStartInSandbox_OutputFileKeepsSiblingsReadOnly$")
+		cmd.Env = append(os.Environ(), "CAGE_TEST_OUTPUT_DIR="+dir)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("child test failed: %v\n%s", err, out)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, "new.log")); string(data) != "written\n" {
+			t.Errorf("output file = %q, want the command's output", data)
+		}
+		for _, name := range []string{"sibling", filepath.Join("sub", "nested")} {
+			if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != "original" {
+				t.Errorf("%s = %q, want it left read-only", name, data)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "created")); err == nil {
+			t.Error("the command could create a file next to the output file")
+		}
+		return
+	}
+
+	output := filepath.Join(dir, "new.log")
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{{Path: output, Action: ActionAllow, Mode: AccessWrite, IsFile: true}},
+		Command:    "sh",
+		Args: []string{"-c", "echo written > " + output + "; " +
+			"echo hacked > " + filepath.Join(dir, "sibling") + "; " +
+			"echo hacked > " + filepath.Join(dir, "sub", "nested") + "; " +
+			"echo hacked > " + filepath.Join(dir, "created") + "; true"},
+	}
+	cmd, err := StartInSandbox(config)
+	if err != nil {
+		t.Fatalf("StartInSandbox() error = %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+}
+
+func TestAllowFileRule_FIFO(t *testing.T) {
+	fifo := filepath.Join(t.TempDir(), "pipe")
+	if err := unix.Mkfifo(fifo, 0o600); err != nil {
+		t.Fatalf("failed to create fifo: %v", err)
+	}
+	info, err := os.Stat(fifo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ruleStr := allowFileRule(fifo, info.Mode()).String()
+	if !strings.Contains(ruleStr, "["+fifo+"]") {
+		t.Fatalf("expected a rule for the fifo %s, got %s", fifo, ruleStr)
+	}
+	if !strings.Contains(ruleStr, "read_file") || !strings.Contains(ruleStr, "write_file") {
+		t.Errorf("expected read and write access to the fifo, got %s", ruleStr)
+	}
+	if strings.Contains(ruleStr, "execute") || strings.Contains(ruleStr, "truncate") {
+		t.Errorf("a fifo needs no execute or truncate access, got %s", ruleStr)
+	}
+
+	// --allow-output of an existing fifo grants the fifo itself, not its parent
+	rule, err := outputFileRule(fifo)
+	if err != nil {
+		t.Fatalf("outputFileRule() error = %v", err)
+	}
+	if ruleStr := rule.String(); ruleStr != allowFileRule(fifo, info.Mode()).String() {
+		t.Errorf("outputFileRule() = %s, want the fifo rule", ruleStr)
+	}
+}
+
+func TestIsDeviceDir(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/dev", true},
+		{"/dev/shm", false},
+		{"/dev/shm/app", false},
+		{"/dev/mqueue", false},
+		{t.TempDir(), false},
+	}
+	for _, tt := range tests {
+		if got := isDeviceDir(tt.path); got != tt.want {
+			t.Errorf("isDeviceDir(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	// A directory is a device directory when it holds devices, wherever it is
+	if entries, err := os.ReadDir("/dev/pts"); err == nil && len(entries) > 0 && !isDeviceDir("/dev/pts") {
+		t.Error("isDeviceDir(/dev/pts) = false, want true")
+	}
+}
+
+func TestAllowFileRule_Ioctl(t *testing.T) {
+	info, err := os.Stat("/dev/null")
+	if err != nil {
+		t.Skipf("no /dev/null: %v", err)
+	}
+	if ruleStr := allowFileRule("/dev/null", info.Mode()).String(); !strings.Contains(ruleStr, "ioctl_dev") {
+		t.Errorf("expected ioctl access to a device, got %s", ruleStr)
+	}
+
+	// Shared memory objects are ordinary files
+	if ruleStr := allowFileRule("/dev/shm/segment", 0o600).String(); strings.Contains(ruleStr, "ioctl_dev") {
+		t.Errorf("expected no ioctl access below /dev/shm, got %s", ruleStr)
+	}
+	if ruleStr := allowFileRule("/tmp/data", 0o600).String(); strings.Contains(ruleStr, "ioctl_dev") {
+		t.Errorf("expected no ioctl access to a regular file, got %s", ruleStr)
+	}
+}
+
+func TestTTYRules(t *testing.T) {
+	if _, err := os.Stat("/dev/tty"); err != nil {
+		t.Skipf("no /dev/tty: %v", err)
+	}
+	rules := ttyRules([]string{"/dev/tty", "/dev/does-not-exist"})
+	if len(rules) != 1 {
+		t.Fatalf("expected a rule for the existing device only, got %v", rules)
+	}
+	ruleStr := fmt.Sprint(rules[0])
+	for _, want := range []string{"[/dev/tty]", "read_file", "write_file", "ioctl_dev"} {
+		if !strings.Contains(ruleStr, want) {
+			t.Errorf("expected %s in the terminal rule, got %s", want, ruleStr)
+		}
+	}
+}
+
+func TestConnectRules(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "s.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("cannot create a Unix socket: %v", err)
+	}
+	defer listener.Close()
+
+	rules := connectRules([]string{socket, filepath.Join(dir, "missing.sock")})
+	if len(rules) != 1 {
+		t.Fatalf("expected a rule for the existing socket only, got %v", rules)
+	}
+	ruleStr := fmt.Sprint(rules[0])
+	if !strings.Contains(ruleStr, socket) || !strings.Contains(ruleStr, "read_file") {
+		t.Errorf("expected read_file on %s, got %s", socket, ruleStr)
+	}
+	for _, denied := range []string{"write_file", "make_sock", "remove_file", "truncate"} {
+		if strings.Contains(ruleStr, denied) {
+			t.Errorf("socket rule must not get %s, got %s", denied, ruleStr)
+		}
+	}
+}
+
+func TestAppendRule(t *testing.T) {
+	dirRule := appendRule("/var/log/app", true).String()
+	if !strings.Contains(dirRule, "make_reg") || !strings.Contains(dirRule, "write_file") {
+		t.Errorf("expected creating and writing files, got %s", dirRule)
+	}
+	for _, denied := range []string{"remove_file", "remove_dir", "truncate", "refer", "make_dir"} {
+		if strings.Contains(dirRule, denied) {
+			t.Errorf("append-only directory must not get %s, got %s", denied, dirRule)
+		}
+	}
+
+	fileRule := appendRule("/var/log/app.log", false).String()
+	if !strings.Contains(fileRule, "write_file") || strings.Contains(fileRule, "make_reg") || strings.Contains(fileRule, "truncate") {
+		t.Errorf("expected only write access to an append-only file, got %s", fileRule)
+	}
+}
+
+func TestCheckLandlockABI(t *testing.T) {
+	tests := []struct {
+		name          string
+		kernelABI     int
+		required      int
+		wantEffective int
+		wantErr       bool
+	}{
+		{"no requirement", 3, 0, 3, false},
+		{"kernel newer than target is capped", 7, 0, landlockTargetABI, false},
+		{"requirement met", 5, 4, 5, false},
+		{"requirement not met", 2, 4, 2, true},
+		{"landlock unavailable", -1, 1, 0, true},
+		{"landlock unavailable without requirement", 0, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			effective, err := checkLandlockABI(tt.kernelABI, tt.required)
+			if effective != tt.wantEffective {
+				t.Errorf("effective = %d, want %d", effective, tt.wantEffective)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllowDirRule_Refer(t *testing.T) {
+	withRefer := allowDirRule("/work", true).String()
+	if !strings.Contains(withRefer, "refer") {
+		t.Errorf("expected refer access by default, got %s", withRefer)
+	}
+	if !strings.Contains(withRefer, "write_file") || !strings.Contains(withRefer, "make_reg") {
+		t.Errorf("expected read-write access, got %s", withRefer)
+	}
+	if !strings.Contains(withRefer, "execute") {
+		t.Errorf("expected binaries built in the directory to be executable, got %s", withRefer)
+	}
+
+	withoutRefer := allowDirRule("/work", false).String()
+	if strings.Contains(withoutRefer, "refer") {
+		t.Errorf("expected no refer access, got %s", withoutRefer)
+	}
+	if !strings.Contains(withoutRefer, "write_file") || !strings.Contains(withoutRefer, "make_reg") {
+		t.Errorf("expected read-write access without refer, got %s", withoutRefer)
+	}
+	if !strings.Contains(withoutRefer, "execute") {
+		t.Errorf("expected execute access without refer, got %s", withoutRefer)
+	}
+}
+
+func TestRunInSandboxRejectsProfileFile(t *testing.T) {
+	config := &SandboxConfig{
+		ProfileFile: "custom.sb",
+		Command:     "true",
+	}
+	if err := runInSandbox(config); !errors.Is(err, errProfileFileUnsupported) {
+		t.Errorf("runInSandbox() error = %v, want %v", err, errProfileFileUnsupported)
+	}
+	if err := showDryRun(config); !errors.Is(err, errProfileFileUnsupported) {
+		t.Errorf("showDryRun() error = %v, want %v", err, errProfileFileUnsupported)
+	}
+}
+
+func TestWriteAllowDenied(t *testing.T) {
+	denySet := map[string]bool{"/home/test": true}
+
+	if writeAllowDenied("/home/test/project", denySet) {
+		t.Error("an allow nested inside a denied directory is a write carve-out and should be kept")
+	}
+	if !writeAllowDenied("/home/test", denySet) {
+		t.Error("an allow of the denied path itself should be overridden")
+	}
+	if writeAllowDenied("/tmp", denySet) {
+		t.Error("an allow outside the denied directory should be kept")
+	}
+}
+
+func TestRulePathsExpandsGlobAllows(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/scratch", "b/scratch", "c/other"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		rule ResolvedRule
+		want []string
+	}{
+		{
+			name: "glob matches each directory",
+			rule: ResolvedRule{Path: filepath.Join(root, "*", "scratch"), Action: ActionAllow, IsGlob: true},
+			want: []string{filepath.Join(root, "a", "scratch"), filepath.Join(root, "b", "scratch")},
+		},
+		{
+			name: "double star matches one element",
+			rule: ResolvedRule{Path: filepath.Join(root, "**", "other"), Action: ActionAllow, IsGlob: true},
+			want: []string{filepath.Join(root, "c", "other")},
+		},
+		{
+			name: "glob matching nothing",
+			rule: ResolvedRule{Path: filepath.Join(root, "*", "missing"), Action: ActionAllow, IsGlob: true},
+			want: nil,
+		},
+		{
+			name: "literal path is kept even if missing",
+			rule: ResolvedRule{Path: filepath.Join(root, "missing"), Action: ActionAllow},
+			want: []string{filepath.Join(root, "missing")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rulePaths(tt.rule, false)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("rulePaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulePathsWarnsWhenGlobMatchesNothing(t *testing.T) {
+	var stderr strings.Builder
+	saved := logger
+	logger = &Logger{stderr: &stderr, level: LogInfo}
+	defer func() { logger = saved }()
+
+	rulePaths(ResolvedRule{Path: filepath.Join(t.TempDir(), "*"), Action: ActionAllow, IsGlob: true}, true)
+	if !strings.Contains(stderr.String(), "matches nothing") {
+		t.Errorf("expected a warning for a glob matching nothing, got %q", stderr.String())
+	}
+}
+
+func TestRulePathsResolvesSymlinkedAllow(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(root, "target")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(root, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	got := rulePaths(ResolvedRule{Path: link, Action: ActionAllow}, false)
+	if len(got) != 1 || got[0] != target {
+		t.Errorf("rulePaths() = %v, want [%s]", got, target)
+	}
+
+	// A deny on the target overrides an allow given through the symlink
+	denySet := buildWriteDenySet([]ResolvedRule{{Path: target, Mode: AccessWrite, Action: ActionDeny}})
+	if !writeAllowDenied(got[0], denySet) {
+		t.Error("a deny of the symlink target should override the symlinked allow")
+	}
+}
+
+func TestShowDryRunSummaryOnly(t *testing.T) {
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{
+			{Path: "/work/project", Action: ActionAllow, Mode: AccessWrite, Source: RuleSource{Origin: OriginCLI}},
+		},
+		Command: "test",
+	}
+
+	capture := func() string {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		oldStdout := os.Stdout
+		os.Stdout = w
+		err = showDryRun(config)
+		w.Close()
+		os.Stdout = oldStdout
+		if err != nil {
+			t.Fatalf("showDryRun failed: %v", err)
+		}
+		output, _ := io.ReadAll(r)
+		return string(output)
+	}
+
+	if output := capture(); !strings.Contains(output, "Landlock ABI") {
+		t.Errorf("the full dry-run should show the Landlock details, got:\n%s", output)
+	}
+	config.SummaryOnly = true
+	output := capture()
+	if strings.Contains(output, "Landlock ABI") || strings.Contains(output, "Technology:") {
+		t.Errorf("--summary-only should omit the Landlock details, got:\n%s", output)
+	}
+	if !strings.Contains(output, "/work/project") {
+		t.Errorf("--summary-only should keep the rule summary, got:\n%s", output)
+	}
+}
+
+// TestStartInSandbox_NoNewPrivs sets no_new_privs and restricts the test process,
+// which cannot be undone, so it re-runs in a child test binary; the parent owns
+// the directory the child writes to, as the child cannot remove it
+func TestStartInSandbox_NoNewPrivs(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	dir := os.Getenv("CAGE_TEST_NNP_DIR")
+	if dir == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestStartInSandbox_NoNewPrivs$")
+		cmd.Env = append(os.Environ(), "CAGE_TEST_NNP_DIR="+t.TempDir())
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("child test failed: %v\n%s", err, out)
+		}
+		return
+	}
+
+	output := filepath.Join(dir, "status")
+	config := &SandboxConfig{
+		WriteRules: []ResolvedRule{{Path: dir, Action: ActionAllow, Mode: AccessWrite}},
+		Command:    "sh",
+		Args:       []string{"-c", "grep NoNewPrivs /proc/self/status > " + output},
+	}
+	cmd, err := StartInSandbox(config)
+	if err != nil {
+		t.Fatalf("StartInSandbox() error = %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	out, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fields := strings.Fields(string(out)); len(fields) != 2 || fields[1] != "1" {
+		t.Errorf("command status = %q, want NoNewPrivs: 1", out)
+	}
+	if set, err := unix.PrctlRetInt(unix.PR_GET_NO_NEW_PRIVS, 0, 0, 0, 0); err != nil || set != 1 {
+		t.Errorf("PR_GET_NO_NEW_PRIVS = %d, %v; want 1", set, err)
+	}
+}
+
+func TestTerminalDevicesOnPTY(t *testing.T) {
+	_, term, pts := openPTY(t)
+
+	stdin := os.Stdin
+	os.Stdin = term
+	defer func() { os.Stdin = stdin }()
+
+	// Only the caller's own terminal and /dev/ptmx, not all of /dev/pts
+	devices := terminalDevices()
+	for _, want := range []string{"/dev/tty", pts, "/dev/ptmx"} {
+		if !slices.Contains(devices, want) {
+			t.Errorf("terminalDevices() = %v, missing %s", devices, want)
+		}
+	}
+	if slices.Contains(devices, "/dev/pts") {
+		t.Errorf("terminalDevices() = %v, should not grant all of /dev/pts", devices)
+	}
+}
+
+// openPTY opens a new pseudo-terminal, without making it the controlling terminal,
+// and returns its master, its terminal and the terminal's path
+func openPTY(t *testing.T) (ptmx, term *os.File, pts string) {
+	t.Helper()
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+	t.Cleanup(func() { ptmx.Close() })
+	if err := unix.IoctlSetPointerInt(int(ptmx.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatalf("unlock pty: %v", err)
+	}
+	n, err := unix.IoctlGetInt(int(ptmx.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		t.Fatalf("get pty number: %v", err)
+	}
+	pts = fmt.Sprintf("/dev/pts/%d", n)
+	term, err = os.OpenFile(pts, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("open %s: %v", pts, err)
+	}
+	t.Cleanup(func() { term.Close() })
+	return ptmx, term, pts
+}
+
+// TestStartInSandbox_StrictClosesFDs restricts the test process, so it re-runs in
+// a child test binary; the parent owns the directory the child writes to
+func TestStartInSandbox_StrictClosesFDs(t *testing.T) {
+	testStrictInheritedFD(t, "TestStartInSandbox_StrictClosesFDs", false, "closed\n")
+}
+
+// TestStartInSandbox_StrictKeepFDs checks that --keep-fds reaches a started
+// command, which only gets the descriptors it is handed
+func TestStartInSandbox_StrictKeepFDs(t *testing.T) {
+	testStrictInheritedFD(t, "TestStartInSandbox_StrictKeepFDs", true, "open\n")
+}
+
+// testStrictInheritedFD starts a command in strict mode, with KeepFDs set to keep,
+// and checks whether a descriptor inherited without close-on-exec is open in it
+// The named test runs again in a child test binary, which does the restricting
+func testStrictInheritedFD(t *testing.T, name string, keep bool, want string) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	dir := os.Getenv("CAGE_TEST_STRICT_FDS_DIR")
+	if dir == "" {
+		dir = t.TempDir()
+		cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+		cmd.Env = append(os.Environ(), "CAGE_TEST_STRICT_FDS_DIR="+dir)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("child test failed: %v\n%s", err, out)
+		}
+		if data, _ := os.ReadFile(filepath.Join(dir, "fd")); string(data) != want {
+			t.Errorf("inherited descriptor in the command: %q, want %q", data, want)
+		}
+		return
+	}
+
+	// An inherited descriptor without close-on-exec
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if _, err := unix.FcntlInt(w.Fd(), unix.F_SETFD, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var readRules []ResolvedRule
+	for _, path := range []string{"/usr", "/lib", "/lib64", "/bin", "/etc", filepath.Dir(sh)} {
+		if _, err := os.Stat(path); err == nil {
+			readRules = append(readRules, ResolvedRule{Path: path, Action: ActionAllow, Mode: AccessRead})
+		}
+	}
+	output := filepath.Join(dir, "fd")
+	config := &SandboxConfig{
+		Strict:     true,
+		KeepFDs:    keep,
+		ReadRules:  readRules,
+		WriteRules: []ResolvedRule{{Path: dir, Action: ActionAllow, Mode: AccessWrite}},
+		Command:    "sh",
+		Args:       []string{"-c", fmt.Sprintf("if (: >&%d) 2>/dev/null; then echo open; else echo closed; fi > %s", w.Fd(), output)},
+	}
+	cmd, err := StartInSandbox(config)
+	if err != nil {
+		t.Fatalf("StartInSandbox() error = %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+}
@@ -4,6 +4,8 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
 	"runtime"
 )
 
@@ -11,3 +13,13 @@ import (
 func runInSandbox(config *SandboxConfig) error {
 	return fmt.Errorf("sandboxing is not yet implemented for %s", runtime.GOOS)
 }
+
+// startInSandbox is not implemented for platforms other than Darwin and Linux
+func startInSandbox(config *SandboxConfig) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("sandboxing is not yet implemented for %s", runtime.GOOS)
+}
+
+// isTerminal reports whether the file is a terminal; always false on unsupported platforms
+func isTerminal(f *os.File) bool {
+	return false
+}
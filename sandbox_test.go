@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSymlinkTarget(t *testing.T) {
+	tmpDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatalf("EvalSymlinks failed: %v", err)
+	}
+	target := filepath.Join(tmpDir, "target")
+	link := filepath.Join(tmpDir, "link")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatalf("failed to create target: %v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	if got, ok := symlinkTarget(link); !ok || got != target {
+		t.Errorf("symlinkTarget(link) = %q, %v; want %q, true", got, ok, target)
+	}
+	if _, ok := symlinkTarget(target); ok {
+		t.Error("symlinkTarget should report false for a path that is not a symlink")
+	}
+	if _, ok := symlinkTarget(filepath.Join(tmpDir, "missing")); ok {
+		t.Error("symlinkTarget should report false for a missing path")
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	base := []string{"PATH=/usr/bin", "HOME=/home/test", "GIT_CONFIG_NOSYSTEM=0"}
+
+	if got := commandEnv(base, nil); !reflect.DeepEqual(got, base) {
+		t.Errorf("commandEnv() without overrides = %v, want %v", got, base)
+	}
+
+	got := commandEnv(base, map[string]string{
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"CARGO_HOME":          "/home/test/.cargo",
+	})
+	want := []string{
+		"PATH=/usr/bin",
+		"HOME=/home/test",
+		"CARGO_HOME=/home/test/.cargo",
+		"GIT_CONFIG_NOSYSTEM=1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("commandEnv() = %v, want %v", got, want)
+	}
+}
+
+func TestAccessModeString(t *testing.T) {
+	tests := []struct {
+		mode AccessMode
+		want string
+	}{
+		{AccessRead, "read"},
+		{AccessWrite, "write"},
+		{AccessReadWrite, "read+write"},
+		{AccessMode(0), "AccessMode(0)"},
+		{AccessMode(8), "AccessMode(8)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.mode.String(); got != tt.want {
+				t.Errorf("AccessMode(%d).String() = %q, want %q", uint8(tt.mode), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccessModeJSON(t *testing.T) {
+	for _, mode := range []AccessMode{AccessRead, AccessWrite, AccessReadWrite} {
+		data, err := json.Marshal(mode)
+		if err != nil {
+			t.Fatalf("json.Marshal(%v) error = %v", mode, err)
+		}
+		if want := `"` + mode.String() + `"`; string(data) != want {
+			t.Errorf("json.Marshal(%v) = %s, want %s", mode, data, want)
+		}
+		var got AccessMode
+		if err := json.Unmarshal(data, &got); err != nil || got != mode {
+			t.Errorf("json.Unmarshal(%s) = %v, %v; want %v", data, got, err, mode)
+		}
+	}
+
+	if _, err := json.Marshal(AccessMode(0)); err == nil {
+		t.Error("json.Marshal should reject an invalid mode")
+	}
+	var mode AccessMode
+	if err := json.Unmarshal([]byte(`"execute"`), &mode); err == nil {
+		t.Error("json.Unmarshal should reject an unknown mode")
+	}
+	if err := json.Unmarshal([]byte(`2`), &mode); err == nil {
+		t.Error("json.Unmarshal should reject a numeric mode")
+	}
+}
+
+func TestParseSeatbeltParams(t *testing.T) {
+	params, err := parseSeatbeltParams([]string{"HOME_DIR=/Users/me", "EMPTY=", "EXPR=a=b"})
+	if err != nil {
+		t.Fatalf("parseSeatbeltParams() error = %v", err)
+	}
+	if !reflect.DeepEqual(params, []string{"HOME_DIR=/Users/me", "EMPTY=", "EXPR=a=b"}) {
+		t.Errorf("parseSeatbeltParams() = %v", params)
+	}
+
+	for _, values := range [][]string{{"NOVALUE"}, {"=value"}, {"A=1", "A=2"}} {
+		if _, err := parseSeatbeltParams(values); err == nil {
+			t.Errorf("parseSeatbeltParams(%q) should fail", values)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// ProfileFinding is a likely mistake in a generated SBPL profile (--profile-lint)
+type ProfileFinding struct {
+	Line    int
+	Message string
+}
+
+// sbplRuleLine matches a one-line allow or deny rule: the action, the operations
+// and the filters
+var sbplRuleLine = regexp.MustCompile(`^\((allow|deny) ([a-z*-]+(?: [a-z*-]+)*) (.*)\)$`)
+
+// sbplFilter matches one (subpath "..."), (literal "...") or (regex #"...") filter
+var sbplFilter = regexp.MustCompile(`\((subpath|literal|regex) #?"((?:[^"\\]|\\.)*)"\)`)
+
+// sbplStringFilter matches any filter with a string argument, e.g. (global-name "...")
+var sbplStringFilter = regexp.MustCompile(`\([a-z-]+ #?"(?:[^"\\]|\\.)*"\)`)
+
+// lintSandboxProfile looks for logical mistakes in a profile that sandbox-exec
+// would still accept: subpath denies that a later allow for the same operation
+// overrides entirely (the last matching rule wins), path strings with escapes
+// escapePathForSandbox does not produce or lines broken by an unescaped newline,
+// and regexes that match "/" and so the whole filesystem
+func lintSandboxProfile(profile string) []ProfileFinding {
+	var findings []ProfileFinding
+	type subpathDeny struct {
+		line      int
+		operation string
+		path      string
+	}
+	var denies []subpathDeny
+
+	for i, line := range strings.Split(profile, "\n") {
+		lineNo := i + 1
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if !strings.HasPrefix(line, "(") {
+			findings = append(findings, ProfileFinding{lineNo, "line is not an expression, a path may contain an unescaped newline"})
+			continue
+		}
+		m := sbplRuleLine.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		action, operation := m[1], m[2]
+		filters := sbplFilter.FindAllStringSubmatch(m[3], -1)
+		if rest := sbplStringFilter.ReplaceAllString(m[3], ""); strings.Contains(rest, `"`) {
+			findings = append(findings, ProfileFinding{lineNo, "unbalanced quote, a path may contain an unescaped \""})
+			continue
+		}
+
+		for _, filter := range filters {
+			kind, value := filter[1], filter[2]
+			if kind == "regex" {
+				if re, err := regexp.Compile(value); err == nil && re.MatchString("/") {
+					findings = append(findings, ProfileFinding{lineNo, fmt.Sprintf("regex %q matches / and so every path", value)})
+				}
+				continue
+			}
+			path, ok := unescapeSBPLString(value)
+			if !ok {
+				findings = append(findings, ProfileFinding{lineNo, fmt.Sprintf("path %q has an escape other than \\\\ or \\\"", value)})
+				continue
+			}
+			if kind != "subpath" {
+				continue
+			}
+			if action == "deny" {
+				denies = append(denies, subpathDeny{lineNo, operation, path})
+				continue
+			}
+			for _, deny := range denies {
+				if deny.operation == operation && (deny.path == path || pathContains(path, deny.path)) {
+					findings = append(findings, ProfileFinding{deny.line, fmt.Sprintf(
+						"%s deny on %s is overridden by the allow on %s at line %d", operation, deny.path, path, lineNo)})
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// unescapeSBPLString undoes escapePathForSandbox; ok is false for any other escape
+func unescapeSBPLString(value string) (string, bool) {
+	var result strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			result.WriteByte(value[i])
+			continue
+		}
+		if i+1 >= len(value) || (value[i+1] != '\\' && value[i+1] != '"') {
+			return "", false
+		}
+		i++
+		result.WriteByte(value[i])
+	}
+	return result.String(), true
+}
+
+// printProfileLint prints the --profile-lint section of the macOS dry-run
+func printProfileLint(w io.Writer, findings []ProfileFinding) {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "Profile lint: OK")
+		return
+	}
+	fmt.Fprintf(w, "Profile lint: %d warning(s)\n", len(findings))
+	for _, finding := range findings {
+		fmt.Fprintf(w, "  line %d: %s\n", finding.Line, finding.Message)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintSandboxProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		want    string // substring of the only finding, empty for none
+		line    int
+	}{
+		{
+			name: "clean profile",
+			profile: `(version 1)
+(allow default)
+; from preset: dev
+(deny file-write* (subpath "/Users/me/.ssh"))
+(allow file-write* (subpath "/Users/me/project"))
+(allow file-write* (regex #"^/Users/[^/]*/build($|/)"))
+(allow mach-lookup (global-name "com.apple.SecurityServer"))
+(allow file-write* (literal "/dev/ptmx") (literal "/dev/tty") (regex #"^/dev/ttys[0-9]+$"))`,
+		},
+		{
+			name: "deny overridden by a broader allow",
+			profile: `(deny file-read-data (subpath "/Users/me/secrets"))
+(allow file-write* (subpath "/Users/me"))
+(allow file-read-data (subpath "/Users/me"))`,
+			want: "overridden by the allow on /Users/me at line 3",
+			line: 1,
+		},
+		{
+			name: "deny overridden by an allow on the same path",
+			profile: `(deny file-write* (subpath "/data"))
+(allow file-write* (subpath "/data"))`,
+			want: "file-write* deny on /data",
+			line: 1,
+		},
+		{
+			name:    "stray escape",
+			profile: `(deny file-write* (subpath "/data/a\nb"))`,
+			want:    "escape other than",
+			line:    1,
+		},
+		{
+			name:    "unescaped quote",
+			profile: `(deny file-write* (subpath "/data/a"b"))`,
+			want:    "unbalanced quote",
+			line:    1,
+		},
+		{
+			name:    "unescaped newline",
+			profile: "(deny file-write* (subpath \"/data/a\nb\"))",
+			want:    "unescaped newline",
+			line:    2,
+		},
+		{
+			name:    "regex matching everything",
+			profile: `(deny file-read-data (regex #"^/.*($|/)"))`,
+			want:    "matches / and so every path",
+			line:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			findings := lintSandboxProfile(tt.profile)
+			if tt.want == "" {
+				if len(findings) != 0 {
+					t.Errorf("expected no findings, got %v", findings)
+				}
+				return
+			}
+			if len(findings) != 1 || !strings.Contains(findings[0].Message, tt.want) || findings[0].Line != tt.line {
+				t.Errorf("expected one finding on line %d containing %q, got %v", tt.line, tt.want, findings)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import "fmt"
+
+// Values of defaults.skip-defaults-scope
+const (
+	// skipScopeGlobal lets any preset in the run skip the default presets
+	skipScopeGlobal = "global"
+	// skipScopeExplicit only honors skip-defaults set by a preset named with
+	// --preset itself, not by an auto-detected preset or an extended base
+	skipScopeExplicit = "explicit"
+)
+
+// skipDefaultsScope returns the configured skip-defaults scope, global by default
+func skipDefaultsScope(defaults Defaults) (string, error) {
+	switch defaults.SkipScope {
+	case "":
+		return skipScopeGlobal, nil
+	case skipScopeGlobal, skipScopeExplicit:
+		return defaults.SkipScope, nil
+	}
+	return "", fmt.Errorf("defaults.skip-defaults-scope must be %s or %s, got %q",
+		skipScopeGlobal, skipScopeExplicit, defaults.SkipScope)
+}
+
+// skipDefaultsSource is a preset in the run that asks to skip the default presets
+type skipDefaultsSource struct {
+	Preset string     // preset in the run
+	SetBy  string     // preset in its extends chain that sets skip-defaults
+	Origin RuleOrigin // how Preset was selected
+}
+
+// explicit reports whether the preset was named with --preset and sets
+// skip-defaults itself
+func (s skipDefaultsSource) explicit() bool {
+	return s.Origin == OriginManualPreset && s.SetBy == s.Preset
+}
+
+// describe names the preset and, when it is not explicit, how it got skip-defaults
+func (s skipDefaultsSource) describe() string {
+	desc := "preset " + s.Preset
+	if s.Origin == OriginAutoPreset {
+		desc = "auto-detected " + desc
+	}
+	if s.SetBy != s.Preset {
+		desc += " (inherited from " + s.SetBy + ")"
+	}
+	return desc
+}
+
+// skipDefaultsSources returns the presets whose resolved preset sets
+// skip-defaults, in run order; origins maps presets not named with --preset to
+// how they were selected
+func skipDefaultsSources(config *Config, presets []string, origins map[string]RuleOrigin) []skipDefaultsSource {
+	var sources []skipDefaultsSource
+	for _, name := range presets {
+		resolved, err := config.ResolvePreset(name, nil)
+		if err != nil || !resolved.SkipDefaults {
+			// An unresolvable preset is reported later during processing
+			continue
+		}
+		sources = append(sources, skipDefaultsSource{
+			Preset: name,
+			SetBy:  config.skipDefaultsSetter(name, make(map[string]bool)),
+			Origin: origins[name],
+		})
+	}
+	return sources
+}
+
+// skipDefaultsSetter returns the first preset in name's extends chain, name
+// included, that sets skip-defaults, searching bases in application order
+func (c *Config) skipDefaultsSetter(name string, visited map[string]bool) string {
+	preset, ok := c.GetPreset(name)
+	if !ok || visited[name] {
+		return ""
+	}
+	visited[name] = true
+	if preset.SkipDefaults {
+		return name
+	}
+	for _, parents := range [][]string{preset.Extends, preset.SoftExtends} {
+		for _, parent := range parents {
+			if setter := c.skipDefaultsSetter(parent, visited); setter != "" {
+				return setter
+			}
+		}
+	}
+	return ""
+}
+
+// decideSkipDefaults reports whether sources skip the default presets under
+// scope, with a note for each source that was not named with --preset: why it
+// skips the defaults, or, with the explicit scope, that it was ignored
+func decideSkipDefaults(scope string, sources []skipDefaultsSource) (bool, []string) {
+	skip := false
+	var notes []string
+	for _, source := range sources {
+		if source.explicit() {
+			skip = true
+			continue
+		}
+		if scope == skipScopeExplicit {
+			notes = append(notes, fmt.Sprintf(
+				"skip-defaults of %s is ignored, as defaults.skip-defaults-scope is %s", source.describe(), skipScopeExplicit))
+			continue
+		}
+		skip = true
+		notes = append(notes, fmt.Sprintf("default presets are skipped because of skip-defaults in %s", source.describe()))
+	}
+	return skip, notes
+}
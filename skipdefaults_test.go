@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSkipDefaultsSources(t *testing.T) {
+	config := &Config{Presets: map[string]Preset{
+		"bare":     {SkipDefaults: true},
+		"child":    {Extends: []string{"bare"}},
+		"soft":     {SoftExtends: []string{"child"}},
+		"plain":    {},
+		"auto":     {SkipDefaults: true},
+		"autobase": {Extends: []string{"plain", "bare"}},
+	}}
+	origins := map[string]RuleOrigin{"auto": OriginAutoPreset, "autobase": OriginAutoPreset}
+
+	got := skipDefaultsSources(config, []string{"bare", "child", "soft", "plain", "auto", "autobase"}, origins)
+	want := []skipDefaultsSource{
+		{Preset: "bare", SetBy: "bare", Origin: OriginManualPreset},
+		{Preset: "child", SetBy: "bare", Origin: OriginManualPreset},
+		{Preset: "soft", SetBy: "bare", Origin: OriginManualPreset},
+		{Preset: "auto", SetBy: "auto", Origin: OriginAutoPreset},
+		{Preset: "autobase", SetBy: "bare", Origin: OriginAutoPreset},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecideSkipDefaults(t *testing.T) {
+	explicit := skipDefaultsSource{Preset: "bare", SetBy: "bare", Origin: OriginManualPreset}
+	inherited := skipDefaultsSource{Preset: "child", SetBy: "bare", Origin: OriginManualPreset}
+	auto := skipDefaultsSource{Preset: "auto", SetBy: "auto", Origin: OriginAutoPreset}
+
+	tests := []struct {
+		name      string
+		scope     string
+		sources   []skipDefaultsSource
+		wantSkip  bool
+		wantNotes []string
+	}{
+		{name: "no source", scope: skipScopeGlobal},
+		{name: "explicit preset", scope: skipScopeGlobal, sources: []skipDefaultsSource{explicit}, wantSkip: true},
+		{
+			name:      "inherited from a base",
+			scope:     skipScopeGlobal,
+			sources:   []skipDefaultsSource{inherited},
+			wantSkip:  true,
+			wantNotes: []string{"skip-defaults in preset child (inherited from bare)"},
+		},
+		{
+			name:      "auto-detected preset",
+			scope:     skipScopeGlobal,
+			sources:   []skipDefaultsSource{auto},
+			wantSkip:  true,
+			wantNotes: []string{"skip-defaults in auto-detected preset auto"},
+		},
+		{
+			name:      "explicit scope ignores inherited and auto-detected",
+			scope:     skipScopeExplicit,
+			sources:   []skipDefaultsSource{inherited, auto},
+			wantNotes: []string{"preset child (inherited from bare) is ignored", "auto-detected preset auto is ignored"},
+		},
+		{
+			name:     "explicit scope honors explicit preset",
+			scope:    skipScopeExplicit,
+			sources:  []skipDefaultsSource{explicit},
+			wantSkip: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			skip, notes := decideSkipDefaults(tt.scope, tt.sources)
+			if skip != tt.wantSkip {
+				t.Errorf("skip = %v, want %v", skip, tt.wantSkip)
+			}
+			if len(notes) != len(tt.wantNotes) {
+				t.Fatalf("notes = %q, want %d", notes, len(tt.wantNotes))
+			}
+			for i, want := range tt.wantNotes {
+				if !strings.Contains(notes[i], want) {
+					t.Errorf("note %d = %q, want it to contain %q", i, notes[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSkipDefaultsScope(t *testing.T) {
+	if scope, err := skipDefaultsScope(Defaults{}); err != nil || scope != skipScopeGlobal {
+		t.Errorf("expected the global scope by default, got %q, %v", scope, err)
+	}
+	if scope, err := skipDefaultsScope(Defaults{SkipScope: "explicit"}); err != nil || scope != skipScopeExplicit {
+		t.Errorf("expected the explicit scope, got %q, %v", scope, err)
+	}
+	if _, err := skipDefaultsScope(Defaults{SkipScope: "preset"}); err == nil {
+		t.Error("expected an error for an unknown scope")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// connectSocketPaths resolves the --allow-connect paths against workDir. A path
+// that exists must be a Unix socket; a missing one is kept, as the server may
+// create it later, and the platform decides whether it can still be allowed.
+func connectSocketPaths(workDir string, paths []string) ([]string, error) {
+	var sockets []string
+	for _, path := range paths {
+		abs := cleanPathIn(workDir, expandUserPath(path))
+		info, err := os.Stat(abs)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, err
+		case info.Mode()&fs.ModeSocket == 0:
+			return nil, fmt.Errorf("%s is not a Unix socket", abs)
+		}
+		sockets = append(sockets, abs)
+	}
+	return sockets, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestConnectSocketPaths(t *testing.T) {
+	dir := t.TempDir()
+	listener, err := net.Listen("unix", filepath.Join(dir, "s.sock"))
+	if err != nil {
+		t.Skipf("cannot create a Unix socket: %v", err)
+	}
+	defer listener.Close()
+
+	got, err := connectSocketPaths(dir, []string{"s.sock", "later.sock"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{filepath.Join(dir, "s.sock"), filepath.Join(dir, "later.sock")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	file := filepath.Join(dir, "plain")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connectSocketPaths(dir, []string{file}); err == nil || !strings.Contains(err.Error(), "not a Unix socket") {
+		t.Errorf("expected a not-a-socket error, got %v", err)
+	}
+}
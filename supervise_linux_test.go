@@ -0,0 +1,102 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// runTestOnTerminal re-runs the named test in a child test binary that leads a
+// new session with a pseudo-terminal as its controlling terminal and stdio. It
+// types input on the terminal and returns everything the child wrote to it
+func runTestOnTerminal(t *testing.T, name, input string) string {
+	t.Helper()
+	ptmx, term, _ := openPTY(t)
+
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+	cmd.Env = append(os.Environ(), "CAGE_TEST_ON_TERMINAL=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = term, term, term
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start child test: %v", err)
+	}
+	// Reading the master fails once the child's copies of the terminal are closed
+	term.Close()
+
+	var out bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(&out, ptmx)
+		close(copied)
+	}()
+	ptmx.Write([]byte(input))
+
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- cmd.Wait() }()
+	select {
+	case err := <-waitErr:
+		<-copied
+		if err != nil {
+			t.Fatalf("child test failed: %v\n%s", err, out.String())
+		}
+	case <-time.After(30 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("child test still running after 30s")
+	}
+	return out.String()
+}
+
+func TestRunSupervised_ReadsFromTerminal(t *testing.T) {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	if os.Getenv("CAGE_TEST_ON_TERMINAL") == "" {
+		if out := runTestOnTerminal(t, "TestRunSupervised_ReadsFromTerminal", "hello\n"); !strings.Contains(out, "got:hello") {
+			t.Errorf("command did not read from the terminal, output:\n%s", out)
+		}
+		return
+	}
+
+	// Without the terminal the read stops the command with SIGTTIN until the timeout
+	config := &SandboxConfig{Timeout: 10 * time.Second}
+	err = runSupervised(path, []string{"sh", "-c", "read x; echo got:$x"}, config, nil)
+
+	var exitErr *exitCodeError
+	if !errors.As(err, &exitErr) || exitErr.code != 0 {
+		t.Fatalf("expected exit code 0, got %v", err)
+	}
+	if !ownsTerminal(os.Stdin) {
+		t.Error("terminal not handed back to cage after the command exited")
+	}
+}
+
+func TestExecCommand_SuperviseReadsFromTerminal(t *testing.T) {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	if os.Getenv("CAGE_TEST_ON_TERMINAL") == "" {
+		if out := runTestOnTerminal(t, "TestExecCommand_SuperviseReadsFromTerminal", "hello\n"); !strings.Contains(out, "got:hello") {
+			t.Errorf("command did not read from the terminal, output:\n%s", out)
+		}
+		return
+	}
+
+	// cage exec-sync: supervised without a timeout, so a stopped command hangs forever
+	config := &SandboxConfig{Supervise: true}
+	err = execCommand(path, []string{"sh", "-c", "read x; echo got:$x"}, config, nil)
+
+	var exitErr *exitCodeError
+	if !errors.As(err, &exitErr) || exitErr.code != 0 {
+		t.Fatalf("expected exit code 0, got %v", err)
+	}
+}
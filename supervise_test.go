@@ -0,0 +1,34 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{"SIGTERM", syscall.SIGTERM, false},
+		{"TERM", syscall.SIGTERM, false},
+		{"sigint", syscall.SIGINT, false},
+		{"KILL", syscall.SIGKILL, false},
+		{"9", syscall.Signal(9), false},
+		{"SIGBOGUS", 0, true},
+		{"-1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSignal(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSignal(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseSignal(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
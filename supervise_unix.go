@@ -0,0 +1,233 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// execCommand replaces cage with the command, or runs it as a supervised child
+// process when a timeout or supervision is configured; keep lists the descriptors
+// that child is given for --keep-fds
+func execCommand(path string, argv []string, config *SandboxConfig, keep []int) error {
+	if config.WorkingDir != "" {
+		if err := os.Chdir(config.WorkingDir); err != nil {
+			return fmt.Errorf("change to working directory: %w", err)
+		}
+	}
+	if !supervised(config) {
+		if err := applyResourceLimits(config.Limits); err != nil {
+			return fmt.Errorf("resource limits: %w", err)
+		}
+		if err := runPreExec(config); err != nil {
+			return err
+		}
+		if config.RunAs != nil {
+			if err := dropPrivileges(config.RunAs); err != nil {
+				return err
+			}
+		}
+		err := syscall.Exec(path, argv, commandEnv(os.Environ(), config.Env))
+		return fmt.Errorf("syscall.Exec failed: %w", err)
+	}
+	return runSupervised(path, argv, config, keep)
+}
+
+// supervised reports whether cage runs the command as a child process instead
+// of replacing itself with it
+func supervised(config *SandboxConfig) bool {
+	return config.Timeout > 0 || config.Supervise
+}
+
+// keptFDs returns the descriptors --keep-fds passes to a command cage starts as
+// a child process, which only inherits the descriptors it is given, unlike a
+// command cage execs in place. They must be listed before the sandbox applies,
+// as Landlock in strict mode hides /dev/fd
+func keptFDs(config *SandboxConfig, started bool) ([]int, error) {
+	if !config.KeepFDs || !started {
+		return nil, nil
+	}
+	fds, err := inheritableFDs()
+	if err != nil {
+		return nil, fmt.Errorf("list inherited file descriptors: %w", err)
+	}
+	return fds, nil
+}
+
+// runSupervised runs the command in its own process group and terminates the whole
+// group when the timeout (if any) expires: KillSignal first, then SIGKILL after KillGrace
+// The returned exitCodeError carries the command's exit status
+func runSupervised(path string, argv []string, config *SandboxConfig, keep []int) error {
+	// An interactive command needs the terminal, which cage hands back once it exits
+	foreground := ownsTerminal(os.Stdin)
+	cmd, err := startSandboxed(path, argv, config, foreground, keep)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	timedOut := make(chan struct{})
+
+	// Forward termination signals sent to cage to the command's process group
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	go func() {
+		var expired <-chan time.Time
+		if config.Timeout > 0 {
+			timer := time.NewTimer(config.Timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-signals:
+				syscall.Kill(-cmd.Process.Pid, sig.(syscall.Signal))
+			case <-expired:
+				close(timedOut)
+				terminateProcessGroup(cmd.Process.Pid, config.KillSignal, config.KillGrace, done)
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+	if foreground {
+		reclaimTerminal(os.Stdin)
+	}
+
+	select {
+	case <-timedOut:
+		logger.Errorf("command timed out after %s", config.Timeout)
+		return &exitCodeError{code: timeoutExitCode}
+	default:
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return &exitCodeError{code: 128 + int(status.Signal())}
+		}
+		return &exitCodeError{code: exitErr.ExitCode()}
+	}
+	if err != nil {
+		return fmt.Errorf("wait for command: %w", err)
+	}
+	return &exitCodeError{code: 0}
+}
+
+// startSandboxed starts the command as a child process with cage's stdio and the
+// configured environment and credentials, and the descriptors in keep. With
+// foreground set, the command's process group becomes the foreground group of
+// the terminal on stdin
+func startSandboxed(path string, argv []string, config *SandboxConfig, foreground bool, keep []int) (*exec.Cmd, error) {
+	cmd := exec.Command(path)
+	cmd.Args = argv
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = commandEnv(os.Environ(), config.Env)
+	// A separate process group lets us signal the command's own children too
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if foreground {
+		// Otherwise reading from the terminal stops the command with SIGTTIN
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = 0
+	}
+	if config.RunAs != nil {
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid:    config.RunAs.UID,
+			Gid:    config.RunAs.GID,
+			Groups: config.RunAs.Groups,
+		}
+	}
+
+	files, err := extraFiles(keep)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFiles(files)
+	cmd.ExtraFiles = files
+
+	if err := runPreExec(config); err != nil {
+		return nil, err
+	}
+	if err := startWithLimits(cmd, config.Limits); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// runPreExec calls the PreExec hook of an embedding program, if it set one
+func runPreExec(config *SandboxConfig) error {
+	if config.PreExec == nil {
+		return nil
+	}
+	if err := config.PreExec(); err != nil {
+		return fmt.Errorf("pre-exec hook: %w", err)
+	}
+	return nil
+}
+
+// dropPrivileges switches cage to the given groups and user before exec
+// Supplementary groups are set first, and the group before the user, since
+// neither can be changed once root is given up
+func dropPrivileges(creds *Credentials) error {
+	groups := make([]int, len(creds.Groups))
+	for i, group := range creds.Groups {
+		groups[i] = int(group)
+	}
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("set supplementary groups: %w", err)
+	}
+	if err := syscall.Setgid(int(creds.GID)); err != nil {
+		return fmt.Errorf("setgid %d: %w", creds.GID, err)
+	}
+	if err := syscall.Setuid(int(creds.UID)); err != nil {
+		return fmt.Errorf("setuid %d: %w", creds.UID, err)
+	}
+	return nil
+}
+
+// ownsTerminal reports whether f is a terminal with cage's process group in the
+// foreground, so that cage can hand it to the command
+func ownsTerminal(f *os.File) bool {
+	pgrp, err := unix.IoctlGetInt(int(f.Fd()), unix.TIOCGPGRP)
+	return err == nil && pgrp == syscall.Getpgrp()
+}
+
+// reclaimTerminal makes cage's process group the foreground group of the terminal
+// f again. cage is in the background at this point, so SIGTTOU is ignored while
+// it does, or the kernel would stop it
+func reclaimTerminal(f *os.File) {
+	signal.Ignore(syscall.SIGTTOU)
+	defer signal.Reset(syscall.SIGTTOU)
+	unix.IoctlSetPointerInt(int(f.Fd()), unix.TIOCSPGRP, syscall.Getpgrp())
+}
+
+// terminateProcessGroup sends sig to the process group, then SIGKILL if it is
+// still running after the grace period
+func terminateProcessGroup(pgid int, sig syscall.Signal, grace time.Duration, done <-chan struct{}) {
+	if sig == 0 {
+		sig = syscall.SIGTERM
+	}
+	syscall.Kill(-pgid, sig)
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		syscall.Kill(-pgid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,259 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestTerminateProcessGroup_EscalatesToSIGKILL(t *testing.T) {
+	// The child ignores SIGTERM, so only the SIGKILL after the grace period stops it
+	cmd := exec.Command("sh", "-c", `trap "" TERM; echo ready; while :; do sleep 1; done`)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("StdoutPipe failed: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start child: %v", err)
+	}
+	// Wait until the trap is installed
+	buf := make([]byte, 6)
+	if _, err := stdout.Read(buf); err != nil {
+		t.Fatalf("failed to read from child: %v", err)
+	}
+
+	done := make(chan struct{})
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+		close(done)
+	}()
+
+	start := time.Now()
+	terminateProcessGroup(cmd.Process.Pid, syscall.SIGTERM, 200*time.Millisecond, done)
+
+	select {
+	case err := <-waitErr:
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Fatalf("expected child to be killed, got %v", err)
+		}
+		status := exitErr.Sys().(syscall.WaitStatus)
+		if !status.Signaled() || status.Signal() != syscall.SIGKILL {
+			t.Errorf("expected child to die from SIGKILL, got %v", status)
+		}
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("child still running after terminateProcessGroup")
+	}
+
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("SIGKILL sent before the grace period elapsed (%s)", elapsed)
+	}
+}
+
+func TestTerminateProcessGroup_StopsAfterSignal(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start child: %v", err)
+	}
+
+	done := make(chan struct{})
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+		close(done)
+	}()
+
+	terminateProcessGroup(cmd.Process.Pid, syscall.SIGTERM, 10*time.Second, done)
+
+	var exitErr *exec.ExitError
+	if err := <-waitErr; !errors.As(err, &exitErr) {
+		t.Fatalf("expected child to be terminated, got %v", err)
+	}
+	status := exitErr.Sys().(syscall.WaitStatus)
+	if !status.Signaled() || status.Signal() != syscall.SIGTERM {
+		t.Errorf("expected child to die from SIGTERM, got %v", status)
+	}
+}
+
+func TestRunSupervised_Timeout(t *testing.T) {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	config := &SandboxConfig{
+		Timeout:    100 * time.Millisecond,
+		KillSignal: syscall.SIGTERM,
+		KillGrace:  100 * time.Millisecond,
+	}
+
+	// The grandchild must die too, so the process group is killed
+	err = runSupervised(path, []string{"sh", "-c", `trap "" TERM; sleep 30 & wait`}, config, nil)
+
+	var exitErr *exitCodeError
+	if !errors.As(err, &exitErr) || exitErr.code != timeoutExitCode {
+		t.Fatalf("expected timeout exit code %d, got %v", timeoutExitCode, err)
+	}
+}
+
+func TestRunSupervised_ExitCode(t *testing.T) {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	config := &SandboxConfig{Timeout: 10 * time.Second}
+
+	err = runSupervised(path, []string{"sh", "-c", "exit 3"}, config, nil)
+
+	var exitErr *exitCodeError
+	if !errors.As(err, &exitErr) || exitErr.code != 3 {
+		t.Fatalf("expected exit code 3, got %v", err)
+	}
+}
+
+func TestStartInSandbox_ReturnsChild(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	// AllowAll keeps Landlock off the test process on Linux
+	config := &SandboxConfig{
+		AllowAll: true,
+		KeepFDs:  true,
+		Command:  "sh",
+		Args:     []string{"-c", `test "$CAGE_EMBED" = yes && exit 3`},
+		Env:      map[string]string{"CAGE_EMBED": "yes"},
+	}
+
+	cmd, err := StartInSandbox(config)
+	if err != nil {
+		t.Fatalf("StartInSandbox() error = %v", err)
+	}
+	err = cmd.Wait()
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("expected the child to see its environment and exit with 3, got %v", err)
+	}
+}
+
+func TestStartInSandbox_PreExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	ran := false
+	config := &SandboxConfig{
+		AllowAll: true,
+		KeepFDs:  true,
+		Command:  "sh",
+		Args:     []string{"-c", "exit 0"},
+		PreExec: func() error {
+			ran = true
+			return nil
+		},
+	}
+
+	cmd, err := StartInSandbox(config)
+	if err != nil {
+		t.Fatalf("StartInSandbox() error = %v", err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatalf("Wait() error = %v", err)
+	}
+	if !ran {
+		t.Error("expected the pre-exec hook to run")
+	}
+}
+
+func TestPreExecErrorAbortsRun(t *testing.T) {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	marker := filepath.Join(t.TempDir(), "ran")
+	hookErr := errors.New("setrlimit failed")
+	config := &SandboxConfig{
+		AllowAll: true,
+		KeepFDs:  true,
+		Command:  "sh",
+		Args:     []string{"-c", "touch " + marker},
+		PreExec:  func() error { return hookErr },
+	}
+
+	if _, err := StartInSandbox(config); !errors.Is(err, hookErr) {
+		t.Errorf("StartInSandbox() error = %v, want the hook's error", err)
+	}
+	// Without a timeout execCommand would replace the test process; an exit
+	// status other than 0 makes a failed abort visible
+	argv := []string{"sh", "-c", "touch " + marker + "; exit 7"}
+	if err := execCommand(path, argv, config, nil); !errors.Is(err, hookErr) {
+		t.Errorf("execCommand() error = %v, want the hook's error", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the command ran although the pre-exec hook failed")
+	}
+}
+
+func TestRunSupervised_ForwardsSignals(t *testing.T) {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	ready := filepath.Join(t.TempDir(), "ready")
+	config := &SandboxConfig{Supervise: true}
+
+	result := make(chan error, 1)
+	go func() {
+		script := `trap "exit 7" TERM; touch "$0"; while :; do sleep 0.1; done`
+		result <- runSupervised(path, []string{"sh", "-c", script, ready}, config, nil)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(ready); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("child did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// SIGTERM sent to cage reaches the child, whose exit status is propagated
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-result:
+		var exitErr *exitCodeError
+		if !errors.As(err, &exitErr) || exitErr.code != 7 {
+			t.Fatalf("expected exit code 7 from the trap, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("supervised child did not exit after SIGTERM")
+	}
+}
+
+func TestRunSupervised_NoTimeoutExitCode(t *testing.T) {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	config := &SandboxConfig{Supervise: true}
+
+	// Without a timeout the command must run to completion, not be killed at once
+	err = runSupervised(path, []string{"sh", "-c", "sleep 0.2; exit 5"}, config, nil)
+
+	var exitErr *exitCodeError
+	if !errors.As(err, &exitErr) || exitErr.code != 5 {
+		t.Fatalf("expected exit code 5, got %v", err)
+	}
+}
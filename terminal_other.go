@@ -0,0 +1,8 @@
+//go:build !darwin && !linux
+
+package main
+
+// terminalDevices returns no devices, as there is no sandbox to keep them open in
+func terminalDevices() []string {
+	return nil
+}
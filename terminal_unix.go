@@ -0,0 +1,62 @@
+//go:build darwin || linux
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// terminalDevicePatterns match the device nodes a terminal on stdio can be: pseudo
+// terminals on Linux and macOS, virtual consoles and serial lines
+var terminalDevicePatterns = []string{
+	"/dev/pts/*",
+	"/dev/ttys*",
+	"/dev/tty[0-9]*",
+	"/dev/ttyS*",
+	"/dev/ttyUSB*",
+	"/dev/console",
+}
+
+// terminalDevices returns /dev/tty and the device nodes of the terminals on
+// cage's stdin, stdout and stderr, found by their device number, and with a
+// terminal attached /dev/ptmx; the rest of /dev/pts needs --allow-pty
+func terminalDevices() []string {
+	devices := []string{"/dev/tty"}
+	seen := map[string]bool{"/dev/tty": true}
+	attached := false
+	for _, f := range []*os.File{os.Stdin, os.Stdout, os.Stderr} {
+		if !isTerminal(f) {
+			continue
+		}
+		attached = true
+		var st unix.Stat_t
+		if err := unix.Fstat(int(f.Fd()), &st); err != nil {
+			continue
+		}
+		if path := deviceByNumber(st); path != "" && !seen[path] {
+			seen[path] = true
+			devices = append(devices, path)
+		}
+	}
+	if attached {
+		devices = append(devices, "/dev/ptmx")
+	}
+	return devices
+}
+
+// deviceByNumber returns the terminal device node with the device number of term
+func deviceByNumber(term unix.Stat_t) string {
+	for _, pattern := range terminalDevicePatterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			var st unix.Stat_t
+			if unix.Stat(path, &st) == nil && st.Rdev == term.Rdev {
+				return path
+			}
+		}
+	}
+	return ""
+}
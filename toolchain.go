@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+)
+
+// errNoHome is returned by toolchain helpers whose defaults live in the home directory
+var errNoHome = errors.New("home directory is unknown")
+
+// toolchainEnv is what a toolchain helper resolves its paths from
+type toolchainEnv struct {
+	goos   string
+	home   string
+	getenv func(string) string
+}
+
+// cacheDir returns the platform's per-user cache directory for name:
+// ~/Library/Caches on macOS, $XDG_CACHE_HOME or ~/.cache elsewhere
+func (e toolchainEnv) cacheDir(name string) string {
+	if e.goos == "darwin" {
+		return filepath.Join(e.home, "Library", "Caches", name)
+	}
+	if xdg := e.getenv("XDG_CACHE_HOME"); filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, name)
+	}
+	return filepath.Join(e.home, ".cache", name)
+}
+
+// envOr returns the environment variable name, or fallback if it is unset
+func (e toolchainEnv) envOr(name, fallback string) string {
+	if value := e.getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// toolchainPaths are the paths a toolchain helper grants, by access mode
+type toolchainPaths struct {
+	Allow []string
+	Read  []string
+}
+
+// toolchainHelper is an --allow-<name> flag that grants a toolchain's
+// well-known cache and config locations
+type toolchainHelper struct {
+	name    string
+	resolve func(env toolchainEnv) (toolchainPaths, error)
+}
+
+// toolchainHelpers lists the toolchain helpers in the order their rules are added
+var toolchainHelpers = []toolchainHelper{
+	{"go", goToolchainRules},
+	{"node", nodeToolchainRules},
+	{"python", pythonToolchainRules},
+	{"rust", rustToolchainRules},
+}
+
+// goToolchainRules grants the build cache and module cache reported by go env
+func goToolchainRules(toolchainEnv) (toolchainPaths, error) {
+	paths, err := goToolchainPaths()
+	return toolchainPaths{Allow: paths}, err
+}
+
+// nodeToolchainRules grants the npm cache, npm's global prefix when set, and
+// node-gyp's header cache
+func nodeToolchainRules(env toolchainEnv) (toolchainPaths, error) {
+	if env.home == "" {
+		return toolchainPaths{}, errNoHome
+	}
+	paths := toolchainPaths{
+		Allow: []string{
+			env.envOr("npm_config_cache", filepath.Join(env.home, ".npm")),
+			env.cacheDir("node-gyp"),
+		},
+	}
+	if prefix := env.getenv("npm_config_prefix"); prefix != "" {
+		paths.Allow = append(paths.Allow, prefix)
+	}
+	return paths, nil
+}
+
+// pythonToolchainRules grants pip's cache and the active virtualenv
+func pythonToolchainRules(env toolchainEnv) (toolchainPaths, error) {
+	if env.home == "" {
+		return toolchainPaths{}, errNoHome
+	}
+	paths := toolchainPaths{
+		Allow: []string{env.envOr("PIP_CACHE_DIR", env.cacheDir("pip"))},
+	}
+	if venv := env.getenv("VIRTUAL_ENV"); venv != "" {
+		paths.Allow = append(paths.Allow, venv)
+	}
+	return paths, nil
+}
+
+// rustToolchainRules grants $CARGO_HOME (registry, git checkouts and installed
+// binaries) and $CARGO_TARGET_DIR when set; rustup's toolchains are read-only
+func rustToolchainRules(env toolchainEnv) (toolchainPaths, error) {
+	if env.home == "" {
+		return toolchainPaths{}, errNoHome
+	}
+	paths := toolchainPaths{
+		Allow: []string{env.envOr("CARGO_HOME", filepath.Join(env.home, ".cargo"))},
+		Read:  []string{env.envOr("RUSTUP_HOME", filepath.Join(env.home, ".rustup"))},
+	}
+	if target := env.getenv("CARGO_TARGET_DIR"); target != "" {
+		paths.Allow = append(paths.Allow, target)
+	}
+	return paths, nil
+}
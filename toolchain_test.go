@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// mockEnv returns a getenv that reads from vars
+func mockEnv(vars map[string]string) func(string) string {
+	return func(name string) string { return vars[name] }
+}
+
+func TestNodeToolchainRules(t *testing.T) {
+	tests := []struct {
+		name string
+		goos string
+		vars map[string]string
+		want toolchainPaths
+	}{
+		{
+			name: "defaults on linux",
+			goos: "linux",
+			want: toolchainPaths{Allow: []string{"/home/me/.npm", "/home/me/.cache/node-gyp"}},
+		},
+		{
+			name: "defaults on darwin",
+			goos: "darwin",
+			want: toolchainPaths{Allow: []string{"/home/me/.npm", "/home/me/Library/Caches/node-gyp"}},
+		},
+		{
+			name: "cache and prefix from env",
+			goos: "linux",
+			vars: map[string]string{
+				"npm_config_cache":  "/cache/npm",
+				"npm_config_prefix": "/opt/npm-global",
+				"XDG_CACHE_HOME":    "/xdg",
+			},
+			want: toolchainPaths{Allow: []string{"/cache/npm", "/xdg/node-gyp", "/opt/npm-global"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nodeToolchainRules(toolchainEnv{goos: tt.goos, home: "/home/me", getenv: mockEnv(tt.vars)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPythonToolchainRules(t *testing.T) {
+	tests := []struct {
+		name string
+		goos string
+		vars map[string]string
+		want toolchainPaths
+	}{
+		{
+			name: "defaults on linux",
+			goos: "linux",
+			want: toolchainPaths{Allow: []string{"/home/me/.cache/pip"}},
+		},
+		{
+			name: "defaults on darwin",
+			goos: "darwin",
+			want: toolchainPaths{Allow: []string{"/home/me/Library/Caches/pip"}},
+		},
+		{
+			name: "pip cache and virtualenv from env",
+			goos: "linux",
+			vars: map[string]string{"PIP_CACHE_DIR": "/cache/pip", "VIRTUAL_ENV": "/work/.venv"},
+			want: toolchainPaths{Allow: []string{"/cache/pip", "/work/.venv"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pythonToolchainRules(toolchainEnv{goos: tt.goos, home: "/home/me", getenv: mockEnv(tt.vars)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRustToolchainRules(t *testing.T) {
+	tests := []struct {
+		name string
+		vars map[string]string
+		want toolchainPaths
+	}{
+		{
+			name: "defaults",
+			want: toolchainPaths{
+				Allow: []string{"/home/me/.cargo"},
+				Read:  []string{"/home/me/.rustup"},
+			},
+		},
+		{
+			name: "homes and target dir from env",
+			vars: map[string]string{
+				"CARGO_HOME":       "/opt/cargo",
+				"RUSTUP_HOME":      "/opt/rustup",
+				"CARGO_TARGET_DIR": "/build/target",
+			},
+			want: toolchainPaths{
+				Allow: []string{"/opt/cargo", "/build/target"},
+				Read:  []string{"/opt/rustup"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rustToolchainRules(toolchainEnv{goos: "linux", home: "/home/me", getenv: mockEnv(tt.vars)})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToolchainRulesWithoutHome(t *testing.T) {
+	env := toolchainEnv{goos: "linux", getenv: mockEnv(nil)}
+	for _, helper := range toolchainHelpers {
+		if helper.name == "go" {
+			continue
+		}
+		if _, err := helper.resolve(env); err != errNoHome {
+			t.Errorf("--allow-%s without a home directory: expected errNoHome, got %v", helper.name, err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// traceDenySyscalls is the strace syscall filter for --trace-deny: every
+// syscall that takes a file name, which covers what Landlock can deny
+const traceDenySyscalls = "trace=%file"
+
+// deniedPath is a path the traced command was refused access to
+type deniedPath struct {
+	Path     string
+	Syscalls []string // distinct syscalls that failed, sorted
+	Count    int      // number of failed calls
+}
+
+// traceDenyArgs returns the arguments for the cage run that --trace-deny traces:
+// exec-sync if it was given, cage's own flags without --trace-deny, then the command
+func traceDenyArgs(flagArgs, command []string, execSync bool) []string {
+	var argv []string
+	if execSync {
+		argv = append(argv, "exec-sync")
+	}
+	for _, arg := range flagArgs {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && name == "trace-deny" {
+			continue
+		}
+		argv = append(argv, arg)
+	}
+	argv = append(argv, "--")
+	return append(argv, command...)
+}
+
+// runTraceDeny implements --trace-deny: it runs cage again without the flag
+// under `strace -f`, waits for it, and reports the paths whose syscalls failed
+// with EACCES or EPERM. It returns the command's exit status.
+func runTraceDeny(command []string, execSync bool) (int, error) {
+	stracePath, err := exec.LookPath("strace")
+	if err != nil {
+		return 0, fmt.Errorf("strace is required: %w", err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("find cage executable: %w", err)
+	}
+
+	traceFile, err := os.CreateTemp("", "cage-trace-*.log")
+	if err != nil {
+		return 0, fmt.Errorf("create trace file: %w", err)
+	}
+	tracePath := traceFile.Name()
+	traceFile.Close()
+	defer os.Remove(tracePath)
+
+	flagArgs := os.Args[1 : len(os.Args)-len(command)]
+	if n := len(flagArgs); n > 0 && flagArgs[n-1] == "--" {
+		flagArgs = flagArgs[:n-1]
+	}
+	argv := append([]string{"-f", "-qq", "-y", "-s", "4096", "-e", traceDenySyscalls, "-o", tracePath, "--", exe},
+		traceDenyArgs(flagArgs, command, execSync)...)
+
+	cmd := exec.Command(stracePath, argv...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	code := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return 0, fmt.Errorf("run strace: %w", err)
+		}
+		code = exitErr.ExitCode()
+	}
+
+	trace, err := os.Open(tracePath)
+	if err != nil {
+		return code, fmt.Errorf("read trace: %w", err)
+	}
+	defer trace.Close()
+	cwd, err := os.Getwd()
+	if err != nil {
+		return code, fmt.Errorf("get working directory: %w", err)
+	}
+	denied, err := parseStraceDenials(trace, exe, cwd)
+	if err != nil {
+		return code, fmt.Errorf("read trace: %w", err)
+	}
+	printDeniedPaths(os.Stderr, denied)
+	return code, nil
+}
+
+// parseStraceDenials collects the paths of the syscalls in `strace -f -y` output
+// that failed with EACCES or EPERM, with relative paths resolved against cwd.
+// Lines before the command is executed belong to cage itself (exe) and are skipped.
+func parseStraceDenials(r io.Reader, exe, cwd string) ([]deniedPath, error) {
+	byPath := make(map[string]*deniedPath)
+	// pending holds calls that another process interrupted, by pid
+	pending := make(map[string]string)
+	started := false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		pid, line := splitStracePid(scanner.Text())
+		if call, ok := strings.CutSuffix(line, " <unfinished ...>"); ok {
+			pending[pid] = call
+			continue
+		}
+		if strings.HasPrefix(line, "<... ") {
+			_, rest, ok := strings.Cut(line, " resumed>")
+			call, found := pending[pid]
+			if !ok || !found {
+				continue
+			}
+			delete(pending, pid)
+			line = call + rest
+		}
+
+		for _, access := range parseStraceLine(line, cwd) {
+			if access.Call == "execve" && access.Errno == "" && access.Path != exe {
+				started = true
+				continue
+			}
+			if !started || (access.Errno != "EACCES" && access.Errno != "EPERM") {
+				continue
+			}
+
+			entry := byPath[access.Path]
+			if entry == nil {
+				entry = &deniedPath{Path: access.Path}
+				byPath[access.Path] = entry
+			}
+			entry.Count++
+			if !slices.Contains(entry.Syscalls, access.Call) {
+				entry.Syscalls = append(entry.Syscalls, access.Call)
+				slices.Sort(entry.Syscalls)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	denied := make([]deniedPath, 0, len(byPath))
+	for _, entry := range byPath {
+		denied = append(denied, *entry)
+	}
+	sort.Slice(denied, func(i, j int) bool { return denied[i].Path < denied[j].Path })
+	return denied, nil
+}
+
+// printDeniedPaths writes the --trace-deny report
+func printDeniedPaths(w io.Writer, denied []deniedPath) {
+	if len(denied) == 0 {
+		fmt.Fprintln(w, "cage: --trace-deny: no denied paths")
+		return
+	}
+	noun := "paths"
+	if len(denied) == 1 {
+		noun = "path"
+	}
+	fmt.Fprintf(w, "cage: --trace-deny: %d denied %s:\n", len(denied), noun)
+	for _, entry := range denied {
+		fmt.Fprintf(w, "  %s (%s", entry.Path, strings.Join(entry.Syscalls, ", "))
+		if entry.Count > 1 {
+			fmt.Fprintf(w, ", %d times", entry.Count)
+		}
+		fmt.Fprintln(w, ")")
+	}
+}
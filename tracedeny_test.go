@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTraceDenyArgs(t *testing.T) {
+	got := traceDenyArgs([]string{"--strict", "--trace-deny", "-trace-deny=true", "--allow", "."}, []string{"make", "test"}, false)
+	want := []string{"--strict", "--allow", ".", "--", "make", "test"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("traceDenyArgs() = %v, want %v", got, want)
+	}
+
+	got = traceDenyArgs([]string{"--trace-deny"}, []string{"make"}, true)
+	want = []string{"exec-sync", "--", "make"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("traceDenyArgs() with exec-sync = %v, want %v", got, want)
+	}
+}
+
+func TestParseStraceDenials(t *testing.T) {
+	trace := `100 execve("/usr/local/bin/cage", ["cage", "--", "make"], 0x7ffd /* 20 vars */) = 0
+100 openat(AT_FDCWD, "/etc/cage-only", O_RDONLY) = -1 EACCES (Permission denied)
+100 execve("/usr/bin/make", ["make"], 0x7ffd /* 20 vars */) = 0
+100 openat(AT_FDCWD, "/etc/ld.so.cache", O_RDONLY|O_CLOEXEC) = 3
+100 openat(AT_FDCWD, "/root/.ssh/id_ed25519", O_RDONLY) = -1 EACCES (Permission denied)
+101 mkdir("/work/build", 0777 <unfinished ...>
+100 openat(AT_FDCWD, "/root/.ssh/id_ed25519", O_RDONLY) = -1 EACCES (Permission denied)
+101 <... mkdir resumed>) = -1 EACCES (Permission denied)
+101 unlink("/work/with \"quote\"") = -1 EPERM (Operation not permitted)
+101 stat("/work/build", 0x7ffd) = -1 EACCES (Permission denied)
+101 openat(3</work/build>, "out.o", O_WRONLY|O_CREAT, 0666) = -1 EACCES (Permission denied)
+101 openat(AT_FDCWD, "/missing", O_RDONLY) = -1 ENOENT (No such file or directory)
+101 +++ exited with 0 +++
+`
+	denied, err := parseStraceDenials(strings.NewReader(trace), "/usr/local/bin/cage", "/work")
+	if err != nil {
+		t.Fatalf("parseStraceDenials() error = %v", err)
+	}
+	want := []deniedPath{
+		{Path: "/root/.ssh/id_ed25519", Syscalls: []string{"openat"}, Count: 2},
+		{Path: "/work/build", Syscalls: []string{"mkdir"}, Count: 1},
+		{Path: "/work/build/out.o", Syscalls: []string{"openat"}, Count: 1},
+		{Path: `/work/with "quote"`, Syscalls: []string{"unlink"}, Count: 1},
+	}
+	if !reflect.DeepEqual(denied, want) {
+		t.Errorf("parseStraceDenials() = %+v, want %+v", denied, want)
+	}
+
+	var out bytes.Buffer
+	printDeniedPaths(&out, denied)
+	if !strings.Contains(out.String(), "  /root/.ssh/id_ed25519 (openat, 2 times)\n") {
+		t.Errorf("unexpected report:\n%s", out.String())
+	}
+}
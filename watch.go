@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// watchInterval is how often --watch checks the watched files for changes
+	watchInterval = 500 * time.Millisecond
+	// watchDebounce is how long the watched files must stay unchanged before
+	// cage runs again, so an editor's save in several writes triggers one run
+	watchDebounce = 300 * time.Millisecond
+)
+
+// fileSnapshot maps each watched file to its modification time and size
+type fileSnapshot map[string]string
+
+// snapshotFiles records the config file and the preset files in presetDir
+// Missing files are left out, so creating or deleting one is a change
+func snapshotFiles(configPath, presetDir string) fileSnapshot {
+	snapshot := make(fileSnapshot)
+	add := func(path string) {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			snapshot[path] = fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	if configPath != "" {
+		add(configPath)
+	}
+	if presetDir != "" {
+		entries, _ := os.ReadDir(presetDir)
+		for _, entry := range entries {
+			if ext := filepath.Ext(entry.Name()); ext == ".yaml" || ext == ".yml" {
+				add(filepath.Join(presetDir, entry.Name()))
+			}
+		}
+	}
+	return snapshot
+}
+
+// watchArgs returns the arguments for each run started by --watch: cage's own
+// flags without --watch and --rerun, plus --dry-run unless rerun is set, then
+// the command
+func watchArgs(flagArgs, command []string, rerun bool) []string {
+	var argv []string
+	dryRun := false
+	for _, arg := range flagArgs {
+		name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if strings.HasPrefix(arg, "-") && (name == "watch" || name == "rerun") {
+			continue
+		}
+		if strings.HasPrefix(arg, "-") && name == "dry-run" {
+			dryRun = true
+		}
+		argv = append(argv, arg)
+	}
+	if !rerun && !dryRun {
+		argv = append(argv, "--dry-run")
+	}
+	if len(command) > 0 {
+		argv = append(argv, "--")
+		argv = append(argv, command...)
+	}
+	return argv
+}
+
+// runWatch implements --watch: it runs cage again without --watch, as a dry-run
+// or with --rerun as the sandboxed command, each time the config file or a file
+// in the preset directory changes. It is a development aid for writing presets
+// and returns when cage is interrupted.
+func runWatch(f *flags, command []string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("find cage executable: %w", err)
+	}
+	configPath, _ := configFilePath(f.configPath)
+	presetDir := f.presetDir
+	if presetDir == "" {
+		presetDir, _ = defaultPresetDir()
+	}
+	flagArgs := os.Args[1 : len(os.Args)-len(command)]
+	if n := len(flagArgs); n > 0 && flagArgs[n-1] == "--" {
+		flagArgs = flagArgs[:n-1]
+	}
+	argv := watchArgs(flagArgs, command, f.rerun)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var cmd *exec.Cmd
+	var done chan error
+	start := func() {
+		logger.Infof("watch: running at %s", time.Now().Format(time.TimeOnly))
+		cmd = exec.Command(exe, argv...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Start(); err != nil {
+			logger.Errorf("watch: %v", err)
+			cmd = nil
+			return
+		}
+		done = make(chan error, 1)
+		go func(cmd *exec.Cmd, done chan error) { done <- cmd.Wait() }(cmd, done)
+	}
+	stop := func() {
+		if cmd == nil {
+			return
+		}
+		cmd.Process.Signal(syscall.SIGTERM)
+		<-done
+		cmd, done = nil, nil
+	}
+
+	logger.Infof("watching %s and %s for changes (interrupt to stop)", configPath, presetDir)
+	last := snapshotFiles(configPath, presetDir)
+	var changedAt time.Time
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	start()
+	for {
+		select {
+		case <-signals:
+			stop()
+			return nil
+		case err := <-done:
+			if err != nil {
+				logger.Infof("watch: run finished: %v", err)
+			}
+			cmd, done = nil, nil
+		case now := <-ticker.C:
+			if snapshot := snapshotFiles(configPath, presetDir); !maps.Equal(snapshot, last) {
+				last, changedAt = snapshot, now
+				continue
+			}
+			if !changedAt.IsZero() && now.Sub(changedAt) >= watchDebounce {
+				changedAt = time.Time{}
+				stop()
+				start()
+			}
+		}
+	}
+}
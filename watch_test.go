@@ -0,0 +1,86 @@
+package main
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWatchArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		flagArgs []string
+		command  []string
+		rerun    bool
+		expected []string
+	}{
+		{
+			name:     "watch becomes a dry-run",
+			flagArgs: []string{"--watch", "--preset", "dev"},
+			command:  []string{"make"},
+			expected: []string{"--preset", "dev", "--dry-run", "--", "make"},
+		},
+		{
+			name:     "rerun runs the command",
+			flagArgs: []string{"-watch", "--rerun=true", "--allow", "."},
+			command:  []string{"go", "test"},
+			rerun:    true,
+			expected: []string{"--allow", ".", "--", "go", "test"},
+		},
+		{
+			name:     "existing dry-run is kept once",
+			flagArgs: []string{"--dry-run", "--watch"},
+			command:  []string{"ls"},
+			expected: []string{"--dry-run", "--", "ls"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := watchArgs(tt.flagArgs, tt.command, tt.rerun); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("watchArgs() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSnapshotFilesDetectsChanges(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "presets.yaml")
+	presetDir := filepath.Join(dir, "presets.d")
+	if err := os.Mkdir(presetDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(configPath, []byte("presets: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(presetDir, "notes.txt"), []byte("ignored"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	before := snapshotFiles(configPath, presetDir)
+	if len(before) != 1 {
+		t.Fatalf("expected only the config file to be watched, got %v", before)
+	}
+
+	// A new preset file is a change
+	if err := os.WriteFile(filepath.Join(presetDir, "dev.yaml"), []byte("allow: [.]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	added := snapshotFiles(configPath, presetDir)
+	if maps.Equal(before, added) {
+		t.Error("adding a preset file should change the snapshot")
+	}
+
+	// So is editing the config file
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(configPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if maps.Equal(added, snapshotFiles(configPath, presetDir)) {
+		t.Error("modifying the config file should change the snapshot")
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// whichQuery reports whether the command line is a `cage [flags] which <path>...`
+// query and returns its paths. osArgs are cage's arguments and args the ones left
+// after flag parsing; `cage -- which` runs the which command instead.
+func whichQuery(osArgs, args []string) ([]string, bool) {
+	if len(args) == 0 || args[0] != "which" {
+		return nil, false
+	}
+	if i := len(osArgs) - len(args) - 1; i >= 0 && osArgs[i] == "--" {
+		return nil, false
+	}
+	return args[1:], true
+}
+
+// accessDecision is the effective access to a path for one operation and the
+// rule that decides it (nil when the default applies)
+type accessDecision struct {
+	Allowed bool
+	Rule    *ResolvedRule
+	Except  string // the except entry of Rule that restores read access
+	Note    string // why the default or a platform limitation applies
+}
+
+// ruleMatches reports whether rule applies to path: the path itself or, unless
+// the rule is for a single file, anything below it. Glob rules match each
+// element like filepath.Match, as Landlock expands them.
+func ruleMatches(rule ResolvedRule, path string) bool {
+	if !rule.IsGlob {
+		if rule.IsFile {
+			return rule.Path == path
+		}
+		return rule.Path == path || pathContains(rule.Path, path)
+	}
+	for candidate := path; ; candidate = filepath.Dir(candidate) {
+		if ok, _ := filepath.Match(rule.Path, candidate); ok {
+			return !rule.IsFile || candidate == path
+		}
+		if parent := filepath.Dir(candidate); parent == candidate {
+			return false
+		}
+	}
+}
+
+// decidingRule returns the most specific rule among rules that matches path
+// On equal paths a deny wins on Linux, where it overrides an exact allow, and
+// an allow wins on macOS, where allows are emitted after denies
+func decidingRule(rules []ResolvedRule, path, goos string) *ResolvedRule {
+	var best *ResolvedRule
+	for i := range rules {
+		rule := &rules[i]
+		if !ruleMatches(*rule, path) {
+			continue
+		}
+		switch {
+		case best == nil, len(rule.Path) > len(best.Path):
+			best = rule
+		case len(rule.Path) == len(best.Path) && rule.Action != best.Action:
+			if (rule.Action == ActionDeny) == (goos == "linux") {
+				best = rule
+			}
+		}
+	}
+	return best
+}
+
+// explainWrite decides write access to path: writes are denied unless an allow
+// is the most specific matching write rule
+func explainWrite(path string, writeRules []ResolvedRule, goos string) accessDecision {
+	var candidates []ResolvedRule
+	for _, rule := range writeRules {
+		if rule.Mode&AccessWrite != 0 {
+			candidates = append(candidates, rule)
+		}
+	}
+	rule := decidingRule(candidates, path, goos)
+	if rule == nil {
+		return accessDecision{Note: "no write allow covers it"}
+	}
+	return accessDecision{Allowed: rule.Action == ActionAllow, Rule: rule}
+}
+
+// explainRead decides read access to path: allowed by default unless strict,
+// where read and write allows grant it; read+write denies remove it, and their
+// except entries restore it
+func explainRead(path string, writeRules, readRules []ResolvedRule, strict bool, goos string) accessDecision {
+	var candidates []ResolvedRule
+	for _, rule := range writeRules {
+		if (rule.Action == ActionDeny && rule.Mode&AccessRead != 0) || (rule.Action == ActionAllow && strict) {
+			candidates = append(candidates, rule)
+		}
+	}
+	if strict {
+		candidates = append(candidates, readRules...)
+	}
+
+	rule := decidingRule(candidates, path, goos)
+	if rule == nil {
+		if strict {
+			return accessDecision{Note: "strict mode allows only listed read paths"}
+		}
+		return accessDecision{Allowed: true, Note: "reads are allowed outside strict mode"}
+	}
+	if rule.Action == ActionAllow {
+		return accessDecision{Allowed: true, Rule: rule}
+	}
+	for _, exc := range rule.Except {
+		if exc == path || pathContains(exc, path) {
+			return accessDecision{Allowed: true, Rule: rule, Except: exc}
+		}
+	}
+	if goos == "linux" && !strict {
+		return accessDecision{Allowed: true, Rule: rule, Note: "read denies are only enforced with --strict on Linux"}
+	}
+	return accessDecision{Rule: rule}
+}
+
+// formatDecision describes an access decision on one line
+func formatDecision(d accessDecision) string {
+	verdict := "denied"
+	if d.Allowed {
+		verdict = "allowed"
+	}
+	if d.Rule == nil {
+		return fmt.Sprintf("%s (%s)", verdict, d.Note)
+	}
+	action := "allow"
+	if d.Rule.Action == ActionDeny {
+		action = "deny"
+	}
+	by := "by "
+	if d.Except != "" {
+		by = "by except " + d.Except + " of "
+	} else if d.Allowed && d.Rule.Action == ActionDeny {
+		by = "despite "
+	}
+	line := fmt.Sprintf("%s %s%s %s (%s) from %s", verdict, by, action, formatRulePath(*d.Rule), d.Rule.Mode, formatRuleSource(*d.Rule))
+	if d.Note != "" {
+		line += " (" + d.Note + ")"
+	}
+	return line
+}
+
+// printWhich prints the effective read and write access to each path
+func printWhich(w io.Writer, paths []string, writeRules, readRules []ResolvedRule, strict bool, goos string) {
+	for i, path := range paths {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		absPath := cleanPath(expandUserPath(path))
+		fmt.Fprintln(w, absPath)
+		fmt.Fprintf(w, "  read:  %s\n", formatDecision(explainRead(absPath, writeRules, readRules, strict, goos)))
+		fmt.Fprintf(w, "  write: %s\n", formatDecision(explainWrite(absPath, writeRules, goos)))
+	}
+}
+
+// printWhichAndExit answers `cage which` and exits
+func printWhichAndExit(paths []string, writeRules, readRules []ResolvedRule, strict bool, goos string) {
+	if len(paths) == 0 {
+		logger.Errorf("usage: cage [flags] which <path>...")
+		os.Exit(1)
+	}
+	printWhich(os.Stdout, paths, writeRules, readRules, strict, goos)
+	os.Exit(0)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWhichQuery(t *testing.T) {
+	tests := []struct {
+		name      string
+		osArgs    []string
+		args      []string
+		wantPaths []string
+		wantOK    bool
+	}{
+		{"query", []string{"--preset", "dev", "which", "/a", "/b"}, []string{"which", "/a", "/b"}, []string{"/a", "/b"}, true},
+		{"no paths", []string{"which"}, []string{"which"}, []string{}, true},
+		{"which command after --", []string{"--", "which", "ls"}, []string{"which", "ls"}, nil, false},
+		{"other command", []string{"ls", "which"}, []string{"ls", "which"}, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, ok := whichQuery(tt.osArgs, tt.args)
+			if ok != tt.wantOK || !reflect.DeepEqual(paths, tt.wantPaths) {
+				t.Errorf("whichQuery() = %v, %v, want %v, %v", paths, ok, tt.wantPaths, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestExplainAccess(t *testing.T) {
+	preset := RuleSource{PresetName: "secure"}
+	resolver := NewRuleResolver()
+	resolver.AddDenyRule("/home/me", []string{"/home/me/.gitconfig"}, preset)
+	resolver.AddAllowRule("/home/me/project", RuleSource{Origin: OriginCLI})
+	resolver.AddReadRule("/usr", preset)
+	writeRules, readRules, _ := resolver.Resolve()
+
+	tests := []struct {
+		path      string
+		strict    bool
+		goos      string
+		wantRead  bool
+		wantWrite bool
+		wantRule  string // deciding read rule path, "" for the default
+	}{
+		{"/home/me/project/main.go", true, "darwin", true, true, "/home/me/project"},
+		{"/home/me/.ssh/config", true, "darwin", false, false, "/home/me"},
+		{"/home/me/.ssh/config", false, "darwin", false, false, "/home/me"},
+		{"/home/me/.ssh/config", false, "linux", true, false, "/home/me"},
+		{"/home/me/.gitconfig", true, "darwin", true, false, "/home/me"},
+		{"/usr/bin/ls", true, "linux", true, false, "/usr"},
+		{"/etc/passwd", true, "linux", false, false, ""},
+		{"/etc/passwd", false, "linux", true, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			read := explainRead(tt.path, writeRules, readRules, tt.strict, tt.goos)
+			write := explainWrite(tt.path, writeRules, tt.goos)
+			if read.Allowed != tt.wantRead || write.Allowed != tt.wantWrite {
+				t.Errorf("strict=%v %s: read=%v write=%v, want read=%v write=%v",
+					tt.strict, tt.goos, read.Allowed, write.Allowed, tt.wantRead, tt.wantWrite)
+			}
+			gotRule := ""
+			if read.Rule != nil {
+				gotRule = read.Rule.Path
+			}
+			if gotRule != tt.wantRule {
+				t.Errorf("read decided by %q, want %q", gotRule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestExplainWriteExactDenyByPlatform(t *testing.T) {
+	rules := []ResolvedRule{
+		{Path: "/work", Mode: AccessWrite, Action: ActionAllow},
+		{Path: "/work", Mode: AccessWrite, Action: ActionDeny},
+	}
+	if explainWrite("/work/x", rules, "linux").Allowed {
+		t.Error("on Linux an exact write deny overrides the allow")
+	}
+	if !explainWrite("/work/x", rules, "darwin").Allowed {
+		t.Error("on macOS the allow, emitted after the deny, wins")
+	}
+}
+
+func TestPrintWhich(t *testing.T) {
+	rules := []ResolvedRule{{Path: "/work/*/out", Mode: AccessWrite, Action: ActionAllow, IsGlob: true, Source: RuleSource{Origin: OriginCLI}}}
+
+	var buf strings.Builder
+	printWhich(&buf, []string{"/work/a/out/bin", "/work/a/src"}, rules, nil, false, "linux")
+	output := buf.String()
+
+	if !strings.Contains(output, "/work/a/out/bin\n  read:  allowed (reads are allowed outside strict mode)\n  write: allowed by allow /work/*/out (write) from CLI flag\n") {
+		t.Errorf("unexpected output for a path matched by a glob allow:\n%s", output)
+	}
+	if !strings.Contains(output, "/work/a/src\n  read:  allowed (reads are allowed outside strict mode)\n  write: denied (no write allow covers it)\n") {
+		t.Errorf("unexpected output for a path outside any allow:\n%s", output)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build darwin || linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// userWritable reports whether the current user may write to path, by the same
+// permission check the kernel applies on open (file modes, ACLs, read-only mounts)
+func userWritable(path string) bool {
+	return unix.Access(path, unix.W_OK) == nil
+}